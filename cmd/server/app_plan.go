@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+
+	"istio.io/istio/pkg/log"
+)
+
+// defaultMaxAppPlans bounds the number of applications whose plan is remembered when the plan label is enabled
+const defaultMaxAppPlans = 10000
+
+// appPlanCache remembers the application plan of each application seen by 3scale backend when metrics_plan_label is set
+var appPlanCache *appPlans
+
+// authorizationEndpoints are the endpoints of 3scale backend whose responses include the plan of the application
+var authorizationEndpoints = map[string]bool{
+	"authorize.xml":       true,
+	"authrep.xml":         true,
+	"oauth_authorize.xml": true,
+	"oauth_authrep.xml":   true,
+}
+
+type appPlanKey struct {
+	serviceID string
+	app       string
+}
+
+type appPlan struct {
+	key  appPlanKey
+	plan string
+}
+
+// appPlans remembers the application plan last returned by 3scale backend for each application, identified by
+// threescale.AppIdentifierHash. Once full, the plan of the least recently seen application is forgotten
+type appPlans struct {
+	max int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[appPlanKey]*list.Element
+}
+
+// newAppPlans returns a store remembering the plans of up to max applications
+func newAppPlans(max int) *appPlans {
+	return &appPlans{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[appPlanKey]*list.Element),
+	}
+}
+
+// record remembers the plan of the application of the service
+func (p *appPlans) record(serviceID, app, plan string) {
+	key := appPlanKey{serviceID: serviceID, app: app}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if element, ok := p.entries[key]; ok {
+		element.Value.(*appPlan).plan = plan
+		p.order.MoveToFront(element)
+		return
+	}
+
+	p.entries[key] = p.order.PushFront(&appPlan{key: key, plan: plan})
+	if p.order.Len() > p.max {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(*appPlan).key)
+	}
+}
+
+// plan returns the plan of the application of the service, or an empty string if not known
+func (p *appPlans) plan(serviceID, app string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	element, ok := p.entries[appPlanKey{serviceID: serviceID, app: app}]
+	if !ok {
+		return ""
+	}
+	p.order.MoveToFront(element)
+	return element.Value.(*appPlan).plan
+}
+
+// planRecorder is a http.RoundTripper which records the application plan returned by 3scale backend for each
+// application it authorizes, including authorizations made by the backend cache on behalf of many requests
+type planRecorder struct {
+	next  http.RoundTripper
+	plans *appPlans
+}
+
+func (r planRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError || !isAuthorizationPath(req.URL.Path) {
+		return resp, err
+	}
+
+	query := req.URL.Query()
+	app := threescale.AppIdentifierHash(authorizer.BackendParams{
+		AppID:   query.Get("app_id"),
+		UserKey: query.Get("user_key"),
+	})
+	if app == "" {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// the body is restored for the client, which parses the authorization itself
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var status struct {
+		Plan string `xml:"plan"`
+	}
+	if err := xml.Unmarshal(body, &status); err != nil {
+		log.Debugf("failed to parse application plan of response from 3scale backend - %v", err)
+		return resp, nil
+	}
+
+	if status.Plan != "" {
+		r.plans.record(query.Get("service_id"), app, status.Plan)
+	}
+	return resp, nil
+}
+
+// isAuthorizationPath returns true if the path is that of an authorization endpoint of 3scale backend
+func isAuthorizationPath(p string) bool {
+	return path.Base(path.Dir(p)) == "transactions" && authorizationEndpoints[path.Base(p)]
+}
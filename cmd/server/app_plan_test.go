@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+)
+
+func TestPlanRecorder(t *testing.T) {
+	const body = `<?xml version="1.0" encoding="UTF-8"?><status><authorized>true</authorized><plan>Basic</plan></status>`
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	plans := newAppPlans(1)
+	c := &http.Client{Transport: planRecorder{next: http.DefaultTransport, plans: plans}}
+
+	inputs := []struct {
+		name   string
+		path   string
+		params authorizer.BackendParams
+		expect string
+	}{
+		{
+			name:   "Test plan is recorded for application id",
+			path:   "/transactions/authrep.xml?service_id=123&app_id=app",
+			params: authorizer.BackendParams{AppID: "app"},
+			expect: "Basic",
+		},
+		{
+			name:   "Test plan is recorded for user key",
+			path:   "/transactions/authorize.xml?service_id=123&user_key=key",
+			params: authorizer.BackendParams{UserKey: "key"},
+			expect: "Basic",
+		},
+		{
+			name:   "Test plan is not recorded for reports",
+			path:   "/transactions.xml?service_id=123&transactions[0][app_id]=other",
+			params: authorizer.BackendParams{AppID: "other"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			resp, err := c.Get(backend.URL + input.path)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(b) != body {
+				t.Errorf("expected the response body to be restored, got %s", b)
+			}
+
+			if plan := plans.plan("123", threescale.AppIdentifierHash(input.params)); plan != input.expect {
+				t.Errorf("expected plan %q, got %q", input.expect, plan)
+			}
+		})
+	}
+
+	if plan := plans.plan("123", threescale.AppIdentifierHash(authorizer.BackendParams{AppID: "app"})); plan != "" {
+		t.Errorf("expected the plan of the least recently seen application to be forgotten, got %q", plan)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/Shopify/sarama"
+
+	"istio.io/istio/pkg/log"
+)
+
+// kafkaAuditSink publishes audit records, encoded as JSON, to a Kafka topic.
+// Records are keyed by service id so that the records for a service are ordered within a partition.
+type kafkaAuditSink struct {
+	producer sarama.AsyncProducer
+	topic    string
+	done     chan struct{}
+}
+
+// newKafkaAuditSink connects to the provided brokers in order to publish to topic
+func newKafkaAuditSink(brokers []string, topic string) (*kafkaAuditSink, error) {
+	conf := sarama.NewConfig()
+	conf.ClientID = "3scale-istio-adapter"
+	conf.Producer.RequiredAcks = sarama.WaitForLocal
+	conf.Producer.Return.Errors = true
+
+	producer, err := sarama.NewAsyncProducer(brokers, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &kafkaAuditSink{
+		producer: producer,
+		topic:    topic,
+		done:     make(chan struct{}),
+	}
+	go sink.logErrors()
+	return sink, nil
+}
+
+// Publish queues the record with the producer, which is sent to the brokers in the background
+func (k *kafkaAuditSink) Publish(record threescale.AuditRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	k.producer.Input() <- &sarama.ProducerMessage{
+		Topic:     k.topic,
+		Key:       sarama.StringEncoder(record.ServiceID),
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: record.Timestamp,
+	}
+	return nil
+}
+
+// Close flushes any records buffered by the producer
+func (k *kafkaAuditSink) Close() error {
+	k.producer.AsyncClose()
+	<-k.done
+	return nil
+}
+
+func (k *kafkaAuditSink) logErrors() {
+	defer close(k.done)
+	for err := range k.producer.Errors() {
+		log.Errorf("failed to publish audit record to kafka topic %s - %v", k.topic, err.Err)
+	}
+}
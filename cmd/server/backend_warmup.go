@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/istio/pkg/log"
+)
+
+// backendWarmup opens connections to 3scale backend before requests are served, so that the first requests reuse
+// established connections rather than paying for the TCP and TLS handshakes
+type backendWarmup struct {
+	// readinessGate is opened once warmup has completed or timed out
+	readinessGate
+}
+
+// run opens the provided number of connections to the backend URL concurrently, each with a HEAD request whose
+// response returns the connection to the idle pool of the client. Warmup gives up on connections not opened
+// within the timeout, since requests may still be served by opening connections as needed
+func (b *backendWarmup) run(client *http.Client, backendURL string, connections int, timeout time.Duration) {
+	defer b.open()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	var failed int32
+	var wg sync.WaitGroup
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := warmBackendConnection(ctx, client, backendURL); err != nil {
+				atomic.AddInt32(&failed, 1)
+				log.Debugf("failed to warm connection to 3scale backend - %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		log.Warnf("failed to warm %d of %d connections to %s within %s", failed, connections, backendURL, timeout)
+		return
+	}
+	log.Infof("warmed %d connections to %s in %s", connections, backendURL, time.Since(start).Round(time.Millisecond))
+}
+
+// warmBackendConnection makes a HEAD request to the backend URL. Any response establishes the connection
+func warmBackendConnection(ctx context.Context, client *http.Client, backendURL string) error {
+	req, err := http.NewRequest(http.MethodHead, backendURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	// the body must be drained for the connection to be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
+
+	"istio.io/istio/pkg/log"
+)
+
+const (
+	// systemFetchBulk labels calls to 3scale system fetching the configuration of many services at once
+	systemFetchBulk = "bulk"
+	// systemFetchIndividual labels calls to 3scale system fetching the configuration of a single service
+	systemFetchIndividual = "individual"
+
+	// bulkProxyConfigPath is the path of the list of the latest configuration of every service in an environment
+	bulkProxyConfigPath = systemAPIPathPrefix + "account/proxy_configs/%s.json"
+	// bulkProxyConfigsPerPage is the number of configurations requested per page of the list
+	bulkProxyConfigsPerPage = 500
+	// maxBulkProxyConfigPages bounds the pages of the list fetched for a batch. Services beyond them are fetched individually
+	maxBulkProxyConfigPages = 10
+)
+
+// systemFetchResult is the response to a fetch of configuration waiting on a batch
+type systemFetchResult struct {
+	resp *http.Response
+	err  error
+}
+
+// systemFetchWaiter is a fetch of the latest configuration of a service waiting on a batch
+type systemFetchWaiter struct {
+	req       *http.Request
+	serviceID string
+	result    chan systemFetchResult
+}
+
+// systemFetchBatch is the fetches of configuration from the same 3scale system, environment and credentials which
+// arrived within the interval
+type systemFetchBatch struct {
+	env     string
+	waiters []*systemFetchWaiter
+}
+
+// bulkSystemFetcher is a http.RoundTripper which coalesces fetches of the latest configuration of services from 3scale
+// system, such as those for many cold services after a restart, into a single call to the bulk endpoint per interval.
+// Batches with a single fetch, and services missing from the bulk response, are fetched individually. Should 3scale
+// system not provide the bulk endpoint, every fetch is made individually from then on
+type bulkSystemFetcher struct {
+	next     http.RoundTripper
+	interval time.Duration
+	// timeout bounds the bulk fetch of a batch, as the timeout of the client bounds each individual fetch
+	timeout time.Duration
+
+	// unavailable is 1 once the bulk endpoint has been found not to exist, accessed atomically
+	unavailable int32
+
+	mu      sync.Mutex
+	batches map[string]*systemFetchBatch
+}
+
+func newBulkSystemFetcher(next http.RoundTripper, interval, timeout time.Duration) *bulkSystemFetcher {
+	return &bulkSystemFetcher{
+		next:     next,
+		interval: interval,
+		timeout:  timeout,
+		batches:  make(map[string]*systemFetchBatch),
+	}
+}
+
+func (f *bulkSystemFetcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	serviceID, env, ok := latestProxyConfigPath(req.URL.Path)
+	if !ok || req.Method != http.MethodGet || atomic.LoadInt32(&f.unavailable) == 1 {
+		return f.next.RoundTrip(req)
+	}
+
+	waiter := &systemFetchWaiter{req: req, serviceID: serviceID, result: make(chan systemFetchResult, 1)}
+	f.enqueue(batchKey(req, env), env, waiter)
+
+	select {
+	case result := <-waiter.result:
+		return result.resp, result.err
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// enqueue adds the fetch to the pending batch for the key, starting a batch to be fetched after the interval if none is pending
+func (f *bulkSystemFetcher) enqueue(key, env string, waiter *systemFetchWaiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if batch, ok := f.batches[key]; ok {
+		batch.waiters = append(batch.waiters, waiter)
+		return
+	}
+
+	f.batches[key] = &systemFetchBatch{env: env, waiters: []*systemFetchWaiter{waiter}}
+	time.AfterFunc(f.interval, func() {
+		f.mu.Lock()
+		batch := f.batches[key]
+		delete(f.batches, key)
+		f.mu.Unlock()
+
+		f.fetch(batch)
+	})
+}
+
+// fetch fetches the configuration of each service in the batch, with a single bulk call where more than one is waiting
+func (f *bulkSystemFetcher) fetch(batch *systemFetchBatch) {
+	if len(batch.waiters) == 1 || atomic.LoadInt32(&f.unavailable) == 1 {
+		f.fetchIndividually(batch.waiters)
+		return
+	}
+
+	wanted := make(map[string]bool, len(batch.waiters))
+	for _, waiter := range batch.waiters {
+		wanted[waiter.serviceID] = true
+	}
+
+	configs, err := f.fetchBulk(batch.waiters[0].req, batch.env, wanted)
+	if err != nil {
+		log.Debugf("bulk fetch of configuration for %d services failed, fetching individually - %v", len(batch.waiters), err)
+		f.fetchIndividually(batch.waiters)
+		return
+	}
+
+	var missing []*systemFetchWaiter
+	for _, waiter := range batch.waiters {
+		config, ok := configs[waiter.serviceID]
+		if !ok {
+			missing = append(missing, waiter)
+			continue
+		}
+
+		waiter.result <- systemFetchResult{resp: &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          ioutil.NopCloser(bytes.NewReader(config)),
+			ContentLength: int64(len(config)),
+			Request:       waiter.req,
+		}}
+	}
+	f.fetchIndividually(missing)
+}
+
+// fetchBulk fetches the latest configuration of the wanted services in the environment using the URL and credentials
+// of the provided request, returning each as the body of a response for a single service, keyed by service id. Pages
+// of the list are fetched until every wanted service is found, the list is exhausted or maxBulkProxyConfigPages is
+// reached, so the configuration of services beyond those pages is not returned
+func (f *bulkSystemFetcher) fetchBulk(template *http.Request, env string, wanted map[string]bool) (map[string][]byte, error) {
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	configs := make(map[string][]byte)
+	var found int
+	for page := 1; page <= maxBulkProxyConfigPages; page++ {
+		list, err := f.fetchBulkPage(ctx, template, env, page)
+		if err != nil {
+			return nil, err
+		}
+
+		var added int
+		for id, config := range list {
+			if _, ok := configs[id]; ok {
+				continue
+			}
+			configs[id] = config
+			added++
+			if wanted[id] {
+				found++
+			}
+		}
+
+		// a page which adds no services is taken as the end of the list, should 3scale system not paginate it
+		if found == len(wanted) || len(list) < bulkProxyConfigsPerPage || added == 0 {
+			break
+		}
+	}
+	return configs, nil
+}
+
+// fetchBulkPage fetches a page of the list of the latest configuration of every service in the environment
+func (f *bulkSystemFetcher) fetchBulkPage(ctx context.Context, template *http.Request, env string, page int) (map[string][]byte, error) {
+	u := *template.URL
+	u.Path = fmt.Sprintf(bulkProxyConfigPath, env)
+	u.RawPath = ""
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(bulkProxyConfigsPerPage))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range template.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	metrics.IncrementSystemFetches(systemFetchBulk)
+	resp, err := f.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		if atomic.CompareAndSwapInt32(&f.unavailable, 0, 1) {
+			log.Warnf("3scale system does not provide bulk fetch of configuration, fetching configuration individually")
+		}
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var list struct {
+		ProxyConfigs []json.RawMessage `json:"proxy_configs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string][]byte, len(list.ProxyConfigs))
+	for _, raw := range list.ProxyConfigs {
+		var element struct {
+			ProxyConfig struct {
+				Content struct {
+					ID int64 `json:"id"`
+				} `json:"content"`
+			} `json:"proxy_config"`
+		}
+		if err := json.Unmarshal(raw, &element); err != nil {
+			return nil, err
+		}
+		configs[strconv.FormatInt(element.ProxyConfig.Content.ID, 10)] = raw
+	}
+	return configs, nil
+}
+
+// fetchIndividually fetches the configuration of each service concurrently, with a call per service
+func (f *bulkSystemFetcher) fetchIndividually(waiters []*systemFetchWaiter) {
+	for _, waiter := range waiters {
+		go func(waiter *systemFetchWaiter) {
+			metrics.IncrementSystemFetches(systemFetchIndividual)
+			resp, err := f.next.RoundTrip(waiter.req)
+			waiter.result <- systemFetchResult{resp: resp, err: err}
+		}(waiter)
+	}
+}
+
+// latestProxyConfigPath returns the service id and environment of a request for the latest configuration of a service
+func latestProxyConfigPath(path string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, systemAPIPathPrefix), "/")
+	if len(parts) != 6 || parts[0] != "services" || parts[2] != "proxy" || parts[3] != "configs" || parts[5] != "latest.json" {
+		return "", "", false
+	}
+	return parts[1], parts[4], true
+}
+
+// batchKey identifies the batch of a fetch, such that only fetches from the same 3scale system, with the same
+// credentials, are coalesced
+func batchKey(req *http.Request, env string) string {
+	return strings.Join([]string{req.URL.Scheme, req.URL.Host, env, req.URL.RawQuery, req.Header.Get("Authorization")}, "|")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkSystemFetcher(t *testing.T) {
+	firstPage := make([]int64, bulkProxyConfigsPerPage)
+	for i := range firstPage {
+		firstPage[i] = int64(i + 1)
+	}
+
+	inputs := []struct {
+		name     string
+		bulk     string
+		pages    map[int][]int64
+		timeout  time.Duration
+		services []string
+		// expect is the source of the configuration of each service, either "bulk" or "individual"
+		expect          map[string]string
+		expectBulkCalls int32
+	}{
+		{
+			name:            "Test single fetch is made individually",
+			pages:           map[int][]int64{1: {1}},
+			services:        []string{"1"},
+			expect:          map[string]string{"1": "individual"},
+			expectBulkCalls: 0,
+		},
+		{
+			name:            "Test fetches within the interval are coalesced into a bulk fetch",
+			pages:           map[int][]int64{1: {1, 2, 3}},
+			services:        []string{"1", "2"},
+			expect:          map[string]string{"1": "bulk", "2": "bulk"},
+			expectBulkCalls: 1,
+		},
+		{
+			name:            "Test services missing from the bulk fetch are fetched individually",
+			pages:           map[int][]int64{1: {1}},
+			services:        []string{"1", "2"},
+			expect:          map[string]string{"1": "bulk", "2": "individual"},
+			expectBulkCalls: 1,
+		},
+		{
+			name:            "Test pages are fetched until every service is found",
+			pages:           map[int][]int64{1: firstPage, 2: {501}, 3: {502}},
+			services:        []string{"1", "501"},
+			expect:          map[string]string{"1": "bulk", "501": "bulk"},
+			expectBulkCalls: 2,
+		},
+		{
+			name:            "Test fetches are made individually without the bulk endpoint",
+			bulk:            "not_found",
+			services:        []string{"1", "2"},
+			expect:          map[string]string{"1": "individual", "2": "individual"},
+			expectBulkCalls: 1,
+		},
+		{
+			name:            "Test bulk fetch beyond the timeout falls back to individual fetches",
+			bulk:            "hang",
+			timeout:         time.Millisecond * 50,
+			services:        []string{"1", "2"},
+			expect:          map[string]string{"1": "individual", "2": "individual"},
+			expectBulkCalls: 1,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var bulkCalls int32
+			system := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == fmt.Sprintf(bulkProxyConfigPath, "production") {
+					atomic.AddInt32(&bulkCalls, 1)
+					switch input.bulk {
+					case "not_found":
+						w.WriteHeader(http.StatusNotFound)
+						return
+					case "hang":
+						select {
+						case <-r.Context().Done():
+						case <-time.After(time.Second):
+						}
+						return
+					}
+
+					page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+					configs := make([]json.RawMessage, 0, len(input.pages[page]))
+					for _, id := range input.pages[page] {
+						configs = append(configs, proxyConfigFixture(id, "bulk"))
+					}
+					json.NewEncoder(w).Encode(map[string][]json.RawMessage{"proxy_configs": configs})
+					return
+				}
+
+				serviceID, _, ok := latestProxyConfigPath(r.URL.Path)
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				id, _ := strconv.ParseInt(serviceID, 10, 64)
+				w.Write(proxyConfigFixture(id, "individual"))
+			}))
+			defer system.Close()
+
+			fetcher := newBulkSystemFetcher(http.DefaultTransport, time.Millisecond*50, input.timeout)
+			c := &http.Client{Transport: fetcher}
+
+			var mu sync.Mutex
+			sources := make(map[string]string)
+			var wg sync.WaitGroup
+			for _, service := range input.services {
+				wg.Add(1)
+				go func(service string) {
+					defer wg.Done()
+					resp, err := c.Get(system.URL + systemAPIPathPrefix + "services/" + service + "/proxy/configs/production/latest.json")
+					if err != nil {
+						t.Errorf("unexpected error fetching service %s - %v", service, err)
+						return
+					}
+					defer resp.Body.Close()
+
+					var config struct {
+						ProxyConfig struct {
+							Source string `json:"source"`
+						} `json:"proxy_config"`
+					}
+					b, _ := ioutil.ReadAll(resp.Body)
+					if err := json.Unmarshal(b, &config); err != nil {
+						t.Errorf("unexpected configuration for service %s - %s", service, b)
+						return
+					}
+
+					mu.Lock()
+					sources[service] = config.ProxyConfig.Source
+					mu.Unlock()
+				}(service)
+			}
+			wg.Wait()
+
+			for service, expect := range input.expect {
+				if sources[service] != expect {
+					t.Errorf("expected service %s to be fetched via %s, got %q", service, expect, sources[service])
+				}
+			}
+
+			if calls := atomic.LoadInt32(&bulkCalls); calls != input.expectBulkCalls {
+				t.Errorf("expected %d bulk calls, got %d", input.expectBulkCalls, calls)
+			}
+
+			if unavailable := atomic.LoadInt32(&fetcher.unavailable) == 1; unavailable != (input.bulk == "not_found") {
+				t.Errorf("unexpected availability of the bulk endpoint, unavailable %t", unavailable)
+			}
+		})
+	}
+}
+
+// proxyConfigFixture returns the latest configuration of a service, marked with the source it was fetched from
+func proxyConfigFixture(id int64, source string) []byte {
+	return []byte(fmt.Sprintf(`{"proxy_config":{"id":%d,"environment":"production","source":%q,"content":{"id":%d}}}`, id, source, id))
+}
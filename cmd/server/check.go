@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+)
+
+// validateConfig parses each configuration value without starting any servers.
+// Invalid configuration is fatal, as it would be on startup.
+func validateConfig() *http.Client {
+	getStringSlice("metrics_disabled_labels")
+	getAppQuotaThreshold()
+	getMetricsLatencyBuckets()
+	getMetricsConstLabels()
+	getTrustedProxies()
+	getLocalMappingRules()
+	getMappingRulesMode()
+	getMultiMatchPolicy()
+	getCredentialLogMode()
+	getPathNormalization()
+	getUnknownServicePolicy()
+	getDeletedServicePolicy()
+	getInternalErrorPolicy()
+	getMissingCredentialPolicy()
+	getBackendOverflowPolicy()
+	getReportMode()
+	getReportOverflowPolicy()
+	getBackendRetries()
+	getReportTimestamps()
+	getReportPersistPath()
+	getCredentialExtractor()
+	getAuthModes()
+	getLoadShed()
+	getServiceMaxInflightOverrides()
+	getTenantCacheBudgets()
+	getFailurePolicy()
+	getFailPolicyByMethod()
+	getFailPolicyByMetric()
+	getMaintenanceFailPolicy()
+	getSoftLimitThreshold()
+	getDenyResponseTemplate()
+	getDecisionTraceSink()
+	getMaxStaleServe()
+	getStandby()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	getAccessTokenProvider(stop)
+
+	if sink := getAuditSink(); sink != nil {
+		sink.Close()
+	}
+
+	return parseClientConfig()
+}
+
+// checkConnectivity requests each of the provided 3scale URLs, returning an error for any which could not be reached.
+// Any HTTP response is considered a success since the adapter holds no credentials of its own.
+func checkConnectivity(client *http.Client, urls []string) error {
+	var failed []string
+	for _, url := range urls {
+		resp, err := client.Get(url)
+		if err != nil {
+			log.Errorf("failed to reach %s - %v", url, err)
+			failed = append(failed, url)
+			continue
+		}
+		resp.Body.Close()
+		log.Infof("reached %s - status %d", url, resp.StatusCode)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to reach %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runConfigCheck validates the configuration and connectivity to 3scale, returning the exit code for the process
+func runConfigCheck(urls []string) int {
+	client := validateConfig()
+	log.Info("configuration is valid")
+
+	if err := checkConnectivity(client, urls); err != nil {
+		log.Errorf("connectivity check failed - %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"istio.io/istio/pkg/log"
+)
+
+// withClientCert returns an option presenting the certificate to the host the transport is used for, in place of any
+// default certificate
+func withClientCert(cert tls.Certificate) hostTransportOption {
+	return func(t *http.Transport) error {
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// getClientCertsByHost loads the client certificates configured by host as a comma separated list of
+// host=cert_file:key_file pairs
+func getClientCertsByHost() map[string]tls.Certificate {
+	pairs := getStringMap("client_certs_by_host")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	certs := make(map[string]tls.Certificate, len(pairs))
+	for host, files := range pairs {
+		parts := strings.SplitN(files, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalf("invalid client certificate for host %s - must be of the form host=cert_file:key_file", host)
+		}
+
+		cert, err := tls.LoadX509KeyPair(parts[0], parts[1])
+		if err != nil {
+			log.Fatalf("error creating X509 key pair for host %s from %s and %s - %v", host, parts[0], parts[1], err)
+		}
+		certs[strings.ToLower(host)] = cert
+	}
+	return certs
+}
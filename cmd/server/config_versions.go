@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/admin"
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
+
+	"istio.io/istio/pkg/log"
+)
+
+// configVersionRecorder is a http.RoundTripper which records the version of each configuration fetched from 3scale
+// system, including by refreshes made by the system cache in the background, for the debug cache endpoint and
+// optionally as a metric
+type configVersionRecorder struct {
+	next http.RoundTripper
+	// versions is nil unless the debug cache endpoint is enabled
+	versions *admin.ConfigVersions
+	metric   bool
+}
+
+func (r configVersionRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// the body is restored for the client, which parses the configuration itself
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var element struct {
+		ProxyConfig struct {
+			Version int `json:"version"`
+		} `json:"proxy_config"`
+	}
+	if err := json.Unmarshal(body, &element); err != nil {
+		log.Debugf("failed to parse version of configuration fetched from 3scale system - %v", err)
+		return resp, nil
+	}
+
+	serviceID := serviceIDFromPath(req.URL.Path)
+	if r.versions != nil {
+		sum := sha256.Sum256(body)
+		r.versions.Record(serviceID, admin.ConfigVersion{
+			Version:     element.ProxyConfig.Version,
+			ETag:        resp.Header.Get("ETag"),
+			Hash:        "sha256:" + hex.EncodeToString(sum[:]),
+			RefreshedAt: time.Now(),
+		})
+	}
+
+	if r.metric {
+		metrics.SetServiceConfigVersion(serviceID, element.ProxyConfig.Version)
+	}
+	return resp, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+
+	"istio.io/istio/pkg/log"
+)
+
+// decisionTraceLog writes decision traces to stdout, independently of the level of the default scope
+var decisionTraceLog = log.RegisterScope("decision-trace", "Sampled traces of authorization decisions", 0)
+
+// logDecisionTraceSink writes decision traces as JSON lines under the decision-trace logger scope
+type logDecisionTraceSink struct{}
+
+// Publish writes the trace, encoded as JSON, at info level
+func (logDecisionTraceSink) Publish(trace threescale.DecisionTrace) error {
+	value, err := json.Marshal(trace)
+	if err != nil {
+		return err
+	}
+
+	decisionTraceLog.Info(string(value))
+	return nil
+}
+
+// Close has nothing to flush since traces are written as they are published
+func (logDecisionTraceSink) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/log"
+)
+
+// maxDNSNegativeTTL bounds the time for which a failed lookup is cached, so that connections to 3scale resume
+// promptly once resolution recovers
+const maxDNSNegativeTTL = time.Second * 30
+
+// dnsFailure is a failed lookup of a host, returned in place of a fresh lookup until it expires
+type dnsFailure struct {
+	err   error
+	until time.Time
+}
+
+// negativeDNSCache remembers failed lookups of the hosts of 3scale for a short TTL, so that while resolution is
+// failing, connections fail fast rather than each waiting for a lookup to fail. Successful lookups are never cached
+type negativeDNSCache struct {
+	ttl      time.Duration
+	lookupIP func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu       sync.Mutex
+	failures map[string]dnsFailure
+}
+
+func newNegativeDNSCache(ttl time.Duration) *negativeDNSCache {
+	if ttl > maxDNSNegativeTTL {
+		log.Warnf("negative DNS TTL of %s exceeds the maximum of %s, which is used instead", ttl, maxDNSNegativeTTL)
+		ttl = maxDNSNegativeTTL
+	}
+
+	return &negativeDNSCache{
+		ttl:      ttl,
+		lookupIP: net.DefaultResolver.LookupIPAddr,
+		failures: make(map[string]dnsFailure),
+	}
+}
+
+// failed returns the error of a failed lookup of the host, if one has been cached and not yet expired
+func (c *negativeDNSCache) failed(host string, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failure, ok := c.failures[host]
+	if !ok {
+		return nil
+	}
+
+	if now.After(failure.until) {
+		delete(c.failures, host)
+		return nil
+	}
+	return failure.err
+}
+
+// lookup resolves the host, caching the error should resolution fail. Lookups which fail since the context is done
+// are not cached, since they say nothing of the health of DNS
+func (c *negativeDNSCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if err := c.failed(host, time.Now()); err != nil {
+		return nil, err
+	}
+
+	addrs, err := c.lookupIP(ctx, host)
+	if err == nil {
+		c.mu.Lock()
+		delete(c.failures, host)
+		c.mu.Unlock()
+		return addrs, nil
+	}
+
+	if _, ok := err.(*net.DNSError); ok && ctx.Err() == nil {
+		log.Debugf("lookup of %s failed, caching failure for %s - %v", host, c.ttl, err)
+		c.mu.Lock()
+		c.failures[host] = dnsFailure{err: err, until: time.Now().Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return nil, err
+}
+
+// dialContext returns a function which resolves the host of the address via the cache, then dials each of the
+// addresses it resolves to in turn using dial, until a connection is made
+func (c *negativeDNSCache) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+
+		for _, ip := range addrs {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
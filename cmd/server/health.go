@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/admin"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+// systemAPIPathPrefix is the path prefix shared by all requests to the 3scale system API's
+const systemAPIPathPrefix = "/admin/api/"
+
+// refreshObserver is a http.RoundTripper which records successful fetches of configuration from 3scale system
+type refreshObserver struct {
+	next      http.RoundTripper
+	freshness *admin.CacheFreshness
+}
+
+func (r refreshObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusOK && strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		r.freshness.MarkRefreshed()
+	}
+	return resp, err
+}
+
+// serviceRefreshObserver is a http.RoundTripper which records successful fetches of configuration for each service
+type serviceRefreshObserver struct {
+	next      http.RoundTripper
+	freshness *admin.ServiceFreshness
+}
+
+func (r serviceRefreshObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusOK && strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		r.freshness.MarkRefreshed(serviceIDFromPath(req.URL.Path))
+	}
+	return resp, err
+}
+
+// refreshErrorRecorder is a http.RoundTripper which retains errors fetching configuration from 3scale system,
+// including those of refreshes made by the system cache in the background
+type refreshErrorRecorder struct {
+	next   http.RoundTripper
+	errors *admin.RefreshErrors
+}
+
+func (r refreshErrorRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if !strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		return resp, err
+	}
+
+	// the request URL is not included in the error, since it may hold the access token
+	if err != nil {
+		r.errors.Record(serviceIDFromPath(req.URL.Path), err)
+	} else if resp.StatusCode != http.StatusOK {
+		r.errors.Record(serviceIDFromPath(req.URL.Path), fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	return resp, err
+}
+
+// serviceIDFromPath returns the service id from the path of a request to the 3scale system API's for a service,
+// or the path itself for other requests
+func serviceIDFromPath(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, systemAPIPathPrefix), "/")
+	if len(parts) > 1 && parts[0] == "services" && parts[1] != "" {
+		return parts[1]
+	}
+	return path
+}
+
+// freshnessAuthorizer records each request for system configuration made by the adapter
+type freshnessAuthorizer struct {
+	threescale.ReportingAuthorizer
+	freshness *admin.CacheFreshness
+}
+
+func (f freshnessAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	f.freshness.MarkUsed()
+	return f.ReportingAuthorizer.GetSystemConfiguration(systemURL, request)
+}
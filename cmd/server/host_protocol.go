@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
+
+	"golang.org/x/net/http2"
+)
+
+// useHTTP2 configures the transport of a listed host to make requests over HTTP/2
+func useHTTP2(t *http.Transport) error {
+	return http2.ConfigureTransport(t)
+}
+
+// useHTTP1 configures the transport to make every request over HTTP/1.1
+func useHTTP1(t *http.Transport) error {
+	// a non-nil, empty map disables the upgrade to HTTP/2
+	t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	return nil
+}
+
+// protocolRecorder is a http.RoundTripper which records the protocol of each response from 3scale by host
+type protocolRecorder struct {
+	next http.RoundTripper
+}
+
+func (r protocolRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err == nil {
+		metrics.IncrementBackendProtocol(strings.ToLower(req.URL.Hostname()), resp.Proto)
+	}
+	return resp, err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// hostTransportOption adjusts the transport used for requests to a single 3scale host
+type hostTransportOption func(*http.Transport) error
+
+// hostTransportOptions holds the options of each 3scale host which requires a transport of its own, keyed by host
+type hostTransportOptions map[string][]hostTransportOption
+
+func (o hostTransportOptions) add(host string, option hostTransportOption) {
+	host = strings.ToLower(host)
+	o[host] = append(o[host], option)
+}
+
+// hostTransport is a http.RoundTripper which makes requests to each configured host of 3scale with a transport of its
+// own, and to every other host with the default transport
+type hostTransport struct {
+	byHost map[string]*http.Transport
+	def    *http.Transport
+}
+
+// newHostTransport returns a transport making requests to each host of the options with a clone of the default
+// transport, adjusted by the options of the host
+func newHostTransport(def *http.Transport, options hostTransportOptions) (*hostTransport, error) {
+	byHost := make(map[string]*http.Transport, len(options))
+	for host, opts := range options {
+		t := cloneTransport(def)
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+
+		for _, opt := range opts {
+			if err := opt(t); err != nil {
+				return nil, fmt.Errorf("failed to configure transport for host %s - %v", host, err)
+			}
+		}
+		byHost[host] = t
+	}
+	return &hostTransport{byHost: byHost, def: def}, nil
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.byHost[strings.ToLower(req.URL.Hostname())]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.def.RoundTrip(req)
+}
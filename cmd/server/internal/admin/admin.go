@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"istio.io/istio/pkg/log"
+)
+
+// Server serves the adapters administrative endpoints, such as health checks and metrics, over HTTP
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// NewServer returns a Server which will listen on the provided port once started
+func NewServer(port int) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:    fmt.Sprintf(":%d", port),
+			Handler: mux,
+		},
+	}
+}
+
+// Handle registers the handler for the given pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start binds the listener and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("admin server has shut down: err %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "bearer "
+
+// TokenHandler serves requests with the provided handler only when they provide the token in the Authorization
+// header, with or without a Bearer prefix, responding with 401 Unauthorized otherwise
+func TokenHandler(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get("Authorization")
+		if len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			value = value[len(bearerPrefix):]
+		}
+
+		if value == "" || subtle.ConstantTimeCompare([]byte(value), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
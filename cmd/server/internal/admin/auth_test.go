@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenHandler(t *testing.T) {
+	handler := TokenHandler("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	inputs := []struct {
+		name   string
+		header string
+		expect int
+	}{
+		{name: "Test missing token", expect: http.StatusUnauthorized},
+		{name: "Test invalid token", header: "Bearer wrong", expect: http.StatusUnauthorized},
+		{name: "Test token", header: "secret", expect: http.StatusOK},
+		{name: "Test bearer token", header: "Bearer secret", expect: http.StatusOK},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/usage", nil)
+			if input.header != "" {
+				req.Header.Set("Authorization", input.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != input.expect {
+				t.Errorf("expected status %d, got %d", input.expect, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	handler := UsageHandler(func(serviceID, appID string) (interface{}, bool) {
+		if serviceID != "123" || appID != "app" {
+			return nil, false
+		}
+		return map[string]string{"app_id": appID}, true
+	})
+
+	for target, expect := range map[string]int{
+		"/debug/usage":                     http.StatusBadRequest,
+		"/debug/usage?service=123":         http.StatusBadRequest,
+		"/debug/usage?service=123&app=foo": http.StatusNotFound,
+		"/debug/usage?service=123&app=app": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != expect {
+			t.Errorf("expected status %d for %s, got %d", expect, target, rec.Code)
+		}
+	}
+}
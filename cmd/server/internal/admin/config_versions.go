@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"sync"
+	"time"
+)
+
+// ConfigVersion identifies the configuration of a service last fetched from 3scale system
+type ConfigVersion struct {
+	// Version is the version of the proxy configuration, as numbered by 3scale
+	Version int `json:"version"`
+	// ETag is the entity tag of the response, if 3scale provided one
+	ETag string `json:"etag,omitempty"`
+	// Hash is the sha256 of the content of the response, which changes whenever the configuration does
+	Hash        string    `json:"hash"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// ConfigVersions retains the version of the configuration last fetched for each service, so that operators can
+// verify that a change to the configuration in 3scale has been picked up by the adapter
+type ConfigVersions struct {
+	mu       sync.Mutex
+	services map[string]ConfigVersion
+}
+
+// NewConfigVersions returns an empty ConfigVersions
+func NewConfigVersions() *ConfigVersions {
+	return &ConfigVersions{services: make(map[string]ConfigVersion)}
+}
+
+// Record retains the version of the configuration fetched for the service, replacing any previously retained
+func (c *ConfigVersions) Record(serviceID string, version ConfigVersion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.services[serviceID] = version
+}
+
+// Snapshot returns the version of the configuration last fetched for each service
+func (c *ConfigVersions) Snapshot() map[string]ConfigVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]ConfigVersion, len(c.services))
+	for serviceID, version := range c.services {
+		snapshot[serviceID] = version
+	}
+	return snapshot
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigVersions(t *testing.T) {
+	c := NewConfigVersions()
+	if snapshot := c.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("expected no versions to be retained, got %v", snapshot)
+	}
+
+	c.Record("123", ConfigVersion{Version: 1, Hash: "a", RefreshedAt: time.Now()})
+	c.Record("123", ConfigVersion{Version: 2, ETag: `"b"`, Hash: "b", RefreshedAt: time.Now()})
+	c.Record("456", ConfigVersion{Version: 7, Hash: "c", RefreshedAt: time.Now()})
+
+	snapshot := c.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("expected versions for 2 services, got %v", snapshot)
+	}
+
+	if v := snapshot["123"]; v.Version != 2 || v.ETag != `"b"` || v.Hash != "b" {
+		t.Errorf("expected latest version to replace the previous, got %v", v)
+	}
+
+	// the snapshot must not be affected by later records
+	c.Record("456", ConfigVersion{Version: 8})
+	if v := snapshot["456"]; v.Version != 7 {
+		t.Errorf("expected snapshot to be unaffected by later records, got %v", v)
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"istio.io/istio/pkg/log"
+)
+
+// JSONHandler responds with the JSON encoding of the value returned by the provided function
+func JSONHandler(fn func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(fn(), "", "  ")
+		if err != nil {
+			log.Errorf("failed to encode response for %s - %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// UsageHandler responds with the JSON encoding of the usage returned by the provided function for the application
+// identified by the service and app query parameters, or 404 Not Found if its usage is not known
+func UsageHandler(fn func(serviceID, appID string) (interface{}, bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		serviceID, appID := r.URL.Query().Get("service"), r.URL.Query().Get("app")
+		if serviceID == "" || appID == "" {
+			http.Error(w, "service and app query parameters are required", http.StatusBadRequest)
+			return
+		}
+
+		usage, ok := fn(serviceID, appID)
+		if !ok {
+			http.Error(w, "no usage known for the application", http.StatusNotFound)
+			return
+		}
+
+		JSONHandler(func() interface{} {
+			return usage
+		}).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/istio/pkg/log"
+)
+
+// HealthCheck returns a non-nil error when the adapter should be considered unhealthy
+type HealthCheck func() error
+
+// HealthHandler responds with 200 OK when all the provided checks pass and 503 Service Unavailable otherwise
+func HealthHandler(checks ...HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, check := range checks {
+			if err := check(); err != nil {
+				log.Warnf("health check failed - %v", err)
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprint(w, "ok")
+	})
+}
+
+// CacheFreshness tracks when the 3scale system configuration was last requested by the adapter and when
+// it was last successfully fetched from 3scale, in order to detect a cache whose refresh process has stalled
+type CacheFreshness struct {
+	// unix nano timestamps, accessed atomically
+	lastUsed    int64
+	lastRefresh int64
+}
+
+// MarkUsed records that the system configuration has been requested
+func (c *CacheFreshness) MarkUsed() {
+	atomic.StoreInt64(&c.lastUsed, time.Now().UnixNano())
+}
+
+// MarkRefreshed records that the system configuration has been successfully fetched from 3scale
+func (c *CacheFreshness) MarkRefreshed() {
+	atomic.StoreInt64(&c.lastRefresh, time.Now().UnixNano())
+}
+
+// LastRefreshed returns the time of the last successful fetch, which is zero if none has occurred
+func (c *CacheFreshness) LastRefreshed() time.Time {
+	return unixNanoToTime(atomic.LoadInt64(&c.lastRefresh))
+}
+
+// Check returns a HealthCheck which fails when the system configuration has been in use within the threshold
+// but has not been successfully fetched within the same period. An idle adapter is never considered stale since
+// there are no cached entries being refreshed.
+func (c *CacheFreshness) Check(threshold time.Duration) HealthCheck {
+	return func() error {
+		lastUsed := unixNanoToTime(atomic.LoadInt64(&c.lastUsed))
+		if lastUsed.IsZero() || time.Since(lastUsed) > threshold {
+			return nil
+		}
+
+		lastRefresh := c.LastRefreshed()
+		if lastRefresh.IsZero() {
+			return fmt.Errorf("system cache has never been refreshed successfully")
+		}
+
+		if since := time.Since(lastRefresh); since > threshold {
+			return fmt.Errorf("system cache last refreshed successfully %s ago, exceeding threshold of %s",
+				since.Round(time.Second), threshold)
+		}
+		return nil
+	}
+}
+
+// ServiceFreshness tracks when the configuration of each service was last successfully fetched from 3scale system,
+// including by refreshes made by the system cache in the background
+type ServiceFreshness struct {
+	// refreshed holds the time.Time of the last successful fetch, keyed by service id
+	refreshed sync.Map
+}
+
+// MarkRefreshed records that the configuration of the service has been successfully fetched from 3scale
+func (f *ServiceFreshness) MarkRefreshed(serviceID string) {
+	f.refreshed.Store(serviceID, time.Now())
+}
+
+// LastRefreshed returns the time of the last successful fetch for the service, which is zero if none has occurred
+func (f *ServiceFreshness) LastRefreshed(serviceID string) time.Time {
+	refreshed, ok := f.refreshed.Load(serviceID)
+	if !ok {
+		return time.Time{}
+	}
+	return refreshed.(time.Time)
+}
+
+func unixNanoToTime(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	inputs := []struct {
+		name       string
+		checks     []HealthCheck
+		expectCode int
+	}{
+		{
+			name:       "Test no checks is healthy",
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "Test passing checks is healthy",
+			checks: []HealthCheck{
+				func() error { return nil },
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "Test any failed check is unhealthy",
+			checks: []HealthCheck{
+				func() error { return nil },
+				func() error { return errors.New("failed") },
+			},
+			expectCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HealthHandler(input.checks...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != input.expectCode {
+				t.Errorf("expected %d but got %d", input.expectCode, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCacheFreshnessCheck(t *testing.T) {
+	const threshold = time.Minute
+	now := time.Now()
+
+	inputs := []struct {
+		name        string
+		lastUsed    time.Time
+		lastRefresh time.Time
+		expectErr   bool
+	}{
+		{
+			name: "Test unused cache is healthy",
+		},
+		{
+			name:        "Test cache idle beyond threshold is healthy",
+			lastUsed:    now.Add(-threshold * 2),
+			lastRefresh: now.Add(-threshold * 3),
+		},
+		{
+			name:        "Test recently refreshed cache is healthy",
+			lastUsed:    now,
+			lastRefresh: now.Add(-threshold / 2),
+		},
+		{
+			name:      "Test cache in use which was never refreshed is unhealthy",
+			lastUsed:  now,
+			expectErr: true,
+		},
+		{
+			name:        "Test cache in use with stale refresh is unhealthy",
+			lastUsed:    now,
+			lastRefresh: now.Add(-threshold * 2),
+			expectErr:   true,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			c := &CacheFreshness{}
+			if !input.lastUsed.IsZero() {
+				c.lastUsed = input.lastUsed.UnixNano()
+			}
+			if !input.lastRefresh.IsZero() {
+				c.lastRefresh = input.lastRefresh.UnixNano()
+			}
+
+			err := c.Check(threshold)()
+			if input.expectErr && err == nil {
+				t.Errorf("expected cache to be reported as stale")
+			}
+			if !input.expectErr && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestServiceFreshness(t *testing.T) {
+	f := &ServiceFreshness{}
+	if !f.LastRefreshed("123").IsZero() {
+		t.Errorf("expected service which has never been fetched to have no refresh time")
+	}
+
+	before := time.Now()
+	f.MarkRefreshed("123")
+	if refreshed := f.LastRefreshed("123"); refreshed.Before(before) {
+		t.Errorf("expected refresh time to be recorded, got %v", refreshed)
+	}
+
+	if !f.LastRefreshed("456").IsZero() {
+		t.Errorf("expected refresh times to be tracked per service")
+	}
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"istio.io/istio/pkg/log"
+)
+
+// MaintenanceHandler reports whether 3scale is considered to be under maintenance on GET requests, and enters or leaves
+// maintenance on POST requests as per the boolean "active" parameter, using the provided functions
+func MaintenanceHandler(isActive func() bool, set func(active bool) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, maintenanceState(isActive()))
+		case http.MethodPost:
+			active, err := strconv.ParseBool(r.FormValue("active"))
+			if err != nil {
+				http.Error(w, "active must be one of true or false", http.StatusBadRequest)
+				return
+			}
+
+			if set(active) {
+				log.Infof("maintenance mode is now %s", maintenanceState(active))
+			}
+			fmt.Fprint(w, maintenanceState(active))
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func maintenanceState(active bool) string {
+	if active {
+		return "active"
+	}
+	return "inactive"
+}
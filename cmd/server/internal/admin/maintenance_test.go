@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	var active bool
+	handler := MaintenanceHandler(func() bool { return active }, func(a bool) bool {
+		changed := a != active
+		active = a
+		return changed
+	})
+
+	inputs := []struct {
+		method string
+		target string
+		code   int
+		body   string
+		active bool
+	}{
+		{method: http.MethodGet, target: "/maintenance", code: http.StatusOK, body: "inactive"},
+		{method: http.MethodPost, target: "/maintenance?active=true", code: http.StatusOK, body: "active", active: true},
+		{method: http.MethodPost, target: "/maintenance?active=maybe", code: http.StatusBadRequest, body: "active must be one of true or false\n", active: true},
+		{method: http.MethodGet, target: "/maintenance", code: http.StatusOK, body: "active", active: true},
+		{method: http.MethodPost, target: "/maintenance?active=false", code: http.StatusOK, body: "inactive"},
+		{method: http.MethodPut, target: "/maintenance?active=true", code: http.StatusMethodNotAllowed, body: "method not allowed\n"},
+	}
+
+	for _, input := range inputs {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(input.method, input.target, nil))
+		if rec.Code != input.code || rec.Body.String() != input.body {
+			t.Errorf("%s %s: expected %d %q, got %d %q", input.method, input.target, input.code, input.body, rec.Code, rec.Body.String())
+		}
+
+		if active != input.active {
+			t.Errorf("%s %s: expected maintenance to be %v", input.method, input.target, input.active)
+		}
+	}
+}
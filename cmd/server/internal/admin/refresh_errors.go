@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"sync"
+	"time"
+)
+
+// RefreshError is an error encountered while fetching the configuration of a service from 3scale system
+type RefreshError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// RefreshErrors retains the most recent errors encountered while fetching configuration from 3scale system, for each
+// service, up to a fixed number per service
+type RefreshErrors struct {
+	size int
+
+	mu       sync.Mutex
+	services map[string]*refreshErrorRing
+}
+
+// refreshErrorRing is a ring buffer of the most recent errors for a single service
+type refreshErrorRing struct {
+	errors []RefreshError
+	next   int
+}
+
+// NewRefreshErrors returns RefreshErrors which retains up to size errors per service. A non-positive size retains none
+func NewRefreshErrors(size int) *RefreshErrors {
+	return &RefreshErrors{
+		size:     size,
+		services: make(map[string]*refreshErrorRing),
+	}
+}
+
+// Record retains the error for the service, discarding the oldest error retained for it if the limit is reached
+func (r *RefreshErrors) Record(serviceID string, err error) {
+	if r.size <= 0 || err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ring, ok := r.services[serviceID]
+	if !ok {
+		ring = &refreshErrorRing{}
+		r.services[serviceID] = ring
+	}
+
+	e := RefreshError{Time: time.Now(), Error: err.Error()}
+	if len(ring.errors) < r.size {
+		ring.errors = append(ring.errors, e)
+		return
+	}
+	ring.errors[ring.next] = e
+	ring.next = (ring.next + 1) % r.size
+}
+
+// Snapshot returns the errors retained for each service, oldest first
+func (r *RefreshErrors) Snapshot() map[string][]RefreshError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string][]RefreshError, len(r.services))
+	for serviceID, ring := range r.services {
+		errs := make([]RefreshError, 0, len(ring.errors))
+		errs = append(errs, ring.errors[ring.next:]...)
+		errs = append(errs, ring.errors[:ring.next]...)
+		snapshot[serviceID] = errs
+	}
+	return snapshot
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRefreshErrors(t *testing.T) {
+	r := NewRefreshErrors(3)
+	for i := 0; i < 5; i++ {
+		r.Record("123", fmt.Errorf("error %d", i))
+	}
+	r.Record("456", errors.New("other"))
+	r.Record("456", nil)
+
+	snapshot := r.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("expected errors for 2 services, got %v", snapshot)
+	}
+
+	errs := snapshot["123"]
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors to be retained, got %d", len(errs))
+	}
+	for i, err := range errs {
+		if expect := fmt.Sprintf("error %d", i+2); err.Error != expect {
+			t.Errorf("expected %q at %d, got %q", expect, i, err.Error)
+		}
+	}
+
+	if errs := snapshot["456"]; len(errs) != 1 || errs[0].Error != "other" {
+		t.Errorf("unexpected errors retained for service 456 - %v", errs)
+	}
+
+	disabled := NewRefreshErrors(0)
+	disabled.Record("123", errors.New("ignored"))
+	if snapshot := disabled.Snapshot(); len(snapshot) != 0 {
+		t.Errorf("expected no errors to be retained, got %v", snapshot)
+	}
+}
@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"istio.io/istio/pkg/log"
+)
+
+// PromoteHandler calls the provided function on POST requests in order to promote a standby adapter, responding
+// with whether the adapter was promoted or was already serving requests
+func PromoteHandler(promote func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !promote() {
+			fmt.Fprint(w, "already active")
+			return
+		}
+
+		log.Infof("adapter promoted from standby, now serving requests")
+		fmt.Fprint(w, "promoted")
+	})
+}
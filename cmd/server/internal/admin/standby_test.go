@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPromoteHandler(t *testing.T) {
+	var promotions int
+	handler := PromoteHandler(func() bool {
+		promotions++
+		return promotions == 1
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/promote", nil))
+	if rec.Code != http.StatusMethodNotAllowed || promotions != 0 {
+		t.Errorf("expected GET to be rejected without promoting, got %d", rec.Code)
+	}
+
+	for _, expect := range []string{"promoted", "already active"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/promote", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != expect {
+			t.Errorf("expected %q, got %d %q", expect, rec.Code, rec.Body.String())
+		}
+	}
+}
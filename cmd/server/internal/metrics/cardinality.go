@@ -0,0 +1,62 @@
+package metrics
+
+import "sync"
+
+// otherLabelValue is recorded in place of any label value which exceeds the cardinality limit
+const otherLabelValue = "other"
+
+// cardinalityGuard bounds the number of distinct values recorded for each label name.
+// Once the limit has been reached for a label, any previously unseen value is recorded as otherLabelValue.
+type cardinalityGuard struct {
+	mu     sync.Mutex
+	max    int
+	values map[string]map[string]struct{}
+}
+
+// newCardinalityGuard returns a guard allowing max values per label. A non-positive max disables the guard.
+func newCardinalityGuard(max int) *cardinalityGuard {
+	return &cardinalityGuard{
+		max:    max,
+		values: make(map[string]map[string]struct{}),
+	}
+}
+
+// value returns the value which should be recorded for the label
+func (g *cardinalityGuard) value(label, value string) string {
+	if g.max <= 0 {
+		return value
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	seen, ok := g.values[label]
+	if !ok {
+		seen = make(map[string]struct{})
+		g.values[label] = seen
+	}
+
+	if _, ok := seen[value]; ok {
+		return value
+	}
+
+	if len(seen) >= g.max {
+		return otherLabelValue
+	}
+
+	seen[value] = struct{}{}
+	return value
+}
+
+// has returns true if the value has been recorded for the label, or if the guard is disabled
+func (g *cardinalityGuard) has(label, value string) bool {
+	if g.max <= 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, ok := g.values[label][value]
+	return ok
+}
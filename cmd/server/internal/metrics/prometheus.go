@@ -1,10 +1,13 @@
 package metrics
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -12,25 +15,355 @@ import (
 // defaultMetricsPort - Default port that metrics endpoint will be served on
 const defaultMetricsPort = 8080
 
+const (
+	hostLabel     = "host"
+	methodLabel   = "method"
+	endpointLabel = "endpoint"
+	statusLabel   = "status"
+
+	serviceIDLabel = "service_id"
+	codeLabel      = "code"
+	attributeLabel = "attribute"
+	reasonLabel    = "reason"
+	stateLabel     = "state"
+	sourceLabel    = "source"
+	metricLabel    = "metric"
+	resultLabel    = "result"
+
+	statusClassLabel = "status_class"
+	priorityLabel    = "priority"
+	appLabel         = "app"
+	cacheLabel       = "cache"
+	modeLabel        = "mode"
+	protocolLabel    = "protocol"
+	planLabel        = "plan"
+)
+
+// unknownPlanLabelValue is recorded as the plan of requests whose application plan is not known
+const unknownPlanLabelValue = "unknown"
+
+// InstanceLabel distinguishes deployments of the adapter whose metrics are scraped side by side
+const InstanceLabel = "adapter_instance"
+
+// Options allows customisation of the collectors prior to registration
+type Options struct {
+	// DisabledLabels is a list of label names which will be omitted from all collectors
+	DisabledLabels []string
+	// MaxLabelValues bounds the number of distinct values recorded for high cardinality labels, such as service_id.
+	// Values beyond the limit are recorded as "other". A non-positive value disables the limit
+	MaxLabelValues int
+	// ConstLabels are added, with a fixed value, to every collector. Useful for distinguishing deployments
+	// which are scraped side by side, such as canary and stable fleets
+	ConstLabels map[string]string
+	// RequestsByMetric enables counting requests by the 3scale metrics they were counted against.
+	// The metric label is bound by MaxLabelValues
+	RequestsByMetric bool
+	// AppQuotaUtilization enables reporting the utilization of the limits of each application, labelled by a hash of
+	// its identifier. The app label is bound by MaxLabelValues, and applications beyond the bound are not reported
+	AppQuotaUtilization bool
+	// AppQuotaThreshold restricts the applications reported by AppQuotaUtilization to those whose utilization is at
+	// least the threshold, between 0 and 1. Applications falling below the threshold are no longer reported
+	AppQuotaThreshold float64
+	// LatencyBuckets overrides the bucket boundaries, in seconds, of the latency histograms, such that they can be
+	// aligned with alerting thresholds. Boundaries must be positive and in increasing order
+	LatencyBuckets []float64
+	// PlanOf returns the application plan of the application of a request, as identified by RequestReport.App, or an
+	// empty string if not known. When set, the request metrics are labelled by plan, bound by MaxLabelValues
+	PlanOf func(serviceID, app string) string
+}
+
 var (
 	// Range of buckets, in seconds for which metrics will be placed for 3scale latency
 	threescaleBucket = []float64{.01, .02, .03, .05, .08, .1, .15, .2, .3, .5, 1.0, 1.5}
 
-	threescaleLatency = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "threescale_latency",
-			Help:    "Request latency between adapter and 3scale",
-			Buckets: threescaleBucket,
+	// latencyBucket is the range of buckets in use for latency, threescaleBucket unless overridden by LatencyBuckets
+	latencyBucket = threescaleBucket
+
+	// Range of buckets, in seconds for which metrics will be placed for mapping rule evaluation
+	mappingRuleBucket = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05}
+
+	// Range of buckets, in seconds for which metrics will be placed for the overhead of the adapter
+	overheadBucket = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25}
+
+	// requestsByMetricEnabled determines whether requests are counted by 3scale metric
+	requestsByMetricEnabled bool
+
+	// appQuotaEnabled determines whether the utilization of the limits of applications is reported
+	appQuotaEnabled bool
+
+	// appQuotaThreshold is the utilization below which applications are not reported
+	appQuotaThreshold float64
+
+	// planOf resolves the application plan of requests, if the plan label is enabled
+	planOf func(serviceID, app string) string
+
+	// disabledLabels holds the set of label names which should not be recorded. The plan label is only recorded once enabled
+	disabledLabels = map[string]bool{planLabel: true}
+
+	// registerer registers the collectors, adding any constant labels
+	registerer = prometheus.DefaultRegisterer
+
+	threescaleLatency = newThreescaleLatency()
+
+	threescaleHTTP = newThreescaleHTTP()
+
+	// guard bounds the cardinality of labels derived from request data
+	guard = newCardinalityGuard(0)
+
+	requestsTotal = newRequestsTotal()
+
+	requestDuration = newRequestDuration()
+
+	unknownServices = newUnknownServices()
+
+	slowChecks = newSlowChecks()
+
+	missingCredentials = newMissingCredentials()
+
+	negativeCacheHits = newNegativeCacheHits()
+
+	attributeErrors = newAttributeErrors()
+
+	unexpectedBackendStatus = newUnexpectedBackendStatus()
+
+	unservedServices = newUnservedServices()
+
+	localRateLimited = newLocalRateLimited()
+
+	configVersionChanges = newConfigVersionChanges()
+
+	circuitTransitions = newCircuitTransitions()
+
+	systemFetchesCoalesced = newSystemFetchesCoalesced()
+
+	authorizesCoalesced = newAuthorizesCoalesced()
+
+	missingUsageData = newMissingUsageData()
+
+	mappingRuleEvaluation = newMappingRuleEvaluation()
+
+	credentialSources = newCredentialSources()
+
+	deletedServices = newDeletedServices()
+
+	requestsByMetric = newRequestsByMetric()
+
+	lastKnownDecisions = newLastKnownDecisions()
+
+	backendDuration = newBackendDuration()
+
+	staleConfigDenied = newStaleConfigDenied()
+
+	serviceInflight = newServiceInflight()
+
+	misconfiguredServices = newMisconfiguredServices()
+
+	refreshQueueWait = newRefreshQueueWait()
+
+	appQuotaUtilization = newAppQuotaUtilization()
+
+	serviceConfigVersion = newServiceConfigVersion()
+
+	adapterOverhead = newAdapterOverhead()
+
+	decisionCacheRequests = newDecisionCacheRequests()
+
+	decisionCacheEvictions = newDecisionCacheEvictions()
+
+	maintenanceFailPolicy = newMaintenanceFailPolicy()
+
+	systemFetches = newSystemFetches()
+
+	softLimitExceeded = newSoftLimitExceeded()
+
+	backendProtocol = newBackendProtocol()
+
+	syntheticCheckSuccess = newSyntheticCheckSuccess()
+
+	syntheticCheckDuration = newSyntheticCheckDuration()
+
+	conflictingCredentials = newConflictingCredentials()
+
+	circuitProbeInterval = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_backend_circuit_probe_interval_seconds",
+			Help: "Current interval between probes of 3scale backend while the circuit is open",
 		},
-		[]string{"host", "method", "endpoint"},
 	)
 
-	threescaleHTTP = prometheus.NewCounterVec(
+	backendInflight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_backend_inflight_requests",
+			Help: "Current number of authorization requests in flight to 3scale backend",
+		},
+	)
+
+	backendRejections = prometheus.NewCounter(
 		prometheus.CounterOpts{
-			Name: "threescale_http_total",
-			Help: "HTTP Status response codes for requests to 3scale backend",
+			Name: "threescale_backend_inflight_rejections_total",
+			Help: "Total number of requests which could not call 3scale backend since the in flight limit was reached",
+		},
+	)
+
+	backendResponseTooLarge = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_backend_response_too_large_total",
+			Help: "Total number of responses from 3scale backend rejected since they exceeded the maximum size",
+		},
+	)
+
+	backendCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_backend_cache_entries",
+			Help: "Estimated number of distinct applications held by the backend cache since it was last flushed",
+		},
+	)
+
+	decisionCacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_decision_cache_entries",
+			Help: "Current number of entries held by the negative cache and last known decisions combined",
+		},
+	)
+
+	backendCacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_backend_cache_bytes",
+			Help: "Estimated size in bytes of the applications held by the backend cache since it was last flushed",
+		},
+	)
+
+	standby = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_standby",
+			Help: "Whether the adapter is in standby (1) or serving requests (0)",
+		},
+	)
+
+	maintenance = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_maintenance",
+			Help: "Whether 3scale is considered to be under maintenance (1) or not (0)",
+		},
+	)
+
+	startTime = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_start_time_seconds",
+			Help: "Start time of the adapter process since unix epoch in seconds",
+		},
+	)
+
+	shutdowns = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_shutdowns_total",
+			Help: "Total number of graceful shutdowns started by the adapter",
+		},
+	)
+
+	reportQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_report_queue_depth",
+			Help: "Current number of usage reports waiting to be sent to 3scale backend",
+		},
+	)
+
+	decisionTracesDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_decision_traces_dropped_total",
+			Help: "Total number of decision traces dropped since the decision trace buffer was full",
+		},
+	)
+
+	auditDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_audit_dropped_total",
+			Help: "Total number of audit records dropped since the audit buffer was full",
+		},
+	)
+
+	reportsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_report_queue_dropped_total",
+			Help: "Total number of usage reports dropped since the report queue was full",
+		},
+	)
+
+	reportsDroppedOldest = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_report_queue_dropped_oldest_total",
+			Help: "Total number of queued usage reports dropped to make room for newer reports since the report queue was full",
+		},
+	)
+
+	retryBudgetExhausted = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_backend_retry_budget_exhausted_total",
+			Help: "Total number of failed calls to 3scale backend which were not retried since the retry budget was exhausted",
+		},
+	)
+
+	loadShed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_load_shed_total",
+			Help: "Total number of authorization requests shed, applying the fail policy, since the adapter was overloaded",
+		},
+	)
+
+	loadShedProbability = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_load_shed_probability",
+			Help: "Current probability with which authorization requests are shed since the adapter is overloaded",
+		},
+	)
+
+	handlerActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_handler_goroutines_active",
+			Help: "Current number of goroutines of the handler pool handling an authorization request",
+		},
+	)
+
+	handlerQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_handler_queue_depth",
+			Help: "Current number of authorization requests waiting for a goroutine of the handler pool",
+		},
+	)
+
+	missingServiceID = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_missing_service_id_total",
+			Help: "Total number of authorization requests rejected since they did not identify the 3scale service",
+		},
+	)
+
+	handlerRejected = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_handler_rejected_total",
+			Help: "Total number of authorization requests rejected, applying the fail policy, since the handler pool queue was full",
+		},
+	)
+
+	reportsBlocked = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_report_queue_blocked_total",
+			Help: "Total number of usage reports which waited for space since the report queue was full",
+		},
+	)
+
+	reportTimestampRejected = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "threescale_report_timestamp_rejected_total",
+			Help: "Total number of usage reports rejected by 3scale backend due to their timestamp",
+		},
+	)
+
+	backendClockSkew = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "threescale_backend_clock_skew_seconds",
+			Help: "Seconds by which the clock of the adapter is ahead of 3scale backend, as last detected when a usage report was rejected due to its timestamp",
 		},
-		[]string{"host", "method", "endpoint", "status"},
 	)
 
 	cacheHitsSystem = prometheus.NewCounter(
@@ -48,24 +381,1238 @@ var (
 	)
 )
 
-func ReportCB(tr authorizer.TelemetryReport) {
-	latencyObserver := threescaleLatency.WithLabelValues(tr.Host, tr.Method, tr.Endpoint)
-	latencyObserver.Observe(tr.TimeTaken.Seconds())
+func newThreescaleLatency() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_latency",
+			Help:    "Request latency between adapter and 3scale",
+			Buckets: latencyBucket,
+		},
+		enabledLabels(hostLabel, methodLabel, endpointLabel),
+	)
+}
 
-	threescaleHTTP.WithLabelValues(tr.Host, tr.Method, tr.Endpoint, strconv.Itoa(tr.Code)).Inc()
+func newThreescaleHTTP() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_http_total",
+			Help: "HTTP Status response codes for requests to 3scale backend",
+		},
+		enabledLabels(hostLabel, methodLabel, endpointLabel, statusLabel),
+	)
 }
 
-// IncrementCacheHits increments proxy configurations that have been read from the cache
-func IncrementCacheHits(cache authorizer.Cache) {
-	if cache == authorizer.System {
-		cacheHitsSystem.Inc()
-		return
-	}
-	cacheHitsBackend.Inc()
+func newRequestsTotal() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_requests_total",
+			Help: "Total number of authorization requests handled by the adapter by status code returned to Mixer",
+		},
+		enabledLabels(serviceIDLabel, planLabel, codeLabel),
+	)
+}
+
+func newRequestsByMetric() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_requests_by_metric_total",
+			Help: "Total number of authorization requests handled by the adapter, by the 3scale metrics they were counted against",
+		},
+		enabledLabels(serviceIDLabel, metricLabel, codeLabel),
+	)
+}
+
+func newRequestDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_request_duration_seconds",
+			Help:    "Time taken by the adapter to handle authorization requests",
+			Buckets: latencyBucket,
+		},
+		enabledLabels(serviceIDLabel, planLabel),
+	)
+}
+
+func newBackendDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_backend_duration_seconds",
+			Help:    "Time taken by calls to 3scale backend, by HTTP status class of the response or error if none was received",
+			Buckets: latencyBucket,
+		},
+		enabledLabels(statusClassLabel),
+	)
+}
+
+func newRefreshQueueWait() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_system_refresh_queue_wait_seconds",
+			Help:    "Time fetches of service configuration from 3scale system waited for the refresh concurrency limit, by priority of the service",
+			Buckets: latencyBucket,
+		},
+		enabledLabels(priorityLabel),
+	)
+}
+
+func newAdapterOverhead() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_adapter_overhead_seconds",
+			Help:    "Time spent by the adapter on an authorization request, excluding the time spent waiting on 3scale system and backend",
+			Buckets: overheadBucket,
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newMappingRuleEvaluation() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "threescale_mapping_rule_evaluation_seconds",
+			Help:    "Time taken to evaluate the mapping rules of a service for an authorization request",
+			Buckets: mappingRuleBucket,
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newUnknownServices() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_unknown_service_total",
+			Help: "Total number of authorization requests for services which do not exist in 3scale",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newSlowChecks() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_slow_checks_total",
+			Help: "Total number of authorization requests which exceeded the slow check threshold",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newMissingCredentials() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_missing_credentials_total",
+			Help: "Total number of authorization requests which did not provide any credentials",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newNegativeCacheHits() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_negative_cache_hits_total",
+			Help: "Total number of requests with invalid credentials rejected without calling 3scale backend",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newAttributeErrors() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_attribute_errors_total",
+			Help: "Total number of attributes which could not be extracted from authorization requests",
+		},
+		enabledLabels(attributeLabel, reasonLabel),
+	)
 }
 
-func Register() {
-	prometheus.MustRegister(threescaleLatency, threescaleHTTP, cacheHitsSystem, cacheHitsBackend)
+func newUnexpectedBackendStatus() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_backend_unexpected_status_total",
+			Help: "Total number of responses from 3scale backend which could not be interpreted, by status",
+		},
+		enabledLabels(codeLabel),
+	)
+}
+
+func newCircuitTransitions() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_backend_circuit_transitions_total",
+			Help: "Total number of transitions of the circuit to 3scale backend, by the state transitioned to",
+		},
+		enabledLabels(stateLabel),
+	)
+}
+
+func newAuthorizesCoalesced() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_authorize_coalesced_total",
+			Help: "Total number of requests which shared an identical call to authorize against 3scale backend already in flight",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newSystemFetchesCoalesced() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_system_fetch_coalesced_total",
+			Help: "Total number of requests which shared a fetch of configuration from 3scale system already in flight",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newMissingUsageData() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_missing_usage_data_total",
+			Help: "Total number of requests authorized by 3scale backend without usage or limit data in the response",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newCredentialSources() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_credential_source_matches_total",
+			Help: "Total number of requests whose credentials were read from each source of the credential source chain",
+		},
+		enabledLabels(serviceIDLabel, sourceLabel),
+	)
+}
+
+func newDeletedServices() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_deleted_services_total",
+			Help: "Total number of services found to have been deleted from 3scale since their configuration was fetched",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newDecisionCacheRequests() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_decision_cache_requests_total",
+			Help: "Total number of lookups of the negative cache and last known decisions, by cache and result",
+		},
+		enabledLabels(cacheLabel, resultLabel),
+	)
+}
+
+func newDecisionCacheEvictions() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_decision_cache_evictions_total",
+			Help: "Total number of entries evicted from the negative cache and last known decisions since their shared limit was reached, by cache",
+		},
+		enabledLabels(cacheLabel),
+	)
+}
+
+func newMaintenanceFailPolicy() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_maintenance_fail_policy_total",
+			Help: "Total number of authorization requests which had the maintenance fail policy applied since 3scale backend failed during maintenance",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newSystemFetches() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_system_fetches_total",
+			Help: "Total number of calls to 3scale system fetching the latest configuration of services when bulk fetching is enabled, by whether the call fetched many services in bulk or a single service",
+		},
+		enabledLabels(modeLabel),
+	)
+}
+
+func newSoftLimitExceeded() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_soft_limit_exceeded_total",
+			Help: "Total number of authorization requests allowed by 3scale for applications which have used more of a limit than the soft limit threshold",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newBackendProtocol() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_backend_protocol_total",
+			Help: "Total number of responses from 3scale by host and the HTTP protocol negotiated, when HTTP/2 is enabled by host",
+		},
+		enabledLabels(hostLabel, protocolLabel),
+	)
+}
+
+func newSyntheticCheckSuccess() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "threescale_synthetic_check_success",
+			Help: "Whether the last synthetic check of the service was authorized (1) or not (0)",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newSyntheticCheckDuration() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "threescale_synthetic_check_duration_seconds",
+			Help: "Time taken by the last synthetic check of the service",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newConflictingCredentials() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_conflicting_credentials_total",
+			Help: "Total number of authorization requests rejected for presenting credentials which disagree in different locations",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newLastKnownDecisions() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_last_known_decisions_total",
+			Help: "Total number of lookups of last known decisions while 3scale backend was unavailable, by result",
+		},
+		enabledLabels(serviceIDLabel, resultLabel),
+	)
+}
+
+func newUnservedServices() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_unserved_service_total",
+			Help: "Total number of authorization requests denied for services which are not served by the adapter",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newLocalRateLimited() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_local_rate_limited_total",
+			Help: "Total number of authorization requests denied by the local rate limit",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newStaleConfigDenied() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_stale_config_denied_total",
+			Help: "Total number of authorization requests denied since the configuration of the service was too stale to serve",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newMisconfiguredServices() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_misconfigured_service_total",
+			Help: "Total number of authorization requests for which 3scale backend reported the service as not found, indicating the service id or token is misconfigured",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newServiceInflight() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "threescale_service_inflight_requests",
+			Help: "Current number of concurrent authorization requests to services with a limit of in flight requests",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newAppQuotaUtilization() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "threescale_app_quota_utilization",
+			Help: "Highest ratio of usage to limit across the limits of an application, as last returned by 3scale backend",
+		},
+		enabledLabels(serviceIDLabel, appLabel),
+	)
+}
+
+func newServiceConfigVersion() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "threescale_service_config_version",
+			Help: "Version of the configuration last fetched from 3scale system for each service",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+func newConfigVersionChanges() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "threescale_config_version_changes_total",
+			Help: "Total number of changes observed to the version of service configuration fetched from 3scale",
+		},
+		enabledLabels(serviceIDLabel),
+	)
+}
+
+// enabledLabels returns the provided label names, excluding any which have been disabled
+func enabledLabels(names ...string) []string {
+	var enabled []string
+	for _, name := range names {
+		if !disabledLabels[name] {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// filterLabels removes any disabled labels from the provided set so they match the collectors label names
+func filterLabels(labels prometheus.Labels) prometheus.Labels {
+	for name := range labels {
+		if disabledLabels[name] {
+			delete(labels, name)
+		}
+	}
+	return labels
+}
+
+func ReportCB(tr authorizer.TelemetryReport) {
+	latencyObserver := threescaleLatency.With(filterLabels(prometheus.Labels{
+		hostLabel:     tr.Host,
+		methodLabel:   tr.Method,
+		endpointLabel: tr.Endpoint,
+	}))
+	latencyObserver.Observe(tr.TimeTaken.Seconds())
+
+	threescaleHTTP.With(filterLabels(prometheus.Labels{
+		hostLabel:     tr.Host,
+		methodLabel:   tr.Method,
+		endpointLabel: tr.Endpoint,
+		statusLabel:   strconv.Itoa(tr.Code),
+	})).Inc()
+}
+
+// ReportRequest records the outcome of an authorization request handled by the adapter
+func ReportRequest(rr threescale.RequestReport) {
+	serviceID := guard.value(serviceIDLabel, rr.ServiceID)
+	plan := requestPlan(rr)
+
+	requestsTotal.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: serviceID,
+		planLabel:      plan,
+		codeLabel:      rr.Code.String(),
+	})).Inc()
+
+	requestDuration.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: serviceID,
+		planLabel:      plan,
+	})).Observe(rr.TimeTaken.Seconds())
+
+	if !requestsByMetricEnabled {
+		return
+	}
+
+	for _, metric := range rr.Metrics {
+		requestsByMetric.With(filterLabels(prometheus.Labels{
+			serviceIDLabel: serviceID,
+			metricLabel:    guard.value(metricLabel, metric),
+			codeLabel:      rr.Code.String(),
+		})).Inc()
+	}
+}
+
+// requestPlan returns the value of the plan label for the request, bound by the cardinality guard
+func requestPlan(rr threescale.RequestReport) string {
+	if planOf == nil {
+		return ""
+	}
+
+	plan := planOf(rr.ServiceID, rr.App)
+	if plan == "" {
+		return unknownPlanLabelValue
+	}
+	return guard.value(planLabel, plan)
+}
+
+// IncrementUnknownService increments requests made for services which do not exist in 3scale
+func IncrementUnknownService(serviceID string) {
+	unknownServices.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementSlowChecks increments requests which exceeded the slow check threshold
+func IncrementSlowChecks(serviceID string) {
+	slowChecks.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementMissingCredentials increments requests which did not provide any credentials
+func IncrementMissingCredentials(serviceID string) {
+	missingCredentials.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// SetBackendInflight records the number of authorization requests in flight to 3scale backend
+func SetBackendInflight(inflight int64) {
+	backendInflight.Set(float64(inflight))
+}
+
+// IncrementBackendRejections increments requests rejected due to the in flight limit to 3scale backend
+func IncrementBackendRejections() {
+	backendRejections.Inc()
+}
+
+// IncrementBackendResponseTooLarge increments responses from 3scale backend which exceeded the maximum size
+func IncrementBackendResponseTooLarge() {
+	backendResponseTooLarge.Inc()
+}
+
+// SetReportQueueDepth records the number of usage reports waiting to be sent
+func SetReportQueueDepth(depth int) {
+	reportQueueDepth.Set(float64(depth))
+}
+
+// IncrementReportsDropped increments usage reports dropped since the report queue was full
+func IncrementReportsDropped() {
+	reportsDropped.Inc()
+}
+
+// IncrementReportsDroppedOldest increments queued usage reports dropped to make room for newer reports
+func IncrementReportsDroppedOldest() {
+	reportsDroppedOldest.Inc()
+}
+
+// IncrementRetryBudgetExhausted increments failed calls to 3scale backend not retried since the retry budget was exhausted
+func IncrementRetryBudgetExhausted() {
+	retryBudgetExhausted.Inc()
+}
+
+// IncrementLoadShed increments authorization requests shed since the adapter was overloaded
+func IncrementLoadShed() {
+	loadShed.Inc()
+}
+
+// SetLoadShedProbability sets the probability with which authorization requests are shed
+func SetLoadShedProbability(probability float64) {
+	loadShedProbability.Set(probability)
+}
+
+// SetHandlerActive sets the number of goroutines of the handler pool handling an authorization request
+func SetHandlerActive(active int64) {
+	handlerActive.Set(float64(active))
+}
+
+// SetHandlerQueueDepth sets the number of authorization requests waiting for a goroutine of the handler pool
+func SetHandlerQueueDepth(depth int64) {
+	handlerQueueDepth.Set(float64(depth))
+}
+
+// IncrementMissingServiceID increments authorization requests which did not identify the 3scale service
+func IncrementMissingServiceID() {
+	missingServiceID.Inc()
+}
+
+// IncrementHandlerRejected increments authorization requests rejected since the handler pool queue was full
+func IncrementHandlerRejected() {
+	handlerRejected.Inc()
+}
+
+// IncrementReportsBlocked increments usage reports which waited for space in the report queue
+func IncrementReportsBlocked() {
+	reportsBlocked.Inc()
+}
+
+// IncrementReportTimestampRejected increments usage reports rejected by 3scale backend due to their timestamp
+func IncrementReportTimestampRejected() {
+	reportTimestampRejected.Inc()
+}
+
+// SetBackendClockSkew sets how far the clock of the adapter was last detected to be ahead of 3scale backend
+func SetBackendClockSkew(skew time.Duration) {
+	backendClockSkew.Set(skew.Seconds())
+}
+
+// IncrementNegativeCacheHits increments requests rejected by the negative cache
+func IncrementNegativeCacheHits(serviceID string) {
+	negativeCacheHits.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementAttributeErrors increments attributes which could not be extracted from a request, for the given reason
+func IncrementAttributeErrors(attribute, reason string) {
+	attributeErrors.With(filterLabels(prometheus.Labels{
+		attributeLabel: attribute,
+		reasonLabel:    reason,
+	})).Inc()
+}
+
+// IncrementUnexpectedBackendStatus increments responses from 3scale backend which could not be interpreted
+func IncrementUnexpectedBackendStatus(code string) {
+	unexpectedBackendStatus.With(filterLabels(prometheus.Labels{
+		codeLabel: code,
+	})).Inc()
+}
+
+// IncrementUnservedService increments requests denied for services which are not served by the adapter
+func IncrementUnservedService(serviceID string) {
+	unservedServices.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementAuditDropped increments audit records dropped since the audit buffer was full
+func IncrementAuditDropped() {
+	auditDropped.Inc()
+}
+
+// IncrementDecisionTracesDropped increments decision traces dropped since the decision trace buffer was full
+func IncrementDecisionTracesDropped() {
+	decisionTracesDropped.Inc()
+}
+
+// IncrementLocalRateLimited increments requests denied by the local rate limit
+func IncrementLocalRateLimited(serviceID string) {
+	localRateLimited.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// AddServiceInflight adds the delta to the concurrent authorization requests to the service
+func AddServiceInflight(serviceID string, delta int) {
+	serviceInflight.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Add(float64(delta))
+}
+
+// SetServiceConfigVersion sets the version of the configuration last fetched for the service
+func SetServiceConfigVersion(serviceID string, version int) {
+	serviceConfigVersion.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Set(float64(version))
+}
+
+// IncrementConfigVersionChanges increments changes observed to the version of a service's configuration
+func IncrementConfigVersionChanges(serviceID string) {
+	configVersionChanges.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementCircuitTransitions increments transitions of the circuit to 3scale backend to the provided state
+func IncrementCircuitTransitions(state string) {
+	circuitTransitions.With(filterLabels(prometheus.Labels{
+		stateLabel: state,
+	})).Inc()
+}
+
+// IncrementSystemFetchCoalesced increments requests which shared a fetch of configuration already in flight
+func IncrementSystemFetchCoalesced(serviceID string) {
+	systemFetchesCoalesced.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementAuthorizeCoalesced increments requests which shared an identical call to authorize already in flight
+func IncrementAuthorizeCoalesced(serviceID string) {
+	authorizesCoalesced.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// ObserveMappingRuleEvaluation records the time taken to evaluate the mapping rules of a service for a request
+func ObserveMappingRuleEvaluation(serviceID string, elapsed time.Duration) {
+	mappingRuleEvaluation.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Observe(elapsed.Seconds())
+}
+
+// ObserveAdapterOverhead records the time spent by the adapter itself on a request to the service
+func ObserveAdapterOverhead(serviceID string, overhead time.Duration) {
+	adapterOverhead.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Observe(overhead.Seconds())
+}
+
+// IncrementMissingUsageData increments requests authorized by 3scale backend without usage data
+func IncrementMissingUsageData(serviceID string) {
+	missingUsageData.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementCredentialSource increments requests whose credentials were read from the provided source
+func IncrementCredentialSource(serviceID, source string) {
+	credentialSources.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+		sourceLabel:    source,
+	})).Inc()
+}
+
+// IncrementDeletedServices increments services found to have been deleted from 3scale
+func IncrementDeletedServices(serviceID string) {
+	deletedServices.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementLastKnownDecisions increments lookups of last known decisions with the provided result
+func IncrementLastKnownDecisions(serviceID, result string) {
+	lastKnownDecisions.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+		resultLabel:    result,
+	})).Inc()
+}
+
+// IncrementStaleConfigDenied increments requests denied since the configuration of the service was too stale to serve
+func IncrementStaleConfigDenied(serviceID string) {
+	staleConfigDenied.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementMisconfiguredService increments requests for which 3scale backend reported the service as not found
+func IncrementMisconfiguredService(serviceID string) {
+	misconfiguredServices.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// SetAppQuotaUtilization sets the utilization of the limits of the application identified by the hash, if enabled.
+// Applications below the threshold are removed, so that only those approaching their limits are reported
+func SetAppQuotaUtilization(serviceID, appHash string, utilization float64) {
+	if !appQuotaEnabled {
+		return
+	}
+
+	serviceID = guard.value(serviceIDLabel, serviceID)
+	if utilization < appQuotaThreshold {
+		if guard.has(appLabel, appHash) {
+			appQuotaUtilization.Delete(filterLabels(prometheus.Labels{
+				serviceIDLabel: serviceID,
+				appLabel:       appHash,
+			}))
+		}
+		return
+	}
+
+	// a single series shared by every application beyond the bound would not identify any of them
+	app := guard.value(appLabel, appHash)
+	if app == otherLabelValue {
+		return
+	}
+
+	appQuotaUtilization.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: serviceID,
+		appLabel:       app,
+	})).Set(utilization)
+}
+
+// ObserveBackendDuration records the time taken by a call to 3scale backend with the provided status class
+func ObserveBackendDuration(statusClass string, elapsed time.Duration) {
+	backendDuration.With(filterLabels(prometheus.Labels{
+		statusClassLabel: statusClass,
+	})).Observe(elapsed.Seconds())
+}
+
+// ObserveRefreshQueueWait records the time a fetch of service configuration of the provided priority waited to be made
+func ObserveRefreshQueueWait(priority string, elapsed time.Duration) {
+	refreshQueueWait.With(filterLabels(prometheus.Labels{
+		priorityLabel: priority,
+	})).Observe(elapsed.Seconds())
+}
+
+// SetCircuitProbeInterval sets the interval between probes of 3scale backend while the circuit is open
+func SetCircuitProbeInterval(interval time.Duration) {
+	circuitProbeInterval.Set(interval.Seconds())
+}
+
+// SetBackendCacheEntries sets the number of distinct applications held by the backend cache
+func SetBackendCacheEntries(entries int) {
+	backendCacheEntries.Set(float64(entries))
+}
+
+// IncrementDecisionCacheRequests increments lookups of the cache of decisions with the result
+func IncrementDecisionCacheRequests(cache, result string) {
+	decisionCacheRequests.With(filterLabels(prometheus.Labels{
+		cacheLabel:  cache,
+		resultLabel: result,
+	})).Inc()
+}
+
+// IncrementDecisionCacheEvictions increments entries of the cache of decisions evicted since the shared limit was reached
+func IncrementDecisionCacheEvictions(cache string) {
+	decisionCacheEvictions.With(filterLabels(prometheus.Labels{
+		cacheLabel: cache,
+	})).Inc()
+}
+
+// IncrementMaintenanceFailPolicy increments requests to the service which had the maintenance fail policy applied
+func IncrementMaintenanceFailPolicy(serviceID string) {
+	maintenanceFailPolicy.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementSystemFetches increments calls to 3scale system fetching the configuration of services in the mode
+func IncrementSystemFetches(mode string) {
+	systemFetches.With(filterLabels(prometheus.Labels{
+		modeLabel: mode,
+	})).Inc()
+}
+
+// IncrementSoftLimitExceeded increments requests to the service allowed beyond the soft limit threshold
+func IncrementSoftLimitExceeded(serviceID string) {
+	softLimitExceeded.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// IncrementBackendProtocol increments responses from the host of 3scale received over the protocol
+func IncrementBackendProtocol(host, protocol string) {
+	backendProtocol.With(filterLabels(prometheus.Labels{
+		hostLabel:     host,
+		protocolLabel: protocol,
+	})).Inc()
+}
+
+// SetSyntheticCheck records the outcome and duration of the last synthetic check of the service
+func SetSyntheticCheck(serviceID string, success bool, duration time.Duration) {
+	labels := filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})
+
+	value := float64(0)
+	if success {
+		value = 1
+	}
+	syntheticCheckSuccess.With(labels).Set(value)
+	syntheticCheckDuration.With(labels).Set(duration.Seconds())
+}
+
+// IncrementConflictingCredentials increments requests rejected for presenting conflicting credentials
+func IncrementConflictingCredentials(serviceID string) {
+	conflictingCredentials.With(filterLabels(prometheus.Labels{
+		serviceIDLabel: guard.value(serviceIDLabel, serviceID),
+	})).Inc()
+}
+
+// SetDecisionCacheEntries sets the number of entries held by the caches of decisions combined
+func SetDecisionCacheEntries(entries int) {
+	decisionCacheEntries.Set(float64(entries))
+}
+
+// SetBackendCacheBytes sets the estimated size in bytes of the applications held by the backend cache
+func SetBackendCacheBytes(bytes int) {
+	backendCacheBytes.Set(float64(bytes))
+}
+
+// SetStandby sets whether the adapter is in standby
+func SetStandby(isStandby bool) {
+	if isStandby {
+		standby.Set(1)
+		return
+	}
+	standby.Set(0)
+}
+
+// SetMaintenance sets whether 3scale is considered to be under maintenance
+func SetMaintenance(active bool) {
+	if active {
+		maintenance.Set(1)
+		return
+	}
+	maintenance.Set(0)
+}
+
+// SetStartTime sets the start time of the adapter process
+func SetStartTime(t time.Time) {
+	startTime.Set(float64(t.UnixNano()) / 1e9)
+}
+
+// IncrementShutdowns increments the number of graceful shutdowns started
+func IncrementShutdowns() {
+	shutdowns.Inc()
+}
+
+// IncrementCacheHits increments proxy configurations that have been read from the cache
+func IncrementCacheHits(cache authorizer.Cache) {
+	if cache == authorizer.System {
+		cacheHitsSystem.Inc()
+		return
+	}
+	cacheHitsBackend.Inc()
+}
+
+// Register configures the collectors as per the provided options and registers them with Prometheus.
+// Register may be called more than once, in which case any identical collectors which have already been
+// registered are reused. An error is returned if a collector conflicts with one which has already been registered.
+func Register(opts Options) error {
+	if err := ValidateBuckets(opts.LatencyBuckets); err != nil {
+		return err
+	}
+	configure(opts)
+
+	var err error
+	if threescaleLatency, err = registerHistogramVec(threescaleLatency); err != nil {
+		return err
+	}
+	if threescaleHTTP, err = registerCounterVec(threescaleHTTP); err != nil {
+		return err
+	}
+	if requestsTotal, err = registerCounterVec(requestsTotal); err != nil {
+		return err
+	}
+	if requestDuration, err = registerHistogramVec(requestDuration); err != nil {
+		return err
+	}
+	if unknownServices, err = registerCounterVec(unknownServices); err != nil {
+		return err
+	}
+	if slowChecks, err = registerCounterVec(slowChecks); err != nil {
+		return err
+	}
+	if missingCredentials, err = registerCounterVec(missingCredentials); err != nil {
+		return err
+	}
+	if negativeCacheHits, err = registerCounterVec(negativeCacheHits); err != nil {
+		return err
+	}
+	if attributeErrors, err = registerCounterVec(attributeErrors); err != nil {
+		return err
+	}
+	if unexpectedBackendStatus, err = registerCounterVec(unexpectedBackendStatus); err != nil {
+		return err
+	}
+	if unservedServices, err = registerCounterVec(unservedServices); err != nil {
+		return err
+	}
+	if localRateLimited, err = registerCounterVec(localRateLimited); err != nil {
+		return err
+	}
+	if configVersionChanges, err = registerCounterVec(configVersionChanges); err != nil {
+		return err
+	}
+	if circuitTransitions, err = registerCounterVec(circuitTransitions); err != nil {
+		return err
+	}
+	if circuitProbeInterval, err = registerGauge(circuitProbeInterval); err != nil {
+		return err
+	}
+	if systemFetchesCoalesced, err = registerCounterVec(systemFetchesCoalesced); err != nil {
+		return err
+	}
+	if authorizesCoalesced, err = registerCounterVec(authorizesCoalesced); err != nil {
+		return err
+	}
+	if missingUsageData, err = registerCounterVec(missingUsageData); err != nil {
+		return err
+	}
+	if mappingRuleEvaluation, err = registerHistogramVec(mappingRuleEvaluation); err != nil {
+		return err
+	}
+	if credentialSources, err = registerCounterVec(credentialSources); err != nil {
+		return err
+	}
+	if deletedServices, err = registerCounterVec(deletedServices); err != nil {
+		return err
+	}
+	if requestsByMetric, err = registerCounterVec(requestsByMetric); err != nil {
+		return err
+	}
+	if lastKnownDecisions, err = registerCounterVec(lastKnownDecisions); err != nil {
+		return err
+	}
+	if backendDuration, err = registerHistogramVec(backendDuration); err != nil {
+		return err
+	}
+	if staleConfigDenied, err = registerCounterVec(staleConfigDenied); err != nil {
+		return err
+	}
+	if serviceInflight, err = registerGaugeVec(serviceInflight); err != nil {
+		return err
+	}
+	if misconfiguredServices, err = registerCounterVec(misconfiguredServices); err != nil {
+		return err
+	}
+	if refreshQueueWait, err = registerHistogramVec(refreshQueueWait); err != nil {
+		return err
+	}
+	if appQuotaUtilization, err = registerGaugeVec(appQuotaUtilization); err != nil {
+		return err
+	}
+	if serviceConfigVersion, err = registerGaugeVec(serviceConfigVersion); err != nil {
+		return err
+	}
+	if adapterOverhead, err = registerHistogramVec(adapterOverhead); err != nil {
+		return err
+	}
+	if decisionCacheRequests, err = registerCounterVec(decisionCacheRequests); err != nil {
+		return err
+	}
+	if decisionCacheEvictions, err = registerCounterVec(decisionCacheEvictions); err != nil {
+		return err
+	}
+	if maintenanceFailPolicy, err = registerCounterVec(maintenanceFailPolicy); err != nil {
+		return err
+	}
+	if systemFetches, err = registerCounterVec(systemFetches); err != nil {
+		return err
+	}
+	if softLimitExceeded, err = registerCounterVec(softLimitExceeded); err != nil {
+		return err
+	}
+	if backendProtocol, err = registerCounterVec(backendProtocol); err != nil {
+		return err
+	}
+	if syntheticCheckSuccess, err = registerGaugeVec(syntheticCheckSuccess); err != nil {
+		return err
+	}
+	if syntheticCheckDuration, err = registerGaugeVec(syntheticCheckDuration); err != nil {
+		return err
+	}
+	if conflictingCredentials, err = registerCounterVec(conflictingCredentials); err != nil {
+		return err
+	}
+	if backendInflight, err = registerGauge(backendInflight); err != nil {
+		return err
+	}
+	if backendRejections, err = registerCounter(backendRejections); err != nil {
+		return err
+	}
+	if backendResponseTooLarge, err = registerCounter(backendResponseTooLarge); err != nil {
+		return err
+	}
+	if reportQueueDepth, err = registerGauge(reportQueueDepth); err != nil {
+		return err
+	}
+	if reportsDropped, err = registerCounter(reportsDropped); err != nil {
+		return err
+	}
+	if reportsDroppedOldest, err = registerCounter(reportsDroppedOldest); err != nil {
+		return err
+	}
+	if reportsBlocked, err = registerCounter(reportsBlocked); err != nil {
+		return err
+	}
+	if reportTimestampRejected, err = registerCounter(reportTimestampRejected); err != nil {
+		return err
+	}
+	if backendClockSkew, err = registerGauge(backendClockSkew); err != nil {
+		return err
+	}
+	if retryBudgetExhausted, err = registerCounter(retryBudgetExhausted); err != nil {
+		return err
+	}
+	if loadShed, err = registerCounter(loadShed); err != nil {
+		return err
+	}
+	if loadShedProbability, err = registerGauge(loadShedProbability); err != nil {
+		return err
+	}
+	if handlerActive, err = registerGauge(handlerActive); err != nil {
+		return err
+	}
+	if handlerQueueDepth, err = registerGauge(handlerQueueDepth); err != nil {
+		return err
+	}
+	if handlerRejected, err = registerCounter(handlerRejected); err != nil {
+		return err
+	}
+	if missingServiceID, err = registerCounter(missingServiceID); err != nil {
+		return err
+	}
+	if auditDropped, err = registerCounter(auditDropped); err != nil {
+		return err
+	}
+	if decisionTracesDropped, err = registerCounter(decisionTracesDropped); err != nil {
+		return err
+	}
+	if backendCacheEntries, err = registerGauge(backendCacheEntries); err != nil {
+		return err
+	}
+	if backendCacheBytes, err = registerGauge(backendCacheBytes); err != nil {
+		return err
+	}
+	if decisionCacheEntries, err = registerGauge(decisionCacheEntries); err != nil {
+		return err
+	}
+	if standby, err = registerGauge(standby); err != nil {
+		return err
+	}
+	if maintenance, err = registerGauge(maintenance); err != nil {
+		return err
+	}
+	if startTime, err = registerGauge(startTime); err != nil {
+		return err
+	}
+	if shutdowns, err = registerCounter(shutdowns); err != nil {
+		return err
+	}
+	if cacheHitsSystem, err = registerCounter(cacheHitsSystem); err != nil {
+		return err
+	}
+	if cacheHitsBackend, err = registerCounter(cacheHitsBackend); err != nil {
+		return err
+	}
+	return nil
+}
+
+// register registers the collector, returning the existing collector if an identical one has already been registered
+func register(c prometheus.Collector) (prometheus.Collector, error) {
+	if err := registerer.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func registerCounter(c prometheus.Counter) (prometheus.Counter, error) {
+	registered, err := register(c)
+	if err != nil {
+		return nil, err
+	}
+	return registered.(prometheus.Counter), nil
+}
+
+func registerGauge(g prometheus.Gauge) (prometheus.Gauge, error) {
+	registered, err := register(g)
+	if err != nil {
+		return nil, err
+	}
+	return registered.(prometheus.Gauge), nil
+}
+
+func registerCounterVec(c *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	registered, err := register(c)
+	if err != nil {
+		return nil, err
+	}
+	return registered.(*prometheus.CounterVec), nil
+}
+
+func registerGaugeVec(g *prometheus.GaugeVec) (*prometheus.GaugeVec, error) {
+	registered, err := register(g)
+	if err != nil {
+		return nil, err
+	}
+	return registered.(*prometheus.GaugeVec), nil
+}
+
+func registerHistogramVec(c *prometheus.HistogramVec) (*prometheus.HistogramVec, error) {
+	registered, err := register(c)
+	if err != nil {
+		return nil, err
+	}
+	return registered.(*prometheus.HistogramVec), nil
+}
+
+// ValidateBuckets returns an error unless each histogram bucket boundary is positive and greater than the previous
+func ValidateBuckets(buckets []float64) error {
+	for i, bound := range buckets {
+		if bound <= 0 {
+			return fmt.Errorf("invalid bucket boundary %v - must be positive", bound)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return fmt.Errorf("invalid bucket boundary %v - must be greater than the previous boundary %v", bound, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// configure (re)creates the labelled collectors, omitting any labels which have been disabled
+func configure(opts Options) {
+	disabledLabels = make(map[string]bool, len(opts.DisabledLabels))
+	for _, label := range opts.DisabledLabels {
+		disabledLabels[label] = true
+	}
+
+	planOf = opts.PlanOf
+	if planOf == nil {
+		disabledLabels[planLabel] = true
+	}
+
+	registerer = prometheus.DefaultRegisterer
+	if len(opts.ConstLabels) > 0 {
+		registerer = prometheus.WrapRegistererWith(opts.ConstLabels, prometheus.DefaultRegisterer)
+	}
+
+	guard = newCardinalityGuard(opts.MaxLabelValues)
+	requestsByMetricEnabled = opts.RequestsByMetric
+	appQuotaEnabled = opts.AppQuotaUtilization
+	appQuotaThreshold = opts.AppQuotaThreshold
+
+	latencyBucket = threescaleBucket
+	if len(opts.LatencyBuckets) > 0 {
+		latencyBucket = opts.LatencyBuckets
+	}
+
+	threescaleLatency = newThreescaleLatency()
+	threescaleHTTP = newThreescaleHTTP()
+	requestsTotal = newRequestsTotal()
+	requestDuration = newRequestDuration()
+	unknownServices = newUnknownServices()
+	slowChecks = newSlowChecks()
+	missingCredentials = newMissingCredentials()
+	negativeCacheHits = newNegativeCacheHits()
+	attributeErrors = newAttributeErrors()
+	unexpectedBackendStatus = newUnexpectedBackendStatus()
+	unservedServices = newUnservedServices()
+	localRateLimited = newLocalRateLimited()
+	configVersionChanges = newConfigVersionChanges()
+	circuitTransitions = newCircuitTransitions()
+	systemFetchesCoalesced = newSystemFetchesCoalesced()
+	authorizesCoalesced = newAuthorizesCoalesced()
+	missingUsageData = newMissingUsageData()
+	mappingRuleEvaluation = newMappingRuleEvaluation()
+	credentialSources = newCredentialSources()
+	deletedServices = newDeletedServices()
+	requestsByMetric = newRequestsByMetric()
+	lastKnownDecisions = newLastKnownDecisions()
+	backendDuration = newBackendDuration()
+	staleConfigDenied = newStaleConfigDenied()
+	serviceInflight = newServiceInflight()
+	misconfiguredServices = newMisconfiguredServices()
+	refreshQueueWait = newRefreshQueueWait()
+	appQuotaUtilization = newAppQuotaUtilization()
+	serviceConfigVersion = newServiceConfigVersion()
+	adapterOverhead = newAdapterOverhead()
+	decisionCacheRequests = newDecisionCacheRequests()
+	decisionCacheEvictions = newDecisionCacheEvictions()
+	maintenanceFailPolicy = newMaintenanceFailPolicy()
+	systemFetches = newSystemFetches()
+	softLimitExceeded = newSoftLimitExceeded()
+	backendProtocol = newBackendProtocol()
+	syntheticCheckSuccess = newSyntheticCheckSuccess()
+	syntheticCheckDuration = newSyntheticCheckDuration()
+	conflictingCredentials = newConflictingCredentials()
 }
 
 func GetHandler() http.Handler {
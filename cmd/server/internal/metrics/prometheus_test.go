@@ -2,11 +2,15 @@ package metrics
 
 import (
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -14,8 +18,47 @@ const url = "www.fake.com"
 const endpoint = "/test"
 
 func TestRegister(t *testing.T) {
-	Register()
-	// test that registration does not panic
+	if err := Register(Options{}); err != nil {
+		t.Fatalf("unexpected error registering collectors - %v", err)
+	}
+
+	// test that registration is idempotent
+	if err := Register(Options{}); err != nil {
+		t.Errorf("unexpected error registering collectors a second time - %v", err)
+	}
+
+	opts := Options{ConstLabels: map[string]string{InstanceLabel: "canary"}}
+	if err := Register(opts); err != nil {
+		t.Errorf("unexpected error registering collectors with constant labels - %v", err)
+	}
+	defer configure(Options{})
+
+	if registerer == prometheus.DefaultRegisterer {
+		t.Errorf("expected constant labels to be added by the registerer")
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	for _, buckets := range [][]float64{{0, .01}, {-.01}, {.01, .005}, {.01, .01}} {
+		if err := Register(Options{LatencyBuckets: buckets}); err == nil {
+			t.Errorf("expected error registering collectors with latency buckets %v", buckets)
+		}
+	}
+
+	buckets := []float64{.005, .01, .025}
+	if err := Register(Options{LatencyBuckets: buckets}); err != nil {
+		t.Fatalf("unexpected error registering collectors with latency buckets - %v", err)
+	}
+	defer configure(Options{})
+
+	if !reflect.DeepEqual(latencyBucket, buckets) {
+		t.Errorf("expected latency buckets %v, got %v", buckets, latencyBucket)
+	}
+
+	configure(Options{})
+	if !reflect.DeepEqual(latencyBucket, threescaleBucket) {
+		t.Errorf("expected default latency buckets once no longer overridden, got %v", latencyBucket)
+	}
 }
 
 func TestReportCB(t *testing.T) {
@@ -56,6 +99,129 @@ func TestReportCB(t *testing.T) {
 	}
 }
 
+func TestDisabledLabels(t *testing.T) {
+	const metricName = "threescale_http_total"
+	const expect = `
+                # HELP threescale_http_total HTTP Status response codes for requests to 3scale backend
+                # TYPE threescale_http_total counter
+                threescale_http_total{method="GET",status="200"} 1
+        `
+	configure(Options{DisabledLabels: []string{hostLabel, endpointLabel}})
+	defer configure(Options{})
+
+	tr := authorizer.TelemetryReport{
+		Host:      url,
+		Method:    http.MethodGet,
+		Endpoint:  endpoint,
+		Code:      http.StatusOK,
+		TimeTaken: time.Millisecond,
+	}
+	ReportCB(tr)
+	err := testutil.CollectAndCompare(threescaleHTTP, strings.NewReader(expect), metricName)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestReportRequest(t *testing.T) {
+	configure(Options{MaxLabelValues: 1})
+	defer configure(Options{})
+
+	for _, svc := range []string{"123", "456", "789"} {
+		ReportRequest(threescale.RequestReport{
+			ServiceID: svc,
+			Code:      rpc.OK,
+			TimeTaken: time.Millisecond,
+		})
+	}
+
+	if v := testutil.ToFloat64(requestsTotal.WithLabelValues("123", "OK")); v != 1 {
+		t.Errorf("unexpected request count %v for first service", v)
+	}
+
+	if v := testutil.ToFloat64(requestsTotal.WithLabelValues(otherLabelValue, "OK")); v != 2 {
+		t.Errorf("expected services beyond the cardinality limit to be recorded as %s, got %v", otherLabelValue, v)
+	}
+}
+
+func TestReportRequestByPlan(t *testing.T) {
+	plans := map[string]string{"a": "basic", "b": "pro", "c": "enterprise"}
+	configure(Options{MaxLabelValues: 2, PlanOf: func(serviceID, app string) string {
+		return plans[app]
+	}})
+	defer configure(Options{})
+
+	for _, app := range []string{"a", "a", "b", "c", "d"} {
+		ReportRequest(threescale.RequestReport{
+			ServiceID: "123",
+			App:       app,
+			Code:      rpc.OK,
+			TimeTaken: time.Millisecond,
+		})
+	}
+
+	for plan, expect := range map[string]float64{"basic": 2, "pro": 1, otherLabelValue: 1, unknownPlanLabelValue: 1} {
+		if v := testutil.ToFloat64(requestsTotal.WithLabelValues("123", plan, "OK")); v != expect {
+			t.Errorf("unexpected request count %v for plan %s", v, plan)
+		}
+	}
+}
+
+func TestReportRequestByMetric(t *testing.T) {
+	report := threescale.RequestReport{
+		ServiceID: "123",
+		Metrics:   []string{"hits", "reads", "writes"},
+		Code:      rpc.OK,
+		TimeTaken: time.Millisecond,
+	}
+
+	configure(Options{})
+	ReportRequest(report)
+	if v := testutil.ToFloat64(requestsByMetric.WithLabelValues("123", "hits", "OK")); v != 0 {
+		t.Errorf("expected requests not to be counted by metric unless enabled, got %v", v)
+	}
+
+	configure(Options{MaxLabelValues: 2, RequestsByMetric: true})
+	defer configure(Options{})
+
+	ReportRequest(report)
+	for metric, expect := range map[string]float64{"hits": 1, "reads": 1, otherLabelValue: 1} {
+		if v := testutil.ToFloat64(requestsByMetric.WithLabelValues("123", metric, "OK")); v != expect {
+			t.Errorf("unexpected request count %v for metric %s", v, metric)
+		}
+	}
+}
+
+func TestSetAppQuotaUtilization(t *testing.T) {
+	configure(Options{})
+	SetAppQuotaUtilization("123", "a", 0.9)
+	if appQuotaUtilization.DeleteLabelValues("123", "a") {
+		t.Errorf("expected app quota utilization not to be reported unless enabled")
+	}
+
+	configure(Options{MaxLabelValues: 2, AppQuotaUtilization: true, AppQuotaThreshold: 0.8})
+	defer configure(Options{})
+
+	SetAppQuotaUtilization("123", "a", 0.9)
+	SetAppQuotaUtilization("123", "b", 0.5)
+	SetAppQuotaUtilization("123", "c", 0.95)
+	SetAppQuotaUtilization("123", "d", 0.85)
+
+	if v := testutil.ToFloat64(appQuotaUtilization.WithLabelValues("123", "a")); v != 0.9 {
+		t.Errorf("unexpected utilization %v for app above the threshold", v)
+	}
+	for _, app := range []string{"b", otherLabelValue} {
+		if appQuotaUtilization.DeleteLabelValues("123", app) {
+			t.Errorf("expected app %s not to be reported", app)
+		}
+	}
+
+	SetAppQuotaUtilization("123", "a", 0.1)
+	if appQuotaUtilization.DeleteLabelValues("123", "a") {
+		t.Errorf("expected app which fell below the threshold to no longer be reported")
+	}
+}
+
 func TestIncrementCacheHits(t *testing.T) {
 	sysCollector := cacheHitsSystem
 	if testutil.ToFloat64(sysCollector) != 0 {
@@ -77,3 +243,17 @@ func TestIncrementCacheHits(t *testing.T) {
 		t.Errorf("unexpected counter value for %s", backendCollector.Desc().String())
 	}
 }
+
+func TestStartAndShutdown(t *testing.T) {
+	start := time.Unix(1500000000, 500000000)
+	SetStartTime(start)
+	if v := testutil.ToFloat64(startTime); v != 1500000000.5 {
+		t.Errorf("unexpected start time %v", v)
+	}
+
+	before := testutil.ToFloat64(shutdowns)
+	IncrementShutdowns()
+	if v := testutil.ToFloat64(shutdowns); v != before+1 {
+		t.Errorf("expected shutdowns to be incremented, got %v", v)
+	}
+}
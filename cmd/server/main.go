@@ -1,20 +1,25 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"fmt"
+	"encoding/json"
+	"flag"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/3scale/3scale-authorizer/pkg/authorizer"
 	"github.com/3scale/3scale-authorizer/pkg/backend/v1"
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/admin"
 	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
 	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
 	"github.com/spf13/viper"
@@ -26,6 +31,30 @@ import (
 
 var version string
 
+// startTime is the time at which the process started
+var startTime = time.Now()
+
+// cacheFreshness tracks the age of the system configuration when deep health checks are enabled
+var cacheFreshness = &admin.CacheFreshness{}
+
+// backendConnWarmup gates readiness until connections to 3scale backend are warmed, when backend_warmup_connections is set
+var backendConnWarmup = &backendWarmup{
+	readinessGate: readinessGate{reason: "connections to 3scale backend are warming up"},
+}
+
+// serviceFreshness tracks the age of the configuration of each service when max_stale_serve_seconds is set
+var serviceFreshness = &admin.ServiceFreshness{}
+
+// refreshTraffic tracks the traffic to each service when cache_refresh_concurrency is set, so that fetches of
+// configuration may be prioritized
+var refreshTraffic *serviceTraffic
+
+// refreshErrors retains recent errors fetching configuration from 3scale system when the debug cache endpoint is enabled
+var refreshErrors = admin.NewRefreshErrors(0)
+
+// configVersions retains the version of the configuration last fetched for each service when the debug cache endpoint is enabled
+var configVersions = admin.NewConfigVersions()
+
 const (
 	defaultListenAddr = "3333"
 
@@ -34,12 +63,49 @@ const (
 	defaultSystemCacheRefreshIntervalSeconds = 180
 	defaultSystemCacheSize                   = 1000
 
-	defaultMetricsEndpoint = "/metrics"
-	defaultMetricsPort     = 8080
+	defaultMetricsEndpoint       = "/metrics"
+	defaultMetricsPort           = 8080
+	defaultMetricsMaxLabelValues = 100
 
 	defaultBackendCacheFlushInterval = time.Second * 15
+
+	defaultClientDialTimeout = time.Second * 30
+
+	defaultGRPCConnMaxGrace = time.Second * 10
+
+	defaultWarmupConcurrency = 4
+	defaultWarmupTimeout     = time.Second * 30
+
+	defaultBackendWarmupTimeout = time.Second * 10
+
+	defaultReportQueueSize = 1000
+	defaultAuditBufferSize = 1000
+
+	defaultDecisionTraceBufferSize = 1000
+
+	defaultRetryBudgetRatio = 0.1
+
+	defaultBulkSystemFetchInterval = time.Millisecond * 50
+
+	defaultSyntheticCheckInterval = time.Second * 60
+	defaultSyntheticCheckMethod   = "GET"
+	defaultSyntheticCheckPath     = "/"
+
+	defaultAdminPort                       = 8090
+	defaultHealthEndpoint                  = "/healthz"
+	defaultHealthStalenessThresholdSeconds = 600
+	defaultAdminShutdownTimeout            = time.Second * 5
+	defaultDebugConfigEndpoint             = "/debug/config"
+	defaultDebugCacheEndpoint              = "/debug/cache"
+	defaultDebugUsageEndpoint              = "/debug/usage"
+	defaultRefreshErrorHistorySize         = 10
+	defaultPromoteEndpoint                 = "/promote"
+	defaultMaintenanceEndpoint             = "/maintenance"
 )
 
+// secretKeyFragments identify configuration keys whose values must never be exposed
+var secretKeyFragments = []string{"key", "token", "password", "secret", "headers"}
+
 func init() {
 	viper.BindEnv("log_level")
 	viper.BindEnv("log_json")
@@ -47,22 +113,155 @@ func init() {
 	viper.BindEnv("listen_addr")
 	viper.BindEnv("report_metrics")
 	viper.BindEnv("metrics_port")
+	viper.BindEnv("metrics_disabled_labels")
+	viper.BindEnv("metrics_requests_by_metric")
+	viper.BindEnv("metrics_plan_label")
+	viper.BindEnv("metrics_app_quota_utilization")
+	viper.BindEnv("metrics_app_quota_threshold")
+	viper.BindEnv("metrics_latency_buckets")
+	viper.BindEnv("metrics_config_version")
+	viper.BindEnv("metrics_max_label_values")
+	viper.BindEnv("metrics_shutdown_grace_seconds")
 
 	viper.BindEnv("cache_ttl_seconds")
 	viper.BindEnv("cache_refresh_seconds")
+	viper.BindEnv("cache_refresh_concurrency")
+	viper.BindEnv("cache_refresh_priority")
 	viper.BindEnv("cache_entries_max")
+	viper.BindEnv("tenant_cache_budgets")
 
 	viper.BindEnv("client_timeout_seconds")
 	viper.BindEnv("allow_insecure_conn")
 	viper.BindEnv("root_ca")
+	viper.BindEnv("insecure_skip_verify_hosts")
+	viper.BindEnv("backend_tls_server_name")
 	viper.BindEnv("client_cert")
 	viper.BindEnv("client_key")
+	viper.BindEnv("client_certs_by_host")
+	viper.BindEnv("backend_extra_headers")
+	viper.BindEnv("backend_tcp_keepalive_seconds")
+	viper.BindEnv("backend_dns_negative_ttl_seconds")
+	viper.BindEnv("backend_max_response_bytes")
 
 	viper.BindEnv("grpc_conn_max_seconds")
+	viper.BindEnv("grpc_conn_max_grace_seconds")
+	viper.BindEnv("grpc_reflection")
+	viper.BindEnv("grpc_channelz")
+	viper.BindEnv("grpc_api_key")
+	viper.BindEnv("deny_response_template")
+	viper.BindEnv("check_max_total_latency_ms")
+	viper.BindEnv("check_max_timeout_override_ms")
+	viper.BindEnv("slow_check_threshold_ms")
+	viper.BindEnv("overhead_log_threshold_ms")
+
+	viper.BindEnv("admin_port")
+	viper.BindEnv("health_deep_check")
+	viper.BindEnv("health_staleness_threshold_seconds")
+	viper.BindEnv("debug_config_endpoint")
+	viper.BindEnv("debug_cache_endpoint")
+	viper.BindEnv("debug_usage_endpoint")
+	viper.BindEnv("admin_auth_token")
+	viper.BindEnv("refresh_error_history_size")
 
 	viper.BindEnv("use_cached_backend")
 	viper.BindEnv("backend_cache_flush_interval_seconds")
 	viper.BindEnv("backend_cache_policy_fail_closed")
+	viper.BindEnv("fail_policy_by_method")
+	viper.BindEnv("fail_policy_by_metric")
+	viper.BindEnv("soft_limit_threshold")
+	viper.BindEnv("soft_limit_log")
+	viper.BindEnv("auth_mode")
+	viper.BindEnv("backend_max_inflight")
+	viper.BindEnv("per_service_max_inflight")
+	viper.BindEnv("per_service_max_inflight_overrides")
+	viper.BindEnv("backend_overflow_policy")
+	viper.BindEnv("report_mode")
+	viper.BindEnv("report_queue_size")
+	viper.BindEnv("report_timestamps")
+	viper.BindEnv("report_time_offset_seconds")
+	viper.BindEnv("report_persist_path")
+	viper.BindEnv("report_buffer_max")
+	viper.BindEnv("report_overflow_policy")
+	viper.BindEnv("report_denied_requests")
+	viper.BindEnv("authorize_singleflight")
+	viper.BindEnv("local_mapping_rules")
+	viper.BindEnv("local_mapping_rules_mode")
+	viper.BindEnv("multi_match_policy")
+	viper.BindEnv("credential_log_mode")
+	viper.BindEnv("default_metric_name")
+	viper.BindEnv("max_mapping_rule_evaluations")
+	viper.BindEnv("trust_xff")
+	viper.BindEnv("trusted_proxies")
+	viper.BindEnv("negative_cache_ttl_seconds")
+	viper.BindEnv("last_known_decision_ttl_seconds")
+	viper.BindEnv("max_decision_cache_entries")
+	viper.BindEnv("debug_service_ids")
+	viper.BindEnv("path_match_normalize")
+	viper.BindEnv("warmup_system_url")
+	viper.BindEnv("warmup_service_ids")
+	viper.BindEnv("warmup_concurrency")
+	viper.BindEnv("warmup_timeout_seconds")
+	viper.BindEnv("startup_delay_seconds")
+	viper.BindEnv("startup_check_urls")
+	viper.BindEnv("backend_warmup_connections")
+	viper.BindEnv("backend_warmup_url")
+	viper.BindEnv("backend_warmup_timeout_seconds")
+	viper.BindEnv("system_access_token_file")
+	viper.BindEnv("system_access_token_file_watch_seconds")
+	viper.BindEnv("check_valid_duration_ms")
+	viper.BindEnv("check_valid_use_count")
+	viper.BindEnv("served_service_ids")
+	viper.BindEnv("audit_sink")
+	viper.BindEnv("audit_buffer_size")
+	viper.BindEnv("decision_trace_sample_rate")
+	viper.BindEnv("decision_trace_sink")
+	viper.BindEnv("decision_trace_buffer_size")
+	viper.BindEnv("audit_kafka_brokers")
+	viper.BindEnv("audit_kafka_topic")
+	viper.BindEnv("local_rate_limit_rps")
+	viper.BindEnv("local_rate_limit_burst")
+	viper.BindEnv("local_rate_limit_per_service")
+	viper.BindEnv("backend_cache_max_entries")
+	viper.BindEnv("backend_cache_max_bytes")
+	viper.BindEnv("metrics_instance_label")
+	viper.BindEnv("backend_tls_session_cache")
+	viper.BindEnv("backend_tls_session_cache_size")
+	viper.BindEnv("tls_renegotiation")
+	viper.BindEnv("standby")
+	viper.BindEnv("maintenance_mode")
+	viper.BindEnv("maintenance_fail_policy")
+	viper.BindEnv("use_bulk_system_fetch")
+	viper.BindEnv("backend_http2_hosts")
+	viper.BindEnv("synthetic_check_service_id")
+	viper.BindEnv("synthetic_check_system_url")
+	viper.BindEnv("synthetic_check_access_token")
+	viper.BindEnv("synthetic_check_user_key")
+	viper.BindEnv("synthetic_check_app_id")
+	viper.BindEnv("synthetic_check_app_key")
+	viper.BindEnv("synthetic_check_method")
+	viper.BindEnv("synthetic_check_path")
+	viper.BindEnv("synthetic_check_interval_seconds")
+	viper.BindEnv("bulk_system_fetch_interval_ms")
+	viper.BindEnv("max_stale_serve_seconds")
+	viper.BindEnv("cb_failure_threshold")
+	viper.BindEnv("backend_retries")
+	viper.BindEnv("retry_budget_ratio")
+	viper.BindEnv("load_shed_enabled")
+	viper.BindEnv("load_shed_max_inflight")
+	viper.BindEnv("load_shed_max_latency_ms")
+	viper.BindEnv("max_handler_goroutines")
+	viper.BindEnv("handler_queue_size")
+	viper.BindEnv("cb_probe_initial_ms")
+	viper.BindEnv("cb_probe_max_ms")
+	viper.BindEnv("unknown_service_policy")
+	viper.BindEnv("deleted_service_policy")
+	viper.BindEnv("internal_error_policy")
+	viper.BindEnv("credential_source")
+	viper.BindEnv("credential_source_chain")
+	viper.BindEnv("reject_conflicting_credentials")
+	viper.BindEnv("app_id_location")
+	viper.BindEnv("app_key_location")
+	viper.BindEnv("missing_credential_policy")
 
 	configureLogging()
 }
@@ -100,9 +299,11 @@ func stringToLogLevel(loglevel string) log.Level {
 	return log.InfoLevel
 }
 
-func parseMetricsConfig() *authorizer.MetricsReporter {
+// parseMetricsConfig registers the collectors and starts serving metrics if enabled.
+// The returned server is nil when metrics are disabled.
+func parseMetricsConfig() (*authorizer.MetricsReporter, *threescale.MetricsReporter, *admin.Server) {
 	if !viper.IsSet("report_metrics") || !viper.GetBool("report_metrics") {
-		return nil
+		return nil, nil, nil
 	}
 
 	port := defaultMetricsPort
@@ -110,20 +311,161 @@ func parseMetricsConfig() *authorizer.MetricsReporter {
 		port = viper.GetInt("metrics_port")
 	}
 
-	metrics.Register()
-	http.Handle(defaultMetricsEndpoint, metrics.GetHandler())
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	maxLabelValues := defaultMetricsMaxLabelValues
+	if viper.IsSet("metrics_max_label_values") {
+		maxLabelValues = viper.GetInt("metrics_max_label_values")
+	}
+
+	var planOf func(serviceID, app string) string
+	if viper.GetBool("metrics_plan_label") {
+		appPlanCache = newAppPlans(defaultMaxAppPlans)
+		planOf = appPlanCache.plan
+	}
+
+	err := metrics.Register(metrics.Options{
+		DisabledLabels:      getStringSlice("metrics_disabled_labels"),
+		MaxLabelValues:      maxLabelValues,
+		ConstLabels:         getMetricsConstLabels(),
+		RequestsByMetric:    viper.GetBool("metrics_requests_by_metric"),
+		AppQuotaUtilization: viper.GetBool("metrics_app_quota_utilization"),
+		AppQuotaThreshold:   getAppQuotaThreshold(),
+		LatencyBuckets:      getMetricsLatencyBuckets(),
+		PlanOf:              planOf,
+	})
 	if err != nil {
+		log.Fatalf("failed to register metrics %v", err)
+	}
+	metrics.SetStartTime(startTime)
+
+	server := admin.NewServer(port)
+	server.Handle(defaultMetricsEndpoint, metrics.GetHandler())
+	if err := server.Start(); err != nil {
 		log.Fatalf("failed to start metrics server %v", err)
 	}
-	go http.Serve(listener, nil)
 	log.Infof("Serving metrics on port %d", port)
 
-	return &authorizer.MetricsReporter{
+	authorizerMetrics := &authorizer.MetricsReporter{
 		ReportMetrics: true,
 		ResponseCB:    metrics.ReportCB,
 		CacheHitCB:    metrics.IncrementCacheHits,
 	}
+
+	adapterMetrics := &threescale.MetricsReporter{
+		RequestCB:                 metrics.ReportRequest,
+		UnknownServiceCB:          metrics.IncrementUnknownService,
+		SlowCheckCB:               metrics.IncrementSlowChecks,
+		MissingCredentialsCB:      metrics.IncrementMissingCredentials,
+		MissingServiceIDCB:        metrics.IncrementMissingServiceID,
+		BackendInflightCB:         metrics.SetBackendInflight,
+		BackendRejectedCB:         metrics.IncrementBackendRejections,
+		ReportQueueDepthCB:        metrics.SetReportQueueDepth,
+		ReportDroppedCB:           metrics.IncrementReportsDropped,
+		ReportDroppedOldestCB:     metrics.IncrementReportsDroppedOldest,
+		ReportBlockedCB:           metrics.IncrementReportsBlocked,
+		NegativeCacheHitCB:        metrics.IncrementNegativeCacheHits,
+		AttributeErrorCB:          metrics.IncrementAttributeErrors,
+		UnexpectedBackendStatusCB: metrics.IncrementUnexpectedBackendStatus,
+		UnservedServiceCB:         metrics.IncrementUnservedService,
+		AuditDroppedCB:            metrics.IncrementAuditDropped,
+		DecisionTraceDroppedCB:    metrics.IncrementDecisionTracesDropped,
+		StaleConfigDeniedCB:       metrics.IncrementStaleConfigDenied,
+		MisconfiguredServiceCB:    metrics.IncrementMisconfiguredService,
+		LoadShedCB:                metrics.IncrementLoadShed,
+		LoadShedProbabilityCB:     metrics.SetLoadShedProbability,
+		HandlerActiveCB:           metrics.SetHandlerActive,
+		HandlerQueueDepthCB:       metrics.SetHandlerQueueDepth,
+		HandlerRejectedCB:         metrics.IncrementHandlerRejected,
+		ServiceInflightCB:         metrics.AddServiceInflight,
+		LocalRateLimitedCB:        metrics.IncrementLocalRateLimited,
+		ConfigVersionChangeCB:     metrics.IncrementConfigVersionChanges,
+		BackendCacheEntriesCB:     metrics.SetBackendCacheEntries,
+		BackendCacheBytesCB:       metrics.SetBackendCacheBytes,
+		StandbyCB:                 metrics.SetStandby,
+		MaintenanceCB:             metrics.SetMaintenance,
+		MaintenanceFailPolicyCB:   metrics.IncrementMaintenanceFailPolicy,
+		CircuitStateCB:            metrics.IncrementCircuitTransitions,
+		CircuitProbeIntervalCB:    metrics.SetCircuitProbeInterval,
+		SystemFetchCoalescedCB:    metrics.IncrementSystemFetchCoalesced,
+		AuthorizeCoalescedCB:      metrics.IncrementAuthorizeCoalesced,
+		MissingUsageDataCB:        metrics.IncrementMissingUsageData,
+		MappingRuleEvaluationCB:   metrics.ObserveMappingRuleEvaluation,
+		CredentialSourceCB:        metrics.IncrementCredentialSource,
+		DeletedServiceCB:          metrics.IncrementDeletedServices,
+		LastKnownDecisionCB:       metrics.IncrementLastKnownDecisions,
+		BackendDurationCB:         metrics.ObserveBackendDuration,
+		RetryBudgetExhaustedCB:    metrics.IncrementRetryBudgetExhausted,
+		AppQuotaUtilizationCB:     metrics.SetAppQuotaUtilization,
+		ReportTimestampRejectedCB: metrics.IncrementReportTimestampRejected,
+		BackendClockSkewCB:        metrics.SetBackendClockSkew,
+		AdapterOverheadCB:         metrics.ObserveAdapterOverhead,
+		DecisionCacheRequestCB:    metrics.IncrementDecisionCacheRequests,
+		DecisionCacheEvictedCB:    metrics.IncrementDecisionCacheEvictions,
+		DecisionCacheEntriesCB:    metrics.SetDecisionCacheEntries,
+		SoftLimitExceededCB:       metrics.IncrementSoftLimitExceeded,
+		SyntheticCheckCB:          metrics.SetSyntheticCheck,
+		ConflictingCredentialsCB:  metrics.IncrementConflictingCredentials,
+	}
+
+	return authorizerMetrics, adapterMetrics, server
+}
+
+// getMetricsConstLabels returns the labels added with a fixed value to every collector
+func getMetricsConstLabels() map[string]string {
+	labels := make(map[string]string)
+	if instance := viper.GetString("metrics_instance_label"); instance != "" {
+		labels[metrics.InstanceLabel] = instance
+	}
+	return labels
+}
+
+// getAppQuotaThreshold returns the utilization below which applications are not reported by the app quota metric
+func getAppQuotaThreshold() float64 {
+	threshold := viper.GetFloat64("metrics_app_quota_threshold")
+	if threshold < 0 || threshold > 1 {
+		log.Fatalf("invalid app quota threshold %v - must be between 0 and 1", threshold)
+	}
+	return threshold
+}
+
+// getMetricsLatencyBuckets returns the bucket boundaries, in seconds, configured for the latency histograms, if any
+func getMetricsLatencyBuckets() []float64 {
+	var buckets []float64
+	for _, value := range getStringSlice("metrics_latency_buckets") {
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("invalid metrics latency bucket %q - must be a number of seconds", value)
+		}
+		buckets = append(buckets, bound)
+	}
+
+	if err := metrics.ValidateBuckets(buckets); err != nil {
+		log.Fatalf("invalid metrics latency buckets - %v", err)
+	}
+	return buckets
+}
+
+// getStringSlice parses the comma separated list of values set for the provided key
+func getStringSlice(key string) []string {
+	var values []string
+	for _, value := range strings.Split(viper.GetString(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getStringMap parses the comma separated list of key=value pairs set for the provided key
+func getStringMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getStringSlice(key) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			log.Fatalf("invalid value for %s - expected a list of key=value pairs", key)
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return values
 }
 
 func parseClientConfig() *http.Client {
@@ -138,6 +480,8 @@ func parseClientConfig() *http.Client {
 
 	tlsConfig := tls.Config{}
 	useTlsConfig := false
+	// hosts whose calls require settings of their own are each given a transport of their own
+	perHost := make(hostTransportOptions)
 
 	if viper.IsSet("allow_insecure_conn") {
 		tlsConfig.InsecureSkipVerify = viper.GetBool("allow_insecure_conn")
@@ -147,23 +491,23 @@ func parseClientConfig() *http.Client {
 	if viper.IsSet("root_ca") {
 		rootCAPath := viper.GetString("root_ca")
 		if rootCAPath != "" {
-			var pool, err = x509.SystemCertPool()
+			pool, err := rootCAs.get(rootCAPath)
 			if err != nil {
-				log.Errorf("failed to read system certificates %v, trying to read CA certs anyway", err)
-				pool = x509.NewCertPool()
+				log.Fatalf("%v", err)
 			}
+			tlsConfig.RootCAs = pool
+			useTlsConfig = true
+		}
+	}
 
-			pemCerts, err := ioutil.ReadFile(rootCAPath)
-			if err != nil {
-				log.Fatalf("failed to read root CA file %s - %v", rootCAPath, err)
-			} else {
-				if ok := pool.AppendCertsFromPEM(pemCerts); ok {
-					tlsConfig.RootCAs = pool
-					useTlsConfig = true
-				} else {
-					log.Fatalf("failed to parse root CA certificates %v", err)
-				}
+	if hosts := getStringSlice("insecure_skip_verify_hosts"); len(hosts) > 0 {
+		if tlsConfig.InsecureSkipVerify {
+			log.Warnf("insecure skip verify hosts are ignored since certificate verification is disabled for every host")
+		} else {
+			for _, host := range hosts {
+				perHost.add(host, skipVerify)
 			}
+			log.Warnf("certificate verification is disabled for calls to hosts %v", hosts)
 		}
 	}
 
@@ -187,43 +531,375 @@ func parseClientConfig() *http.Client {
 		}
 	}
 
+	if certsByHost := getClientCertsByHost(); len(certsByHost) > 0 {
+		// the certificates configured by host take precedence over the default certificate, which is used otherwise
+		for host, cert := range certsByHost {
+			perHost.add(host, withClientCert(cert))
+		}
+		log.Infof("client certificates configured for %d 3scale hosts", len(certsByHost))
+	}
+
+	if viper.GetBool("backend_tls_session_cache") {
+		// a non-positive capacity uses the default capacity
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(viper.GetInt("backend_tls_session_cache_size"))
+		useTlsConfig = true
+	}
+
+	if renegotiation := getTLSRenegotiation(); renegotiation != tls.RenegotiateNever {
+		tlsConfig.Renegotiation = renegotiation
+		useTlsConfig = true
+	}
+
+	if serverName := viper.GetString("backend_tls_server_name"); serverName != "" {
+		// applies to every connection made by the client, regardless of the address dialled
+		tlsConfig.ServerName = serverName
+		useTlsConfig = true
+		log.Infof("TLS server name for connections to 3scale set to %s", serverName)
+	}
+
+	var transport *http.Transport
 	if useTlsConfig {
-		transport := &http.Transport{
-			TLSClientConfig: &tlsConfig,
+		transport = newDefaultTransport()
+		transport.TLSClientConfig = &tlsConfig
+	}
+
+	if viper.IsSet("backend_tcp_keepalive_seconds") {
+		if transport == nil {
+			transport = newDefaultTransport()
+		}
+
+		keepAlive := time.Duration(viper.GetInt("backend_tcp_keepalive_seconds")) * time.Second
+		transport.DialContext = (&net.Dialer{
+			Timeout:   defaultClientDialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext
+		log.Infof("TCP keepalive period for connections to 3scale set to %s", keepAlive.String())
+	}
+
+	if connections := viper.GetInt("backend_warmup_connections"); connections > 0 {
+		if transport == nil {
+			transport = newDefaultTransport()
+		}
+
+		// warmed connections are only retained if the idle pool can hold them all
+		if transport.MaxIdleConnsPerHost < connections {
+			transport.MaxIdleConnsPerHost = connections
+		}
+	}
+
+	if ttl := viper.GetInt("backend_dns_negative_ttl_seconds"); ttl > 0 {
+		if transport == nil {
+			transport = newDefaultTransport()
+		}
+
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{
+				Timeout:   defaultClientDialTimeout,
+				KeepAlive: time.Second * 30,
+			}).DialContext
 		}
+
+		dnsCache := newNegativeDNSCache(time.Duration(ttl) * time.Second)
+		transport.DialContext = dnsCache.dialContext(dial)
+		log.Infof("failed DNS lookups of 3scale hosts cached for %s", dnsCache.ttl.String())
+	}
+
+	http2Hosts := getStringSlice("backend_http2_hosts")
+	if len(http2Hosts) > 0 {
+		if transport == nil {
+			transport = newDefaultTransport()
+		}
+
+		useHTTP1(transport)
+		for _, host := range http2Hosts {
+			perHost.add(host, useHTTP2)
+		}
+		log.Infof("using HTTP/2 for 3scale hosts %s and HTTP/1.1 for any other host", strings.Join(http2Hosts, ", "))
+	}
+
+	if transport != nil {
 		c.Transport = transport
 	}
 
+	if len(perHost) > 0 {
+		if transport == nil {
+			transport = newDefaultTransport()
+		}
+
+		hostTransport, err := newHostTransport(transport, perHost)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		c.Transport = hostTransport
+	}
+
+	if len(http2Hosts) > 0 {
+		c.Transport = protocolRecorder{next: c.Transport}
+	}
+
+	if maxBytes := viper.GetInt64("backend_max_response_bytes"); maxBytes > 0 {
+		c.Transport = responseLimitTransport{next: transportOrDefault(c.Transport), maxBytes: maxBytes}
+		log.Infof("responses from 3scale backend limited to %d bytes", maxBytes)
+	}
+
+	if headers := getStringMap("backend_extra_headers"); len(headers) > 0 {
+		transport := newHeaderTransport(transportOrDefault(c.Transport), headers)
+		log.Debugf("setting extra headers on requests to 3scale: %s", transport)
+		c.Transport = transport
+	}
+
+	if appPlanCache != nil {
+		c.Transport = planRecorder{next: transportOrDefault(c.Transport), plans: appPlanCache}
+	}
+
+	if viper.GetBool("use_bulk_system_fetch") {
+		interval := defaultBulkSystemFetchInterval
+		if viper.IsSet("bulk_system_fetch_interval_ms") {
+			interval = time.Duration(viper.GetInt("bulk_system_fetch_interval_ms")) * time.Millisecond
+		}
+
+		c.Transport = newBulkSystemFetcher(transportOrDefault(c.Transport), interval, c.Timeout)
+		log.Infof("coalescing fetches of configuration from 3scale system into bulk fetches every %s", interval)
+	}
+
+	if viper.GetBool("debug_cache_endpoint") {
+		size := defaultRefreshErrorHistorySize
+		if viper.IsSet("refresh_error_history_size") {
+			size = viper.GetInt("refresh_error_history_size")
+		}
+
+		refreshErrors = admin.NewRefreshErrors(size)
+		c.Transport = refreshErrorRecorder{next: transportOrDefault(c.Transport), errors: refreshErrors}
+	}
+
+	if viper.GetBool("debug_cache_endpoint") || viper.GetBool("metrics_config_version") {
+		recorder := configVersionRecorder{next: transportOrDefault(c.Transport), metric: viper.GetBool("metrics_config_version")}
+		if viper.GetBool("debug_cache_endpoint") {
+			recorder.versions = configVersions
+		}
+		c.Transport = recorder
+	}
+
+	if viper.GetBool("health_deep_check") {
+		c.Transport = refreshObserver{next: transportOrDefault(c.Transport), freshness: cacheFreshness}
+	}
+
+	if viper.GetInt("max_stale_serve_seconds") > 0 {
+		c.Transport = serviceRefreshObserver{next: transportOrDefault(c.Transport), freshness: serviceFreshness}
+	}
+
+	if concurrency := viper.GetInt("cache_refresh_concurrency"); concurrency > 0 {
+		refreshInterval := defaultSystemCacheRefreshIntervalSeconds
+		if viper.IsSet("cache_refresh_seconds") {
+			refreshInterval = viper.GetInt("cache_refresh_seconds")
+		}
+
+		refreshTraffic = newServiceTraffic(time.Duration(refreshInterval) * time.Second)
+		prioritize := viper.GetBool("cache_refresh_priority")
+		c.Transport = newRefreshScheduler(transportOrDefault(c.Transport), concurrency, refreshTraffic, prioritize)
+		log.Infof("fetching configuration from 3scale system with a concurrency of %d, prioritized by traffic: %v",
+			concurrency, prioritize)
+	} else if viper.GetBool("cache_refresh_priority") {
+		log.Warnf("cache refresh priority has no effect unless cache_refresh_concurrency is set")
+	}
+
 	return c
 }
 
-func createSystemCache() *authorizer.SystemCache {
-	cacheTTL := defaultSystemCacheTTLSeconds
-	cacheEntriesMax := defaultSystemCacheSize
-	cacheUpdateRetries := defaultSystemCacheRetries
-	cacheRefreshInterval := defaultSystemCacheRefreshIntervalSeconds
+func parseAdminConfig(standby *threescale.Standby, maintenance *threescale.Maintenance) *admin.Server {
+	if !adminEnabled() {
+		log.Debugf("no admin endpoints enabled, not serving admin endpoints")
+		return nil
+	}
+
+	port := defaultAdminPort
+	if viper.IsSet("admin_port") {
+		port = viper.GetInt("admin_port")
+	}
+
+	var checks []admin.HealthCheck
+	if viper.GetBool("health_deep_check") {
+		threshold := defaultHealthStalenessThresholdSeconds
+		if viper.IsSet("health_staleness_threshold_seconds") {
+			threshold = viper.GetInt("health_staleness_threshold_seconds")
+		}
+
+		checks = append(checks, cacheFreshness.Check(time.Duration(threshold)*time.Second))
+		log.Infof("deep health check enabled with system cache staleness threshold of %d seconds", threshold)
+	}
+
+	if viper.GetInt("startup_delay_seconds") > 0 {
+		checks = append(checks, startupGate.Check())
+	}
+
+	if viper.GetInt("backend_warmup_connections") > 0 && viper.GetString("backend_warmup_url") != "" {
+		checks = append(checks, backendConnWarmup.Check())
+	}
+
+	server := admin.NewServer(port)
+	server.Handle(defaultHealthEndpoint, admin.HealthHandler(checks...))
 
+	if viper.GetBool("debug_config_endpoint") {
+		server.Handle(defaultDebugConfigEndpoint, admin.JSONHandler(func() interface{} {
+			return effectiveConfig()
+		}))
+	}
+	if viper.GetBool("debug_cache_endpoint") {
+		server.Handle(defaultDebugCacheEndpoint, admin.JSONHandler(func() interface{} {
+			return map[string]interface{}{
+				"refresh_errors":  refreshErrors.Snapshot(),
+				"config_versions": configVersions.Snapshot(),
+			}
+		}))
+	}
+	// maintenance changes how every request is handled, so is never exposed unauthenticated
+	if token := viper.GetString("admin_auth_token"); token != "" {
+		server.Handle(defaultMaintenanceEndpoint, admin.TokenHandler(token,
+			admin.MaintenanceHandler(maintenance.IsActive, maintenance.Set)))
+	} else {
+		log.Infof("admin_auth_token is not set, %s is disabled", defaultMaintenanceEndpoint)
+	}
+
+	if standby.IsStandby() {
+		server.Handle(defaultPromoteEndpoint, promoteHandler(standby))
+		log.Infof("adapter is in standby, POST to %s to begin serving requests", defaultPromoteEndpoint)
+	}
+
+	if err := server.Start(); err != nil {
+		log.Fatalf("failed to start admin server %v", err)
+	}
+	log.Infof("Serving admin endpoints on port %d", port)
+
+	return server
+}
+
+// adminEnabled returns true if the admin server is to be started, either since admin_port has been set explicitly or
+// since a feature served on it has been enabled, so that the admin port is only opened when required
+func adminEnabled() bool {
+	return viper.IsSet("admin_port") ||
+		viper.GetBool("health_deep_check") ||
+		viper.GetInt("startup_delay_seconds") > 0 ||
+		viper.GetInt("backend_warmup_connections") > 0 && viper.GetString("backend_warmup_url") != "" ||
+		viper.GetBool("debug_config_endpoint") ||
+		viper.GetBool("debug_cache_endpoint") ||
+		viper.GetString("admin_auth_token") != "" ||
+		viper.GetBool("standby")
+}
+
+// promoteHandler promotes the adapter from standby for requests authenticated by the admin auth token
+func promoteHandler(standby *threescale.Standby) http.Handler {
+	return admin.TokenHandler(viper.GetString("admin_auth_token"), admin.PromoteHandler(standby.Promote))
+}
+
+// getStandby returns true if the adapter starts in standby. Promotion changes whether requests are served, so
+// requires an admin auth token
+func getStandby() bool {
+	standby := viper.GetBool("standby")
+	if standby && viper.GetString("admin_auth_token") == "" {
+		log.Fatalf("invalid standby %t - requires admin_auth_token to be set, so that promotion is authenticated", standby)
+	}
+	return standby
+}
+
+// effectiveConfig returns each configuration value which has been set, with secrets redacted
+func effectiveConfig() map[string]interface{} {
+	conf := make(map[string]interface{})
+	for _, key := range viper.AllKeys() {
+		if !viper.IsSet(key) {
+			continue
+		}
+
+		conf[key] = viper.Get(key)
+		for _, fragment := range secretKeyFragments {
+			if strings.Contains(key, fragment) {
+				conf[key] = redacted
+				break
+			}
+		}
+	}
+	return conf
+}
+
+func logEffectiveConfig() {
+	b, err := json.Marshal(effectiveConfig())
+	if err != nil {
+		log.Errorf("failed to encode effective configuration - %v", err)
+		return
+	}
+	log.Infof("effective configuration: %s", b)
+}
+
+// getSystemCacheTTL returns the duration for which configuration fetched from 3scale system is considered valid
+func getSystemCacheTTL() time.Duration {
+	cacheTTL := defaultSystemCacheTTLSeconds
 	if viper.IsSet("cache_ttl_seconds") {
 		cacheTTL = viper.GetInt("cache_ttl_seconds")
 	}
+	return time.Duration(cacheTTL) * time.Second
+}
+
+// getLoadShed parses the thresholds beyond which authorization requests are shed
+func getLoadShed() threescale.LoadShed {
+	loadShed := threescale.LoadShed{
+		Enabled:     viper.GetBool("load_shed_enabled"),
+		MaxInflight: viper.GetInt("load_shed_max_inflight"),
+		MaxLatency:  time.Duration(viper.GetInt("load_shed_max_latency_ms")) * time.Millisecond,
+	}
+
+	if loadShed.Enabled && loadShed.MaxInflight <= 0 && loadShed.MaxLatency <= 0 {
+		log.Warnf("load shedding is enabled but neither LOAD_SHED_MAX_INFLIGHT nor LOAD_SHED_MAX_LATENCY_MS is set, " +
+			"no requests will be shed")
+	}
+	return loadShed
+}
+
+// getMaxStaleServe parses the age beyond which the configuration of a service is too stale to serve requests
+func getMaxStaleServe() time.Duration {
+	maxStale := time.Duration(viper.GetInt("max_stale_serve_seconds")) * time.Second
+	if maxStale <= 0 {
+		return 0
+	}
 
+	refreshInterval := defaultSystemCacheRefreshIntervalSeconds
 	if viper.IsSet("cache_refresh_seconds") {
-		cacheRefreshInterval = viper.GetInt("cache_refresh_seconds")
+		refreshInterval = viper.GetInt("cache_refresh_seconds")
 	}
 
+	if maxStale <= time.Duration(refreshInterval)*time.Second {
+		log.Warnf("max stale serve of %s does not exceed the cache refresh interval of %ds, requests may be denied "+
+			"between successful refreshes", maxStale, refreshInterval)
+	}
+	return maxStale
+}
+
+func createSystemCache() *authorizer.SystemCache {
+	cacheEntriesMax := defaultSystemCacheSize
 	if viper.IsSet("cache_entries_max") {
 		cacheEntriesMax = viper.GetInt("cache_entries_max")
 	}
 
+	return newSystemCache(cacheEntriesMax)
+}
+
+// newSystemCache returns a cache of configuration fetched from 3scale system holding up to maxSize services
+func newSystemCache(maxSize int) *authorizer.SystemCache {
+	cacheUpdateRetries := defaultSystemCacheRetries
+	cacheRefreshInterval := defaultSystemCacheRefreshIntervalSeconds
+
+	if viper.IsSet("cache_refresh_seconds") {
+		cacheRefreshInterval = viper.GetInt("cache_refresh_seconds")
+	}
+
 	if viper.IsSet("cache_refresh_retries") {
 		cacheUpdateRetries = viper.GetInt("cache_refresh_retries")
 	}
 
 	config := authorizer.SystemCacheConfig{
-		MaxSize:               cacheEntriesMax,
+		MaxSize:               maxSize,
 		NumRetryFailedRefresh: cacheUpdateRetries,
 		RefreshInterval:       time.Duration(cacheRefreshInterval) * time.Second,
-		TTL:                   time.Duration(cacheTTL) * time.Second,
+		TTL:                   getSystemCacheTTL(),
 	}
 
 	return authorizer.NewSystemCache(config, make(chan struct{}))
@@ -233,11 +909,7 @@ func createBackendConfig() authorizer.BackendConfig {
 	logger := log.FindScope(log.DefaultScopeName)
 
 	if viper.GetBool("use_cached_backend") {
-		interval := time.Second * time.Duration(viper.GetInt("backend_cache_flush_interval_seconds"))
-		if interval == 0 {
-			interval = defaultBackendCacheFlushInterval
-		}
-
+		interval := getBackendCacheFlushInterval()
 		log.Infof("backend cache set to flush at %s intervals", interval.String())
 
 		return authorizer.BackendConfig{
@@ -253,10 +925,226 @@ func createBackendConfig() authorizer.BackendConfig {
 	}
 }
 
+// newAuthorizer returns the authorizer calling 3scale with the provided client, wrapped as configured
+func newAuthorizer(client *http.Client, reporter *authorizer.MetricsReporter) threescale.ReportingAuthorizer {
+	manager := authorizer.NewManager(
+		client,
+		createSystemCache(),
+		createBackendConfig(),
+		reporter,
+	)
+	var a threescale.ReportingAuthorizer = newReportingAuthorizer(manager, client)
+
+	// partitions are innermost, such that requests for configuration of every tenant pass through the other wrappers
+	if budgets := getTenantCacheBudgets(); len(budgets) > 0 {
+		a = newTenantCacheAuthorizer(a, client, budgets, reporter)
+		log.Infof("caching configuration of %d tenants in partitions of their own", len(budgets))
+	}
+
+	if viper.GetBool("health_deep_check") {
+		a = freshnessAuthorizer{ReportingAuthorizer: a, freshness: cacheFreshness}
+	}
+
+	if refreshTraffic != nil {
+		a = trafficAuthorizer{ReportingAuthorizer: a, traffic: refreshTraffic}
+	}
+	return a
+}
+
+// getTLSRenegotiation returns the level of TLS renegotiation supported when calling 3scale
+func getTLSRenegotiation() tls.RenegotiationSupport {
+	renegotiation := viper.GetString("tls_renegotiation")
+	switch strings.ToLower(renegotiation) {
+	case "", "never":
+		return tls.RenegotiateNever
+	case "once":
+		return tls.RenegotiateOnceAsClient
+	case "freely":
+		return tls.RenegotiateFreelyAsClient
+	default:
+		log.Fatalf("invalid tls renegotiation %q - must be one of never, once or freely", renegotiation)
+	}
+	return tls.RenegotiateNever
+}
+
+// getBackendCacheFlushInterval returns the interval at which the backend cache is flushed, when enabled
+func getBackendCacheFlushInterval() time.Duration {
+	if !viper.GetBool("use_cached_backend") {
+		return 0
+	}
+
+	interval := time.Second * time.Duration(viper.GetInt("backend_cache_flush_interval_seconds"))
+	if interval == 0 {
+		interval = defaultBackendCacheFlushInterval
+	}
+	return interval
+}
+
+// isFailOpen returns true when requests which could not be authorized by 3scale should be allowed
+func isFailOpen() bool {
+	return viper.IsSet("backend_cache_policy_fail_closed") && !viper.GetBool("backend_cache_policy_fail_closed")
+}
+
+// getFailPolicyByMethod parses the comma separated list of method=policy pairs which override the fail policy per HTTP method
+func getFailPolicyByMethod() map[string]threescale.FailPolicy {
+	pairs := getStringSlice("fail_policy_by_method")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	policies := make(map[string]threescale.FailPolicy, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid fail policy by method %q - must be of the form METHOD=open or METHOD=closed", pair)
+		}
+
+		method := strings.ToUpper(strings.TrimSpace(parts[0]))
+		switch policy := strings.ToLower(strings.TrimSpace(parts[1])); policy {
+		case "open":
+			policies[method] = threescale.FailOpen
+		case "closed":
+			policies[method] = threescale.FailClosed
+		default:
+			log.Fatalf("invalid fail policy %q for method %s - must be one of open or closed", policy, method)
+		}
+	}
+	return policies
+}
+
+// getFailPolicyByMetric parses the comma separated list of metric=policy pairs which override the fail policy per 3scale metric
+func getFailPolicyByMetric() map[string]threescale.FailPolicy {
+	pairs := getStringSlice("fail_policy_by_metric")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	policies := make(map[string]threescale.FailPolicy, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			log.Fatalf("invalid fail policy by metric %q - must be of the form metric=open or metric=closed", pair)
+		}
+
+		metric := strings.TrimSpace(parts[0])
+		switch policy := strings.ToLower(strings.TrimSpace(parts[1])); policy {
+		case "open":
+			policies[metric] = threescale.FailOpen
+		case "closed":
+			policies[metric] = threescale.FailClosed
+		default:
+			log.Fatalf("invalid fail policy %q for metric %s - must be one of open or closed", policy, metric)
+		}
+	}
+	return policies
+}
+
+// getMaintenanceFailPolicy parses the fail policy applied while 3scale is under maintenance, which is open by default
+func getMaintenanceFailPolicy() threescale.FailPolicy {
+	policy := viper.GetString("maintenance_fail_policy")
+	switch strings.ToLower(policy) {
+	case "", "open":
+		return threescale.FailOpen
+	case "closed":
+		return threescale.FailClosed
+	default:
+		log.Fatalf("invalid maintenance fail policy %q - must be one of open or closed", policy)
+	}
+	return threescale.FailOpen
+}
+
+// getSoftLimitThreshold returns the ratio of usage to limit beyond which requests are counted as exceeding a soft limit
+func getSoftLimitThreshold() float64 {
+	threshold := viper.GetFloat64("soft_limit_threshold")
+	if threshold < 0 || threshold > 1 {
+		log.Fatalf("invalid soft limit threshold %v - must be between 0 and 1", threshold)
+	}
+	return threshold
+}
+
+// getServiceMaxInflightOverrides parses the limits of concurrent requests by service id
+func getServiceMaxInflightOverrides() map[string]int {
+	pairs := getStringSlice("per_service_max_inflight_overrides")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	overrides := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid per service max inflight override %q - must be of the form SERVICE_ID=limit", pair)
+		}
+
+		serviceID := strings.TrimSpace(parts[0])
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || limit < 0 {
+			log.Fatalf("invalid max inflight %q for service %s - must be a non-negative integer", parts[1], serviceID)
+		}
+		overrides[serviceID] = limit
+	}
+	return overrides
+}
+
+// getTenantCacheBudgets returns the number of services cached for each tenant, keyed by the host of its system URL
+func getTenantCacheBudgets() map[string]int {
+	pairs := getStringSlice("tenant_cache_budgets")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	budgets := make(map[string]int, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid tenant cache budget %q - must be of the form HOST=entries", pair)
+		}
+
+		host := strings.ToLower(strings.TrimSpace(parts[0]))
+		budget, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || budget <= 0 {
+			log.Fatalf("invalid cache budget %q for tenant %s - must be a positive integer", parts[1], host)
+		}
+		budgets[host] = budget
+	}
+	return budgets
+}
+
+// getAuthModes parses the authentication modes which override those declared by services in 3scale, keyed by service id
+func getAuthModes() map[string]threescale.AuthMode {
+	pairs := getStringSlice("auth_mode")
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	modes := make(map[string]threescale.AuthMode, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid auth mode %q - must be of the form SERVICE_ID=mode", pair)
+		}
+
+		serviceID := strings.TrimSpace(parts[0])
+		switch mode := strings.ToLower(strings.TrimSpace(parts[1])); mode {
+		case "declared":
+			modes[serviceID] = threescale.AuthModeDeclared
+		case "api_key":
+			modes[serviceID] = threescale.AuthModeAPIKey
+		case "app_id":
+			modes[serviceID] = threescale.AuthModeAppID
+		case "oidc":
+			modes[serviceID] = threescale.AuthModeOIDC
+		default:
+			log.Fatalf("invalid auth mode %q for service %s - must be one of declared, api_key, app_id or oidc", mode, serviceID)
+		}
+	}
+	return modes
+}
+
 func getFailurePolicy() backend.FailurePolicy {
 	policy := backend.FailClosedPolicy
 
-	if viper.IsSet("backend_cache_policy_fail_closed") && !viper.GetBool("backend_cache_policy_fail_closed") {
+	if isFailOpen() {
 		policy = backend.FailOpenPolicy
 		log.Infof("backend cache fail policy set to open")
 	} else {
@@ -266,9 +1154,554 @@ func getFailurePolicy() backend.FailurePolicy {
 	return policy
 }
 
+// shutdownMetricsServer allows for a final scrape within the configured grace period before gracefully stopping the server
+func shutdownMetricsServer(server *admin.Server) {
+	if server == nil {
+		return
+	}
+
+	if viper.IsSet("metrics_shutdown_grace_seconds") {
+		grace := time.Duration(viper.GetInt("metrics_shutdown_grace_seconds")) * time.Second
+		log.Infof("waiting %s for final metrics scrape before shutting down metrics server", grace.String())
+		time.Sleep(grace)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAdminShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Error shutting down metrics server - %v", err)
+	}
+}
+
+// getUnknownServicePolicy parses the policy applied to requests for services which do not exist in 3scale
+func getUnknownServicePolicy() threescale.UnknownServicePolicy {
+	policy := viper.GetString("unknown_service_policy")
+	switch strings.ToLower(policy) {
+	case "", "fetch":
+		return threescale.UnknownServiceFetch
+	case "deny":
+		return threescale.UnknownServiceDeny
+	case "allow":
+		return threescale.UnknownServiceAllow
+	default:
+		log.Fatalf("invalid unknown service policy %q - must be one of deny, allow or fetch", policy)
+	}
+	return threescale.UnknownServiceFetch
+}
+
+// getPathNormalization parses the options applied to request paths before mapping rules are evaluated
+func getPathNormalization() threescale.PathNormalization {
+	var norm threescale.PathNormalization
+	for _, option := range getStringSlice("path_match_normalize") {
+		switch strings.ToLower(option) {
+		case "strip_trailing_slash":
+			norm.StripTrailingSlash = true
+		case "case_insensitive":
+			norm.CaseInsensitive = true
+		default:
+			log.Fatalf("invalid path match normalization %q - must be one of strip_trailing_slash or case_insensitive", option)
+		}
+	}
+	return norm
+}
+
+// getDenyResponseTemplate parses the template which renders the message of denied requests, if configured.
+// The keyword default selects the built in JSON template
+func getDenyResponseTemplate() *template.Template {
+	text := viper.GetString("deny_response_template")
+	switch text {
+	case "":
+		return nil
+	case "default":
+		text = threescale.DefaultDenyResponseTemplate
+	}
+
+	tmpl, err := threescale.NewDenyResponseTemplate(text)
+	if err != nil {
+		log.Fatalf("invalid deny response template - %v", err)
+	}
+	return tmpl
+}
+
+// getDeletedServicePolicy parses the policy applied to requests for services which have been deleted from 3scale
+func getDeletedServicePolicy() threescale.DeletedServicePolicy {
+	policy := viper.GetString("deleted_service_policy")
+	switch strings.ToLower(policy) {
+	case "", "evict":
+		return threescale.DeletedServiceEvict
+	case "retain":
+		return threescale.DeletedServiceRetain
+	default:
+		log.Fatalf("invalid deleted service policy %q - must be one of evict or retain", policy)
+	}
+	return threescale.DeletedServiceEvict
+}
+
+// getInternalErrorPolicy parses the policy applied to requests which fail due to a misconfigured service
+func getInternalErrorPolicy() threescale.InternalErrorPolicy {
+	policy := viper.GetString("internal_error_policy")
+	switch strings.ToLower(policy) {
+	case "", "deny":
+		return threescale.InternalErrorDeny
+	case "fail_policy":
+		return threescale.InternalErrorFailPolicy
+	default:
+		log.Fatalf("invalid internal error policy %q - must be one of deny or fail_policy", policy)
+	}
+	return threescale.InternalErrorDeny
+}
+
+// getMissingCredentialPolicy parses the policy applied to requests which do not provide any credentials
+func getMissingCredentialPolicy() threescale.MissingCredentialPolicy {
+	policy := viper.GetString("missing_credential_policy")
+	switch strings.ToLower(policy) {
+	case "", "deny":
+		return threescale.MissingCredentialDeny
+	case "allow_anonymous":
+		log.Warnf("missing credential policy set to allow_anonymous, requests without credentials will be allowed")
+		return threescale.MissingCredentialAllowAnonymous
+	default:
+		log.Fatalf("invalid missing credential policy %q - must be one of deny or allow_anonymous", policy)
+	}
+	return threescale.MissingCredentialDeny
+}
+
+// getBackendOverflowPolicy parses the policy applied to requests when the limit of in flight calls to 3scale backend is reached
+func getBackendOverflowPolicy() threescale.BackendOverflowPolicy {
+	policy := viper.GetString("backend_overflow_policy")
+	switch strings.ToLower(policy) {
+	case "", "queue":
+		return threescale.BackendOverflowQueue
+	case "fail":
+		return threescale.BackendOverflowFail
+	default:
+		log.Fatalf("invalid backend overflow policy %q - must be one of queue or fail", policy)
+	}
+	return threescale.BackendOverflowQueue
+}
+
+// getReportMode parses whether usage should be reported to 3scale before or after returning the authorization decision
+func getReportMode() threescale.ReportMode {
+	mode := viper.GetString("report_mode")
+	switch strings.ToLower(mode) {
+	case "", "sync":
+		return threescale.ReportSync
+	case "async":
+		return threescale.ReportAsync
+	default:
+		log.Fatalf("invalid report mode %q - must be one of sync or async", mode)
+	}
+	return threescale.ReportSync
+}
+
+// getReportTimestamps returns whether usage reports sent independently of authorization are stamped with the time
+// of the request. Usage reported along with authorization is always recorded by 3scale at the time it is received
+func getReportTimestamps() bool {
+	stamp := viper.GetBool("report_timestamps")
+	if stamp && getReportMode() != threescale.ReportAsync && !viper.GetBool("report_denied_requests") {
+		log.Fatalf("invalid report timestamps - requires report_mode to be async or report_denied_requests to be set")
+	}
+	return stamp
+}
+
+// getReportPersistPath returns the file to which queued usage reports which could not be sent on shutdown are persisted.
+// Only the asynchronous report queue is persisted, usage held in the backend cache of the authorizer never is
+func getReportPersistPath() string {
+	path := viper.GetString("report_persist_path")
+	if path != "" && getReportMode() != threescale.ReportAsync {
+		log.Fatalf("invalid report persist path %q - requires report_mode to be async, "+
+			"usage held in the backend cache cannot be persisted", path)
+	}
+	return path
+}
+
+// getBackendRetries returns the number of times a failed call to 3scale backend is retried. Calls which report usage
+// are never retried, since 3scale may have recorded the usage before the call failed, so retries require usage to be
+// reported asynchronously
+func getBackendRetries() int {
+	retries := viper.GetInt("backend_retries")
+	if retries > 0 && getReportMode() != threescale.ReportAsync {
+		log.Fatalf("invalid backend retries %d - requires report_mode to be async", retries)
+	}
+	return retries
+}
+
+// getReportOverflowPolicy parses the policy applied to usage reports when the report queue is full
+func getReportOverflowPolicy() threescale.ReportOverflowPolicy {
+	policy := viper.GetString("report_overflow_policy")
+	if policy != "" && getReportMode() != threescale.ReportAsync {
+		log.Fatalf("invalid report overflow policy %q - requires report_mode to be async", policy)
+	}
+
+	switch strings.ToLower(policy) {
+	case "", "drop_newest":
+		return threescale.ReportOverflowDropNewest
+	case "drop_oldest":
+		return threescale.ReportOverflowDropOldest
+	case "block":
+		return threescale.ReportOverflowBlock
+	default:
+		log.Fatalf("invalid report overflow policy %q - must be one of drop_newest, drop_oldest or block", policy)
+	}
+	return threescale.ReportOverflowDropNewest
+}
+
+// getLocalMappingRules parses the JSON encoded mapping rules, keyed by service id, to apply locally
+func getLocalMappingRules() map[string][]threescale.MappingRule {
+	if !viper.IsSet("local_mapping_rules") {
+		return nil
+	}
+
+	var rules map[string][]threescale.MappingRule
+	if err := json.Unmarshal([]byte(viper.GetString("local_mapping_rules")), &rules); err != nil {
+		log.Fatalf("failed to parse local mapping rules - %v", err)
+	}
+
+	for service, serviceRules := range rules {
+		for _, rule := range serviceRules {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				log.Fatalf("invalid pattern %q in local mapping rules for service %s - %v", rule.Pattern, service, err)
+			}
+			if _, err := regexp.Compile(rule.HeaderValue); err != nil {
+				log.Fatalf("invalid header value %q in local mapping rules for service %s - %v", rule.HeaderValue, service, err)
+			}
+		}
+		log.Infof("applying %d local mapping rules for service %s", len(serviceRules), service)
+	}
+	return rules
+}
+
+// getMappingRulesMode parses how local mapping rules are combined with those fetched from 3scale
+func getMappingRulesMode() threescale.MappingRulesMode {
+	mode := viper.GetString("local_mapping_rules_mode")
+	switch strings.ToLower(mode) {
+	case "", "merge":
+		return threescale.MappingRulesMerge
+	case "override":
+		return threescale.MappingRulesOverride
+	default:
+		log.Fatalf("invalid local mapping rules mode %q - must be one of merge or override", mode)
+	}
+	return threescale.MappingRulesMerge
+}
+
+// getMultiMatchPolicy parses which metrics are reported for requests which match multiple mapping rules
+func getMultiMatchPolicy() threescale.MultiMatchPolicy {
+	policy := viper.GetString("multi_match_policy")
+	switch strings.ToLower(policy) {
+	case "", "all":
+		return threescale.MultiMatchAll
+	case "first":
+		return threescale.MultiMatchFirst
+	case "most_specific":
+		return threescale.MultiMatchMostSpecific
+	default:
+		log.Fatalf("invalid multi match policy %q - must be one of all, first or most_specific", policy)
+	}
+	return threescale.MultiMatchAll
+}
+
+// getCredentialLogMode parses how credentials appear in the logs of the adapter
+func getCredentialLogMode() threescale.CredentialLogMode {
+	mode := viper.GetString("credential_log_mode")
+	switch strings.ToLower(mode) {
+	case "", "hashed":
+		return threescale.CredentialLogHashed
+	case "none":
+		return threescale.CredentialLogNone
+	case "masked":
+		return threescale.CredentialLogMasked
+	case "last4":
+		return threescale.CredentialLogLast4
+	default:
+		log.Fatalf("invalid credential log mode %q - must be one of none, masked, hashed or last4", mode)
+	}
+	return threescale.CredentialLogHashed
+}
+
+// getTrustedProxies parses the comma separated list of CIDR ranges which are trusted to set X-Forwarded-For
+func getTrustedProxies() []*net.IPNet {
+	var trusted []*net.IPNet
+	for _, cidr := range getStringSlice("trusted_proxies") {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("invalid trusted proxy range %s - %v", cidr, err)
+		}
+		trusted = append(trusted, ipNet)
+	}
+	return trusted
+}
+
+// getAccessTokenProvider returns a provider for the 3scale system access token read from file, if configured.
+// The file is re-read periodically if a watch interval has been set, until stop is closed.
+func getAccessTokenProvider(stop <-chan struct{}) func() string {
+	if !viper.IsSet("system_access_token_file") {
+		return nil
+	}
+
+	path := viper.GetString("system_access_token_file")
+	secret, err := newSecretFile(path)
+	if err != nil {
+		log.Fatalf("failed to read system access token file %s - %v", path, err)
+	}
+
+	if interval := viper.GetInt("system_access_token_file_watch_seconds"); interval > 0 {
+		go secret.watch(time.Duration(interval)*time.Second, stop)
+		log.Infof("watching system access token file %s for changes every %d seconds", path, interval)
+	}
+	return secret.Get
+}
+
+// getAuditSink returns the sink to which authorization decisions are published, if configured
+func getAuditSink() threescale.AuditSink {
+	sink := viper.GetString("audit_sink")
+	switch strings.ToLower(sink) {
+	case "":
+		return nil
+	case "kafka":
+		brokers := getStringSlice("audit_kafka_brokers")
+		topic := viper.GetString("audit_kafka_topic")
+		if len(brokers) == 0 || topic == "" {
+			log.Fatalf("audit_kafka_brokers and audit_kafka_topic must be set when audit_sink is kafka")
+		}
+
+		kafkaSink, err := newKafkaAuditSink(brokers, topic)
+		if err != nil {
+			log.Fatalf("failed to create kafka audit sink - %v", err)
+		}
+		log.Infof("publishing audit records to kafka topic %s", topic)
+		return kafkaSink
+	default:
+		log.Fatalf("invalid audit sink %q - must be kafka", sink)
+	}
+	return nil
+}
+
+// getDecisionTraceSink returns the sink for sampled decision traces, or nil if decision tracing is disabled
+func getDecisionTraceSink() threescale.DecisionTraceSink {
+	rate := viper.GetFloat64("decision_trace_sample_rate")
+	if rate < 0 || rate > 1 {
+		log.Fatalf("invalid decision trace sample rate %v - must be between 0 and 1", rate)
+	}
+
+	sink := viper.GetString("decision_trace_sink")
+	switch strings.ToLower(sink) {
+	case "", "log":
+		if rate == 0 {
+			return nil
+		}
+		log.Infof("logging %v of authorization decisions under the decision-trace scope", rate)
+		return logDecisionTraceSink{}
+	default:
+		log.Fatalf("invalid decision trace sink %q - must be log", sink)
+	}
+	return nil
+}
+
+// getCredentialExtractor returns the extractor for the configured credential source
+func getCredentialExtractor() threescale.CredentialExtractor {
+	if viper.IsSet("app_id_location") || viper.IsSet("app_key_location") {
+		if viper.IsSet("credential_source") || viper.IsSet("credential_source_chain") {
+			log.Warnf("credential source is ignored since app id and app key locations are configured")
+		}
+
+		appIDLocation, appKeyLocation := viper.GetString("app_id_location"), viper.GetString("app_key_location")
+		extractor, err := threescale.NewCompositeCredentials(appIDLocation, appKeyLocation)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Infof("app id will be read from %s and app key from %s", appIDLocation, appKeyLocation)
+		return extractor
+	}
+
+	if chain := getStringSlice("credential_source_chain"); len(chain) > 0 {
+		if viper.IsSet("credential_source") {
+			log.Warnf("credential source is ignored since a credential source chain is configured")
+		}
+
+		extractor, err := threescale.NewCredentialChain(chain...)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Infof("credentials will be read from the first of sources %v to provide them", chain)
+		if viper.GetBool("reject_conflicting_credentials") {
+			log.Infof("requests whose credential sources yield credentials which disagree will be rejected")
+		}
+		return extractor
+	}
+
+	if viper.GetBool("reject_conflicting_credentials") {
+		log.Warnf("reject conflicting credentials is ignored since no credential source chain is configured")
+	}
+
+	source := threescale.DefaultCredentialSource
+	if viper.IsSet("credential_source") {
+		source = viper.GetString("credential_source")
+	}
+
+	extractor, err := threescale.GetCredentialExtractor(source)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Infof("credentials will be read from source %s", source)
+	return extractor
+}
+
+// warmer fetches the configuration of services before requests are served, as implemented by threescale.Threescale
+type warmer interface {
+	Warmup(ctx context.Context, targets []threescale.WarmupTarget, concurrency int) []string
+}
+
+// warmup fetches the configuration of the configured services into the system cache before requests are served,
+// giving up on any not fetched within the warmup timeout
+func warmup(s warmer, accessToken func() string) {
+	serviceIDs := getStringSlice("warmup_service_ids")
+	if len(serviceIDs) == 0 {
+		return
+	}
+
+	systemURL := viper.GetString("warmup_system_url")
+	if systemURL == "" || accessToken == nil {
+		log.Errorf("warmup_system_url and system_access_token_file must be set to warm services, skipping warmup")
+		return
+	}
+
+	concurrency := defaultWarmupConcurrency
+	if viper.IsSet("warmup_concurrency") {
+		concurrency = viper.GetInt("warmup_concurrency")
+	}
+
+	timeout := defaultWarmupTimeout
+	if viper.IsSet("warmup_timeout_seconds") {
+		timeout = time.Duration(viper.GetInt("warmup_timeout_seconds")) * time.Second
+	}
+
+	targets := make([]threescale.WarmupTarget, 0, len(serviceIDs))
+	for _, serviceID := range serviceIDs {
+		targets = append(targets, threescale.WarmupTarget{
+			SystemURL:   systemURL,
+			ServiceID:   serviceID,
+			AccessToken: accessToken(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if failed := s.Warmup(ctx, targets, concurrency); len(failed) > 0 {
+		log.Warnf("failed to warm %d of %d services within %s: %v", len(failed), len(targets), timeout, failed)
+		return
+	}
+	log.Infof("warmed %d services in %s", len(targets), time.Since(start).Round(time.Millisecond))
+}
+
+// syntheticChecker makes periodic synthetic checks, as implemented by threescale.Threescale
+type syntheticChecker interface {
+	RunSyntheticChecks(check threescale.SyntheticCheck, interval time.Duration, stop <-chan struct{})
+}
+
+// startSyntheticChecks checks the configured service with the configured credentials in the background until stop is closed
+func startSyntheticChecks(c syntheticChecker, stop <-chan struct{}) {
+	serviceID := viper.GetString("synthetic_check_service_id")
+	if serviceID == "" {
+		return
+	}
+
+	check := threescale.SyntheticCheck{
+		SystemURL:   viper.GetString("synthetic_check_system_url"),
+		AccessToken: viper.GetString("synthetic_check_access_token"),
+		ServiceID:   serviceID,
+		UserKey:     viper.GetString("synthetic_check_user_key"),
+		AppID:       viper.GetString("synthetic_check_app_id"),
+		AppKey:      viper.GetString("synthetic_check_app_key"),
+		Method:      defaultSyntheticCheckMethod,
+		Path:        defaultSyntheticCheckPath,
+	}
+
+	if check.SystemURL == "" || (check.UserKey == "" && check.AppID == "") {
+		log.Errorf("synthetic_check_system_url and either synthetic_check_user_key or synthetic_check_app_id must be set for synthetic checks, skipping synthetic checks")
+		return
+	}
+
+	if viper.IsSet("synthetic_check_method") {
+		check.Method = viper.GetString("synthetic_check_method")
+	}
+	if viper.IsSet("synthetic_check_path") {
+		check.Path = viper.GetString("synthetic_check_path")
+	}
+
+	interval := defaultSyntheticCheckInterval
+	if viper.IsSet("synthetic_check_interval_seconds") {
+		interval = time.Duration(viper.GetInt("synthetic_check_interval_seconds")) * time.Second
+	}
+	if interval <= 0 {
+		log.Errorf("synthetic_check_interval_seconds must be positive, skipping synthetic checks")
+		return
+	}
+
+	go c.RunSyntheticChecks(check, interval, stop)
+	log.Infof("checking %s %s of service %s every %s", check.Method, check.Path, serviceID, interval)
+}
+
+// appUsageSource returns the usage of applications last returned by 3scale backend, as implemented by threescale.Threescale
+type appUsageSource interface {
+	AppUsage(serviceID, appID string) (threescale.AppUsage, bool)
+}
+
+// debugUsageEnabled returns true if application usage is to be served, which requires an admin auth token
+func debugUsageEnabled() bool {
+	if !viper.GetBool("debug_usage_endpoint") {
+		return false
+	}
+
+	if viper.GetString("admin_auth_token") == "" {
+		log.Errorf("admin_auth_token must be set to serve application usage, %s is disabled", defaultDebugUsageEndpoint)
+		return false
+	}
+	return true
+}
+
+// warmupBackendConnections opens the configured number of connections to 3scale backend before requests are served,
+// giving up on any not opened within the backend warmup timeout
+func warmupBackendConnections(client *http.Client) {
+	connections := viper.GetInt("backend_warmup_connections")
+	if connections <= 0 {
+		return
+	}
+
+	backendURL := viper.GetString("backend_warmup_url")
+	if backendURL == "" {
+		log.Errorf("backend_warmup_url must be set to warm connections to 3scale backend, skipping warmup")
+		return
+	}
+
+	timeout := defaultBackendWarmupTimeout
+	if viper.IsSet("backend_warmup_timeout_seconds") {
+		timeout = time.Duration(viper.GetInt("backend_warmup_timeout_seconds")) * time.Second
+	}
+	backendConnWarmup.run(client, backendURL, connections, timeout)
+}
+
 func main() {
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and connectivity to 3scale, then exit")
+	checkURLs := flag.String("check-urls", "", "comma separated list of 3scale URLs to verify connectivity to when checking configuration")
+	flag.Parse()
+
 	var addr string
 
+	logEffectiveConfig()
+
+	if *checkConfig {
+		var urls []string
+		for _, url := range strings.Split(*checkURLs, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				urls = append(urls, url)
+			}
+		}
+		os.Exit(runConfigCheck(urls))
+	}
+
 	if viper.IsSet("listen_addr") {
 		addr = viper.GetString("listen_addr")
 	} else {
@@ -280,16 +1713,152 @@ func main() {
 		grpcKeepAliveFor = time.Second * time.Duration(viper.GetInt("grpc_conn_max_seconds"))
 	}
 
-	authorizer := authorizer.NewManager(
-		parseClientConfig(),
-		createSystemCache(),
-		createBackendConfig(),
-		parseMetricsConfig(),
-	)
+	grpcKeepAliveGrace := defaultGRPCConnMaxGrace
+	if viper.IsSet("grpc_conn_max_grace_seconds") {
+		grpcKeepAliveGrace = time.Second * time.Duration(viper.GetInt("grpc_conn_max_grace_seconds"))
+	}
+
+	authorizerMetrics, adapterMetrics, metricsServer := parseMetricsConfig()
+
+	client := parseClientConfig()
+	authorizer := newAuthorizer(client, authorizerMetrics)
+
+	standby := threescale.NewStandby(getStandby(), adapterMetrics)
+	maintenance := threescale.NewMaintenance(viper.GetBool("maintenance_mode"), adapterMetrics)
+	adminServer := parseAdminConfig(standby, maintenance)
+
+	var checkTimeout time.Duration
+	if viper.IsSet("check_max_total_latency_ms") {
+		checkTimeout = time.Millisecond * time.Duration(viper.GetInt("check_max_total_latency_ms"))
+	}
+
+	var slowCheckThreshold time.Duration
+	if viper.IsSet("slow_check_threshold_ms") {
+		slowCheckThreshold = time.Millisecond * time.Duration(viper.GetInt("slow_check_threshold_ms"))
+	}
+
+	reportQueueSize := defaultReportQueueSize
+	if viper.IsSet("report_buffer_max") {
+		reportQueueSize = viper.GetInt("report_buffer_max")
+	} else if viper.IsSet("report_queue_size") {
+		reportQueueSize = viper.GetInt("report_queue_size")
+	}
+
+	retryBudgetRatio := defaultRetryBudgetRatio
+	if viper.IsSet("retry_budget_ratio") {
+		retryBudgetRatio = viper.GetFloat64("retry_budget_ratio")
+	}
+
+	auditBufferSize := defaultAuditBufferSize
+	if viper.IsSet("audit_buffer_size") {
+		auditBufferSize = viper.GetInt("audit_buffer_size")
+	}
+
+	decisionTraceBufferSize := defaultDecisionTraceBufferSize
+	if viper.IsSet("decision_trace_buffer_size") {
+		decisionTraceBufferSize = viper.GetInt("decision_trace_buffer_size")
+	}
+
+	trackAppUsage := debugUsageEnabled()
+
+	// stopWatching stops any background file watchers and synthetic checks on shutdown
+	stopWatching := make(chan struct{})
+
+	failPolicy := threescale.FailClosed
+	if isFailOpen() {
+		failPolicy = threescale.FailOpen
+	}
 
 	adapterConf := &threescale.AdapterConfig{
 		Authorizer:      authorizer,
 		KeepAliveMaxAge: grpcKeepAliveFor,
+		CheckTimeout:    checkTimeout,
+		FailPolicy:      failPolicy,
+		Metrics:         adapterMetrics,
+
+		KeepAliveMaxAgeGrace:    grpcKeepAliveGrace,
+		SlowCheckThreshold:      slowCheckThreshold,
+		OverheadLogThreshold:    time.Duration(viper.GetInt("overhead_log_threshold_ms")) * time.Millisecond,
+		FailPolicyByMethod:      getFailPolicyByMethod(),
+		FailPolicyByMetric:      getFailPolicyByMetric(),
+		SoftLimitThreshold:      getSoftLimitThreshold(),
+		SoftLimitLog:            viper.GetBool("soft_limit_log"),
+		UnknownServicePolicy:    getUnknownServicePolicy(),
+		DeletedServicePolicy:    getDeletedServicePolicy(),
+		InternalErrorPolicy:     getInternalErrorPolicy(),
+		UnknownServiceTTL:       getSystemCacheTTL(),
+		CredentialExtractor:     getCredentialExtractor(),
+		MissingCredentialPolicy: getMissingCredentialPolicy(),
+		AuthModes:               getAuthModes(),
+		BackendMaxInflight:      viper.GetInt("backend_max_inflight"),
+		BackendOverflowPolicy:   getBackendOverflowPolicy(),
+		ServiceMaxInflight:      viper.GetInt("per_service_max_inflight"),
+		ReportMode:              getReportMode(),
+		ReportQueueSize:         reportQueueSize,
+		ReportOverflowPolicy:    getReportOverflowPolicy(),
+		ReportDeniedRequests:    viper.GetBool("report_denied_requests"),
+		ReportTimestamps:        getReportTimestamps(),
+		ReportTimeOffset:        time.Duration(viper.GetInt("report_time_offset_seconds")) * time.Second,
+		ReportPersistPath:       getReportPersistPath(),
+		AuthorizeSingleflight:   viper.GetBool("authorize_singleflight"),
+		LocalMappingRules:       getLocalMappingRules(),
+		MappingRulesMode:        getMappingRulesMode(),
+		MultiMatchPolicy:        getMultiMatchPolicy(),
+		CredentialLogMode:       getCredentialLogMode(),
+		PathNormalization:       getPathNormalization(),
+		DefaultMetricName:       viper.GetString("default_metric_name"),
+		TrustXFF:                viper.GetBool("trust_xff"),
+		TrustedProxies:          getTrustedProxies(),
+		NegativeCacheTTL:        time.Duration(viper.GetInt("negative_cache_ttl_seconds")) * time.Second,
+		AccessTokenProvider:     getAccessTokenProvider(stopWatching),
+		CheckValidDuration:      time.Duration(viper.GetInt("check_valid_duration_ms")) * time.Millisecond,
+		CheckValidUseCount:      int32(viper.GetInt("check_valid_use_count")),
+		ServedServiceIDs:        getStringSlice("served_service_ids"),
+		DebugServiceIDs:         getStringSlice("debug_service_ids"),
+		TrackAppUsage:           trackAppUsage,
+		AuditSink:               getAuditSink(),
+		AuditBufferSize:         auditBufferSize,
+		DecisionTraceSink:       getDecisionTraceSink(),
+		DecisionTraceSampleRate: viper.GetFloat64("decision_trace_sample_rate"),
+		DecisionTraceBufferSize: decisionTraceBufferSize,
+		Standby:                 standby,
+		Maintenance:             maintenance,
+		MaintenanceFailPolicy:   getMaintenanceFailPolicy(),
+		MaxCheckTimeout:         time.Duration(viper.GetInt("check_max_timeout_override_ms")) * time.Millisecond,
+		GRPCReflection:          viper.GetBool("grpc_reflection"),
+		GRPCChannelz:            viper.GetBool("grpc_channelz"),
+		GRPCAPIKey:              viper.GetString("grpc_api_key"),
+		DenyResponseTemplate:    getDenyResponseTemplate(),
+
+		BackendCacheMaxEntries:    viper.GetInt("backend_cache_max_entries"),
+		BackendCacheMaxBytes:      viper.GetInt("backend_cache_max_bytes"),
+		BackendCacheFlushInterval: getBackendCacheFlushInterval(),
+		MaxMappingRuleEvaluations: viper.GetInt("max_mapping_rule_evaluations"),
+		LastKnownDecisionTTL:      time.Duration(viper.GetInt("last_known_decision_ttl_seconds")) * time.Second,
+		MaxDecisionCacheEntries:   viper.GetInt("max_decision_cache_entries"),
+		MaxStaleServe:             getMaxStaleServe(),
+		ConfigRefreshedAt:         serviceFreshness.LastRefreshed,
+		LocalRateLimit: threescale.LocalRateLimit{
+			RequestsPerSecond: viper.GetFloat64("local_rate_limit_rps"),
+			Burst:             viper.GetInt("local_rate_limit_burst"),
+			PerService:        viper.GetBool("local_rate_limit_per_service"),
+		},
+		CircuitBreaker: threescale.CircuitBreaker{
+			FailureThreshold: viper.GetInt("cb_failure_threshold"),
+			ProbeInitial:     time.Duration(viper.GetInt("cb_probe_initial_ms")) * time.Millisecond,
+			ProbeMax:         time.Duration(viper.GetInt("cb_probe_max_ms")) * time.Millisecond,
+		},
+		BackendRetries: threescale.BackendRetries{
+			Max:         getBackendRetries(),
+			BudgetRatio: retryBudgetRatio,
+		},
+		HandlerPool: threescale.HandlerPool{
+			MaxGoroutines: viper.GetInt("max_handler_goroutines"),
+			QueueSize:     viper.GetInt("handler_queue_size"),
+		},
+		LoadShed:                     getLoadShed(),
+		ServiceMaxInflightOverrides:  getServiceMaxInflightOverrides(),
+		RejectConflictingCredentials: viper.GetBool("reject_conflicting_credentials"),
 	}
 
 	s, err := threescale.NewThreescale(addr, adapterConf)
@@ -297,6 +1866,25 @@ func main() {
 		log.Fatalf("Unable to start server: %v", err)
 	}
 
+	awaitStartup(client)
+
+	if w, ok := s.(warmer); ok {
+		warmup(w, adapterConf.AccessTokenProvider)
+	}
+	warmupBackendConnections(client)
+
+	if c, ok := s.(syntheticChecker); ok {
+		startSyntheticChecks(c, stopWatching)
+	}
+
+	if u, ok := s.(appUsageSource); ok && trackAppUsage {
+		adminServer.Handle(defaultDebugUsageEndpoint, admin.TokenHandler(viper.GetString("admin_auth_token"),
+			admin.UsageHandler(func(serviceID, appID string) (interface{}, bool) {
+				return u.AppUsage(serviceID, appID)
+			})))
+		log.Infof("serving application usage at %s on the admin port", defaultDebugUsageEndpoint)
+	}
+
 	shutdown := make(chan error, 1)
 	go func() {
 		if version == "" {
@@ -313,12 +1901,24 @@ func main() {
 		select {
 		case sig := <-sigC:
 			log.Infof("\n%s received. Attempting graceful shutdown\n", sig.String())
+			metrics.IncrementShutdowns()
+			close(stopWatching)
 			authorizer.Shutdown()
 			err := s.Close()
 			if err != nil {
 				log.Fatalf("Error calling graceful shutdown")
 			}
 
+			if adminServer != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), defaultAdminShutdownTimeout)
+				if err := adminServer.Shutdown(ctx); err != nil {
+					log.Errorf("Error shutting down admin server - %v", err)
+				}
+				cancel()
+			}
+
+			shutdownMetricsServer(metricsServer)
+
 		case err = <-shutdown:
 			if err != nil {
 				log.Fatalf("gRPC server has shut down: err %v", err)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/admin"
+)
+
+// readinessGate reports the adapter as unavailable, via its HealthCheck, until the gate is opened
+type readinessGate struct {
+	reason string
+	// opened is set once the gate is opened, accessed atomically
+	opened int32
+}
+
+// open reports the adapter as available, as far as the gate is concerned
+func (g *readinessGate) open() {
+	atomic.StoreInt32(&g.opened, 1)
+}
+
+// Check returns a HealthCheck which fails with the reason of the gate until it is opened
+func (g *readinessGate) Check() admin.HealthCheck {
+	return func() error {
+		if atomic.LoadInt32(&g.opened) == 0 {
+			return errors.New(g.reason)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+const (
+	// refreshPriorityHigh labels fetches for services accessed within the last refresh interval
+	refreshPriorityHigh = "high"
+	// refreshPriorityLow labels fetches for services not accessed within the last refresh interval
+	refreshPriorityLow = "low"
+)
+
+// serviceAccess is the traffic to a service, as a count of accesses which halves every half life
+type serviceAccess struct {
+	score float64
+	last  time.Time
+}
+
+// serviceTraffic tracks how recently and frequently the configuration of each service is accessed
+type serviceTraffic struct {
+	halfLife time.Duration
+
+	mu       sync.Mutex
+	services map[string]*serviceAccess
+}
+
+func newServiceTraffic(halfLife time.Duration) *serviceTraffic {
+	return &serviceTraffic{halfLife: halfLife, services: make(map[string]*serviceAccess)}
+}
+
+// decayed returns the score of the access as of now. Callers must hold mu
+func (t *serviceTraffic) decayed(access *serviceAccess, now time.Time) float64 {
+	if t.halfLife <= 0 {
+		return access.score
+	}
+	return access.score * math.Pow(0.5, float64(now.Sub(access.last))/float64(t.halfLife))
+}
+
+// record counts an access to the configuration of the service
+func (t *serviceTraffic) record(serviceID string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	access, ok := t.services[serviceID]
+	if !ok {
+		access = &serviceAccess{}
+		t.services[serviceID] = access
+	}
+	access.score = t.decayed(access, now) + 1
+	access.last = now
+}
+
+// priority returns the score of the service, higher for services accessed more recently and frequently,
+// and the label of its priority
+func (t *serviceTraffic) priority(serviceID string, now time.Time) (float64, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	access, ok := t.services[serviceID]
+	if !ok {
+		return 0, refreshPriorityLow
+	}
+
+	label := refreshPriorityLow
+	if now.Sub(access.last) < t.halfLife {
+		label = refreshPriorityHigh
+	}
+	return t.decayed(access, now), label
+}
+
+// trafficAuthorizer records each request for the configuration of a service made by the adapter
+type trafficAuthorizer struct {
+	threescale.ReportingAuthorizer
+	traffic *serviceTraffic
+}
+
+func (t trafficAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	t.traffic.record(request.ServiceID, time.Now())
+	return t.ReportingAuthorizer.GetSystemConfiguration(systemURL, request)
+}
+
+// refreshWaiter is a fetch of service configuration waiting for the refresh concurrency limit
+type refreshWaiter struct {
+	ready chan struct{}
+	score float64
+	seq   uint64
+	index int
+}
+
+// refreshWaiters orders waiting fetches by score, highest first, and then in order of arrival
+type refreshWaiters []*refreshWaiter
+
+func (w refreshWaiters) Len() int { return len(w) }
+
+func (w refreshWaiters) Less(i, j int) bool {
+	if w[i].score != w[j].score {
+		return w[i].score > w[j].score
+	}
+	return w[i].seq < w[j].seq
+}
+
+func (w refreshWaiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+
+func (w *refreshWaiters) Push(x interface{}) {
+	waiter := x.(*refreshWaiter)
+	waiter.index = len(*w)
+	*w = append(*w, waiter)
+}
+
+func (w *refreshWaiters) Pop() interface{} {
+	old := *w
+	waiter := old[len(old)-1]
+	waiter.index = -1
+	*w = old[:len(old)-1]
+	return waiter
+}
+
+// refreshScheduler is a http.RoundTripper which bounds the number of concurrent fetches of configuration from
+// 3scale system, including the refreshes made by the system cache in the background. When prioritize is set, fetches
+// waiting for the limit are made in order of the traffic to their service, rather than in order of arrival
+type refreshScheduler struct {
+	next       http.RoundTripper
+	traffic    *serviceTraffic
+	prioritize bool
+
+	mu        sync.Mutex
+	available int
+	waiters   refreshWaiters
+	seq       uint64
+}
+
+func newRefreshScheduler(next http.RoundTripper, concurrency int, traffic *serviceTraffic, prioritize bool) *refreshScheduler {
+	return &refreshScheduler{
+		next:       next,
+		traffic:    traffic,
+		prioritize: prioritize,
+		available:  concurrency,
+	}
+}
+
+func (r *refreshScheduler) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		return r.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	score, label := r.traffic.priority(serviceIDFromPath(req.URL.Path), start)
+	if !r.prioritize {
+		score = 0
+	}
+
+	err := r.acquire(req.Context(), score)
+	metrics.ObserveRefreshQueueWait(label, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	return r.next.RoundTrip(req)
+}
+
+// acquire waits until a fetch with the provided score may be made, or the context is done
+func (r *refreshScheduler) acquire(ctx context.Context, score float64) error {
+	r.mu.Lock()
+	if r.available > 0 && len(r.waiters) == 0 {
+		r.available--
+		r.mu.Unlock()
+		return nil
+	}
+
+	waiter := &refreshWaiter{ready: make(chan struct{}), score: score, seq: r.seq}
+	r.seq++
+	heap.Push(&r.waiters, waiter)
+	r.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		if waiter.index >= 0 {
+			heap.Remove(&r.waiters, waiter.index)
+			r.mu.Unlock()
+			return ctx.Err()
+		}
+		r.mu.Unlock()
+		// the fetch was allowed as the context was done, so its slot is handed on
+		r.release()
+		return ctx.Err()
+	}
+}
+
+// release allows the next waiting fetch, if any, to be made
+func (r *refreshScheduler) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.waiters) == 0 {
+		r.available++
+		return
+	}
+	close(heap.Pop(&r.waiters).(*refreshWaiter).ready)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale"
+	"github.com/3scale/3scale-go-client/threescale/api"
+	apisonator "github.com/3scale/3scale-go-client/threescale/http"
+)
+
+// reportingAuthorizer extends an authorizer with calls to the authorize and report endpoints of 3scale backend, such
+// that usage can be reported independently of authorization. These calls are made directly to 3scale backend and
+// bypass the backend cache of the authorizer, if any
+type reportingAuthorizer struct {
+	*authorizer.Manager
+	client *http.Client
+}
+
+// newReportingAuthorizer returns an authorizer calling 3scale with the provided client
+func newReportingAuthorizer(manager *authorizer.Manager, c *http.Client) *reportingAuthorizer {
+	return &reportingAuthorizer{Manager: manager, client: c}
+}
+
+// Authorize authorizes the request against 3scale backend without reporting usage
+func (r *reportingAuthorizer) Authorize(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	c, req, err := r.backendCall(backendURL, request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Authorize(*req)
+	if err != nil {
+		resp := &authorizer.BackendResponse{}
+		if res != nil {
+			resp.RawResponse = res.RawResponse
+		}
+		return resp, fmt.Errorf("error calling Authorize - %s", err)
+	}
+
+	return &authorizer.BackendResponse{
+		Authorized:     res.Authorized,
+		ErrorCode:      res.ErrorCode,
+		RejectedReason: res.RejectionReason,
+		UsageReports:   res.UsageReports,
+		RawResponse:    res.RawResponse,
+	}, nil
+}
+
+// Report reports usage of the request to 3scale backend. The response is authorized if the report was accepted
+func (r *reportingAuthorizer) Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	c, req, err := r.backendCall(backendURL, request)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Report(*req)
+	if err != nil {
+		resp := &authorizer.BackendResponse{}
+		if res != nil {
+			resp.RawResponse = res.RawResponse
+		}
+		return resp, fmt.Errorf("error calling Report - %s", err)
+	}
+
+	return &authorizer.BackendResponse{
+		Authorized:  res.Accepted,
+		ErrorCode:   res.ErrorCode,
+		RawResponse: res.RawResponse,
+	}, nil
+}
+
+// backendCall returns a client for the 3scale backend and the request to send to it
+func (r *reportingAuthorizer) backendCall(backendURL string, request authorizer.BackendRequest) (*apisonator.Client, *threescale.Request, error) {
+	if len(request.Transactions) < 1 {
+		return nil, nil, fmt.Errorf("cannot process empty transaction")
+	}
+
+	c, err := apisonator.NewClient(backendURL, r.client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to build required client for 3scale backend - %s", err)
+	}
+
+	transaction := request.Transactions[0]
+	return c, &threescale.Request{
+		Auth: api.ClientAuth{
+			Type:  api.AuthType(request.Auth.Type),
+			Value: request.Auth.Value,
+		},
+		// have 3scale set the error code explicitly, as the authorizer does
+		Extensions: api.Extensions{
+			apisonator.RejectionReasonHeaderExtension: "1",
+		},
+		Service: api.Service(request.Service),
+		Transactions: []api.Transaction{
+			{
+				Metrics: transaction.Metrics,
+				Params: api.Params{
+					AppID:   transaction.Params.AppID,
+					AppKey:  transaction.Params.AppKey,
+					UserKey: transaction.Params.UserKey,
+				},
+				Timestamp: transaction.Timestamp,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/spf13/viper"
+)
+
+func TestWrappedAuthorizerReports(t *testing.T) {
+	viper.Set("health_deep_check", true)
+	viper.Set("tenant_cache_budgets", "tenant.example.com=10")
+	refreshTraffic = newServiceTraffic(time.Minute)
+	defer func() {
+		viper.Set("health_deep_check", false)
+		viper.Set("tenant_cache_budgets", "")
+		refreshTraffic = nil
+	}()
+
+	paths := make(chan string, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		if r.URL.Path == "/transactions/authorize.xml" {
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><status><authorized>true</authorized></status>`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	// the adapter only sees the authorizer through its configuration
+	var a threescale.Authorizer = newAuthorizer(&http.Client{}, nil)
+	reporter, ok := a.(threescale.ReportingAuthorizer)
+	if !ok {
+		t.Fatalf("expected the wrapped authorizer to support reporting independently of authorization")
+	}
+
+	request := authorizer.BackendRequest{
+		Auth:    authorizer.BackendAuth{Type: "service_token", Value: "token"},
+		Service: "123",
+		Transactions: []authorizer.BackendTransaction{
+			{
+				Metrics: map[string]int{"hits": 1},
+				Params:  authorizer.BackendParams{UserKey: "key"},
+			},
+		},
+	}
+
+	resp, err := reporter.Authorize(backend.URL, request)
+	if err != nil {
+		t.Fatalf("unexpected error authorizing - %v", err)
+	}
+	if !resp.Authorized {
+		t.Errorf("expected request to be authorized")
+	}
+	if path := <-paths; path != "/transactions/authorize.xml" {
+		t.Errorf("expected authorization to call the authorize endpoint, got %s", path)
+	}
+
+	resp, err = reporter.Report(backend.URL, request)
+	if err != nil {
+		t.Fatalf("unexpected error reporting - %v", err)
+	}
+	if !resp.Authorized {
+		t.Errorf("expected report to be accepted")
+	}
+	if path := <-paths; path != "/transactions.xml" {
+		t.Errorf("expected report to call the report endpoint, got %s", path)
+	}
+}
+
+func TestWrappedAuthorizerReportsDenied(t *testing.T) {
+	reported := make(chan struct{}, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions/authorize.xml" {
+			w.Header().Set("3scale-Rejection-Reason", "limits_exceeded")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><status><authorized>false</authorized><reason>usage limits are exceeded</reason></status>`))
+			return
+		}
+		reported <- struct{}{}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	var a threescale.Authorizer = newAuthorizer(&http.Client{}, nil)
+	reporter, ok := a.(threescale.ReportingAuthorizer)
+	if !ok {
+		t.Fatalf("expected the wrapped authorizer to support reporting denied requests")
+	}
+
+	request := authorizer.BackendRequest{
+		Auth:    authorizer.BackendAuth{Type: "service_token", Value: "token"},
+		Service: "123",
+		Transactions: []authorizer.BackendTransaction{
+			{
+				Metrics: map[string]int{"hits": 1},
+				Params:  authorizer.BackendParams{UserKey: "key"},
+			},
+		},
+	}
+
+	// denials are returned without error so that usage of the denied request can be reported
+	resp, err := reporter.Authorize(backend.URL, request)
+	if err != nil {
+		t.Fatalf("unexpected error authorizing - %v", err)
+	}
+	if resp.Authorized || resp.ErrorCode != "limits_exceeded" {
+		t.Errorf("expected request to be denied for exceeding limits, got authorized %t with code %q", resp.Authorized, resp.ErrorCode)
+	}
+
+	if _, err := reporter.Report(backend.URL, request); err != nil {
+		t.Fatalf("unexpected error reporting denied request - %v", err)
+	}
+	select {
+	case <-reported:
+	default:
+		t.Errorf("expected usage of the denied request to be reported")
+	}
+}
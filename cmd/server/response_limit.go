@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/metrics"
+)
+
+// responseLimitTransport is a http.RoundTripper which bounds the size of responses from 3scale backend, so that an
+// enormous response, such as an error page served by a gateway in front of 3scale, is not read into memory whole.
+// Responses which declare a length beyond the limit are rejected outright, and others fail once the limit is read
+type responseLimitTransport struct {
+	next     http.RoundTripper
+	maxBytes int64
+}
+
+func (t responseLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || strings.HasPrefix(req.URL.Path, systemAPIPathPrefix) {
+		return resp, err
+	}
+
+	if resp.ContentLength > t.maxBytes {
+		resp.Body.Close()
+		metrics.IncrementBackendResponseTooLarge()
+		return nil, t.tooLarge()
+	}
+
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		reader:     io.LimitReader(resp.Body, t.maxBytes+1),
+		transport:  t,
+	}
+	return resp, nil
+}
+
+func (t responseLimitTransport) tooLarge() error {
+	return fmt.Errorf("response from 3scale backend exceeded the limit of %d bytes", t.maxBytes)
+}
+
+// limitedBody fails reads of a response body once more than the limit of its transport has been read.
+// Bytes up to the limit are returned by the read which exceeds it, and any later read fails without reading further
+type limitedBody struct {
+	io.ReadCloser
+	reader    io.Reader
+	transport responseLimitTransport
+
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, b.transport.tooLarge()
+	}
+
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	if b.read <= b.transport.maxBytes {
+		return n, err
+	}
+
+	b.exceeded = true
+	metrics.IncrementBackendResponseTooLarge()
+	return n - int(b.read-b.transport.maxBytes), b.transport.tooLarge()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseLimitTransport(t *testing.T) {
+	const maxBytes = 10
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("a", maxBytes)
+		if r.URL.Query().Get("oversized") == "true" {
+			body += "b"
+		}
+
+		if r.URL.Query().Get("streamed") != "true" {
+			w.Write([]byte(body))
+			return
+		}
+
+		// flushing before the body is written in full omits its length, so it is only known once read
+		w.Write([]byte(body[:1]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[1:]))
+	}))
+	defer backend.Close()
+
+	c := &http.Client{Transport: responseLimitTransport{next: http.DefaultTransport, maxBytes: maxBytes}}
+
+	inputs := []struct {
+		name            string
+		path            string
+		expectErr       bool
+		expectRead      int
+		expectReadErr   bool
+		expectLengthSet bool
+	}{
+		{
+			name:            "Test response within the limit is read in full",
+			path:            "/transactions/authrep.xml",
+			expectRead:      maxBytes,
+			expectLengthSet: true,
+		},
+		{
+			name:      "Test response declaring a length beyond the limit is rejected",
+			path:      "/transactions/authrep.xml?oversized=true",
+			expectErr: true,
+		},
+		{
+			name:          "Test streamed response beyond the limit fails once the limit is read",
+			path:          "/transactions/authrep.xml?oversized=true&streamed=true",
+			expectRead:    maxBytes,
+			expectReadErr: true,
+		},
+		{
+			name:       "Test streamed response within the limit is read in full",
+			path:       "/transactions/authrep.xml?streamed=true",
+			expectRead: maxBytes,
+		},
+		{
+			name:            "Test responses from 3scale system are not limited",
+			path:            systemAPIPathPrefix + "services/123/proxy/configs/production/latest.json?oversized=true",
+			expectRead:      maxBytes + 1,
+			expectLengthSet: true,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			resp, err := c.Get(backend.URL + input.path)
+			if input.expectErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected response to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+			defer resp.Body.Close()
+
+			if lengthSet := resp.ContentLength >= 0; lengthSet != input.expectLengthSet {
+				t.Errorf("expected length to be declared %t, got %d", input.expectLengthSet, resp.ContentLength)
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if len(b) != input.expectRead {
+				t.Errorf("expected %d bytes to be read, got %d", input.expectRead, len(b))
+			}
+			if (err != nil) != input.expectReadErr {
+				t.Errorf("unexpected error reading response - %v", err)
+			}
+
+			if input.expectReadErr {
+				n, err := resp.Body.Read(make([]byte, maxBytes))
+				if n != 0 || err == nil {
+					t.Errorf("expected later reads to fail without reading, got %d bytes and error %v", n, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/log"
+)
+
+// rootCAs caches the root certificate pool used by the client
+var rootCAs = &rootCAPool{}
+
+// rootCAPool holds the system certificates along with those read from a CA file, rebuilt only when the file changes,
+// since reading the system certificates can be slow on some systems
+type rootCAPool struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	pool    *x509.CertPool
+}
+
+// get returns the pool of system certificates and those in the CA file at path
+func (p *rootCAPool) get(path string) (*x509.CertPool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root CA file %s - %v", path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pool != nil && p.path == path && p.modTime.Equal(info.ModTime()) && p.size == info.Size() {
+		return p.pool, nil
+	}
+
+	pemCerts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root CA file %s - %v", path, err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.Errorf("failed to read system certificates %v, trying to read CA certs anyway", err)
+		pool = x509.NewCertPool()
+	}
+
+	if ok := pool.AppendCertsFromPEM(pemCerts); !ok {
+		return nil, errors.New("failed to parse root CA certificates")
+	}
+
+	p.path = path
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.pool = pool
+	return pool, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/log"
+)
+
+// secretFile holds a secret read from a file, such as a mounted Kubernetes secret, so that it is not exposed via the environment
+type secretFile struct {
+	path string
+
+	mu      sync.RWMutex
+	value   string
+	modTime time.Time
+}
+
+// newSecretFile reads the secret from the file at path
+func newSecretFile(path string) (*secretFile, error) {
+	f := &secretFile{path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Get returns the current value of the secret
+func (f *secretFile) Get() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.value
+}
+
+// load reads the secret, trimming any surrounding whitespace such as a trailing newline
+func (f *secretFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.value = string(bytes.TrimSpace(b))
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+// changed returns true if the file has been modified since it was last read
+func (f *secretFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Errorf("failed to stat secret file %s - %v", f.path, err)
+		return false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !info.ModTime().Equal(f.modTime)
+}
+
+// watch re-reads the secret at the provided interval whenever the file has been modified, until stop is closed.
+// The previous value is retained should the file be unreadable.
+func (f *secretFile) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+
+			if err := f.load(); err != nil {
+				log.Errorf("failed to reload secret file %s - %v", f.path, err)
+				continue
+			}
+			log.Infof("reloaded secret from file %s", f.path)
+		case <-stop:
+			return
+		}
+	}
+}
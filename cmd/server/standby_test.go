@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/spf13/viper"
+)
+
+func TestPromoteHandler(t *testing.T) {
+	viper.Set("admin_auth_token", "secret")
+	defer viper.Set("admin_auth_token", "")
+
+	standby := threescale.NewStandby(true, nil)
+	handler := promoteHandler(standby)
+
+	inputs := []struct {
+		name          string
+		authorization string
+		expectCode    int
+		expectStandby bool
+	}{
+		{
+			name:          "Test unauthenticated promotion is rejected",
+			expectCode:    http.StatusUnauthorized,
+			expectStandby: true,
+		},
+		{
+			name:          "Test promotion with an invalid token is rejected",
+			authorization: "Bearer invalid",
+			expectCode:    http.StatusUnauthorized,
+			expectStandby: true,
+		},
+		{
+			name:          "Test authenticated promotion is accepted",
+			authorization: "Bearer secret",
+			expectCode:    http.StatusOK,
+			expectStandby: false,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, defaultPromoteEndpoint, nil)
+			if input.authorization != "" {
+				req.Header.Set("Authorization", input.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != input.expectCode {
+				t.Errorf("expected status %d, got %d", input.expectCode, rec.Code)
+			}
+
+			if standby.IsStandby() != input.expectStandby {
+				t.Errorf("expected standby to be %t", input.expectStandby)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"istio.io/istio/pkg/log"
+)
+
+// startupCheckInterval is the interval at which connectivity to 3scale is checked during the startup delay
+const startupCheckInterval = time.Second
+
+// startupGate holds the adapter unready during the startup delay, when startup_delay_seconds is set
+var startupGate = &readinessGate{reason: "adapter is waiting for its dependencies during the startup delay"}
+
+// awaitStartup blocks for the configured startup delay before requests are served, ending early once each of the
+// startup check URLs can be reached
+func awaitStartup(client *http.Client) {
+	delay := time.Duration(viper.GetInt("startup_delay_seconds")) * time.Second
+	if delay <= 0 {
+		return
+	}
+	defer startupGate.open()
+
+	start := time.Now()
+	deadline := time.After(delay)
+	urls := getStringSlice("startup_check_urls")
+	if len(urls) == 0 {
+		log.Infof("delaying startup for %s", delay)
+		<-deadline
+		return
+	}
+
+	ticker := time.NewTicker(startupCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := checkConnectivity(client, urls); err == nil {
+			log.Infof("3scale reachable after %s, ending startup delay", time.Since(start).Round(time.Millisecond))
+			return
+		}
+
+		select {
+		case <-deadline:
+			log.Warnf("3scale not reachable within startup delay of %s, serving requests regardless", delay)
+			return
+		case <-ticker.C:
+		}
+	}
+}
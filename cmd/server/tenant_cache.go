@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/istio/pkg/log"
+)
+
+// tenantCacheAuthorizer partitions the configuration cached from 3scale system by tenant, such that services of a
+// tenant with a budget are cached apart from every other tenant, up to the budget, and can neither evict nor be
+// evicted by configuration of other tenants. Each tenant, or provider account, is identified by the host of its
+// admin portal, which is the system URL its services are fetched from. Services of tenants without a budget share
+// the default cache. Calls to 3scale backend are unaffected
+type tenantCacheAuthorizer struct {
+	threescale.ReportingAuthorizer
+	tenants map[string]threescale.Authorizer
+}
+
+// newTenantCacheAuthorizer returns an authorizer fetching configuration via a cache of the budgeted size for each
+// tenant host, falling back to the provided authorizer
+func newTenantCacheAuthorizer(next threescale.ReportingAuthorizer, c *http.Client, budgets map[string]int, reporter *authorizer.MetricsReporter) *tenantCacheAuthorizer {
+	logger := log.FindScope(log.DefaultScopeName)
+	tenants := make(map[string]threescale.Authorizer, len(budgets))
+	for host, budget := range budgets {
+		// backend calls are never routed to the partitions, so they need no backend cache of their own
+		tenants[host] = authorizer.NewManager(c, newSystemCache(budget), authorizer.BackendConfig{Logger: logger}, reporter)
+	}
+	return &tenantCacheAuthorizer{ReportingAuthorizer: next, tenants: tenants}
+}
+
+func (t *tenantCacheAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	return t.partition(systemURL).GetSystemConfiguration(systemURL, request)
+}
+
+func (t *tenantCacheAuthorizer) Shutdown() {
+	for _, tenant := range t.tenants {
+		tenant.Shutdown()
+	}
+	t.ReportingAuthorizer.Shutdown()
+}
+
+// partition returns the authorizer caching configuration for the tenant of the system URL
+func (t *tenantCacheAuthorizer) partition(systemURL string) threescale.Authorizer {
+	u, err := url.Parse(systemURL)
+	if err != nil {
+		return t.ReportingAuthorizer
+	}
+
+	if tenant, ok := t.tenants[strings.ToLower(u.Hostname())]; ok {
+		return tenant
+	}
+	return t.ReportingAuthorizer
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/cmd/server/internal/admin"
+	"github.com/3scale/3scale-istio-adapter/pkg/threescale"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/spf13/viper"
+)
+
+// namedAuthorizer records the name of the authorizer which fetched configuration
+type namedAuthorizer struct {
+	threescale.ReportingAuthorizer
+	name    string
+	fetched *[]string
+}
+
+func (n namedAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	*n.fetched = append(*n.fetched, n.name)
+	return client.ProxyConfig{}, nil
+}
+
+func (n namedAuthorizer) Shutdown() {}
+
+func TestTenantCacheAuthorizerPartition(t *testing.T) {
+	var fetched []string
+	a := &tenantCacheAuthorizer{
+		ReportingAuthorizer: namedAuthorizer{name: "shared", fetched: &fetched},
+		tenants: map[string]threescale.Authorizer{
+			"tenant.example.com": namedAuthorizer{name: "tenant", fetched: &fetched},
+		},
+	}
+
+	inputs := []struct {
+		name      string
+		systemURL string
+		expect    string
+	}{
+		{
+			name:      "Test tenant with a budget is fetched via its partition",
+			systemURL: "https://tenant.example.com",
+			expect:    "tenant",
+		},
+		{
+			name:      "Test tenant is matched by host regardless of case and port",
+			systemURL: "https://TENANT.example.com:443",
+			expect:    "tenant",
+		},
+		{
+			name:      "Test tenant without a budget falls back to the shared cache",
+			systemURL: "https://other.example.com",
+			expect:    "shared",
+		},
+		{
+			name:      "Test invalid system URL falls back to the shared cache",
+			systemURL: "://tenant.example.com",
+			expect:    "shared",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			fetched = nil
+			if _, err := a.GetSystemConfiguration(input.systemURL, authorizer.SystemRequest{ServiceID: "123"}); err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			if len(fetched) != 1 || fetched[0] != input.expect {
+				t.Errorf("expected configuration to be fetched via %s, got %v", input.expect, fetched)
+			}
+		})
+	}
+}
+
+func TestTenantCacheMarksFreshness(t *testing.T) {
+	system := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"proxy_config":{"id":1,"version":1,"environment":"production","content":{"id":123}}}`))
+	}))
+	defer system.Close()
+
+	u, _ := url.Parse(system.URL)
+	viper.Set("health_deep_check", true)
+	viper.Set("tenant_cache_budgets", u.Hostname()+"=10")
+	freshness := cacheFreshness
+	cacheFreshness = &admin.CacheFreshness{}
+	defer func() {
+		viper.Set("health_deep_check", false)
+		viper.Set("tenant_cache_budgets", "")
+		cacheFreshness = freshness
+	}()
+
+	a := newAuthorizer(&http.Client{}, nil)
+	defer a.Shutdown()
+
+	a.GetSystemConfiguration(system.URL, authorizer.SystemRequest{AccessToken: "token", ServiceID: "123", Environment: "production"})
+
+	// the check only fails for configuration which was used without being refreshed
+	if err := cacheFreshness.Check(time.Minute)(); err == nil {
+		t.Errorf("expected fetching configuration via a tenant partition to mark the configuration as used")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redacted replaces sensitive values when they are logged
+const redacted = "<redacted>"
+
+// headerTransport is a http.RoundTripper which sets a static set of headers on each outbound request.
+// Headers which have already been set on the request are never overridden.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+func newHeaderTransport(next http.RoundTripper, headers map[string]string) headerTransport {
+	h := make(http.Header, len(headers))
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return headerTransport{next: next, headers: h}
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the provided request so take a copy before setting headers
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+len(h.headers))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	for k, v := range h.headers {
+		if _, ok := r.Header[k]; !ok {
+			r.Header[k] = v
+		}
+	}
+	return h.next.RoundTrip(r)
+}
+
+// String describes the headers which will be set, with their values redacted
+func (h headerTransport) String() string {
+	var keys []string
+	for k := range h.headers {
+		keys = append(keys, k+"="+redacted)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// transportOrDefault returns the provided RoundTripper, or the default if it is nil
+func transportOrDefault(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
+
+// newDefaultTransport returns a transport with the settings of http.DefaultTransport, such as its proxy, timeouts and
+// limits on idle connections, for settings specific to calls to 3scale to be applied to
+func newDefaultTransport() *http.Transport {
+	return cloneTransport(http.DefaultTransport.(*http.Transport))
+}
+
+// cloneTransport returns a transport with the connection settings of the provided transport, but sharing none of its
+// connections
+func cloneTransport(t *http.Transport) *http.Transport {
+	clone := &http.Transport{
+		Proxy:                  t.Proxy,
+		DialContext:            t.DialContext,
+		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
+		DisableKeepAlives:      t.DisableKeepAlives,
+		DisableCompression:     t.DisableCompression,
+		MaxIdleConns:           t.MaxIdleConns,
+		MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+		IdleConnTimeout:        t.IdleConnTimeout,
+		ResponseHeaderTimeout:  t.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  t.ExpectContinueTimeout,
+		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+	}
+
+	if t.TLSClientConfig != nil {
+		clone.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	return clone
+}
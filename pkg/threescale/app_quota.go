@@ -0,0 +1,63 @@
+package threescale
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+// appQuotaUtilization returns the highest ratio of usage to limit across the usage reports, and false if no report
+// sets a limit
+func appQuotaUtilization(reports api.UsageReports) (float64, bool) {
+	var utilization float64
+	var limited bool
+	for _, metricReports := range reports {
+		for _, report := range metricReports {
+			if report.MaxValue <= 0 {
+				continue
+			}
+
+			ratio := float64(report.CurrentValue) / float64(report.MaxValue)
+			if !limited || ratio > utilization {
+				utilization = ratio
+			}
+			limited = true
+		}
+	}
+	return utilization, limited
+}
+
+// AppIdentifierHash identifies the application of the credentials without exposing them. Unlike credentialHash,
+// the application key is excluded, so that every key of an application shares the same identifier. It is empty for
+// credentials without an application id or user key
+func AppIdentifierHash(params authorizer.BackendParams) string {
+	id := params.AppID
+	if id == "" {
+		id = params.UserKey
+	}
+	if id == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// reportAppQuota reports the utilization of the limits of the application, as returned by 3scale backend
+func (s *Threescale) reportAppQuota(serviceID string, params authorizer.BackendParams, resp *authorizer.BackendResponse) {
+	if s.conf.Metrics == nil || s.conf.Metrics.AppQuotaUtilizationCB == nil || resp == nil {
+		return
+	}
+
+	if params.AppID == "" && params.UserKey == "" {
+		return
+	}
+
+	utilization, ok := appQuotaUtilization(resp.UsageReports)
+	if !ok {
+		return
+	}
+	s.conf.Metrics.AppQuotaUtilizationCB(serviceID, AppIdentifierHash(params), utilization)
+}
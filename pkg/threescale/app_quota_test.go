@@ -0,0 +1,122 @@
+package threescale
+
+import (
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+func TestAppQuotaUtilization(t *testing.T) {
+	inputs := []struct {
+		name        string
+		reports     api.UsageReports
+		expect      float64
+		expectLimit bool
+	}{
+		{
+			name: "Test no usage reports",
+		},
+		{
+			name:    "Test reports without limits are ignored",
+			reports: api.UsageReports{"hits": {{MaxValue: 0, CurrentValue: 5}}},
+		},
+		{
+			name: "Test highest utilization across metrics and periods is returned",
+			reports: api.UsageReports{
+				"hits":   {{MaxValue: 100, CurrentValue: 10}, {MaxValue: 10, CurrentValue: 8}},
+				"orders": {{MaxValue: 4, CurrentValue: 2}},
+			},
+			expect:      0.8,
+			expectLimit: true,
+		},
+		{
+			name:        "Test zero usage against a limit is returned",
+			reports:     api.UsageReports{"hits": {{MaxValue: 10}}},
+			expectLimit: true,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			utilization, limited := appQuotaUtilization(input.reports)
+			if limited != input.expectLimit {
+				t.Errorf("expected limited to be %t, got %t", input.expectLimit, limited)
+			}
+			if utilization != input.expect {
+				t.Errorf("expected utilization %v, got %v", input.expect, utilization)
+			}
+		})
+	}
+}
+
+func TestReportAppQuota(t *testing.T) {
+	resp := &authorizer.BackendResponse{
+		Authorized:   true,
+		UsageReports: api.UsageReports{"hits": {{MaxValue: 4, CurrentValue: 3}}},
+	}
+
+	inputs := []struct {
+		name   string
+		params authorizer.BackendParams
+		resp   *authorizer.BackendResponse
+		expect bool
+	}{
+		{
+			name:   "Test application identified by app id is reported",
+			params: authorizer.BackendParams{AppID: "app", AppKey: "key"},
+			resp:   resp,
+			expect: true,
+		},
+		{
+			name:   "Test application identified by user key is reported",
+			params: authorizer.BackendParams{UserKey: "secret"},
+			resp:   resp,
+			expect: true,
+		},
+		{
+			name:   "Test application without limits is not reported",
+			params: authorizer.BackendParams{AppID: "app"},
+			resp:   &authorizer.BackendResponse{Authorized: true},
+		},
+		{
+			name:   "Test missing response is not reported",
+			params: authorizer.BackendParams{AppID: "app"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported bool
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Metrics: &MetricsReporter{
+						AppQuotaUtilizationCB: func(serviceID, appHash string, utilization float64) {
+							reported = true
+							if appHash != AppIdentifierHash(input.params) {
+								t.Errorf("unexpected app hash %s", appHash)
+							}
+							if appHash == input.params.AppID || appHash == input.params.UserKey {
+								t.Errorf("expected app identifier to be hashed")
+							}
+							if utilization != 0.75 {
+								t.Errorf("expected utilization 0.75, got %v", utilization)
+							}
+						},
+					},
+				},
+			}
+
+			c.reportAppQuota("123", input.params, input.resp)
+			if reported != input.expect {
+				t.Errorf("expected reported to be %t, got %t", input.expect, reported)
+			}
+		})
+	}
+
+	keyA := AppIdentifierHash(authorizer.BackendParams{AppID: "app", AppKey: "a"})
+	keyB := AppIdentifierHash(authorizer.BackendParams{AppID: "app", AppKey: "b"})
+	if keyA != keyB {
+		t.Errorf("expected every key of an application to share its identifier")
+	}
+}
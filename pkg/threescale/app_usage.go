@@ -0,0 +1,88 @@
+package threescale
+
+import (
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// maxAppUsageEntries bounds the memory used to track usage should many distinct applications be seen
+const maxAppUsageEntries = 10000
+
+// AppUsage is the usage of an application against its limits, as last returned by 3scale backend
+type AppUsage struct {
+	ServiceID  string       `json:"service_id"`
+	AppID      string       `json:"app_id"`
+	Authorized bool         `json:"authorized"`
+	ErrorCode  string       `json:"error_code,omitempty"`
+	Usage      []UsageTrace `json:"usage"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// appUsage retains the usage last returned by 3scale backend for each application identified by an application id
+type appUsage struct {
+	mu      sync.Mutex
+	entries map[string]AppUsage
+}
+
+// newAppUsage returns a tracker of application usage if enabled, or nil otherwise
+func newAppUsage(enabled bool) *appUsage {
+	if !enabled {
+		return nil
+	}
+	return &appUsage{entries: make(map[string]AppUsage)}
+}
+
+func appUsageKey(serviceID, appID string) string {
+	return serviceID + "|" + appID
+}
+
+// record retains the usage from a response by 3scale backend. Applications identified by a user key are not tracked,
+// since the key itself would be needed to look them up
+func (u *appUsage) record(serviceID, appID string, resp *authorizer.BackendResponse) {
+	if u == nil || appID == "" || resp == nil {
+		return
+	}
+
+	usage := AppUsage{
+		ServiceID:  serviceID,
+		AppID:      appID,
+		Authorized: resp.Authorized,
+		ErrorCode:  resp.ErrorCode,
+		Usage:      usageTraces(resp.UsageReports),
+		UpdatedAt:  time.Now(),
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := appUsageKey(serviceID, appID)
+	if _, ok := u.entries[key]; !ok && len(u.entries) >= maxAppUsageEntries {
+		// evict an arbitrary entry rather than stop tracking new applications
+		for evict := range u.entries {
+			delete(u.entries, evict)
+			break
+		}
+	}
+	u.entries[key] = usage
+}
+
+// get returns the usage last recorded for the application, if any
+func (u *appUsage) get(serviceID, appID string) (AppUsage, bool) {
+	if u == nil {
+		return AppUsage{}, false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage, ok := u.entries[appUsageKey(serviceID, appID)]
+	return usage, ok
+}
+
+// AppUsage returns the usage of the application against its limits as last returned by 3scale backend, if known.
+// Usage is only tracked when enabled by TrackAppUsage
+func (s *Threescale) AppUsage(serviceID, appID string) (AppUsage, bool) {
+	return s.appUsage.get(serviceID, appID)
+}
@@ -0,0 +1,32 @@
+package threescale
+
+import (
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+func TestAppUsage(t *testing.T) {
+	s := &Threescale{appUsage: newAppUsage(true)}
+
+	s.appUsage.record("123", "", &authorizer.BackendResponse{Authorized: true})
+	if len(s.appUsage.entries) != 0 {
+		t.Errorf("expected applications without an application id not to be tracked")
+	}
+
+	s.appUsage.record("123", "app", &authorizer.BackendResponse{ErrorCode: "limits_exceeded"})
+	usage, ok := s.AppUsage("123", "app")
+	if !ok || usage.Authorized || usage.ErrorCode != "limits_exceeded" || usage.UpdatedAt.IsZero() {
+		t.Errorf("unexpected usage %v", usage)
+	}
+
+	if _, ok := s.AppUsage("456", "app"); ok {
+		t.Errorf("expected usage to be tracked by service")
+	}
+
+	disabled := &Threescale{appUsage: newAppUsage(false)}
+	disabled.appUsage.record("123", "app", &authorizer.BackendResponse{})
+	if _, ok := disabled.AppUsage("123", "app"); ok {
+		t.Errorf("expected usage not to be tracked when disabled")
+	}
+}
@@ -0,0 +1,91 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+const (
+	// AttributeMissing is reported when a required attribute was not provided by the instance
+	AttributeMissing = "missing"
+	// AttributeWrongType is reported when an attribute was provided with a type the adapter cannot read
+	AttributeWrongType = "wrong_type"
+)
+
+// attributeError describes a failure to extract an attribute from the authorization instance
+type attributeError struct {
+	attribute string
+	reason    string
+}
+
+func (e attributeError) Error() string {
+	return fmt.Sprintf("failed to extract attribute %s - %s", e.attribute, e.reason)
+}
+
+// attributeErrors returns the attributes which could not be extracted from the instance.
+// These usually point to a misconfigured Mixer instance rather than a misbehaving client.
+func attributeErrors(instance *authorization.InstanceMsg, cfg *config.Params) []attributeError {
+	if instance == nil {
+		return []attributeError{{attribute: "instance", reason: AttributeMissing}}
+	}
+
+	if instance.Action == nil {
+		return []attributeError{{attribute: "action", reason: AttributeMissing}}
+	}
+
+	var errs []attributeError
+	if instance.Action.Path == "" {
+		errs = append(errs, attributeError{attribute: "action.path", reason: AttributeMissing})
+	}
+
+	if cfg.ServiceId == "" {
+		errs = append(errs, attributeError{attribute: "action.service", reason: AttributeMissing})
+	}
+
+	if instance.Subject == nil {
+		return errs
+	}
+
+	// sort the properties so that errors are reported in a consistent order
+	keys := make([]string, 0, len(instance.Subject.Properties))
+	for key := range instance.Subject.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !isReadableProperty(key, instance.Subject.Properties[key]) {
+			errs = append(errs, attributeError{attribute: "subject.properties." + key, reason: AttributeWrongType})
+		}
+	}
+	return errs
+}
+
+// isReadableProperty returns true if the subject property is of a type the adapter reads.
+// Every property is read as a string, except the SourceIPAttributeKey which may also be an IP address.
+func isReadableProperty(key string, value *v1beta1.Value) bool {
+	switch value.GetValue().(type) {
+	case nil, *v1beta1.Value_StringValue:
+		return true
+	case *v1beta1.Value_IpAddressValue:
+		return key == SourceIPAttributeKey
+	default:
+		return false
+	}
+}
+
+// reportAttributeErrors logs and records metrics for each attribute which could not be extracted
+func (s *Threescale) reportAttributeErrors(ctx context.Context, errs []attributeError) {
+	rlog := logFor(ctx)
+	for _, err := range errs {
+		rlog.Warnf("%v", err)
+		if s.conf.Metrics != nil && s.conf.Metrics.AttributeErrorCB != nil {
+			s.conf.Metrics.AttributeErrorCB(err.attribute, err.reason)
+		}
+	}
+}
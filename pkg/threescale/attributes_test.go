@@ -0,0 +1,79 @@
+package threescale
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestAttributeErrors(t *testing.T) {
+	inputs := []struct {
+		name     string
+		instance *authorization.InstanceMsg
+		cfg      *config.Params
+		expect   []attributeError
+	}{
+		{
+			name:   "Test missing instance",
+			cfg:    &config.Params{},
+			expect: []attributeError{{attribute: "instance", reason: AttributeMissing}},
+		},
+		{
+			name:     "Test missing action",
+			instance: &authorization.InstanceMsg{},
+			cfg:      &config.Params{},
+			expect:   []attributeError{{attribute: "action", reason: AttributeMissing}},
+		},
+		{
+			name:     "Test missing path and service",
+			instance: &authorization.InstanceMsg{Action: &authorization.ActionMsg{}},
+			cfg:      &config.Params{},
+			expect: []attributeError{
+				{attribute: "action.path", reason: AttributeMissing},
+				{attribute: "action.service", reason: AttributeMissing},
+			},
+		},
+		{
+			name: "Test properties of the wrong type",
+			instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{Path: "/test"},
+				Subject: &authorization.SubjectMsg{
+					Properties: map[string]*v1beta1.Value{
+						AppIDAttributeKey:    {Value: &v1beta1.Value_Int64Value{Int64Value: 1}},
+						AppKeyAttributeKey:   {Value: &v1beta1.Value_IpAddressValue{IpAddressValue: &v1beta1.IPAddress{}}},
+						SourceIPAttributeKey: {Value: &v1beta1.Value_IpAddressValue{IpAddressValue: &v1beta1.IPAddress{}}},
+					},
+				},
+			},
+			cfg: &config.Params{ServiceId: "123"},
+			expect: []attributeError{
+				{attribute: "subject.properties." + AppIDAttributeKey, reason: AttributeWrongType},
+				{attribute: "subject.properties." + AppKeyAttributeKey, reason: AttributeWrongType},
+			},
+		},
+		{
+			name: "Test valid instance",
+			instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{Path: "/test"},
+				Subject: &authorization.SubjectMsg{
+					Properties: map[string]*v1beta1.Value{
+						AppIDAttributeKey: {Value: &v1beta1.Value_StringValue{StringValue: "app"}},
+					},
+				},
+			},
+			cfg: &config.Params{ServiceId: "123"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			errs := attributeErrors(input.instance, input.cfg)
+			if !reflect.DeepEqual(errs, input.expect) {
+				t.Errorf("expected %v got %v", input.expect, errs)
+			}
+		})
+	}
+}
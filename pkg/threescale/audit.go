@@ -0,0 +1,145 @@
+package threescale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/pkg/log"
+)
+
+const (
+	// AuditOutcomeAllow is recorded for requests which were allowed
+	AuditOutcomeAllow = "allow"
+	// AuditOutcomeDeny is recorded for requests which were denied
+	AuditOutcomeDeny = "deny"
+)
+
+// AuditRecord describes the authorization decision made for a single request
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+	ServiceID string    `json:"service_id"`
+	// CredentialHash is the hex encoded sha256 of the credentials provided, so that the credentials are never exposed
+	CredentialHash string `json:"credential_hash,omitempty"`
+	// Metrics are the names of the 3scale metrics the request was counted against
+	Metrics []string `json:"metrics,omitempty"`
+	Outcome string   `json:"outcome"`
+	// Code is the name of the rpc status code returned to Mixer
+	Code   string `json:"code"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditSink publishes audit records to an external system
+type AuditSink interface {
+	Publish(record AuditRecord) error
+	Close() error
+}
+
+// auditQueue publishes audit records in the background so that checks are never blocked by the sink
+type auditQueue struct {
+	sink    AuditSink
+	metrics *MetricsReporter
+	records chan AuditRecord
+	wg      sync.WaitGroup
+
+	// mu guards against records being queued once closed, by checks which outlived their deadline
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newAuditQueue starts a worker which publishes audit records queued, up to size, in the background.
+// Returns nil if no sink has been provided.
+func newAuditQueue(sink AuditSink, size int, metrics *MetricsReporter) *auditQueue {
+	if sink == nil {
+		return nil
+	}
+
+	q := &auditQueue{
+		sink:    sink,
+		metrics: metrics,
+		records: make(chan AuditRecord, size),
+	}
+
+	q.wg.Add(1)
+	go q.run()
+	return q
+}
+
+func (q *auditQueue) run() {
+	defer q.wg.Done()
+	for record := range q.records {
+		if err := q.sink.Publish(record); err != nil {
+			log.Errorf("failed to publish audit record for service %s - %v", record.ServiceID, err)
+		}
+	}
+}
+
+// enqueue queues the audit record, dropping it if the queue is full
+func (q *auditQueue) enqueue(record AuditRecord) {
+	if q == nil {
+		return
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	select {
+	case q.records <- record:
+	default:
+		if q.metrics != nil && q.metrics.AuditDroppedCB != nil {
+			q.metrics.AuditDroppedCB()
+		}
+	}
+}
+
+// close stops accepting records, waits for those queued to be published and closes the sink
+func (q *auditQueue) close() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	q.closed = true
+	close(q.records)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	if err := q.sink.Close(); err != nil {
+		log.Errorf("failed to close audit sink - %v", err)
+	}
+}
+
+// audit records the decision made for the request, if an audit sink has been configured
+func (s *Threescale) audit(ctx context.Context, t *checkTimings, result *v1beta1.CheckResult) {
+	if s.audits == nil || result == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	code := rpc.Code(result.Status.Code)
+	outcome := AuditOutcomeDeny
+	if code == rpc.OK {
+		outcome = AuditOutcomeAllow
+	}
+
+	s.audits.enqueue(AuditRecord{
+		Timestamp:      time.Now().UTC(),
+		RequestID:      RequestIDFromContext(ctx),
+		ServiceID:      t.serviceID,
+		CredentialHash: t.credentialHash,
+		Metrics:        t.metrics,
+		Outcome:        outcome,
+		Code:           code.String(),
+		Reason:         result.Status.Message,
+	})
+}
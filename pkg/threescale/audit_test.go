@@ -0,0 +1,116 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+type mockAuditSink struct {
+	published chan AuditRecord
+	block     chan struct{}
+	closed    bool
+}
+
+func (m *mockAuditSink) Publish(record AuditRecord) error {
+	<-m.block
+	m.published <- record
+	return nil
+}
+
+func (m *mockAuditSink) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestAuditQueue(t *testing.T) {
+	var dropped int
+	sink := &mockAuditSink{
+		published: make(chan AuditRecord, 10),
+		block:     make(chan struct{}),
+	}
+
+	q := newAuditQueue(sink, 1, &MetricsReporter{
+		AuditDroppedCB: func() {
+			dropped++
+		},
+	})
+
+	// the first record is taken by the blocked worker, the second is queued and the third dropped
+	for _, service := range []string{"1", "2", "3"} {
+		q.enqueue(AuditRecord{ServiceID: service})
+
+		// wait for the worker to pick up the first record
+		for service == "1" && len(q.records) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if dropped != 1 {
+		t.Errorf("expected one record to be dropped, got %d", dropped)
+	}
+
+	close(sink.block)
+	q.close()
+
+	if len(sink.published) != 2 {
+		t.Errorf("expected queued records to be published before closing, got %d", len(sink.published))
+	}
+
+	if !sink.closed {
+		t.Errorf("expected sink to be closed")
+	}
+
+	// records queued once closed are dropped rather than panic
+	q.enqueue(AuditRecord{ServiceID: "4"})
+}
+
+func TestHandleAuthorizationAudit(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	sink := &mockAuditSink{
+		published: make(chan AuditRecord, 1),
+		block:     make(chan struct{}),
+	}
+	close(sink.block)
+
+	s := &Threescale{
+		conf:   &AdapterConfig{Authorizer: mockAuthorizer{}},
+		audits: newAuditQueue(sink, 1, nil),
+	}
+
+	ctx := ContextWithRequestID(context.TODO(), "abc")
+	s.HandleAuthorization(ctx, request)
+	s.audits.close()
+
+	record := <-sink.published
+	if record.ServiceID != "123" || record.RequestID != "abc" {
+		t.Errorf("unexpected audit record %+v", record)
+	}
+
+	if record.Outcome != AuditOutcomeDeny || record.Code != rpc.UNAUTHENTICATED.String() || record.Reason == "" {
+		t.Errorf("expected denial to be recorded with a reason, got %+v", record)
+	}
+}
@@ -0,0 +1,148 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	system "github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// AuthMode determines which credentials identify the application making a request to a service
+type AuthMode int
+
+const (
+	// AuthModeDeclared uses the authentication mode declared by the service configuration in 3scale
+	AuthModeDeclared AuthMode = iota
+	// AuthModeAPIKey identifies the application by user key
+	AuthModeAPIKey
+	// AuthModeAppID identifies the application by application id and, optionally, application key
+	AuthModeAppID
+	// AuthModeOIDC identifies the application by the client id of an OpenID Connect token issued by the issuer
+	// configured for the service
+	AuthModeOIDC
+)
+
+// IssuerClaimProperty is the subject property holding the issuer of the token, validated in AuthModeOIDC
+const IssuerClaimProperty = ClaimPropertyPrefix + "iss"
+
+// backend versions by which 3scale declares the authentication mode of a service, along with openIDTypeIdentifier
+const (
+	apiKeyBackendVersion = "1"
+	appIDBackendVersion  = "2"
+)
+
+func (m AuthMode) String() string {
+	switch m {
+	case AuthModeAPIKey:
+		return "api_key"
+	case AuthModeAppID:
+		return "app_id"
+	case AuthModeOIDC:
+		return "oidc"
+	default:
+		return "declared"
+	}
+}
+
+// authMode returns the authentication mode of the service, as overridden by AuthModes or otherwise as declared by
+// its configuration in 3scale, and whether the mode is enforced. Modes are only enforced once AuthModes is configured
+func (s *Threescale) authMode(serviceID string, conf system.ProxyConfig) (AuthMode, bool) {
+	if s.conf.AuthModes == nil {
+		return AuthModeDeclared, false
+	}
+
+	if mode := s.conf.AuthModes[serviceID]; mode != AuthModeDeclared {
+		return mode, true
+	}
+
+	switch conf.Content.BackendVersion {
+	case apiKeyBackendVersion:
+		return AuthModeAPIKey, true
+	case appIDBackendVersion:
+		return AuthModeAppID, true
+	case openIDTypeIdentifier:
+		return AuthModeOIDC, true
+	default:
+		return AuthModeDeclared, false
+	}
+}
+
+// withAuthMode returns the configuration declaring the mode, so that credential extractors which honour the declared
+// mode of a service extract credentials as per an overridden mode
+func withAuthMode(conf system.ProxyConfig, mode AuthMode) system.ProxyConfig {
+	switch mode {
+	case AuthModeAPIKey:
+		conf.Content.BackendVersion = apiKeyBackendVersion
+	case AuthModeAppID:
+		conf.Content.BackendVersion = appIDBackendVersion
+	case AuthModeOIDC:
+		conf.Content.BackendVersion = openIDTypeIdentifier
+	}
+	return conf
+}
+
+// credentialsForAuthMode discards any credentials which do not identify an application in the mode
+func credentialsForAuthMode(params authorizer.BackendParams, mode AuthMode) authorizer.BackendParams {
+	switch mode {
+	case AuthModeAPIKey:
+		return authorizer.BackendParams{UserKey: params.UserKey}
+	case AuthModeAppID, AuthModeOIDC:
+		params.UserKey = ""
+		return params
+	default:
+		return params
+	}
+}
+
+// validateIssuer returns an error unless the issuer of the token, which must already have been verified by Istio
+// end user authentication, is the OpenID Connect issuer configured for the service
+func validateIssuer(instance authorization.InstanceMsg, conf system.ProxyConfig) error {
+	endpoint, _ := conf.Content.Proxy.OidcIssuerEndpoint.(string)
+	if endpoint == "" {
+		return fmt.Errorf("service %d does not configure an OpenID Connect issuer", conf.Content.ID)
+	}
+
+	expected, err := issuerFromEndpoint(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid OpenID Connect issuer configured for service %d - %v", conf.Content.ID, err)
+	}
+
+	issuer := strings.TrimSuffix(subjectProperty(instance, IssuerClaimProperty), "/")
+	if issuer != expected {
+		return fmt.Errorf("token issuer %q is not the OpenID Connect issuer configured for the service", issuer)
+	}
+	return nil
+}
+
+// issuerFromEndpoint returns the issuer of the OpenID Connect issuer endpoint configured in 3scale,
+// which embeds the credentials 3scale uses to register clients
+func issuerFromEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	u.User = nil
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// authModeStatus returns the status for a request whose credentials are not valid in the authentication mode
+// of the service, and true, or false if the credentials are valid
+func (s *Threescale) authModeStatus(ctx context.Context, serviceID string, instance authorization.InstanceMsg, conf system.ProxyConfig) (rpc.Status, bool) {
+	mode, enforced := s.authMode(serviceID, conf)
+	if !enforced || mode != AuthModeOIDC {
+		return rpc.Status{}, false
+	}
+
+	if err := validateIssuer(instance, conf); err != nil {
+		logFor(ctx).Warnf("rejecting request for service %s in %s auth mode - %v", serviceID, mode, err)
+		return status.WithUnauthenticated(err.Error()), true
+	}
+	return rpc.Status{}, false
+}
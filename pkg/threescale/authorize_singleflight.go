@@ -0,0 +1,105 @@
+package threescale
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// authorizeCall is a call to authorize a request against 3scale backend, whose result is shared by concurrent
+// identical requests
+type authorizeCall struct {
+	done chan struct{}
+	resp *authorizer.BackendResponse
+	err  error
+}
+
+// authorizeGroup coalesces concurrent identical calls to authorize against 3scale backend into one.
+// The zero value is ready to use
+type authorizeGroup struct {
+	mu    sync.Mutex
+	calls map[string]*authorizeCall
+}
+
+// do calls authorize, unless an identical call is already in flight, in which case its result is returned once
+// complete, or the error of the context should it be done first. The returned bool is true if the result was shared
+func (g *authorizeGroup) do(ctx context.Context, key string, authorize func() (*authorizer.BackendResponse, error)) (*authorizer.BackendResponse, bool, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*authorizeCall)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.resp, true, c.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+
+	c := &authorizeCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.resp, c.err = authorize()
+	return c.resp, false, c.err
+}
+
+// authorizeKey identifies requests to 3scale backend which are identical, that is, made with the same service
+// credentials, application credentials and usage. Credentials are hashed rather than held in memory
+func authorizeKey(backendURL string, request authorizer.BackendRequest) string {
+	var metrics []string
+	var params authorizer.BackendParams
+	if len(request.Transactions) > 0 {
+		params = request.Transactions[0].Params
+		for name, value := range request.Transactions[0].Metrics {
+			metrics = append(metrics, fmt.Sprintf("%s=%d", name, value))
+		}
+	}
+	sort.Strings(metrics)
+
+	auth := sha256.Sum256([]byte(request.Auth.Type + "|" + request.Auth.Value))
+	return fmt.Sprintf("%s|%s|%s|%s|%s", backendURL, request.Service, hex.EncodeToString(auth[:]),
+		credentialHash(params), strings.Join(metrics, ","))
+}
+
+// authorize authorizes the request against 3scale backend. When AuthorizeSingleflight is enabled, identical requests
+// made while a call is in flight share its result rather than calling 3scale backend. The usage of requests which
+// shared an authorized result is queued when reporting asynchronously, but is not reported when reporting synchronously
+func (s *Threescale) authorize(ctx context.Context, backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	if !s.conf.AuthorizeSingleflight {
+		return s.authRep(ctx, backendURL, request)
+	}
+
+	resp, shared, err := s.authorizes.do(ctx, authorizeKey(backendURL, request), func() (*authorizer.BackendResponse, error) {
+		return s.authRep(ctx, backendURL, request)
+	})
+
+	if !shared {
+		return resp, err
+	}
+
+	if s.conf.Metrics != nil && s.conf.Metrics.AuthorizeCoalescedCB != nil {
+		s.conf.Metrics.AuthorizeCoalescedCB(request.Service)
+	}
+
+	if s.reports != nil && err == nil && resp != nil && resp.Authorized {
+		s.reports.enqueue(backendURL, request)
+	}
+	return resp, err
+}
@@ -0,0 +1,135 @@
+package threescale
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+// blockingAuthorizer counts calls to authorize, which complete once released
+type blockingAuthorizer struct {
+	mockAuthorizer
+	calls   *int64
+	release chan struct{}
+}
+
+func (m blockingAuthorizer) AuthRep(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	atomic.AddInt64(m.calls, 1)
+	<-m.release
+	return &authorizer.BackendResponse{Authorized: true}, nil
+}
+
+func TestAuthorizeSingleflight(t *testing.T) {
+	const requests = 20
+
+	request := func(appID string) authorizer.BackendRequest {
+		return authorizer.BackendRequest{
+			Service: "123",
+			Transactions: []authorizer.BackendTransaction{
+				{Params: authorizer.BackendParams{AppID: appID}, Metrics: api.Metrics{"hits": 1}},
+			},
+		}
+	}
+
+	for _, enabled := range []bool{true, false} {
+		var calls, coalesced int64
+		release := make(chan struct{})
+		s := &Threescale{conf: &AdapterConfig{
+			Authorizer:            blockingAuthorizer{calls: &calls, release: release},
+			AuthorizeSingleflight: enabled,
+			Metrics: &MetricsReporter{
+				AuthorizeCoalescedCB: func(serviceID string) { atomic.AddInt64(&coalesced, 1) },
+			},
+		}}
+
+		var wg sync.WaitGroup
+		var authorized int64
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := s.authorize(context.TODO(), "https://su1.3scale.net", request("app"))
+				if err == nil && resp.Authorized {
+					atomic.AddInt64(&authorized, 1)
+				}
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.authorize(context.TODO(), "https://su1.3scale.net", request("other"))
+		}()
+
+		// allow every request to join the call in flight before it completes
+		time.Sleep(time.Millisecond * 100)
+		close(release)
+		wg.Wait()
+
+		if authorized != requests {
+			t.Errorf("expected every request to be authorized, got %d", authorized)
+		}
+
+		expectCalls := int64(requests + 1)
+		if enabled {
+			expectCalls = 2
+		}
+
+		if calls != expectCalls {
+			t.Errorf("expected %d calls to 3scale backend with single flight %v, got %d", expectCalls, enabled, calls)
+		}
+
+		if calls+coalesced != requests+1 {
+			t.Errorf("expected every request not calling 3scale backend to be reported as coalesced, got %d", coalesced)
+		}
+	}
+
+	if authorizeKey("url", request("app")) == authorizeKey("url", request("other")) {
+		t.Errorf("expected requests with distinct credentials to have distinct keys")
+	}
+}
+
+func TestAuthorizeSingleflightDeadline(t *testing.T) {
+	var calls int64
+	release := make(chan struct{})
+	s := &Threescale{conf: &AdapterConfig{
+		Authorizer:            blockingAuthorizer{calls: &calls, release: release},
+		AuthorizeSingleflight: true,
+	}}
+	defer close(release)
+
+	request := authorizer.BackendRequest{
+		Service: "123",
+		Transactions: []authorizer.BackendTransaction{
+			{Params: authorizer.BackendParams{AppID: "app"}, Metrics: api.Metrics{"hits": 1}},
+		},
+	}
+
+	go s.authorize(context.TODO(), "https://su1.3scale.net", request)
+	for atomic.LoadInt64(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the waiter joins the slow call in flight, but must not outlive its own deadline
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*20)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.authorize(ctx, "https://su1.3scale.net", request)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline of the waiter to be exceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the waiter to return once its deadline passed, returned after %s", elapsed)
+	}
+
+	if atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("expected the waiter to join the call in flight, got %d calls", calls)
+	}
+}
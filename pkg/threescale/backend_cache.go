@@ -0,0 +1,165 @@
+package threescale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+const (
+	// backendCacheEntryOverhead approximates the bytes held by the backend cache for an application beyond its
+	// credentials and metrics, such as its limits and the structures holding them
+	backendCacheEntryOverhead = 256
+	// backendCacheMetricOverhead approximates the bytes held by the backend cache for each metric of an application,
+	// beyond its name, such as its usage in each period
+	backendCacheMetricOverhead = 128
+)
+
+// backendCacheBudget bounds the number of entries, and their estimated size in bytes, held by the authorizer's
+// backend cache between flushes. The cache exposes neither its size nor its flushes, so the budget is an
+// approximation. Entries are counted as the distinct service and credential pairs authorized since the budget was
+// last reset, and it is reset on a timer of its own with the same interval as the flush of the cache. The timer
+// starts independently of that of the cache, so a reset may precede or follow the real flush by up to one interval,
+// and a flush which fails to reach 3scale does not empty the cache although the budget is reset regardless.
+type backendCacheBudget struct {
+	maxEntries int
+	maxBytes   int
+	metrics    *MetricsReporter
+
+	mu sync.Mutex
+	// entries holds the estimated size of each entry
+	entries map[string]int
+	bytes   int
+	// flushed is closed on every flush, waking any requests waiting for room in the cache
+	flushed chan struct{}
+	stop    chan struct{}
+}
+
+// newBackendCacheBudget returns a budget allowing maxEntries entries, of maxBytes estimated bytes in total, per flush
+// interval. A non-positive value applies no limit of that kind. Returns nil if no limit applies
+func newBackendCacheBudget(maxEntries, maxBytes int, flushInterval time.Duration, metrics *MetricsReporter) *backendCacheBudget {
+	if (maxEntries <= 0 && maxBytes <= 0) || flushInterval <= 0 {
+		return nil
+	}
+
+	b := &backendCacheBudget{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		metrics:    metrics,
+		entries:    make(map[string]int),
+		flushed:    make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+	go b.run(flushInterval)
+	return b
+}
+
+func (b *backendCacheBudget) run(flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// flush forgets the entries recorded, as the cache is expected to have been flushed once the flush interval elapsed
+func (b *backendCacheBudget) flush() {
+	b.mu.Lock()
+	b.entries = make(map[string]int)
+	b.bytes = 0
+	close(b.flushed)
+	b.flushed = make(chan struct{})
+	b.mu.Unlock()
+
+	b.reportEntries(0, 0)
+}
+
+// admit records the entry for the request, returning false if the budget has been exhausted.
+// When wait is true, admit blocks until the next flush or the context is done.
+func (b *backendCacheBudget) admit(ctx context.Context, request authorizer.BackendRequest, wait bool) bool {
+	if b == nil {
+		return true
+	}
+
+	key := request.Service + "|" + credentialHash(request.Transactions[0].Params)
+	size := backendCacheEntryBytes(request)
+	for {
+		b.mu.Lock()
+		if b.fits(key, size) {
+			// an entry grows as further metrics are reported for it, but never shrinks before a flush
+			if size > b.entries[key] {
+				b.bytes += size - b.entries[key]
+				b.entries[key] = size
+			}
+			count, bytes := len(b.entries), b.bytes
+			b.mu.Unlock()
+
+			b.reportEntries(count, bytes)
+			return true
+		}
+		flushed := b.flushed
+		b.mu.Unlock()
+
+		if !wait {
+			return false
+		}
+
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// fits returns true if the entry of the provided size may be held within the budget. Callers must hold mu
+func (b *backendCacheBudget) fits(key string, size int) bool {
+	current, exists := b.entries[key]
+	if !exists && b.maxEntries > 0 && len(b.entries) >= b.maxEntries {
+		return false
+	}
+
+	if b.maxBytes <= 0 || size <= current {
+		return true
+	}
+
+	// an entry larger than the whole budget is admitted into an empty cache, rather than never being admitted
+	return b.bytes+size-current <= b.maxBytes || len(b.entries) == 0
+}
+
+// backendCacheEntryBytes estimates the bytes held by the backend cache for the application of the request
+func backendCacheEntryBytes(request authorizer.BackendRequest) int {
+	transaction := request.Transactions[0]
+	size := backendCacheEntryOverhead + len(request.Service) +
+		len(transaction.Params.AppID) + len(transaction.Params.AppKey) + len(transaction.Params.UserKey)
+
+	for metric := range transaction.Metrics {
+		size += backendCacheMetricOverhead + len(metric)
+	}
+	return size
+}
+
+func (b *backendCacheBudget) reportEntries(count, bytes int) {
+	if b.metrics != nil && b.metrics.BackendCacheEntriesCB != nil {
+		b.metrics.BackendCacheEntriesCB(count)
+	}
+	if b.metrics != nil && b.metrics.BackendCacheBytesCB != nil {
+		b.metrics.BackendCacheBytesCB(bytes)
+	}
+}
+
+// close stops the flush timer
+func (b *backendCacheBudget) close() {
+	if b == nil {
+		return
+	}
+	close(b.stop)
+}
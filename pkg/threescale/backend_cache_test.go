@@ -0,0 +1,114 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+func TestBackendCacheBudget(t *testing.T) {
+	if b := newBackendCacheBudget(0, 0, time.Second, nil); b != nil {
+		t.Errorf("expected no budget to apply when disabled")
+	}
+
+	newRequest := func(userKey string) authorizer.BackendRequest {
+		return authorizer.BackendRequest{
+			Service:      "123",
+			Transactions: []authorizer.BackendTransaction{{Params: authorizer.BackendParams{UserKey: userKey}}},
+		}
+	}
+
+	var entries int
+	b := newBackendCacheBudget(1, 0, time.Hour, &MetricsReporter{
+		BackendCacheEntriesCB: func(count int) {
+			entries = count
+		},
+	})
+	defer b.close()
+
+	if !b.admit(context.TODO(), newRequest("a"), false) {
+		t.Errorf("expected first application to be admitted")
+	}
+
+	if !b.admit(context.TODO(), newRequest("a"), false) {
+		t.Errorf("expected application already in the cache to be admitted")
+	}
+
+	if b.admit(context.TODO(), newRequest("b"), false) {
+		t.Errorf("expected application beyond the budget to be rejected")
+	}
+
+	if entries != 1 {
+		t.Errorf("expected one entry to be reported, got %d", entries)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	if b.admit(ctx, newRequest("b"), true) {
+		t.Errorf("expected waiting application to be rejected once the context is done")
+	}
+
+	admitted := make(chan bool)
+	go func() {
+		admitted <- b.admit(context.TODO(), newRequest("b"), true)
+	}()
+
+	b.flush()
+	if !<-admitted {
+		t.Errorf("expected waiting application to be admitted once the cache was flushed")
+	}
+}
+
+func TestBackendCacheBudgetBytes(t *testing.T) {
+	newRequest := func(userKey string, metrics api.Metrics) authorizer.BackendRequest {
+		return authorizer.BackendRequest{
+			Service: "123",
+			Transactions: []authorizer.BackendTransaction{{
+				Params:  authorizer.BackendParams{UserKey: userKey},
+				Metrics: metrics,
+			}},
+		}
+	}
+
+	small := newRequest("a", api.Metrics{"hits": 1})
+	size := backendCacheEntryBytes(small)
+	if size != backendCacheEntryOverhead+len("123")+len("a")+backendCacheMetricOverhead+len("hits") {
+		t.Errorf("unexpected estimated size %d", size)
+	}
+
+	var bytes int
+	b := newBackendCacheBudget(0, size*2, time.Hour, &MetricsReporter{
+		BackendCacheBytesCB: func(estimate int) {
+			bytes = estimate
+		},
+	})
+	defer b.close()
+
+	if !b.admit(context.TODO(), small, false) || !b.admit(context.TODO(), newRequest("b", api.Metrics{"hits": 1}), false) {
+		t.Errorf("expected applications within the budget to be admitted")
+	}
+
+	if bytes != size*2 {
+		t.Errorf("expected %d bytes to be reported, got %d", size*2, bytes)
+	}
+
+	if b.admit(context.TODO(), newRequest("c", api.Metrics{"hits": 1}), false) {
+		t.Errorf("expected application beyond the budget to be rejected")
+	}
+
+	if b.admit(context.TODO(), newRequest("a", api.Metrics{"hits": 1, "orders": 1}), false) {
+		t.Errorf("expected application growing beyond the budget to be rejected")
+	}
+
+	b.flush()
+	if bytes != 0 {
+		t.Errorf("expected bytes to be reset once flushed, got %d", bytes)
+	}
+
+	if !b.admit(context.TODO(), newRequest("c", api.Metrics{"hits": 1}), false) {
+		t.Errorf("expected application to be admitted once the cache was flushed")
+	}
+}
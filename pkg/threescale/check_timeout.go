@@ -0,0 +1,42 @@
+package threescale
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// TimeoutHeader is the gRPC metadata key from which a per-request timeout, in milliseconds, is read
+const TimeoutHeader = "x-3scale-timeout-ms"
+
+// checkTimeout returns the deadline for the request. A timeout provided via the TimeoutHeader overrides the CheckTimeout,
+// bounded by the MaxCheckTimeout, while malformed values are ignored
+func (s *Threescale) checkTimeout(ctx context.Context) time.Duration {
+	if s.conf.MaxCheckTimeout <= 0 {
+		return s.conf.CheckTimeout
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return s.conf.CheckTimeout
+	}
+
+	values := md.Get(TimeoutHeader)
+	if len(values) == 0 {
+		return s.conf.CheckTimeout
+	}
+
+	ms, err := strconv.Atoi(values[0])
+	if err != nil || ms <= 0 {
+		logFor(ctx).Debugf("ignoring invalid %s %q - must be a positive number of milliseconds", TimeoutHeader, values[0])
+		return s.conf.CheckTimeout
+	}
+
+	timeout := time.Duration(ms) * time.Millisecond
+	if timeout > s.conf.MaxCheckTimeout {
+		return s.conf.MaxCheckTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,72 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCheckTimeout(t *testing.T) {
+	withHeader := func(value string) context.Context {
+		return metadata.NewIncomingContext(context.TODO(), metadata.Pairs(TimeoutHeader, value))
+	}
+
+	inputs := []struct {
+		name   string
+		ctx    context.Context
+		max    time.Duration
+		expect time.Duration
+	}{
+		{
+			name:   "Test default applies without header",
+			ctx:    context.TODO(),
+			max:    time.Second,
+			expect: time.Millisecond * 500,
+		},
+		{
+			name:   "Test header overrides default",
+			ctx:    withHeader("200"),
+			max:    time.Second,
+			expect: time.Millisecond * 200,
+		},
+		{
+			name:   "Test header is clamped to maximum",
+			ctx:    withHeader("5000"),
+			max:    time.Second,
+			expect: time.Second,
+		},
+		{
+			name:   "Test malformed header is ignored",
+			ctx:    withHeader("fast"),
+			max:    time.Second,
+			expect: time.Millisecond * 500,
+		},
+		{
+			name:   "Test negative header is ignored",
+			ctx:    withHeader("-1"),
+			max:    time.Second,
+			expect: time.Millisecond * 500,
+		},
+		{
+			name:   "Test header is ignored without a maximum",
+			ctx:    withHeader("200"),
+			expect: time.Millisecond * 500,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			s := &Threescale{
+				conf: &AdapterConfig{
+					CheckTimeout:    time.Millisecond * 500,
+					MaxCheckTimeout: input.max,
+				},
+			}
+			if timeout := s.checkTimeout(input.ctx); timeout != input.expect {
+				t.Errorf("expected timeout of %v, got %v", input.expect, timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package threescale
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+const (
+	defaultCircuitProbeInitial = time.Second
+	defaultCircuitProbeMax     = time.Minute
+)
+
+// CircuitState is the state of the circuit to 3scale backend
+type CircuitState int
+
+const (
+	// CircuitClosed allows every call to 3scale backend
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects calls to 3scale backend until the probe interval has elapsed
+	CircuitOpen
+	// CircuitHalfOpen allows a single call to 3scale backend, which probes whether it has recovered
+	CircuitHalfOpen
+)
+
+func (c CircuitState) String() string {
+	switch c {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker configures when calls to 3scale backend are stopped after consecutive failures,
+// and how often 3scale backend is probed for recovery
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit. A non-positive value disables it
+	FailureThreshold int
+	// ProbeInitial is the interval before the first probe once the circuit opens, doubled after each failed probe
+	ProbeInitial time.Duration
+	// ProbeMax bounds the interval between probes
+	ProbeMax time.Duration
+}
+
+// circuitBreaker stops calls to 3scale backend while it is failing, probing it with exponential backoff
+type circuitBreaker struct {
+	conf    CircuitBreaker
+	metrics *MetricsReporter
+	now     func() time.Time
+
+	mu            sync.Mutex
+	state         CircuitState
+	failures      int
+	probeInterval time.Duration
+	nextProbe     time.Time
+}
+
+// newCircuitBreaker returns a breaker as per the provided configuration, or nil if disabled
+func newCircuitBreaker(conf CircuitBreaker, metrics *MetricsReporter) *circuitBreaker {
+	if conf.FailureThreshold <= 0 {
+		return nil
+	}
+
+	if conf.ProbeInitial <= 0 {
+		conf.ProbeInitial = defaultCircuitProbeInitial
+	}
+
+	if conf.ProbeMax < conf.ProbeInitial {
+		conf.ProbeMax = defaultCircuitProbeMax
+		if conf.ProbeMax < conf.ProbeInitial {
+			conf.ProbeMax = conf.ProbeInitial
+		}
+	}
+
+	c := &circuitBreaker{
+		conf:          conf,
+		metrics:       metrics,
+		now:           time.Now,
+		probeInterval: conf.ProbeInitial,
+	}
+
+	if metrics != nil && metrics.CircuitProbeIntervalCB != nil {
+		metrics.CircuitProbeIntervalCB(c.probeInterval)
+	}
+	return c
+}
+
+// allow returns true if a call to 3scale backend may be made. Once the probe interval has elapsed, an open circuit
+// allows a single call through to probe 3scale backend
+func (c *circuitBreaker) allow() bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if c.now().Before(c.nextProbe) {
+			return false
+		}
+		c.transition(CircuitHalfOpen)
+		return true
+	default:
+		// a probe is already in flight
+		return false
+	}
+}
+
+// record updates the circuit with the outcome of a call to 3scale backend permitted by allow
+func (c *circuitBreaker) record(failed bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= c.conf.FailureThreshold {
+			c.open()
+		}
+	case CircuitHalfOpen:
+		if !failed {
+			c.failures = 0
+			c.setProbeInterval(c.conf.ProbeInitial)
+			c.transition(CircuitClosed)
+			return
+		}
+
+		next := c.probeInterval * 2
+		if next > c.conf.ProbeMax {
+			next = c.conf.ProbeMax
+		}
+		c.setProbeInterval(next)
+		c.open()
+	}
+	// failures of calls allowed before the circuit opened are disregarded
+}
+
+// open stops calls until the probe interval elapses. Callers must hold mu
+func (c *circuitBreaker) open() {
+	c.nextProbe = c.now().Add(c.probeInterval)
+	c.transition(CircuitOpen)
+}
+
+// transition changes the state of the circuit, reporting the new state. Callers must hold mu
+func (c *circuitBreaker) transition(state CircuitState) {
+	c.state = state
+	if c.metrics != nil && c.metrics.CircuitStateCB != nil {
+		c.metrics.CircuitStateCB(state.String())
+	}
+}
+
+// setProbeInterval changes the interval before the next probe, reporting it if changed. Callers must hold mu
+func (c *circuitBreaker) setProbeInterval(interval time.Duration) {
+	if interval == c.probeInterval {
+		return
+	}
+
+	c.probeInterval = interval
+	if c.metrics != nil && c.metrics.CircuitProbeIntervalCB != nil {
+		c.metrics.CircuitProbeIntervalCB(interval)
+	}
+}
+
+// isBackendFailure returns true if a call to 3scale backend failed, as opposed to 3scale backend responding
+// with a decision, such that it counts towards opening the circuit
+func isBackendFailure(resp *authorizer.BackendResponse, err error) bool {
+	if _, unexpected := unexpectedBackendResponse(resp, err); unexpected {
+		return true
+	}
+
+	if err == nil {
+		return false
+	}
+
+	if resp != nil {
+		if raw, ok := resp.RawResponse.(*http.Response); ok && raw != nil {
+			return raw.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package threescale
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	if c := newCircuitBreaker(CircuitBreaker{}, nil); c != nil || !c.allow() {
+		t.Errorf("expected no circuit to apply when disabled")
+	}
+
+	var states []string
+	var intervals []time.Duration
+	metrics := &MetricsReporter{
+		CircuitStateCB: func(state string) {
+			states = append(states, state)
+		},
+		CircuitProbeIntervalCB: func(interval time.Duration) {
+			intervals = append(intervals, interval)
+		},
+	}
+
+	c := newCircuitBreaker(CircuitBreaker{
+		FailureThreshold: 2,
+		ProbeInitial:     time.Second,
+		ProbeMax:         time.Second * 3,
+	}, metrics)
+
+	now := time.Now()
+	c.now = func() time.Time {
+		return now
+	}
+
+	c.record(true)
+	c.record(false)
+	c.record(true)
+	if !c.allow() {
+		t.Errorf("expected circuit to remain closed after non consecutive failures")
+	}
+
+	c.record(true)
+	if c.allow() {
+		t.Errorf("expected circuit to open after consecutive failures")
+	}
+
+	// failed probes back off exponentially, up to the max
+	for _, interval := range []time.Duration{time.Second, time.Second * 2, time.Second * 3} {
+		now = now.Add(interval - time.Millisecond)
+		if c.allow() {
+			t.Errorf("expected no probe before %v elapsed", interval)
+		}
+
+		now = now.Add(time.Millisecond)
+		if !c.allow() {
+			t.Errorf("expected probe once %v elapsed", interval)
+		}
+
+		if c.allow() {
+			t.Errorf("expected a single probe at a time")
+		}
+		c.record(true)
+	}
+
+	now = now.Add(time.Second * 3)
+	if !c.allow() {
+		t.Errorf("expected probe once max interval elapsed")
+	}
+	c.record(false)
+
+	if !c.allow() || c.probeInterval != time.Second {
+		t.Errorf("expected circuit to close, resetting the probe interval, once a probe succeeds")
+	}
+
+	expectStates := []string{"open", "half_open", "open", "half_open", "open", "half_open", "open", "half_open", "closed"}
+	if !reflect.DeepEqual(states, expectStates) {
+		t.Errorf("expected state transitions %v, got %v", expectStates, states)
+	}
+
+	expectIntervals := []time.Duration{time.Second, time.Second * 2, time.Second * 3, time.Second}
+	if !reflect.DeepEqual(intervals, expectIntervals) {
+		t.Errorf("expected probe intervals %v, got %v", expectIntervals, intervals)
+	}
+}
+
+func TestIsBackendFailure(t *testing.T) {
+	withStatus := func(code int) *authorizer.BackendResponse {
+		return &authorizer.BackendResponse{RawResponse: &http.Response{StatusCode: code}, ErrorCode: "error"}
+	}
+
+	inputs := []struct {
+		name   string
+		resp   *authorizer.BackendResponse
+		err    error
+		expect bool
+	}{
+		{
+			name:   "Test decision is not a failure",
+			resp:   withStatus(http.StatusForbidden),
+			expect: false,
+		},
+		{
+			name:   "Test error without response is a failure",
+			err:    errors.New("connection refused"),
+			expect: true,
+		},
+		{
+			name:   "Test server error is a failure",
+			resp:   withStatus(http.StatusServiceUnavailable),
+			err:    errors.New("unavailable"),
+			expect: true,
+		},
+		{
+			name:   "Test client error is not a failure",
+			resp:   withStatus(http.StatusNotFound),
+			err:    errors.New("not found"),
+			expect: false,
+		},
+		{
+			name:   "Test unexpected response is a failure",
+			resp:   withStatus(http.StatusBadGateway),
+			expect: true,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			if failed := isBackendFailure(input.resp, input.err); failed != input.expect {
+				t.Errorf("expected failure to be %t, got %t", input.expect, failed)
+			}
+		})
+	}
+}
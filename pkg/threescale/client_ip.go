@@ -0,0 +1,82 @@
+package threescale
+
+import (
+	"net"
+	"strings"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+const (
+	// SourceIPAttributeKey is the subject property expected to hold the address of the immediate peer, such as source.ip
+	SourceIPAttributeKey = "source_ip"
+	// XForwardedForAttributeKey is the subject property expected to hold the X-Forwarded-For request header
+	XForwardedForAttributeKey = HeaderPropertyPrefix + "x-forwarded-for"
+)
+
+// resolveClientIP returns the address of the client which originated the request.
+// When X-Forwarded-For is trusted, the chain is walked from the immediate peer towards the client, skipping any
+// trusted proxies, and the first untrusted address is returned. When no trusted proxies are configured, only the
+// immediate peer is trusted and the right most address, which it appended, is returned, since any address to its
+// left may have been forged by the client.
+func (s *Threescale) resolveClientIP(instance authorization.InstanceMsg) string {
+	peer := sourceIP(instance)
+	if !s.conf.TrustXFF {
+		return peer
+	}
+
+	var chain []string
+	for _, hop := range strings.Split(subjectProperty(instance, XForwardedForAttributeKey), ",") {
+		if hop = strings.TrimSpace(hop); hop != "" {
+			chain = append(chain, hop)
+		}
+	}
+
+	if len(chain) == 0 {
+		return peer
+	}
+
+	if len(s.conf.TrustedProxies) == 0 {
+		return chain[len(chain)-1]
+	}
+
+	if peer != "" && !s.isTrustedProxy(peer) {
+		// the peer is not a proxy we trust so the header may have been forged
+		return peer
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !s.isTrustedProxy(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+// isTrustedProxy returns true if the address falls within any of the trusted proxy ranges
+func (s *Threescale) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range s.conf.TrustedProxies {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP reads the address of the immediate peer, which may be provided as either an IP address or string value
+func sourceIP(instance authorization.InstanceMsg) string {
+	if instance.Subject == nil {
+		return ""
+	}
+
+	value := instance.Subject.Properties[SourceIPAttributeKey]
+	if ip := value.GetIpAddressValue().GetValue(); len(ip) > 0 {
+		return net.IP(ip).String()
+	}
+	return value.GetStringValue()
+}
@@ -0,0 +1,83 @@
+package threescale
+
+import (
+	"net"
+	"testing"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+
+	newInstance := func(peer, xff string) authorization.InstanceMsg {
+		return authorization.InstanceMsg{
+			Subject: &authorization.SubjectMsg{
+				Properties: map[string]*v1beta1.Value{
+					SourceIPAttributeKey: {
+						Value: &v1beta1.Value_IpAddressValue{IpAddressValue: &v1beta1.IPAddress{Value: net.ParseIP(peer)}},
+					},
+					XForwardedForAttributeKey: {
+						Value: &v1beta1.Value_StringValue{StringValue: xff},
+					},
+				},
+			},
+		}
+	}
+
+	inputs := []struct {
+		name     string
+		trustXFF bool
+		trusted  []*net.IPNet
+		instance authorization.InstanceMsg
+		expect   string
+	}{
+		{
+			name:     "Test peer is used when X-Forwarded-For is not trusted",
+			instance: newInstance("10.0.0.1", "1.1.1.1"),
+			expect:   "10.0.0.1",
+		},
+		{
+			name:     "Test right most address is used when no proxies are trusted",
+			trustXFF: true,
+			instance: newInstance("10.0.0.1", "1.1.1.1, 2.2.2.2"),
+			expect:   "2.2.2.2",
+		},
+		{
+			name:     "Test trusted proxies are skipped",
+			trustXFF: true,
+			trusted:  []*net.IPNet{trusted},
+			instance: newInstance("10.0.0.1", "1.1.1.1, 2.2.2.2, 10.0.0.2"),
+			expect:   "2.2.2.2",
+		},
+		{
+			name:     "Test untrusted peer is used since X-Forwarded-For may be forged",
+			trustXFF: true,
+			trusted:  []*net.IPNet{trusted},
+			instance: newInstance("3.3.3.3", "1.1.1.1"),
+			expect:   "3.3.3.3",
+		},
+		{
+			name:     "Test peer is used when X-Forwarded-For is empty",
+			trustXFF: true,
+			instance: newInstance("10.0.0.1", ""),
+			expect:   "10.0.0.1",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			s := &Threescale{
+				conf: &AdapterConfig{
+					TrustXFF:       input.trustXFF,
+					TrustedProxies: input.trusted,
+				},
+			}
+
+			if ip := s.resolveClientIP(input.instance); ip != input.expect {
+				t.Errorf("expected client ip %s got %s", input.expect, ip)
+			}
+		})
+	}
+}
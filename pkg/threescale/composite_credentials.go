@@ -0,0 +1,67 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	system "github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// CompositeCredentials is a CredentialExtractor which reads the application id and key from independently configured
+// locations, for services which expect them in distinct, non default, headers or query parameters. Each location is
+// the name of the subject property holding the component, such as HeaderPropertyPrefix + "x-app-id"
+type CompositeCredentials struct {
+	AppIDLocation  string
+	AppKeyLocation string
+}
+
+// NewCompositeCredentials returns CompositeCredentials reading from the provided locations, both of which are required
+func NewCompositeCredentials(appIDLocation, appKeyLocation string) (*CompositeCredentials, error) {
+	if appIDLocation == "" || appKeyLocation == "" {
+		return nil, fmt.Errorf("both the app id and app key location must be provided for composite credentials")
+	}
+	return &CompositeCredentials{AppIDLocation: appIDLocation, AppKeyLocation: appKeyLocation}, nil
+}
+
+// Extract reads each component of the credentials from its configured location
+func (c *CompositeCredentials) Extract(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	return authorizer.BackendParams{
+		AppID:  subjectProperty(instance, c.AppIDLocation),
+		AppKey: subjectProperty(instance, c.AppKeyLocation),
+	}
+}
+
+// missing returns the location of the first component not provided by the params, or "" if both were provided
+func (c *CompositeCredentials) missing(params authorizer.BackendParams) string {
+	if params.AppID == "" {
+		return c.AppIDLocation
+	}
+	if params.AppKey == "" {
+		return c.AppKeyLocation
+	}
+	return ""
+}
+
+// compositeCredentialsStatus returns the status for a request which provided only one of the components of composite
+// credentials, and true, or false if the request may proceed. Requests which provide neither are left to the
+// missing credential policy
+func (s *Threescale) compositeCredentialsStatus(ctx context.Context, serviceID string, params authorizer.BackendParams) (rpc.Status, bool) {
+	composite, ok := s.credentialExtractor().(*CompositeCredentials)
+	if !ok || params.AppID == "" && params.AppKey == "" {
+		return rpc.Status{}, false
+	}
+
+	location := composite.missing(params)
+	if location == "" {
+		return rpc.Status{}, false
+	}
+
+	msg := fmt.Sprintf("incomplete credentials - no value found in %s", location)
+	logFor(ctx).Warnf("rejecting request for service %s - %s", serviceID, msg)
+	return status.WithUnauthenticated(msg), true
+}
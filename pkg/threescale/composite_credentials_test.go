@@ -0,0 +1,69 @@
+package threescale
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestCompositeCredentials(t *testing.T) {
+	if _, err := NewCompositeCredentials(HeaderPropertyPrefix+"x-app-id", ""); err == nil {
+		t.Errorf("expected error when app key location is not provided")
+	}
+
+	composite, err := NewCompositeCredentials(HeaderPropertyPrefix+"x-app-id", QueryPropertyPrefix+"appkey")
+	if err != nil {
+		t.Fatalf("unexpected error - %v", err)
+	}
+
+	instance := authorization.InstanceMsg{
+		Subject: &authorization.SubjectMsg{
+			User: "attr-user",
+			Properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "x-app-id": {Value: &v1beta1.Value_StringValue{StringValue: "app"}},
+				QueryPropertyPrefix + "appkey":    {Value: &v1beta1.Value_StringValue{StringValue: "key"}},
+			},
+		},
+	}
+
+	params := composite.Extract(instance, client.ProxyConfig{})
+	if params != (authorizer.BackendParams{AppID: "app", AppKey: "key"}) {
+		t.Errorf("unexpected credentials %v", params)
+	}
+
+	s := &Threescale{conf: &AdapterConfig{CredentialExtractor: composite}}
+	inputs := []struct {
+		name     string
+		params   authorizer.BackendParams
+		rejected bool
+	}{
+		{name: "Test both components provided", params: params},
+		{name: "Test neither component provided"},
+		{name: "Test missing app key", params: authorizer.BackendParams{AppID: "app"}, rejected: true},
+		{name: "Test missing app id", params: authorizer.BackendParams{AppKey: "key"}, rejected: true},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			st, rejected := s.compositeCredentialsStatus(context.TODO(), "123", input.params)
+			if rejected != input.rejected {
+				t.Fatalf("expected rejected to be %v", input.rejected)
+			}
+
+			if rejected && !strings.HasPrefix(st.Message, "incomplete credentials") {
+				t.Errorf("unexpected status message %s", st.Message)
+			}
+		})
+	}
+
+	s.conf.CredentialExtractor = nil
+	if _, rejected := s.compositeCredentialsStatus(context.TODO(), "123", authorizer.BackendParams{AppID: "app"}); rejected {
+		t.Errorf("expected request not to be rejected without composite credentials")
+	}
+}
@@ -0,0 +1,39 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	system "github.com/3scale/3scale-porta-go-client/client"
+)
+
+// observeConfigVersion records the version of the configuration fetched for the service, reporting when it has changed
+// since last observed. Each request works with the complete configuration returned by the cache, and never modifies it,
+// so a request sees either the previous or the new version but never a mix of both. Each new version is validated
+// against the local configuration.
+func (s *Threescale) observeConfigVersion(ctx context.Context, cfg *config.Params, conf system.ProxyConfig) {
+	key := unknownServiceKey(cfg)
+
+	s.configVersionsMu.Lock()
+	if s.configVersions == nil {
+		s.configVersions = make(map[string]int)
+	}
+	previous, loaded := s.configVersions[key]
+	s.configVersions[key] = conf.Version
+	s.retainConfig(key, conf)
+	s.configVersionsMu.Unlock()
+
+	if loaded && previous == conf.Version {
+		return
+	}
+
+	s.validateDefaultMetric(ctx, cfg.ServiceId, conf)
+	if !loaded {
+		return
+	}
+
+	logFor(ctx).Infof("configuration for service %s changed from version %d to %d", cfg.ServiceId, previous, conf.Version)
+	if s.conf.Metrics != nil && s.conf.Metrics.ConfigVersionChangeCB != nil {
+		s.conf.Metrics.ConfigVersionChangeCB(cfg.ServiceId)
+	}
+}
@@ -0,0 +1,112 @@
+package threescale
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// refreshingAuthorizer alternates between configurations, as if the cache were refreshed between requests.
+// As with the cache, the same configurations are shared by every request.
+type refreshingAuthorizer struct {
+	mockAuthorizer
+	configs  []client.ProxyConfig
+	requests int64
+}
+
+func (m *refreshingAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	n := atomic.AddInt64(&m.requests, 1)
+	return m.configs[n%int64(len(m.configs))], nil
+}
+
+func TestHandleAuthorizationDuringRefresh(t *testing.T) {
+	newConfig := func(version int, metric string) client.ProxyConfig {
+		return client.ProxyConfig{
+			Version: version,
+			Content: client.Content{
+				Proxy: client.ContentProxy{
+					// the rules are out of order so that evaluating them requires sorting
+					ProxyRules: []client.ProxyRule{
+						{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: metric + "_last", Delta: 1, Position: 2},
+						{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: metric, Delta: 1, Position: 1, Last: true},
+					},
+				},
+			},
+		}
+	}
+
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	var changes int64
+	mock := &refreshingAuthorizer{
+		mockAuthorizer: mockAuthorizer{
+			withAuthResponse: &authorizer.BackendResponse{ErrorCode: "user_key_invalid"},
+			withAuthRepCallback: func(backendURL string, request authorizer.BackendRequest, t *testing.T) {
+				metrics := request.Transactions[0].Metrics
+				if len(metrics) != 1 || (metrics["v1"] != 1 && metrics["v2"] != 1) {
+					t.Errorf("expected usage from a single version of the configuration, got %v", metrics)
+				}
+			},
+			t: t,
+		},
+		configs: []client.ProxyConfig{newConfig(1, "v1"), newConfig(2, "v2")},
+	}
+
+	s := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: mock,
+			Metrics: &MetricsReporter{
+				ConfigVersionChangeCB: func(serviceID string) {
+					atomic.AddInt64(&changes, 1)
+				},
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.HandleAuthorization(context.TODO(), request)
+		}()
+	}
+	wg.Wait()
+
+	for _, conf := range mock.configs {
+		if conf.Content.Proxy.ProxyRules[0].Position != 2 {
+			t.Errorf("expected the shared configuration not to be modified by requests")
+		}
+	}
+
+	if atomic.LoadInt64(&changes) == 0 {
+		t.Errorf("expected configuration version changes to be reported")
+	}
+}
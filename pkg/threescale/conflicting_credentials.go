@@ -0,0 +1,72 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	system "github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// conflictingCredentialsReason is the status message of requests rejected for presenting conflicting credentials
+const conflictingCredentialsReason = "conflicting credentials"
+
+// conflicting returns the names of two sources of the chain which each yield credentials, where those credentials
+// disagree, and true, or false if every source which yields credentials agrees. Where the auth mode is enforced, only
+// the credentials which identify an application in that mode are compared
+func (c *CredentialChain) conflicting(instance authorization.InstanceMsg, conf system.ProxyConfig, mode AuthMode, enforced bool) (string, string, bool) {
+	var first authorizer.BackendParams
+	var firstSource string
+	for i, extractor := range c.extractors {
+		params := extractor.Extract(instance, conf)
+		if enforced {
+			params = credentialsForAuthMode(params, mode)
+		}
+		if !hasCredentials(params) {
+			continue
+		}
+
+		if firstSource == "" {
+			first, firstSource = params, c.sources[i]
+			continue
+		}
+		if credentialsDisagree(first, params) {
+			return firstSource, c.sources[i], true
+		}
+	}
+	return "", "", false
+}
+
+// credentialsDisagree returns true if the params identify different applications, or provide different app keys
+func credentialsDisagree(a, b authorizer.BackendParams) bool {
+	if a.UserKey != b.UserKey || a.AppID != b.AppID {
+		return true
+	}
+	return a.AppKey != "" && b.AppKey != "" && a.AppKey != b.AppKey
+}
+
+// conflictingCredentialsStatus returns the status for a request whose credential sources yield credentials which
+// disagree, such as different user keys in a header and a query parameter, and true, or false if the request may
+// proceed. Only applies when rejecting conflicting credentials and the CredentialExtractor is a CredentialChain
+func (s *Threescale) conflictingCredentialsStatus(ctx context.Context, serviceID string, instance authorization.InstanceMsg, conf system.ProxyConfig) (rpc.Status, bool) {
+	chain, ok := s.credentialExtractor().(*CredentialChain)
+	if !ok || !s.conf.RejectConflictingCredentials {
+		return rpc.Status{}, false
+	}
+
+	mode, enforced := s.authMode(serviceID, conf)
+	a, b, conflict := chain.conflicting(instance, withAuthMode(conf, mode), mode, enforced)
+	if !conflict {
+		return rpc.Status{}, false
+	}
+
+	if s.conf.Metrics != nil && s.conf.Metrics.ConflictingCredentialsCB != nil {
+		s.conf.Metrics.ConflictingCredentialsCB(serviceID)
+	}
+
+	logFor(ctx).Warnf("rejecting request for service %s - credentials from sources %s and %s disagree", serviceID, a, b)
+	return status.WithUnauthenticated(conflictingCredentialsReason), true
+}
@@ -0,0 +1,104 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestConflictingCredentialsStatus(t *testing.T) {
+	stringValue := func(v string) *v1beta1.Value {
+		return &v1beta1.Value{Value: &v1beta1.Value_StringValue{StringValue: v}}
+	}
+
+	chain, err := NewCredentialChain(HeaderCredentialSource, QueryCredentialSource)
+	if err != nil {
+		t.Fatalf("unexpected error creating credential source chain - %v", err)
+	}
+
+	inputs := []struct {
+		name       string
+		properties map[string]*v1beta1.Value
+		rejected   bool
+	}{
+		{
+			name: "Test differing user keys are rejected",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "user_key": stringValue("header-user"),
+				QueryPropertyPrefix + "user_key":  stringValue("query-user"),
+			},
+			rejected: true,
+		},
+		{
+			name: "Test a user key and an app id are rejected",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "user_key": stringValue("header-user"),
+				QueryPropertyPrefix + "app_id":    stringValue("query-app"),
+			},
+			rejected: true,
+		},
+		{
+			name: "Test differing app keys are rejected",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "app_id":  stringValue("app"),
+				HeaderPropertyPrefix + "app_key": stringValue("header-key"),
+				QueryPropertyPrefix + "app_id":   stringValue("app"),
+				QueryPropertyPrefix + "app_key":  stringValue("query-key"),
+			},
+			rejected: true,
+		},
+		{
+			name: "Test agreeing credentials proceed",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "user_key": stringValue("user"),
+				QueryPropertyPrefix + "user_key":  stringValue("user"),
+			},
+		},
+		{
+			name: "Test an app key in a single source proceeds",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "app_id":  stringValue("app"),
+				HeaderPropertyPrefix + "app_key": stringValue("key"),
+				QueryPropertyPrefix + "app_id":   stringValue("app"),
+			},
+		},
+		{
+			name: "Test credentials from a single source proceed",
+			properties: map[string]*v1beta1.Value{
+				QueryPropertyPrefix + "user_key": stringValue("user"),
+			},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported []string
+			s := &Threescale{conf: &AdapterConfig{
+				CredentialExtractor:          chain,
+				RejectConflictingCredentials: true,
+				Metrics: &MetricsReporter{ConflictingCredentialsCB: func(serviceID string) {
+					reported = append(reported, serviceID)
+				}},
+			}}
+
+			instance := authorization.InstanceMsg{Subject: &authorization.SubjectMsg{Properties: input.properties}}
+			st, rejected := s.conflictingCredentialsStatus(context.TODO(), "123", instance, client.ProxyConfig{})
+			if rejected != input.rejected {
+				t.Fatalf("expected rejected to be %v", input.rejected)
+			}
+
+			if rejected && (st.Message != conflictingCredentialsReason || len(reported) != 1) {
+				t.Errorf("expected conflicting credentials to be rejected and reported, got %v, %v", st, reported)
+			}
+
+			s.conf.RejectConflictingCredentials = false
+			if _, rejected := s.conflictingCredentialsStatus(context.TODO(), "123", instance, client.ProxyConfig{}); rejected {
+				t.Errorf("expected request not to be rejected unless enabled")
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package threescale
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// CredentialLogMode determines how credentials appear in the logs of the adapter
+type CredentialLogMode int
+
+const (
+	// CredentialLogHashed logs the hex encoded sha256 of credentials, so that requests with the same credentials
+	// may be correlated without exposing them
+	CredentialLogHashed CredentialLogMode = iota
+	// CredentialLogNone logs credentials in plain text and should only be used while debugging
+	CredentialLogNone
+	// CredentialLogMasked replaces credentials entirely
+	CredentialLogMasked
+	// CredentialLogLast4 logs only the last four characters of credentials, masking those of eight characters or fewer
+	CredentialLogLast4
+)
+
+// redactCredential returns the credential as it must appear in logs as per the mode
+func redactCredential(mode CredentialLogMode, credential string) string {
+	if credential == "" {
+		return ""
+	}
+
+	switch mode {
+	case CredentialLogNone:
+		return credential
+	case CredentialLogMasked:
+		return redacted
+	case CredentialLogLast4:
+		if len(credential) <= 8 {
+			return redacted
+		}
+		return "..." + credential[len(credential)-4:]
+	default:
+		sum := sha256.Sum256([]byte(credential))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// redactCredential returns the credential as it must appear in logs as per the CredentialLogMode
+func (s *Threescale) redactCredential(credential string) string {
+	return redactCredential(s.conf.CredentialLogMode, credential)
+}
+
+// formatCredentials returns the credentials, other than the app id, as they must appear in logs
+func (s *Threescale) formatCredentials(params authorizer.BackendParams) string {
+	var pairs []string
+	if params.UserKey != "" {
+		pairs = append(pairs, fmt.Sprintf("user_key=%s", s.redactCredential(params.UserKey)))
+	}
+	if params.AppKey != "" {
+		pairs = append(pairs, fmt.Sprintf("app_key=%s", s.redactCredential(params.AppKey)))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// redactInstance returns a copy of the instance whose subject user and any properties which may hold credentials
+// are redacted, so that it may be logged
+func (s *Threescale) redactInstance(instance *authorization.InstanceMsg) *authorization.InstanceMsg {
+	if instance == nil || instance.Subject == nil {
+		return instance
+	}
+
+	subject := *instance.Subject
+	subject.User = s.redactCredential(subject.User)
+	if len(subject.Properties) > 0 {
+		subject.Properties = make(map[string]*v1beta1.Value, len(instance.Subject.Properties))
+		for key, value := range instance.Subject.Properties {
+			if isSecretAttribute(key) {
+				value = &v1beta1.Value{Value: &v1beta1.Value_StringValue{
+					StringValue: s.redactCredential(attributeValue(value)),
+				}}
+			}
+			subject.Properties[key] = value
+		}
+	}
+
+	redactedInstance := *instance
+	redactedInstance.Subject = &subject
+	return &redactedInstance
+}
@@ -0,0 +1,69 @@
+package threescale
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestRedactCredential(t *testing.T) {
+	const credential = "0123456789abcdef"
+
+	inputs := []struct {
+		name       string
+		mode       CredentialLogMode
+		credential string
+		expect     string
+	}{
+		{name: "Test hashed", mode: CredentialLogHashed, credential: credential, expect: "sha256:9f9f5111f7b27a781f1f1ddde5ebc2dd2b796bfc7365c9c28b548e564176929f"},
+		{name: "Test none", mode: CredentialLogNone, credential: credential, expect: credential},
+		{name: "Test masked", mode: CredentialLogMasked, credential: credential, expect: redacted},
+		{name: "Test last4", mode: CredentialLogLast4, credential: credential, expect: "...cdef"},
+		{name: "Test last4 masks short credentials", mode: CredentialLogLast4, credential: "abcd", expect: redacted},
+		{name: "Test empty credential", mode: CredentialLogMasked, credential: "", expect: ""},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			if v := redactCredential(input.mode, input.credential); v != input.expect {
+				t.Errorf("expected %q, got %q", input.expect, v)
+			}
+		})
+	}
+}
+
+func TestRedactInstance(t *testing.T) {
+	s := &Threescale{conf: &AdapterConfig{CredentialLogMode: CredentialLogMasked}}
+
+	instance := &authorization.InstanceMsg{
+		Subject: &authorization.SubjectMsg{
+			User: "secret-user-key",
+			Properties: map[string]*v1beta1.Value{
+				AppIDAttributeKey:  {Value: &v1beta1.Value_StringValue{StringValue: "app"}},
+				AppKeyAttributeKey: {Value: &v1beta1.Value_StringValue{StringValue: "secret-app-key"}},
+			},
+		},
+	}
+
+	logged := s.redactInstance(instance)
+	if logged.Subject.User != redacted || logged.Subject.Properties[AppKeyAttributeKey].GetStringValue() != redacted {
+		t.Errorf("expected credentials to be redacted, got %v", logged.Subject)
+	}
+
+	if logged.Subject.Properties[AppIDAttributeKey].GetStringValue() != "app" {
+		t.Errorf("expected app id not to be redacted")
+	}
+
+	if instance.Subject.User != "secret-user-key" || instance.Subject.Properties[AppKeyAttributeKey].GetStringValue() != "secret-app-key" {
+		t.Errorf("expected instance not to be modified")
+	}
+
+	creds := s.formatCredentials(authorizer.BackendParams{AppID: "app", AppKey: "secret-app-key"})
+	if creds != "app_key="+redacted || strings.Contains(creds, "secret") {
+		t.Errorf("unexpected formatted credentials %s", creds)
+	}
+}
@@ -0,0 +1,231 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	system "github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+const (
+	// DefaultCredentialSource extracts credentials from the subject user and properties of the instance
+	DefaultCredentialSource = "attributes"
+	// HeaderCredentialSource extracts credentials from subject properties prefixed with HeaderPropertyPrefix
+	HeaderCredentialSource = "header"
+	// QueryCredentialSource extracts credentials from subject properties prefixed with QueryPropertyPrefix
+	QueryCredentialSource = "query"
+	// JWTCredentialSource extracts the application id from the subject property ClaimPropertyPrefix + JWTClientIDClaim
+	JWTCredentialSource = "jwt"
+
+	// HeaderPropertyPrefix is expected on subject properties which hold request header values
+	HeaderPropertyPrefix = "header."
+	// QueryPropertyPrefix is expected on subject properties which hold request query parameter values
+	QueryPropertyPrefix = "query."
+	// ClaimPropertyPrefix is expected on subject properties which hold JWT claim values
+	ClaimPropertyPrefix = "claim."
+	// JWTClientIDClaim is the claim which holds the application id, as per the 3scale OpenID Connect integration
+	JWTClientIDClaim = "azp"
+
+	// default parameter names for credentials where they have not been customised in the 3scale proxy config
+	defaultUserKeyParam = "user_key"
+	defaultAppIDParam   = "app_id"
+	defaultAppKeyParam  = "app_key"
+)
+
+// CredentialExtractor extracts the application credentials from an authorization request.
+// The 3scale configuration for the service is provided to allow for customised credential names.
+type CredentialExtractor interface {
+	Extract(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams
+}
+
+// CredentialExtractorFunc allows ordinary functions to be used as a CredentialExtractor
+type CredentialExtractorFunc func(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams
+
+// Extract calls fn(instance, conf)
+func (fn CredentialExtractorFunc) Extract(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	return fn(instance, conf)
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]CredentialExtractor{
+		DefaultCredentialSource: CredentialExtractorFunc(extractFromAttributes),
+		HeaderCredentialSource:  prefixedPropertyExtractor{prefix: HeaderPropertyPrefix},
+		QueryCredentialSource:   prefixedPropertyExtractor{prefix: QueryPropertyPrefix},
+		JWTCredentialSource:     CredentialExtractorFunc(extractFromJWT),
+	}
+)
+
+// RegisterCredentialExtractor makes a CredentialExtractor available by the provided name.
+// An error is returned if an extractor has already been registered by that name.
+func RegisterCredentialExtractor(name string, extractor CredentialExtractor) error {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	if _, ok := extractors[name]; ok {
+		return fmt.Errorf("credential extractor %s is already registered", name)
+	}
+	extractors[name] = extractor
+	return nil
+}
+
+// GetCredentialExtractor returns the CredentialExtractor registered by the provided name
+func GetCredentialExtractor(name string) (CredentialExtractor, error) {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	extractor, ok := extractors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown credential source %s - must be one of %v", name, registeredSources())
+	}
+	return extractor, nil
+}
+
+// registeredSources returns the sorted names of all registered extractors. Callers must hold extractorsMu
+func registeredSources() []string {
+	var names []string
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CredentialChain is a CredentialExtractor which tries each of its sources in order, using the credentials of the
+// first source to yield either an application id or a user key
+type CredentialChain struct {
+	sources    []string
+	extractors []CredentialExtractor
+}
+
+// NewCredentialChain returns a CredentialChain of the extractors registered by the provided names, in order
+func NewCredentialChain(sources ...string) (*CredentialChain, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("credential source chain must provide at least one source")
+	}
+
+	chain := &CredentialChain{sources: sources}
+	for _, source := range sources {
+		extractor, err := GetCredentialExtractor(source)
+		if err != nil {
+			return nil, err
+		}
+		chain.extractors = append(chain.extractors, extractor)
+	}
+	return chain, nil
+}
+
+// Extract returns the credentials of the first source which yields any, or empty credentials if none do
+func (c *CredentialChain) Extract(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	params, _ := c.extract(instance, conf)
+	return params
+}
+
+// extract returns the credentials of the first source which yields any, along with the name of that source
+func (c *CredentialChain) extract(instance authorization.InstanceMsg, conf system.ProxyConfig) (authorizer.BackendParams, string) {
+	for i, extractor := range c.extractors {
+		params := extractor.Extract(instance, conf)
+		if hasCredentials(params) {
+			return params, c.sources[i]
+		}
+	}
+	return authorizer.BackendParams{}, ""
+}
+
+// hasCredentials returns true if the params identify an application
+func hasCredentials(params authorizer.BackendParams) bool {
+	return params.AppID != "" || params.UserKey != ""
+}
+
+// extractFromAttributes reads the user key from the subject user and the application id and key from the subject properties.
+// Where the service is integrated with OpenID Connect, the application id is read from the OIDCAttributeKey property.
+func extractFromAttributes(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	var params authorizer.BackendParams
+	if instance.Subject == nil {
+		return params
+	}
+
+	appIdentifierKey := AppIDAttributeKey
+	if conf.Content.BackendVersion == openIDTypeIdentifier {
+		// OIDC integration configured so force app identifier to come from jwt claims
+		appIdentifierKey = OIDCAttributeKey
+	}
+
+	params.AppID = instance.Subject.Properties[appIdentifierKey].GetStringValue()
+	params.AppKey = instance.Subject.Properties[AppKeyAttributeKey].GetStringValue()
+	params.UserKey = instance.Subject.User
+	return params
+}
+
+// extractFromJWT reads the application id from the claim used by the 3scale OpenID Connect integration
+func extractFromJWT(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	return authorizer.BackendParams{
+		AppID: subjectProperty(instance, ClaimPropertyPrefix+JWTClientIDClaim),
+	}
+}
+
+// prefixedPropertyExtractor reads credentials from subject properties named by the prefix and the
+// credential parameter names configured for the service in 3scale
+type prefixedPropertyExtractor struct {
+	prefix string
+}
+
+func (e prefixedPropertyExtractor) Extract(instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	proxy := conf.Content.Proxy
+	return authorizer.BackendParams{
+		AppID:   subjectProperty(instance, e.prefix+stringOrDefault(proxy.AuthAppID, defaultAppIDParam)),
+		AppKey:  subjectProperty(instance, e.prefix+stringOrDefault(proxy.AuthAppKey, defaultAppKeyParam)),
+		UserKey: subjectProperty(instance, e.prefix+stringOrDefault(proxy.AuthUserKey, defaultUserKeyParam)),
+	}
+}
+
+func subjectProperty(instance authorization.InstanceMsg, key string) string {
+	if instance.Subject == nil {
+		return ""
+	}
+	return instance.Subject.Properties[key].GetStringValue()
+}
+
+func stringOrDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// extractCredentials reads the credentials from the request as per the configured CredentialExtractor, reporting the
+// source which matched when it is a CredentialChain
+func (s *Threescale) extractCredentials(serviceID string, instance authorization.InstanceMsg, conf system.ProxyConfig) authorizer.BackendParams {
+	chain, ok := s.credentialExtractor().(*CredentialChain)
+	if !ok {
+		return s.credentialExtractor().Extract(instance, conf)
+	}
+
+	params, source := chain.extract(instance, conf)
+	if source != "" && s.conf.Metrics != nil && s.conf.Metrics.CredentialSourceCB != nil {
+		s.conf.Metrics.CredentialSourceCB(serviceID, source)
+	}
+	return params
+}
+
+// missingCredentialsStatus returns the status for a request which did not provide any credentials, as per the configured policy
+func (s *Threescale) missingCredentialsStatus(ctx context.Context, serviceID string) rpc.Status {
+	if s.conf.Metrics != nil && s.conf.Metrics.MissingCredentialsCB != nil {
+		s.conf.Metrics.MissingCredentialsCB(serviceID)
+	}
+
+	if s.conf.MissingCredentialPolicy == MissingCredentialAllowAnonymous {
+		logFor(ctx).Debugf("no credentials provided for service %s, missing credential policy is allow_anonymous - allowing request", serviceID)
+		return status.OK
+	}
+
+	logFor(ctx).Errorf("%s", errNoCredentials.Error())
+	return status.WithUnauthenticated(errNoCredentials.Error())
+}
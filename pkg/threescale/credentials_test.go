@@ -0,0 +1,176 @@
+package threescale
+
+import (
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestCredentialExtractors(t *testing.T) {
+	stringValue := func(v string) *v1beta1.Value {
+		return &v1beta1.Value{Value: &v1beta1.Value_StringValue{StringValue: v}}
+	}
+
+	instance := authorization.InstanceMsg{
+		Subject: &authorization.SubjectMsg{
+			User: "attr-user",
+			Properties: map[string]*v1beta1.Value{
+				AppIDAttributeKey:                      stringValue("attr-app"),
+				AppKeyAttributeKey:                     stringValue("attr-key"),
+				OIDCAttributeKey:                       stringValue("attr-client"),
+				HeaderPropertyPrefix + "user_key":      stringValue("header-user"),
+				HeaderPropertyPrefix + "x-app-id":      stringValue("header-app"),
+				QueryPropertyPrefix + "app_id":         stringValue("query-app"),
+				QueryPropertyPrefix + "app_key":        stringValue("query-key"),
+				ClaimPropertyPrefix + JWTClientIDClaim: stringValue("jwt-client"),
+			},
+		},
+	}
+
+	inputs := []struct {
+		name   string
+		source string
+		conf   client.ProxyConfig
+		expect authorizer.BackendParams
+	}{
+		{
+			name:   "Test attributes source",
+			source: DefaultCredentialSource,
+			expect: authorizer.BackendParams{AppID: "attr-app", AppKey: "attr-key", UserKey: "attr-user"},
+		},
+		{
+			name:   "Test attributes source with OpenID Connect",
+			source: DefaultCredentialSource,
+			conf:   client.ProxyConfig{Content: client.Content{BackendVersion: openIDTypeIdentifier}},
+			expect: authorizer.BackendParams{AppID: "attr-client", AppKey: "attr-key", UserKey: "attr-user"},
+		},
+		{
+			name:   "Test header source honours custom parameter names",
+			source: HeaderCredentialSource,
+			conf:   client.ProxyConfig{Content: client.Content{Proxy: client.ContentProxy{AuthAppID: "x-app-id"}}},
+			expect: authorizer.BackendParams{AppID: "header-app", UserKey: "header-user"},
+		},
+		{
+			name:   "Test query source",
+			source: QueryCredentialSource,
+			expect: authorizer.BackendParams{AppID: "query-app", AppKey: "query-key"},
+		},
+		{
+			name:   "Test jwt source",
+			source: JWTCredentialSource,
+			expect: authorizer.BackendParams{AppID: "jwt-client"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			extractor, err := GetCredentialExtractor(input.source)
+			if err != nil {
+				t.Fatalf("unexpected error - %v", err)
+			}
+
+			params := extractor.Extract(instance, input.conf)
+			if params != input.expect {
+				t.Errorf("expected %+v got %+v", input.expect, params)
+			}
+		})
+	}
+}
+
+func TestRegisterCredentialExtractor(t *testing.T) {
+	if _, err := GetCredentialExtractor("unknown"); err == nil {
+		t.Errorf("expected error for unknown credential source")
+	}
+
+	if err := RegisterCredentialExtractor(HeaderCredentialSource, prefixedPropertyExtractor{}); err == nil {
+		t.Errorf("expected error when registering a duplicate credential source")
+	}
+}
+
+func TestCredentialChain(t *testing.T) {
+	stringValue := func(v string) *v1beta1.Value {
+		return &v1beta1.Value{Value: &v1beta1.Value_StringValue{StringValue: v}}
+	}
+
+	if _, err := NewCredentialChain(); err == nil {
+		t.Errorf("expected error for an empty credential source chain")
+	}
+
+	if _, err := NewCredentialChain(JWTCredentialSource, "unknown"); err == nil {
+		t.Errorf("expected error for an unknown credential source in the chain")
+	}
+
+	chain, err := NewCredentialChain(JWTCredentialSource, HeaderCredentialSource, QueryCredentialSource)
+	if err != nil {
+		t.Fatalf("unexpected error creating credential source chain - %v", err)
+	}
+
+	inputs := []struct {
+		name         string
+		properties   map[string]*v1beta1.Value
+		expectSource string
+		expect       authorizer.BackendParams
+	}{
+		{
+			name: "Test first source is used when it provides credentials",
+			properties: map[string]*v1beta1.Value{
+				ClaimPropertyPrefix + JWTClientIDClaim: stringValue("jwt-client"),
+				HeaderPropertyPrefix + "user_key":      stringValue("header-user"),
+			},
+			expectSource: JWTCredentialSource,
+			expect:       authorizer.BackendParams{AppID: "jwt-client"},
+		},
+		{
+			name: "Test later source is used when earlier sources provide no credentials",
+			properties: map[string]*v1beta1.Value{
+				QueryPropertyPrefix + "app_id":  stringValue("query-app"),
+				QueryPropertyPrefix + "app_key": stringValue("query-key"),
+			},
+			expectSource: QueryCredentialSource,
+			expect:       authorizer.BackendParams{AppID: "query-app", AppKey: "query-key"},
+		},
+		{
+			name: "Test an app key alone does not match a source",
+			properties: map[string]*v1beta1.Value{
+				HeaderPropertyPrefix + "app_key": stringValue("header-key"),
+			},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported []string
+			s := &Threescale{conf: &AdapterConfig{
+				CredentialExtractor: chain,
+				Metrics: &MetricsReporter{
+					CredentialSourceCB: func(serviceID, source string) {
+						reported = append(reported, serviceID+"/"+source)
+					},
+				},
+			}}
+
+			instance := authorization.InstanceMsg{
+				Subject: &authorization.SubjectMsg{Properties: input.properties},
+			}
+			params := s.extractCredentials("123", instance, client.ProxyConfig{})
+			if params != input.expect {
+				t.Errorf("unexpected credentials, expected %+v, got %+v", input.expect, params)
+			}
+
+			if input.expectSource == "" {
+				if len(reported) != 0 {
+					t.Errorf("expected no source to be reported, got %v", reported)
+				}
+				return
+			}
+
+			if len(reported) != 1 || reported[0] != "123/"+input.expectSource {
+				t.Errorf("expected source %s to be reported, got %v", input.expectSource, reported)
+			}
+		})
+	}
+}
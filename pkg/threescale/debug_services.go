@@ -0,0 +1,129 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+	"istio.io/istio/pkg/log"
+)
+
+// redacted is logged in place of credentials when they are masked
+const redacted = "[redacted]"
+
+// debugLog logs the requests of the DebugServiceIDs at info level, independently of the level of the default scope
+var debugLog = log.RegisterScope("debug-services", "Attributes of requests to the services selected for debugging", 0)
+
+// secretAttributeFragments identify subject properties whose values must never be logged
+var secretAttributeFragments = []string{"key", "token", "secret", "password", "authorization"}
+
+// newDebugServices returns the set of service ids whose requests are logged in detail, or nil if there are none
+func newDebugServices(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	debug := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		debug[id] = true
+	}
+	return debug
+}
+
+// isDebugService returns true if requests for the service are logged in detail
+func (s *Threescale) isDebugService(serviceID string) bool {
+	return s.debugServices[serviceID]
+}
+
+// logDebugAttributes logs the attributes of the instance, with any which may hold credentials redacted
+func (s *Threescale) logDebugAttributes(ctx context.Context, serviceID string, instance *authorization.InstanceMsg) {
+	if !s.isDebugService(serviceID) || instance == nil {
+		return
+	}
+
+	attrs := make(map[string]string)
+	if action := instance.Action; action != nil {
+		attrs["action.namespace"] = action.Namespace
+		attrs["action.service"] = action.Service
+		attrs["action.method"] = action.Method
+		attrs["action.path"] = action.Path
+	}
+
+	if subject := instance.Subject; subject != nil {
+		if subject.User != "" {
+			attrs["subject.user"] = s.redactCredential(subject.User)
+		}
+
+		for key, value := range subject.Properties {
+			attrs["subject.properties."+key] = s.redactAttribute(key, attributeValue(value))
+		}
+	}
+
+	debugLog.Infof(logFor(ctx).format("debug service %s: attributes %s"), serviceID, formatAttributes(attrs))
+}
+
+// logDebugRequest logs the credentials and metrics extracted from a request, with credentials redacted
+func (s *Threescale) logDebugRequest(ctx context.Context, serviceID string, params authorizer.BackendParams, metrics api.Metrics) {
+	if !s.isDebugService(serviceID) {
+		return
+	}
+
+	debugLog.Infof(logFor(ctx).format("debug service %s: app_id=%q %s metrics=%v"),
+		serviceID, params.AppID, s.formatCredentials(params), metrics)
+}
+
+// redactAttribute returns the value of the attribute, redacted as per the CredentialLogMode if its name suggests
+// it holds credentials
+func (s *Threescale) redactAttribute(key, value string) string {
+	if isSecretAttribute(key) {
+		return s.redactCredential(value)
+	}
+	return value
+}
+
+// isSecretAttribute returns true if the name of the attribute suggests it holds credentials
+func isSecretAttribute(key string) bool {
+	lower := strings.ToLower(key)
+	for _, fragment := range secretAttributeFragments {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeValue returns the value of a subject property, formatting values other than strings and IP addresses by type
+func attributeValue(value *v1beta1.Value) string {
+	switch v := value.GetValue().(type) {
+	case nil:
+		return ""
+	case *v1beta1.Value_StringValue:
+		return v.StringValue
+	case *v1beta1.Value_IpAddressValue:
+		return net.IP(v.IpAddressValue.GetValue()).String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// formatAttributes returns the attributes as space separated key=value pairs, sorted by key
+func formatAttributes(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, attrs[key]))
+	}
+	return strings.Join(pairs, " ")
+}
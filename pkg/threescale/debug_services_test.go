@@ -0,0 +1,31 @@
+package threescale
+
+import (
+	"testing"
+)
+
+func TestRedactAttribute(t *testing.T) {
+	inputs := []struct {
+		key    string
+		expect string
+	}{
+		{key: AppIDAttributeKey, expect: "value"},
+		{key: AppKeyAttributeKey, expect: redacted},
+		{key: HeaderPropertyPrefix + "user_key", expect: redacted},
+		{key: HeaderPropertyPrefix + "Authorization", expect: redacted},
+		{key: QueryPropertyPrefix + "access_token", expect: redacted},
+		{key: ClaimPropertyPrefix + JWTClientIDClaim, expect: "value"},
+	}
+
+	s := &Threescale{conf: &AdapterConfig{CredentialLogMode: CredentialLogMasked}}
+	for _, input := range inputs {
+		if v := s.redactAttribute(input.key, "value"); v != input.expect {
+			t.Errorf("expected %q for attribute %s, got %q", input.expect, input.key, v)
+		}
+	}
+
+	attrs := formatAttributes(map[string]string{"b": "2", "a": "1"})
+	if attrs != `a="1" b="2"` {
+		t.Errorf("unexpected formatted attributes %s", attrs)
+	}
+}
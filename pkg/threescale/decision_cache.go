@@ -0,0 +1,140 @@
+package threescale
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultMaxDecisionCacheEntries bounds the entries shared by the caches of decisions, should many distinct
+// credentials be seen, when MaxDecisionCacheEntries is not set
+const defaultMaxDecisionCacheEntries = 20000
+
+const (
+	// DecisionCacheNegative labels entries of the negative cache
+	DecisionCacheNegative = "negative"
+	// DecisionCacheLastKnown labels entries of the last known decisions
+	DecisionCacheLastKnown = "last_known"
+)
+
+const (
+	// DecisionCacheHit is reported when an unexpired entry was found
+	DecisionCacheHit = "hit"
+	// DecisionCacheMiss is reported when no entry was found, or the entry found had expired
+	DecisionCacheMiss = "miss"
+)
+
+// decisionCacheKey identifies an entry of a particular cache, so that caches may use the same keys
+type decisionCacheKey struct {
+	cache string
+	key   string
+}
+
+type decisionCacheEntry struct {
+	key     decisionCacheKey
+	value   interface{}
+	expires time.Time
+}
+
+// decisionCache is a size bounded store shared by the caches of decisions made by 3scale backend, such that their
+// combined memory is predictable. Once full, the least recently used entry of any cache is evicted
+type decisionCache struct {
+	max     int
+	metrics *MetricsReporter
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[decisionCacheKey]*list.Element
+}
+
+// newDecisionCache returns a cache holding up to max entries. A non-positive max applies the default
+func newDecisionCache(max int, metrics *MetricsReporter) *decisionCache {
+	if max <= 0 {
+		max = defaultMaxDecisionCacheEntries
+	}
+
+	return &decisionCache{
+		max:     max,
+		metrics: metrics,
+		order:   list.New(),
+		entries: make(map[decisionCacheKey]*list.Element),
+	}
+}
+
+// get returns the value held for the key of the cache, and whether it has expired. Expired entries are removed
+func (c *decisionCache) get(cache, key string, now time.Time) (interface{}, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[decisionCacheKey{cache: cache, key: key}]
+	if !ok {
+		c.report(cache, DecisionCacheMiss)
+		return nil, false, false
+	}
+
+	entry := element.Value.(*decisionCacheEntry)
+	if now.After(entry.expires) {
+		c.remove(element)
+		c.report(cache, DecisionCacheMiss)
+		return entry.value, true, true
+	}
+
+	c.order.MoveToFront(element)
+	c.report(cache, DecisionCacheHit)
+	return entry.value, true, false
+}
+
+// add holds the value for the key of the cache until it expires, evicting the least recently used entries of any
+// cache should the cache be full
+func (c *decisionCache) add(cache, key string, value interface{}, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := decisionCacheKey{cache: cache, key: key}
+	if element, ok := c.entries[k]; ok {
+		entry := element.Value.(*decisionCacheEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	for c.order.Len() >= c.max {
+		oldest := c.order.Back()
+		c.remove(oldest)
+		if c.metrics != nil && c.metrics.DecisionCacheEvictedCB != nil {
+			c.metrics.DecisionCacheEvictedCB(oldest.Value.(*decisionCacheEntry).key.cache)
+		}
+	}
+
+	c.entries[k] = c.order.PushFront(&decisionCacheEntry{key: k, value: value, expires: expires})
+	c.reportEntries()
+}
+
+// delete removes the value held for the key of the cache, if any
+func (c *decisionCache) delete(cache, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[decisionCacheKey{cache: cache, key: key}]; ok {
+		c.remove(element)
+	}
+}
+
+// remove deletes the entry from the cache. Callers must hold mu
+func (c *decisionCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*decisionCacheEntry).key)
+	c.reportEntries()
+}
+
+func (c *decisionCache) report(cache, result string) {
+	if c.metrics != nil && c.metrics.DecisionCacheRequestCB != nil {
+		c.metrics.DecisionCacheRequestCB(cache, result)
+	}
+}
+
+func (c *decisionCache) reportEntries() {
+	if c.metrics != nil && c.metrics.DecisionCacheEntriesCB != nil {
+		c.metrics.DecisionCacheEntriesCB(c.order.Len())
+	}
+}
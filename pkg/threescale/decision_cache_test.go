@@ -0,0 +1,58 @@
+package threescale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecisionCache(t *testing.T) {
+	results := make(map[string]int)
+	evicted := make(map[string]int)
+	var entries int
+	c := newDecisionCache(2, &MetricsReporter{
+		DecisionCacheRequestCB: func(cache, result string) { results[cache+"|"+result]++ },
+		DecisionCacheEvictedCB: func(cache string) { evicted[cache]++ },
+		DecisionCacheEntriesCB: func(n int) { entries = n },
+	})
+
+	now := time.Now()
+	expires := now.Add(time.Minute)
+
+	// the same key may be used by each cache without conflict
+	c.add(DecisionCacheNegative, "a", "user_key_invalid", expires)
+	c.add(DecisionCacheLastKnown, "a", true, expires)
+	if entries != 2 {
+		t.Errorf("expected 2 entries, got %d", entries)
+	}
+
+	if v, ok, expired := c.get(DecisionCacheNegative, "a", now); !ok || expired || v != "user_key_invalid" {
+		t.Errorf("unexpected negative entry %v", v)
+	}
+
+	// the last known entry is now least recently used, so is evicted to make room for an entry of the other cache
+	c.add(DecisionCacheNegative, "b", "application_not_found", expires)
+	if _, ok, _ := c.get(DecisionCacheLastKnown, "a", now); ok {
+		t.Errorf("expected least recently used entry to be evicted")
+	}
+	if evicted[DecisionCacheLastKnown] != 1 || entries != 2 {
+		t.Errorf("expected eviction of last known entry to be reported, got %v with %d entries", evicted, entries)
+	}
+
+	if _, ok, expired := c.get(DecisionCacheNegative, "b", now.Add(time.Hour)); !ok || !expired {
+		t.Errorf("expected entry to have expired")
+	}
+	if _, ok, _ := c.get(DecisionCacheNegative, "b", now); ok {
+		t.Errorf("expected expired entry to be removed")
+	}
+
+	expect := map[string]int{
+		DecisionCacheNegative + "|" + DecisionCacheHit:   1,
+		DecisionCacheNegative + "|" + DecisionCacheMiss:  2,
+		DecisionCacheLastKnown + "|" + DecisionCacheMiss: 1,
+	}
+	for k, v := range expect {
+		if results[k] != v {
+			t.Errorf("expected %d results for %s, got %d", v, k, results[k])
+		}
+	}
+}
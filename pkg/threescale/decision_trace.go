@@ -0,0 +1,178 @@
+package threescale
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/pkg/log"
+)
+
+// DecisionTrace describes an authorization decision in full, for analysis such as anomaly detection
+type DecisionTrace struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id,omitempty"`
+	ServiceID string    `json:"service_id"`
+	// CredentialHash is the hex encoded sha256 of the credentials provided, so that the credentials are never exposed
+	CredentialHash string `json:"credential_hash,omitempty"`
+	// Metrics are the names of the 3scale metrics the request was counted against
+	Metrics []string `json:"metrics,omitempty"`
+	// Usage is the usage of the application against its limits, as returned by 3scale backend
+	Usage   []UsageTrace `json:"usage,omitempty"`
+	Outcome string       `json:"outcome"`
+	// Code is the name of the rpc status code returned to Mixer
+	Code   string `json:"code"`
+	Reason string `json:"reason,omitempty"`
+	// LatencySeconds is the time taken by the adapter to make the decision
+	LatencySeconds float64 `json:"latency_seconds"`
+}
+
+// UsageTrace is the usage of a metric against its limit for a period
+type UsageTrace struct {
+	Metric  string `json:"metric"`
+	Period  string `json:"period"`
+	Current int    `json:"current"`
+	Max     int    `json:"max"`
+}
+
+// DecisionTraceSink publishes decision traces to an external system
+type DecisionTraceSink interface {
+	Publish(trace DecisionTrace) error
+	Close() error
+}
+
+// decisionTraceQueue publishes a sample of decision traces in the background so that checks are never blocked by the sink
+type decisionTraceQueue struct {
+	sink       DecisionTraceSink
+	sampleRate float64
+	metrics    *MetricsReporter
+	traces     chan DecisionTrace
+	wg         sync.WaitGroup
+
+	// mu guards against traces being queued once closed, by checks which outlived their deadline
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newDecisionTraceQueue starts a worker which publishes the sampled decision traces queued, up to size, in the
+// background. Returns nil if no sink has been provided or nothing is sampled
+func newDecisionTraceQueue(sink DecisionTraceSink, sampleRate float64, size int, metrics *MetricsReporter) *decisionTraceQueue {
+	if sink == nil || sampleRate <= 0 {
+		return nil
+	}
+
+	q := &decisionTraceQueue{
+		sink:       sink,
+		sampleRate: sampleRate,
+		metrics:    metrics,
+		traces:     make(chan DecisionTrace, size),
+	}
+
+	q.wg.Add(1)
+	go q.run()
+	return q
+}
+
+func (q *decisionTraceQueue) run() {
+	defer q.wg.Done()
+	for trace := range q.traces {
+		if err := q.sink.Publish(trace); err != nil {
+			log.Errorf("failed to publish decision trace for service %s - %v", trace.ServiceID, err)
+		}
+	}
+}
+
+// sampled returns true if the decision for a request should be traced
+func (q *decisionTraceQueue) sampled() bool {
+	return q != nil && (q.sampleRate >= 1 || rand.Float64() < q.sampleRate)
+}
+
+// enqueue queues the trace, dropping it if the queue is full
+func (q *decisionTraceQueue) enqueue(trace DecisionTrace) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	select {
+	case q.traces <- trace:
+	default:
+		if q.metrics != nil && q.metrics.DecisionTraceDroppedCB != nil {
+			q.metrics.DecisionTraceDroppedCB()
+		}
+	}
+}
+
+// close stops accepting traces, waits for those queued to be published and closes the sink
+func (q *decisionTraceQueue) close() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	q.closed = true
+	close(q.traces)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	if err := q.sink.Close(); err != nil {
+		log.Errorf("failed to close decision trace sink - %v", err)
+	}
+}
+
+// traceDecision records the decision made for the request, if it is sampled
+func (s *Threescale) traceDecision(ctx context.Context, t *checkTimings, result *v1beta1.CheckResult, elapsed time.Duration) {
+	if result == nil || !s.decisionTraces.sampled() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	code := rpc.Code(result.Status.Code)
+	outcome := AuditOutcomeDeny
+	if code == rpc.OK {
+		outcome = AuditOutcomeAllow
+	}
+
+	s.decisionTraces.enqueue(DecisionTrace{
+		Timestamp:      time.Now().UTC(),
+		RequestID:      RequestIDFromContext(ctx),
+		ServiceID:      t.serviceID,
+		CredentialHash: t.credentialHash,
+		Metrics:        t.metrics,
+		Usage:          usageTraces(t.usage),
+		Outcome:        outcome,
+		Code:           code.String(),
+		Reason:         result.Status.Message,
+		LatencySeconds: elapsed.Seconds(),
+	})
+}
+
+// usageTraces flattens the usage reports, sorted by metric
+func usageTraces(reports api.UsageReports) []UsageTrace {
+	var traces []UsageTrace
+	for metric, metricReports := range reports {
+		for _, report := range metricReports {
+			traces = append(traces, UsageTrace{
+				Metric:  metric,
+				Period:  report.PeriodWindow.Period.String(),
+				Current: report.CurrentValue,
+				Max:     report.MaxValue,
+			})
+		}
+	}
+
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].Metric < traces[j].Metric
+	})
+	return traces
+}
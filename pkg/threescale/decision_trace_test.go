@@ -0,0 +1,93 @@
+package threescale
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+type mockDecisionTraceSink struct {
+	traces chan DecisionTrace
+}
+
+func (m mockDecisionTraceSink) Publish(trace DecisionTrace) error {
+	m.traces <- trace
+	return nil
+}
+
+func (m mockDecisionTraceSink) Close() error {
+	return nil
+}
+
+func TestTraceDecision(t *testing.T) {
+	sink := mockDecisionTraceSink{traces: make(chan DecisionTrace, 10)}
+	s := &Threescale{
+		conf:           &AdapterConfig{},
+		decisionTraces: newDecisionTraceQueue(sink, 1, 10, nil),
+	}
+
+	timings := &checkTimings{
+		serviceID:      "123",
+		credentialHash: "hash",
+		metrics:        []string{"hits"},
+		usage: api.UsageReports{
+			"hits": {{PeriodWindow: api.PeriodWindow{Period: api.Minute}, CurrentValue: 5, MaxValue: 10}},
+		},
+	}
+
+	result := newCheckResult()
+	result.Status = status.WithResourceExhausted("limits_exceeded")
+	s.traceDecision(context.TODO(), timings, result, time.Millisecond*20)
+	s.decisionTraces.close()
+
+	if len(sink.traces) != 1 {
+		t.Fatalf("expected a single trace, got %d", len(sink.traces))
+	}
+
+	trace := <-sink.traces
+	if trace.ServiceID != "123" || trace.Outcome != AuditOutcomeDeny || trace.Code != "RESOURCE_EXHAUSTED" || trace.LatencySeconds != 0.02 {
+		t.Errorf("unexpected trace %+v", trace)
+	}
+
+	expectUsage := []UsageTrace{{Metric: "hits", Period: api.Minute.String(), Current: 5, Max: 10}}
+	if !reflect.DeepEqual(trace.Usage, expectUsage) {
+		t.Errorf("expected usage %+v, got %+v", expectUsage, trace.Usage)
+	}
+}
+
+func TestDecisionTraceSampling(t *testing.T) {
+	if q := newDecisionTraceQueue(mockDecisionTraceSink{}, 0, 10, nil); q != nil {
+		t.Errorf("expected tracing to be disabled without a sample rate")
+	}
+
+	var dropped int
+	sink := mockDecisionTraceSink{traces: make(chan DecisionTrace)}
+	q := &decisionTraceQueue{
+		sink:       sink,
+		sampleRate: 0.5,
+		metrics:    &MetricsReporter{DecisionTraceDroppedCB: func() { dropped++ }},
+		traces:     make(chan DecisionTrace, 1),
+	}
+
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		if q.sampled() {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("expected around half of decisions to be sampled, got %d", sampled)
+	}
+
+	// without a worker, the second trace exceeds the buffer
+	q.enqueue(DecisionTrace{})
+	q.enqueue(DecisionTrace{})
+	if dropped != 1 {
+		t.Errorf("expected trace beyond the buffer to be dropped, got %d", dropped)
+	}
+}
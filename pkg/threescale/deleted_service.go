@@ -0,0 +1,48 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	system "github.com/3scale/3scale-porta-go-client/client"
+)
+
+// retainConfig records the configuration last fetched for the service, when the DeletedServicePolicy retains it.
+// Callers must hold configVersionsMu
+func (s *Threescale) retainConfig(key string, conf system.ProxyConfig) {
+	if s.conf.DeletedServicePolicy != DeletedServiceRetain {
+		return
+	}
+
+	if s.lastKnownConfigs == nil {
+		s.lastKnownConfigs = make(map[string]system.ProxyConfig)
+	}
+	s.lastKnownConfigs[key] = conf
+}
+
+// deletedServiceConfig is called when 3scale system reports the service to be unknown. A service whose configuration
+// was previously fetched has been deleted, which is reported once. When the DeletedServicePolicy retains configuration,
+// the configuration last fetched is returned with true, to be used in place of the fetched configuration
+func (s *Threescale) deletedServiceConfig(ctx context.Context, cfg *config.Params) (system.ProxyConfig, bool) {
+	key := unknownServiceKey(cfg)
+
+	s.configVersionsMu.Lock()
+	_, known := s.configVersions[key]
+	delete(s.configVersions, key)
+	conf, retained := s.lastKnownConfigs[key]
+	s.configVersionsMu.Unlock()
+
+	if known {
+		if s.conf.Metrics != nil && s.conf.Metrics.DeletedServiceCB != nil {
+			s.conf.Metrics.DeletedServiceCB(cfg.ServiceId)
+		}
+
+		if retained {
+			logFor(ctx).Warnf("service %s has been deleted from 3scale, deleted service policy is retain - "+
+				"serving version %d of its configuration", cfg.ServiceId, conf.Version)
+		} else {
+			logFor(ctx).Warnf("service %s has been deleted from 3scale, deleted service policy is evict", cfg.ServiceId)
+		}
+	}
+	return conf, retained
+}
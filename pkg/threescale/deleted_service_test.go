@@ -0,0 +1,122 @@
+package threescale
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// deletingAuthorizer returns the configuration for the first request, after which the service is deleted
+type deletingAuthorizer struct {
+	mockAuthorizer
+	requests int
+}
+
+func (m *deletingAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	m.requests++
+	if m.requests > 1 {
+		return client.ProxyConfig{}, notFoundErr{}
+	}
+	return m.withConfig, nil
+}
+
+func TestHandleAuthorizationDeletedService(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "VALID",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	conf := client.ProxyConfig{
+		Version: 3,
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: "hits", Delta: 1},
+				},
+			},
+		},
+	}
+
+	inputs := []struct {
+		name          string
+		policy        DeletedServicePolicy
+		unknownPolicy UnknownServicePolicy
+		expectStatus  int32
+	}{
+		{
+			name:          "Test deleted service with evict policy applies the unknown service policy",
+			policy:        DeletedServiceEvict,
+			unknownPolicy: UnknownServiceDeny,
+			expectStatus:  int32(rpc.NOT_FOUND),
+		},
+		{
+			name:          "Test deleted service with retain policy is authorized with the last known configuration",
+			policy:        DeletedServiceRetain,
+			unknownPolicy: UnknownServiceDeny,
+			expectStatus:  int32(rpc.OK),
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var deleted []string
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer: &deletingAuthorizer{
+						mockAuthorizer: mockAuthorizer{
+							withConfig:       conf,
+							withAuthResponse: &authorizer.BackendResponse{},
+							t:                t,
+						},
+					},
+					DeletedServicePolicy: input.policy,
+					UnknownServicePolicy: input.unknownPolicy,
+					Metrics: &MetricsReporter{
+						DeletedServiceCB: func(serviceID string) {
+							deleted = append(deleted, serviceID)
+						},
+					},
+				},
+			}
+
+			result, _ := c.HandleAuthorization(context.TODO(), request)
+			if result.Status.Code != int32(rpc.OK) {
+				t.Fatalf("expected request before deletion to be authorized, got %v", result.Status.Code)
+			}
+
+			for i := 0; i < 2; i++ {
+				result, _ = c.HandleAuthorization(context.TODO(), request)
+				if result.Status.Code != input.expectStatus {
+					t.Errorf("expected %v got %v", input.expectStatus, result.Status.Code)
+				}
+			}
+
+			if len(deleted) != 1 || deleted[0] != "123" {
+				t.Errorf("expected the deletion to be reported once, got %v", deleted)
+			}
+		})
+	}
+}
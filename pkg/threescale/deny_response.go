@@ -0,0 +1,93 @@
+package threescale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"text/template"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+)
+
+// DefaultDenyResponseTemplate renders the reason a request was denied as a JSON error
+const DefaultDenyResponseTemplate = `{"error":{"code":{{json .Code}},"message":{{json .Reason}},"service_id":{{json .ServiceID}}` +
+	`{{if .RetryAfter}},"retry_after":{{.RetryAfter}}{{end}}}}`
+
+// DenyResponse is the data available to the template which renders the message of a denied request
+type DenyResponse struct {
+	// ServiceID is the id of the 3scale service the request was made to, if known
+	ServiceID string
+	// Code is the name of the status returned to Mixer, such as PERMISSION_DENIED
+	Code string
+	// Reason is the message the request would otherwise have been denied with
+	Reason string
+	// RetryAfter is the number of seconds until the exceeded limit resets, or zero if unknown
+	RetryAfter int64
+}
+
+// NewDenyResponseTemplate parses the template which renders the message of a denied request.
+// The template is executed against sample data so that errors are found before any request is denied
+func NewDenyResponseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("deny_response").Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := DenyResponse{ServiceID: "123", Code: rpc.PERMISSION_DENIED.String(), Reason: "denied", RetryAfter: 60}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// toJSON encodes the value so that it may be embedded safely in a JSON template
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// renderDenyResponse replaces the message of a denied request with the configured template, keeping the original
+// message should the template fail to render
+func (s *Threescale) renderDenyResponse(ctx context.Context, t *checkTimings, result *v1beta1.CheckResult) {
+	if s.conf.DenyResponseTemplate == nil || result == nil || result.Status.Code == int32(rpc.OK) {
+		return
+	}
+
+	t.mu.Lock()
+	resp := DenyResponse{
+		ServiceID:  t.serviceID,
+		Code:       rpc.Code(result.Status.Code).String(),
+		Reason:     result.Status.Message,
+		RetryAfter: int64(t.retryAfter / time.Second),
+	}
+	t.mu.Unlock()
+
+	var b bytes.Buffer
+	if err := s.conf.DenyResponseTemplate.Execute(&b, resp); err != nil {
+		logFor(ctx).Errorf("failed to render deny response for service %s - %v", resp.ServiceID, err)
+		return
+	}
+	result.Status.Message = b.String()
+}
+
+// retryAfter returns the time until the earliest exceeded limit in the usage reports resets, or zero if none has
+func retryAfter(reports api.UsageReports, now time.Time) time.Duration {
+	var earliest time.Duration
+	for _, metricReports := range reports {
+		for _, report := range metricReports {
+			if report.IsForEternity() || report.CurrentValue < report.MaxValue {
+				continue
+			}
+
+			until := time.Unix(report.PeriodWindow.End, 0).Sub(now)
+			if until > 0 && (earliest == 0 || until < earliest) {
+				earliest = until
+			}
+		}
+	}
+	return earliest.Round(time.Second)
+}
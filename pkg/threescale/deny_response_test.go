@@ -0,0 +1,72 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+func TestNewDenyResponseTemplate(t *testing.T) {
+	if _, err := NewDenyResponseTemplate(DefaultDenyResponseTemplate); err != nil {
+		t.Errorf("unexpected error parsing default template - %v", err)
+	}
+
+	for _, text := range []string{"{{.Reason", "{{.Unknown}}"} {
+		if _, err := NewDenyResponseTemplate(text); err == nil {
+			t.Errorf("expected template %q to be rejected", text)
+		}
+	}
+}
+
+func TestRenderDenyResponse(t *testing.T) {
+	tmpl, err := NewDenyResponseTemplate(DefaultDenyResponseTemplate)
+	if err != nil {
+		t.Fatalf("unexpected error parsing template - %v", err)
+	}
+
+	s := &Threescale{conf: &AdapterConfig{DenyResponseTemplate: tmpl}}
+	timings := &checkTimings{serviceID: "123", retryAfter: time.Second * 42}
+
+	result := newCheckResult()
+	result.Status = status.WithResourceExhausted(`limits "exceeded"`)
+	s.renderDenyResponse(context.TODO(), timings, result)
+
+	expect := `{"error":{"code":"RESOURCE_EXHAUSTED","message":"limits \"exceeded\"","service_id":"123","retry_after":42}}`
+	if result.Status.Message != expect {
+		t.Errorf("unexpected deny response %s", result.Status.Message)
+	}
+
+	result = newCheckResult()
+	result.Status = status.OK
+	s.renderDenyResponse(context.TODO(), timings, result)
+	if result.Status.Code != int32(rpc.OK) || result.Status.Message != "" {
+		t.Errorf("expected authorized response to be unchanged, got %v", result.Status)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	reports := api.UsageReports{
+		"hits": {
+			{PeriodWindow: api.PeriodWindow{Period: api.Minute, End: 1030}, MaxValue: 10, CurrentValue: 10},
+			{PeriodWindow: api.PeriodWindow{Period: api.Hour, End: 4600}, MaxValue: 100, CurrentValue: 101},
+			{PeriodWindow: api.PeriodWindow{Period: api.Eternity}, MaxValue: 5, CurrentValue: 5},
+		},
+		"reads": {
+			{PeriodWindow: api.PeriodWindow{Period: api.Minute, End: 1010}, MaxValue: 10, CurrentValue: 1},
+		},
+	}
+
+	if d := retryAfter(reports, now); d != time.Second*30 {
+		t.Errorf("expected retry after the earliest exceeded limit resets, got %v", d)
+	}
+
+	if d := retryAfter(api.UsageReports{}, now); d != 0 {
+		t.Errorf("expected no retry after without exceeded limits, got %v", d)
+	}
+}
@@ -0,0 +1,46 @@
+package threescale
+
+import (
+	"strings"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// failPolicy returns the FailPolicy for a request with the method, as per FailPolicyByMethod, falling back to the FailPolicy
+func (s *Threescale) failPolicy(method string) FailPolicy {
+	if policy, ok := s.conf.FailPolicyByMethod[strings.ToUpper(method)]; ok {
+		return policy
+	}
+	return s.conf.FailPolicy
+}
+
+// metricFailPolicy returns the FailPolicy for a request with the method counted against the metrics. Each metric is
+// subject to its policy in FailPolicyByMetric, falling back to that of the method, and the request fails closed if
+// the policy of any of its metrics is closed, since its usage of that metric could not be confirmed
+func (s *Threescale) metricFailPolicy(method string, metrics api.Metrics) FailPolicy {
+	policy := s.failPolicy(method)
+	if len(s.conf.FailPolicyByMetric) == 0 || len(metrics) == 0 {
+		return policy
+	}
+
+	for metric := range metrics {
+		metricPolicy, ok := s.conf.FailPolicyByMetric[metric]
+		if !ok {
+			metricPolicy = policy
+		}
+
+		if metricPolicy == FailClosed {
+			return FailClosed
+		}
+	}
+	return FailOpen
+}
+
+// requestMethod returns the HTTP method of the request, if provided
+func requestMethod(r *authorization.HandleAuthorizationRequest) string {
+	if r == nil || r.Instance == nil || r.Instance.Action == nil {
+		return ""
+	}
+	return r.Instance.Action.Method
+}
@@ -0,0 +1,109 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+	"istio.io/istio/mixer/pkg/status"
+)
+
+func TestMetricFailPolicy(t *testing.T) {
+	byMetric := map[string]FailPolicy{
+		"premium":   FailClosed,
+		"analytics": FailOpen,
+	}
+
+	inputs := []struct {
+		name     string
+		policy   FailPolicy
+		byMethod map[string]FailPolicy
+		byMetric map[string]FailPolicy
+		metrics  api.Metrics
+		expect   FailPolicy
+	}{
+		{
+			name:    "Test global policy applies without overrides by metric",
+			policy:  FailOpen,
+			metrics: api.Metrics{"hits": 1},
+			expect:  FailOpen,
+		},
+		{
+			name:     "Test global policy applies when metrics are unknown",
+			policy:   FailOpen,
+			byMetric: byMetric,
+			expect:   FailOpen,
+		},
+		{
+			name:     "Test fail closed metric denies despite open global policy",
+			policy:   FailOpen,
+			byMetric: byMetric,
+			metrics:  api.Metrics{"hits": 1, "premium": 1},
+			expect:   FailClosed,
+		},
+		{
+			name:     "Test fail open metric allows despite closed global policy",
+			policy:   FailClosed,
+			byMetric: byMetric,
+			metrics:  api.Metrics{"analytics": 1},
+			expect:   FailOpen,
+		},
+		{
+			name:     "Test mixed metrics fail closed if any metric fails closed",
+			policy:   FailOpen,
+			byMetric: byMetric,
+			metrics:  api.Metrics{"analytics": 1, "premium": 1},
+			expect:   FailClosed,
+		},
+		{
+			name:     "Test metrics without an override use the global policy",
+			policy:   FailClosed,
+			byMetric: byMetric,
+			metrics:  api.Metrics{"analytics": 1, "hits": 1},
+			expect:   FailClosed,
+		},
+		{
+			name:     "Test metrics without an override use the policy of the method",
+			policy:   FailClosed,
+			byMethod: map[string]FailPolicy{http.MethodGet: FailOpen},
+			byMetric: byMetric,
+			metrics:  api.Metrics{"analytics": 1, "hits": 1},
+			expect:   FailOpen,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			s := &Threescale{conf: &AdapterConfig{
+				FailPolicy:         input.policy,
+				FailPolicyByMethod: input.byMethod,
+				FailPolicyByMetric: input.byMetric,
+			}}
+
+			if policy := s.metricFailPolicy(http.MethodGet, input.metrics); policy != input.expect {
+				t.Errorf("expected fail policy %v, got %v", input.expect, policy)
+			}
+		})
+	}
+}
+
+func TestApplyMetricFailPolicy(t *testing.T) {
+	s := &Threescale{conf: &AdapterConfig{
+		FailPolicy:         FailOpen,
+		FailPolicyByMetric: map[string]FailPolicy{"premium": FailClosed},
+	}}
+
+	err := errors.New("3scale backend unavailable")
+	result := s.applyMetricFailPolicy(context.TODO(), http.MethodGet, api.Metrics{"hits": 1, "analytics": 1}, newCheckResult(), status.WithUnavailable, err)
+	if result.Status.Code != int32(rpc.OK) {
+		t.Errorf("expected request without fail closed metrics to be allowed, got %v", result.Status)
+	}
+
+	result = s.applyMetricFailPolicy(context.TODO(), http.MethodGet, api.Metrics{"hits": 1, "premium": 1}, newCheckResult(), status.WithUnavailable, err)
+	if result.Status.Code != int32(rpc.UNAVAILABLE) {
+		t.Errorf("expected request with a fail closed metric to be denied, got %v", result.Status)
+	}
+}
@@ -0,0 +1,47 @@
+package threescale
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHeader is the gRPC metadata key from which the API key of a request is read
+const APIKeyHeader = "authorization"
+
+const bearerPrefix = "bearer "
+
+// apiKeyInterceptor rejects requests which do not provide the API key, with or without a Bearer prefix, as Unauthenticated
+func apiKeyInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !hasAPIKey(ctx, key) {
+			logFor(ctx).Debugf("rejecting call to %s without a valid API key", info.FullMethod)
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing API key")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// hasAPIKey returns true if the incoming metadata provides the key
+func hasAPIKey(ctx context.Context, key string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	for _, value := range md.Get(APIKeyHeader) {
+		if len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			value = value[len(bearerPrefix):]
+		}
+		// compared in constant time so that the key cannot be guessed from response timings
+		if subtle.ConstantTimeCompare([]byte(value), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
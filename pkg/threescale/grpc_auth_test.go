@@ -0,0 +1,58 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIKeyInterceptor(t *testing.T) {
+	inputs := []struct {
+		name   string
+		md     metadata.MD
+		expect codes.Code
+	}{
+		{
+			name:   "Test request without metadata is rejected",
+			expect: codes.Unauthenticated,
+		},
+		{
+			name:   "Test request with wrong key is rejected",
+			md:     metadata.Pairs(APIKeyHeader, "wrong"),
+			expect: codes.Unauthenticated,
+		},
+		{
+			name:   "Test request with key is allowed",
+			md:     metadata.Pairs(APIKeyHeader, "secret"),
+			expect: codes.OK,
+		},
+		{
+			name:   "Test request with bearer key is allowed",
+			md:     metadata.Pairs(APIKeyHeader, "Bearer secret"),
+			expect: codes.OK,
+		},
+	}
+
+	interceptor := apiKeyInterceptor("secret")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			ctx := context.TODO()
+			if input.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, input.md)
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+			if code := status.Code(err); code != input.expect {
+				t.Errorf("expected code %v, got %v", input.expect, code)
+			}
+		})
+	}
+}
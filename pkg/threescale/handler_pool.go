@@ -0,0 +1,206 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// HandlerPool bounds the number of goroutines handling authorization requests, providing a ceiling on the
+// concurrency of the adapter regardless of load
+type HandlerPool struct {
+	// MaxGoroutines is the number of goroutines handling authorization requests. A non-positive value disables the pool,
+	// such that each request is handled on the goroutine on which it was received
+	MaxGoroutines int
+	// QueueSize is the number of requests which may wait for a goroutine to become available, beyond which
+	// requests are rejected by applying the FailPolicy. A zero value rejects requests once every goroutine is busy
+	QueueSize int
+}
+
+const (
+	handlerJobPending int32 = iota
+	handlerJobRunning
+	handlerJobAbandoned
+)
+
+// handlerJob is a request waiting for, or being handled by, a goroutine of the pool
+type handlerJob struct {
+	run   func()
+	state int32
+	done  chan struct{}
+}
+
+// handlerPool is a fixed number of goroutines handling requests queued, up to a bound, by submit
+type handlerPool struct {
+	jobs    chan *handlerJob
+	metrics *MetricsReporter
+	active  int64
+	queued  int64
+	wg      sync.WaitGroup
+
+	// mu guards against requests being queued once closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newHandlerPool starts the goroutines of the pool as per the provided configuration, or returns nil if disabled
+func newHandlerPool(conf HandlerPool, metrics *MetricsReporter) *handlerPool {
+	if conf.MaxGoroutines <= 0 {
+		return nil
+	}
+
+	queueSize := conf.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &handlerPool{
+		jobs:    make(chan *handlerJob, queueSize),
+		metrics: metrics,
+	}
+
+	p.wg.Add(conf.MaxGoroutines)
+	for i := 0; i < conf.MaxGoroutines; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *handlerPool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		p.reportQueued(atomic.AddInt64(&p.queued, -1))
+		// requests whose caller stopped waiting while queued are skipped
+		if !atomic.CompareAndSwapInt32(&job.state, handlerJobPending, handlerJobRunning) {
+			continue
+		}
+
+		p.reportActive(atomic.AddInt64(&p.active, 1))
+		job.run()
+		p.reportActive(atomic.AddInt64(&p.active, -1))
+		close(job.done)
+	}
+}
+
+// submit runs fn on a goroutine of the pool, returning once it has completed or, should the context be done while fn
+// is running, once the context is done, with fn continuing to hold the goroutine until it returns. Returns
+// errHandlerPoolFull without running fn if the queue is full, or the error of the context should it be done before
+// fn starts running. A nil pool runs fn on the calling goroutine
+func (p *handlerPool) submit(ctx context.Context, fn func()) error {
+	if p == nil {
+		fn()
+		return nil
+	}
+
+	job := &handlerJob{run: fn, done: make(chan struct{})}
+	if err := p.enqueue(job); err != nil {
+		return err
+	}
+
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&job.state, handlerJobPending, handlerJobAbandoned) {
+			return ctx.Err()
+		}
+		// the request started running before the context was done, the caller decides whether to await its result
+		return nil
+	}
+}
+
+func (p *handlerPool) enqueue(job *handlerJob) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errHandlerPoolFull
+	}
+
+	queued := atomic.AddInt64(&p.queued, 1)
+	select {
+	case p.jobs <- job:
+		p.reportQueued(queued)
+		return nil
+	default:
+		atomic.AddInt64(&p.queued, -1)
+		return errHandlerPoolFull
+	}
+}
+
+// close stops the goroutines of the pool once the requests queued have been handled
+func (p *handlerPool) close() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *handlerPool) reportActive(active int64) {
+	if p.metrics != nil && p.metrics.HandlerActiveCB != nil {
+		p.metrics.HandlerActiveCB(active)
+	}
+}
+
+func (p *handlerPool) reportQueued(queued int64) {
+	if p.metrics != nil && p.metrics.HandlerQueueDepthCB != nil {
+		p.metrics.HandlerQueueDepthCB(queued)
+	}
+}
+
+// checkInPool runs the authorization pipeline on a goroutine of the handler pool, applying the fail policy
+// should the request be rejected by, or not complete within the deadline of, the pool. The pipeline runs on the
+// goroutine of the pool itself, which is held until the pipeline returns even once the deadline is exceeded, such
+// that the pool bounds the number of requests being handled
+func (s *Threescale) checkInPool(ctx context.Context, r *authorization.HandleAuthorizationRequest, timings *checkTimings) (*v1beta1.CheckResult, error) {
+	if s.handlerPool == nil {
+		return s.checkUnlessShed(ctx, r, timings, s.checkWithDeadline)
+	}
+
+	if timeout := s.checkTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type checkResponse struct {
+		result *v1beta1.CheckResult
+		err    error
+	}
+
+	done := make(chan checkResponse, 1)
+	poolErr := s.handlerPool.submit(ctx, func() {
+		result, err := s.checkUnlessShed(ctx, r, timings, s.check)
+		done <- checkResponse{result: result, err: err}
+	})
+
+	switch poolErr {
+	case nil:
+		select {
+		case resp := <-done:
+			return resp.result, resp.err
+		case <-ctx.Done():
+			err := fmt.Errorf("authorization did not complete before its deadline - %v", ctx.Err())
+			return s.applyFailPolicy(ctx, requestMethod(r), newCheckResult(), status.WithDeadlineExceeded, err), nil
+		}
+	case errHandlerPoolFull:
+		if s.conf.Metrics != nil && s.conf.Metrics.HandlerRejectedCB != nil {
+			s.conf.Metrics.HandlerRejectedCB()
+		}
+		return s.applyFailPolicy(ctx, requestMethod(r), newCheckResult(), status.WithResourceExhausted, poolErr), nil
+	default:
+		poolErr = fmt.Errorf("request was not handled before its deadline - %v", poolErr)
+		return s.applyFailPolicy(ctx, requestMethod(r), newCheckResult(), status.WithDeadlineExceeded, poolErr), nil
+	}
+}
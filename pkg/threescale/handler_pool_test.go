@@ -0,0 +1,138 @@
+package threescale
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+)
+
+func TestHandlerPool(t *testing.T) {
+	if p := newHandlerPool(HandlerPool{}, nil); p != nil {
+		t.Fatalf("expected nil pool when disabled")
+	}
+
+	var ran bool
+	var nilPool *handlerPool
+	if err := nilPool.submit(context.TODO(), func() { ran = true }); err != nil || !ran {
+		t.Fatalf("expected nil pool to run on the calling goroutine")
+	}
+
+	var depth, active int64
+	p := newHandlerPool(HandlerPool{MaxGoroutines: 1, QueueSize: 1}, &MetricsReporter{
+		HandlerActiveCB:     func(n int64) { atomic.StoreInt64(&active, n) },
+		HandlerQueueDepthCB: func(n int64) { atomic.StoreInt64(&depth, n) },
+	})
+	defer p.close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- p.submit(context.TODO(), func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	if atomic.LoadInt64(&active) != 1 {
+		t.Errorf("expected one active goroutine")
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	var abandonedRan int32
+	queued := make(chan error, 1)
+	go func() {
+		queued <- p.submit(ctx, func() { atomic.StoreInt32(&abandonedRan, 1) })
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&depth) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected request to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.submit(context.TODO(), func() {}); err != errHandlerPoolFull {
+		t.Errorf("expected request to be rejected once the queue is full, got %v", err)
+	}
+
+	cancel()
+	if err := <-queued; err != context.Canceled {
+		t.Errorf("expected queued request to be abandoned once its context is done, got %v", err)
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("unexpected error - %v", err)
+	}
+
+	ran = false
+	if err := p.submit(context.TODO(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("expected request to run once a goroutine is available, got %v", err)
+	}
+
+	if atomic.LoadInt32(&abandonedRan) != 0 {
+		t.Errorf("expected abandoned request not to run")
+	}
+}
+
+// blockingSystemAuthorizer fetches configuration only once released
+type blockingSystemAuthorizer struct {
+	mockAuthorizer
+	release chan struct{}
+}
+
+func (m blockingSystemAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	<-m.release
+	return m.mockAuthorizer.GetSystemConfiguration(systemURL, request)
+}
+
+func TestCheckInPoolHoldsGoroutineUntilCheckReturns(t *testing.T) {
+	var active int64
+	release := make(chan struct{})
+	s := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer:   blockingSystemAuthorizer{release: release},
+			CheckTimeout: time.Millisecond * 10,
+		},
+		handlerPool: newHandlerPool(HandlerPool{MaxGoroutines: 1, QueueSize: 1}, &MetricsReporter{
+			HandlerActiveCB: func(n int64) { atomic.StoreInt64(&active, n) },
+		}),
+	}
+	defer s.handlerPool.close()
+
+	request := syntheticCheckRequest(SyntheticCheck{
+		SystemURL:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+		ServiceID:   "123",
+		UserKey:     "VALID",
+		Method:      "GET",
+		Path:        "/",
+	})
+
+	result, err := s.checkInPool(context.TODO(), request, &checkTimings{})
+	if err != nil || result.Status.Code != int32(rpc.DEADLINE_EXCEEDED) {
+		t.Fatalf("expected fail policy to be applied once the deadline is exceeded, got %v - %v", result.Status, err)
+	}
+
+	// the check which outlived its deadline still holds the goroutine of the pool
+	if atomic.LoadInt64(&active) != 1 {
+		t.Errorf("expected goroutine to be held until the check returns")
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&active) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected goroutine to be released once the check returns")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
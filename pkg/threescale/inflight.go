@@ -0,0 +1,130 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// BackendStatusError is reported as the status class of calls to 3scale backend which did not receive a response
+const BackendStatusError = "error"
+
+// inflightLimiter bounds the number of concurrent authorization calls to 3scale backend
+type inflightLimiter struct {
+	slots    chan struct{}
+	inflight int64
+}
+
+// newInflightLimiter returns a limiter allowing max concurrent calls. A non-positive max returns nil, which applies no limit
+func newInflightLimiter(max int) *inflightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &inflightLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire reserves a slot, returning false if one could not be reserved.
+// When wait is true, acquire blocks until a slot is available or the context is done.
+func (l *inflightLimiter) acquire(ctx context.Context, wait bool) bool {
+	if l == nil {
+		return true
+	}
+
+	if wait {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	} else {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+
+	atomic.AddInt64(&l.inflight, 1)
+	return true
+}
+
+// release frees a slot previously reserved by acquire
+func (l *inflightLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	atomic.AddInt64(&l.inflight, -1)
+	<-l.slots
+}
+
+// current returns the number of calls in flight
+func (l *inflightLimiter) current() int64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&l.inflight)
+}
+
+// authRep calls 3scale backend once the in flight limit allows, as per the configured overflow policy,
+// unless the circuit to 3scale backend is open
+func (s *Threescale) authRep(ctx context.Context, backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	wait := s.conf.BackendOverflowPolicy == BackendOverflowQueue
+	if !s.backendCache.admit(ctx, request, wait) {
+		if s.conf.Metrics != nil && s.conf.Metrics.BackendRejectedCB != nil {
+			s.conf.Metrics.BackendRejectedCB()
+		}
+		return nil, errBackendCacheFull
+	}
+
+	if !s.backendLimiter.acquire(ctx, wait) {
+		if s.conf.Metrics != nil && s.conf.Metrics.BackendRejectedCB != nil {
+			s.conf.Metrics.BackendRejectedCB()
+		}
+		return nil, errBackendSaturated
+	}
+
+	s.reportInflight()
+	defer func() {
+		s.backendLimiter.release()
+		s.reportInflight()
+	}()
+
+	// the circuit is consulted last so that a probe, once allowed, is always made
+	if !s.circuitBreaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	return s.callBackend(ctx, backendURL, request)
+}
+
+// reportBackendDuration reports the time taken by a call to 3scale backend by the class of its HTTP status
+func (s *Threescale) reportBackendDuration(resp *authorizer.BackendResponse, elapsed time.Duration) {
+	if s.conf.Metrics != nil && s.conf.Metrics.BackendDurationCB != nil {
+		s.conf.Metrics.BackendDurationCB(backendStatusClass(resp), elapsed)
+	}
+}
+
+// backendStatusClass returns the class of the HTTP status of a response from 3scale backend, such as 2xx,
+// or BackendStatusError if no response was received
+func backendStatusClass(resp *authorizer.BackendResponse) string {
+	if resp == nil {
+		return BackendStatusError
+	}
+
+	raw, ok := resp.RawResponse.(*http.Response)
+	if !ok || raw == nil {
+		return BackendStatusError
+	}
+	return fmt.Sprintf("%dxx", raw.StatusCode/100)
+}
+
+func (s *Threescale) reportInflight() {
+	if s.backendLimiter != nil && s.conf.Metrics != nil && s.conf.Metrics.BackendInflightCB != nil {
+		s.conf.Metrics.BackendInflightCB(s.backendLimiter.current())
+	}
+}
@@ -0,0 +1,178 @@
+package threescale
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestInflightLimiter(t *testing.T) {
+	l := newInflightLimiter(1)
+	if !l.acquire(context.TODO(), false) {
+		t.Fatalf("expected slot to be acquired")
+	}
+
+	if l.acquire(context.TODO(), false) {
+		t.Errorf("expected slot not to be acquired when saturated")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	if l.acquire(ctx, true) {
+		t.Errorf("expected queued acquire to give up once the context is done")
+	}
+
+	if l.current() != 1 {
+		t.Errorf("expected one call in flight, got %d", l.current())
+	}
+
+	l.release()
+	if !l.acquire(context.TODO(), true) {
+		t.Errorf("expected slot to be acquired after release")
+	}
+
+	var unlimited *inflightLimiter
+	if !unlimited.acquire(context.TODO(), false) {
+		t.Errorf("expected nil limiter to apply no limit")
+	}
+}
+
+func TestHandleAuthorizationBackendSaturated(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	mock := mockAuthorizer{
+		withConfig: client.ProxyConfig{
+			Content: client.Content{
+				Proxy: client.ContentProxy{
+					ProxyRules: []client.ProxyRule{
+						{
+							HTTPMethod:       http.MethodGet,
+							Pattern:          "/test",
+							MetricSystemName: "hits",
+							Delta:            1,
+						},
+					},
+				},
+			},
+		},
+		withAuthResponse: &authorizer.BackendResponse{
+			Authorized: true,
+		},
+	}
+
+	inputs := []struct {
+		name         string
+		policy       FailPolicy
+		expectStatus int32
+	}{
+		{
+			name:         "Test saturated backend fails closed",
+			policy:       FailClosed,
+			expectStatus: int32(rpc.RESOURCE_EXHAUSTED),
+		},
+		{
+			name:         "Test saturated backend fails open",
+			policy:       FailOpen,
+			expectStatus: int32(rpc.OK),
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var rejected int
+			limiter := newInflightLimiter(1)
+			limiter.acquire(context.TODO(), false)
+
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:            mock,
+					FailPolicy:            input.policy,
+					BackendOverflowPolicy: BackendOverflowFail,
+					Metrics: &MetricsReporter{
+						BackendRejectedCB: func() {
+							rejected++
+						},
+					},
+				},
+				backendLimiter: limiter,
+			}
+
+			result, _ := c.HandleAuthorization(context.TODO(), request)
+			if result.Status.Code != input.expectStatus {
+				t.Errorf("Expected %v got %#v", input.expectStatus, result.Status.Code)
+			}
+
+			if rejected != 1 {
+				t.Errorf("expected rejection to be reported once, got %d", rejected)
+			}
+		})
+	}
+}
+
+func TestBackendStatusClass(t *testing.T) {
+	inputs := []struct {
+		name   string
+		resp   *authorizer.BackendResponse
+		expect string
+	}{
+		{
+			name:   "Test no response is an error",
+			expect: BackendStatusError,
+		},
+		{
+			name:   "Test response without HTTP status is an error",
+			resp:   &authorizer.BackendResponse{},
+			expect: BackendStatusError,
+		},
+		{
+			name:   "Test successful response",
+			resp:   &authorizer.BackendResponse{RawResponse: &http.Response{StatusCode: http.StatusOK}},
+			expect: "2xx",
+		},
+		{
+			name:   "Test denied response",
+			resp:   &authorizer.BackendResponse{RawResponse: &http.Response{StatusCode: http.StatusConflict}},
+			expect: "4xx",
+		},
+		{
+			name:   "Test failed response",
+			resp:   &authorizer.BackendResponse{RawResponse: &http.Response{StatusCode: http.StatusBadGateway}},
+			expect: "5xx",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			if class := backendStatusClass(input.resp); class != input.expect {
+				t.Errorf("expected status class %s, got %s", input.expect, class)
+			}
+		})
+	}
+}
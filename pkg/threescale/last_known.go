@@ -0,0 +1,113 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+const (
+	// LastKnownDecisionHit is reported when a last known decision was used in place of 3scale backend
+	LastKnownDecisionHit = "hit"
+	// LastKnownDecisionMiss is reported when no decision was known for the request
+	LastKnownDecisionMiss = "miss"
+	// LastKnownDecisionExpired is reported when the decision known for the request exceeded the LastKnownDecisionTTL
+	LastKnownDecisionExpired = "expired"
+)
+
+type lastKnownDecision struct {
+	authorized bool
+	errorCode  string
+	decided    time.Time
+}
+
+// lastKnownDecisions remembers the most recent decision made by 3scale backend for each credential and set of
+// metrics, to be used in place of the FailPolicy while 3scale backend is unavailable
+type lastKnownDecisions struct {
+	ttl       time.Duration
+	decisions *decisionCache
+}
+
+// newLastKnownDecisions returns a store of decisions valid for the provided TTL, held by the shared decision cache.
+// A non-positive TTL returns nil, which remembers nothing
+func newLastKnownDecisions(ttl time.Duration, decisions *decisionCache) *lastKnownDecisions {
+	if ttl <= 0 {
+		return nil
+	}
+	return &lastKnownDecisions{
+		ttl:       ttl,
+		decisions: decisions,
+	}
+}
+
+// lastKnownDecisionKey identifies the credentials and metrics of a request. Unlike the negativeCacheKey, the
+// configuration version is excluded, since the configuration may change while 3scale backend is unavailable
+func lastKnownDecisionKey(serviceID string, params authorizer.BackendParams, metrics api.Metrics) string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%s|%s|%s", serviceID, credentialHash(params), strings.Join(names, ","))
+}
+
+// add remembers the decision made by 3scale backend
+func (d *lastKnownDecisions) add(key string, resp *authorizer.BackendResponse) {
+	if d == nil || resp == nil {
+		return
+	}
+
+	now := time.Now()
+	d.decisions.add(DecisionCacheLastKnown, key, lastKnownDecision{
+		authorized: resp.Authorized,
+		errorCode:  resp.ErrorCode,
+		decided:    now,
+	}, now.Add(d.ttl))
+}
+
+// get returns the decision last made for the key, along with one of the LastKnownDecision outcomes
+func (d *lastKnownDecisions) get(key string) (lastKnownDecision, string) {
+	value, ok, expired := d.decisions.get(DecisionCacheLastKnown, key, time.Now())
+	if !ok {
+		return lastKnownDecision{}, LastKnownDecisionMiss
+	}
+
+	decision := value.(lastKnownDecision)
+	if expired || time.Since(decision.decided) > d.ttl {
+		d.decisions.delete(DecisionCacheLastKnown, key)
+		return decision, LastKnownDecisionExpired
+	}
+	return decision, LastKnownDecisionHit
+}
+
+// lastKnownStatus returns the status of the decision last made for the key, and true, if a decision was made within
+// the LastKnownDecisionTTL. It is consulted only when 3scale backend is unavailable
+func (s *Threescale) lastKnownStatus(ctx context.Context, serviceID, key string) (rpc.Status, bool) {
+	if s.lastKnown == nil {
+		return rpc.Status{}, false
+	}
+
+	decision, outcome := s.lastKnown.get(key)
+	if s.conf.Metrics != nil && s.conf.Metrics.LastKnownDecisionCB != nil {
+		s.conf.Metrics.LastKnownDecisionCB(serviceID, outcome)
+	}
+
+	if outcome != LastKnownDecisionHit {
+		return rpc.Status{}, false
+	}
+
+	logFor(ctx).Warnf("3scale backend is unavailable, using decision made %s ago for request to service %s",
+		time.Since(decision.decided).Round(time.Second), serviceID)
+	if decision.authorized {
+		return status.OK, true
+	}
+	return errorCodeToRpcStatus(decision.errorCode)(decision.errorCode), true
+}
@@ -0,0 +1,126 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// outageAuthorizer authorizes the user key VALID and denies others as over their limits, until 3scale backend goes down
+type outageAuthorizer struct {
+	mockAuthorizer
+	down bool
+}
+
+func (m *outageAuthorizer) AuthRep(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	if m.down {
+		return nil, errors.New("connection refused")
+	}
+
+	if request.Transactions[0].Params.UserKey == "VALID" {
+		return &authorizer.BackendResponse{Authorized: true}, nil
+	}
+	return &authorizer.BackendResponse{ErrorCode: "limits_exceeded"}, nil
+}
+
+func TestHandleAuthorizationLastKnownDecision(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	newRequest := func(userKey string) *authorization.HandleAuthorizationRequest {
+		return &authorization.HandleAuthorizationRequest{
+			Instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{
+					Method: "get",
+					Path:   "/test",
+				},
+				Subject: &authorization.SubjectMsg{
+					User: userKey,
+				},
+			},
+			AdapterConfig: &types.Any{Value: b},
+		}
+	}
+
+	mock := &outageAuthorizer{
+		mockAuthorizer: mockAuthorizer{
+			withConfig: client.ProxyConfig{
+				Content: client.Content{
+					Proxy: client.ContentProxy{
+						ProxyRules: []client.ProxyRule{
+							{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: "hits", Delta: 1},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	outcomes := make(map[string]int)
+	c := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: mock,
+			FailPolicy: FailClosed,
+			Metrics: &MetricsReporter{
+				LastKnownDecisionCB: func(serviceID, outcome string) {
+					outcomes[outcome]++
+				},
+			},
+		},
+		lastKnown: newLastKnownDecisions(time.Minute, newDecisionCache(0, nil)),
+	}
+
+	for _, userKey := range []string{"VALID", "OVER_LIMIT"} {
+		c.HandleAuthorization(context.TODO(), newRequest(userKey))
+	}
+	if len(outcomes) != 0 {
+		t.Errorf("expected last known decisions to be consulted only when 3scale backend is unavailable, got %v", outcomes)
+	}
+
+	mock.down = true
+
+	inputs := []struct {
+		userKey      string
+		expectStatus int32
+	}{
+		{userKey: "VALID", expectStatus: int32(rpc.OK)},
+		{userKey: "OVER_LIMIT", expectStatus: int32(rpc.RESOURCE_EXHAUSTED)},
+		// no decision is known, so the fail policy applies
+		{userKey: "UNSEEN", expectStatus: int32(rpc.UNKNOWN)},
+	}
+
+	for _, input := range inputs {
+		result, _ := c.HandleAuthorization(context.TODO(), newRequest(input.userKey))
+		if result.Status.Code != input.expectStatus {
+			t.Errorf("expected %v for user key %s, got %v", input.expectStatus, input.userKey, result.Status.Code)
+		}
+	}
+
+	if outcomes[LastKnownDecisionHit] != 2 || outcomes[LastKnownDecisionMiss] != 1 {
+		t.Errorf("unexpected last known decision outcomes %v", outcomes)
+	}
+
+	c.lastKnown.ttl = 0
+	result, _ := c.HandleAuthorization(context.TODO(), newRequest("VALID"))
+	if result.Status.Code == int32(rpc.OK) {
+		t.Errorf("expected an expired decision not to be used")
+	}
+
+	if outcomes[LastKnownDecisionExpired] != 1 {
+		t.Errorf("expected an expired decision to be reported, got %v", outcomes)
+	}
+}
@@ -0,0 +1,143 @@
+package threescale
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/mixer/pkg/status"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+const (
+	// loadShedWindow is the number of requests over which the latency percentile is computed
+	loadShedWindow = 100
+	// maxLoadShedProbability bounds the fraction of requests shed, so that the latency of admitted requests
+	// continues to be observed and shedding stops once the adapter recovers
+	maxLoadShedProbability = 0.9
+)
+
+// LoadShed configures when new authorization requests are shed, by applying the FailPolicy without calling 3scale,
+// since the adapter is overloaded
+type LoadShed struct {
+	// Enabled must be set for requests to be shed
+	Enabled bool
+	// MaxInflight is the number of concurrent authorization requests beyond which requests are shed.
+	// A non-positive value disables it
+	MaxInflight int
+	// MaxLatency is the 99th percentile latency of recent authorization requests beyond which requests are shed.
+	// A zero value disables it
+	MaxLatency time.Duration
+}
+
+// loadShedder sheds a fraction of authorization requests, proportional to how far the in flight count or latency
+// exceeds the configured thresholds
+type loadShedder struct {
+	conf     LoadShed
+	metrics  *MetricsReporter
+	inflight int64
+
+	mu          sync.Mutex
+	latencies   []time.Duration
+	p99         time.Duration
+	probability float64
+}
+
+// newLoadShedder returns a shedder as per the provided configuration, or nil if disabled
+func newLoadShedder(conf LoadShed, metrics *MetricsReporter) *loadShedder {
+	if !conf.Enabled || (conf.MaxInflight <= 0 && conf.MaxLatency <= 0) {
+		return nil
+	}
+
+	return &loadShedder{
+		conf:      conf,
+		metrics:   metrics,
+		latencies: make([]time.Duration, 0, loadShedWindow),
+	}
+}
+
+// admit returns true if a request may be handled, in which case done must be called once it completes,
+// or false if the request is shed
+func (l *loadShedder) admit() bool {
+	if l == nil {
+		return true
+	}
+
+	inflight := atomic.AddInt64(&l.inflight, 1)
+	if p := l.shedProbability(inflight); p > 0 && rand.Float64() < p {
+		atomic.AddInt64(&l.inflight, -1)
+		return false
+	}
+	return true
+}
+
+// done records the latency of a request admitted by admit
+func (l *loadShedder) done(elapsed time.Duration) {
+	if l == nil {
+		return
+	}
+
+	atomic.AddInt64(&l.inflight, -1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.latencies = append(l.latencies, elapsed)
+	if len(l.latencies) < loadShedWindow {
+		return
+	}
+
+	sort.Slice(l.latencies, func(i, j int) bool { return l.latencies[i] < l.latencies[j] })
+	l.p99 = l.latencies[(len(l.latencies)*99-1)/100]
+	l.latencies = l.latencies[:0]
+}
+
+// shedProbability returns the probability with which a request is shed given the number of requests in flight,
+// reporting it if changed
+func (l *loadShedder) shedProbability(inflight int64) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var p float64
+	if max := int64(l.conf.MaxInflight); max > 0 && inflight > max {
+		p = float64(inflight-max) / float64(max)
+	}
+
+	if max := l.conf.MaxLatency; max > 0 && l.p99 > max {
+		p = math.Max(p, float64(l.p99-max)/float64(max))
+	}
+
+	p = math.Min(p, maxLoadShedProbability)
+	if p != l.probability {
+		l.probability = p
+		if l.metrics != nil && l.metrics.LoadShedProbabilityCB != nil {
+			l.metrics.LoadShedProbabilityCB(p)
+		}
+	}
+	return p
+}
+
+// checkFunc runs the authorization pipeline for a request
+type checkFunc func(ctx context.Context, r *authorization.HandleAuthorizationRequest, timings *checkTimings) (*v1beta1.CheckResult, error)
+
+// checkUnlessShed runs the authorization pipeline with check, unless the adapter is overloaded and the request is
+// shed by applying the fail policy
+func (s *Threescale) checkUnlessShed(ctx context.Context, r *authorization.HandleAuthorizationRequest, timings *checkTimings, check checkFunc) (*v1beta1.CheckResult, error) {
+	if !s.loadShedder.admit() {
+		if s.conf.Metrics != nil && s.conf.Metrics.LoadShedCB != nil {
+			s.conf.Metrics.LoadShedCB()
+		}
+		return s.applyFailPolicy(ctx, requestMethod(r), newCheckResult(), status.WithUnavailable, errLoadShed), nil
+	}
+
+	start := time.Now()
+	defer func() {
+		s.loadShedder.done(time.Since(start))
+	}()
+	return check(ctx, r, timings)
+}
@@ -0,0 +1,48 @@
+package threescale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadShedder(t *testing.T) {
+	if newLoadShedder(LoadShed{MaxInflight: 1}, nil) != nil {
+		t.Errorf("expected shedder to be nil unless enabled")
+	}
+
+	if newLoadShedder(LoadShed{Enabled: true}, nil) != nil {
+		t.Errorf("expected shedder to be nil without thresholds")
+	}
+
+	var probabilities []float64
+	l := newLoadShedder(LoadShed{Enabled: true, MaxInflight: 2, MaxLatency: time.Second}, &MetricsReporter{
+		LoadShedProbabilityCB: func(p float64) { probabilities = append(probabilities, p) },
+	})
+
+	for inflight, expect := range map[int64]float64{1: 0, 2: 0, 3: 0.5, 4: 0.9, 10: 0.9} {
+		if p := l.shedProbability(inflight); p != expect {
+			t.Errorf("expected probability %v with %d in flight, got %v", expect, inflight, p)
+		}
+	}
+
+	for i := 0; i < loadShedWindow; i++ {
+		l.done(time.Second + time.Second/4)
+	}
+
+	if l.p99 != time.Second+time.Second/4 {
+		t.Errorf("unexpected 99th percentile latency %v", l.p99)
+	}
+
+	if p := l.shedProbability(1); p != 0.25 {
+		t.Errorf("expected probability 0.25 with latency exceeded, got %v", p)
+	}
+
+	if len(probabilities) == 0 || probabilities[len(probabilities)-1] != 0.25 {
+		t.Errorf("expected changes in probability to be reported, got %v", probabilities)
+	}
+
+	var nilShedder *loadShedder
+	if !nilShedder.admit() {
+		t.Errorf("expected nil shedder to admit every request")
+	}
+}
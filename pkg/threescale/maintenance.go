@@ -0,0 +1,81 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// Maintenance determines whether 3scale is within a planned maintenance window. While active, requests whose fate
+// could not be determined by 3scale backend have the MaintenanceFailPolicy applied in place of the FailPolicy, and
+// failed calls to 3scale backend do not count towards opening the circuit. A nil Maintenance is never active.
+type Maintenance struct {
+	// active is 1 while in maintenance, accessed atomically
+	active  int32
+	metrics *MetricsReporter
+}
+
+// NewMaintenance returns a Maintenance in the provided state
+func NewMaintenance(active bool, metrics *MetricsReporter) *Maintenance {
+	m := &Maintenance{metrics: metrics}
+	if active {
+		m.active = 1
+	}
+	m.report(active)
+	return m
+}
+
+// IsActive returns true if 3scale is within a maintenance window
+func (m *Maintenance) IsActive() bool {
+	return m != nil && atomic.LoadInt32(&m.active) == 1
+}
+
+// Set enters or leaves maintenance, returning false if already in the provided state
+func (m *Maintenance) Set(active bool) bool {
+	if m == nil {
+		return false
+	}
+
+	from, to := int32(1), int32(0)
+	if active {
+		from, to = 0, 1
+	}
+
+	if !atomic.CompareAndSwapInt32(&m.active, from, to) {
+		return false
+	}
+
+	m.report(active)
+	return true
+}
+
+func (m *Maintenance) report(active bool) {
+	if m.metrics != nil && m.metrics.MaintenanceCB != nil {
+		m.metrics.MaintenanceCB(active)
+	}
+}
+
+// maintenanceResult applies the MaintenanceFailPolicy to a request whose fate could not be determined by 3scale backend
+// during maintenance. These are logged and counted apart from other failures, since they are expected
+func (s *Threescale) maintenanceResult(ctx context.Context, serviceID string, result *v1beta1.CheckResult, err error) *v1beta1.CheckResult {
+	if s.conf.Metrics != nil && s.conf.Metrics.MaintenanceFailPolicyCB != nil {
+		s.conf.Metrics.MaintenanceFailPolicyCB(serviceID)
+	}
+
+	if err == nil {
+		err = errors.New("unexpected response from 3scale backend")
+	}
+
+	if s.conf.MaintenanceFailPolicy == FailOpen {
+		logFor(ctx).Infof("3scale is under maintenance, maintenance fail policy is open, allowing request to service %s - %v", serviceID, err)
+		result.Status = status.OK
+		return result
+	}
+
+	logFor(ctx).Infof("3scale is under maintenance, maintenance fail policy is closed, denying request to service %s - %v", serviceID, err)
+	result.Status = status.WithUnavailable("3scale is under maintenance")
+	return result
+}
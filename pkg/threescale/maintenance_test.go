@@ -0,0 +1,87 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/gogo/googleapis/google/rpc"
+)
+
+func TestMaintenance(t *testing.T) {
+	var m *Maintenance
+	if m.IsActive() || m.Set(true) {
+		t.Errorf("expected nil maintenance to never be active")
+	}
+
+	var states []bool
+	m = NewMaintenance(false, &MetricsReporter{MaintenanceCB: func(active bool) {
+		states = append(states, active)
+	}})
+
+	if !m.Set(true) || !m.IsActive() {
+		t.Errorf("expected maintenance to be entered")
+	}
+
+	if m.Set(true) {
+		t.Errorf("expected entering maintenance twice to be a no-op")
+	}
+
+	if !m.Set(false) || m.IsActive() {
+		t.Errorf("expected maintenance to be left")
+	}
+
+	if !reflect.DeepEqual(states, []bool{false, true, false}) {
+		t.Errorf("expected maintenance state to be reported on creation and each change, got %v", states)
+	}
+}
+
+func TestMaintenanceResult(t *testing.T) {
+	var reported []string
+	s := &Threescale{conf: &AdapterConfig{
+		FailPolicy:            FailClosed,
+		MaintenanceFailPolicy: FailOpen,
+		Metrics: &MetricsReporter{MaintenanceFailPolicyCB: func(serviceID string) {
+			reported = append(reported, serviceID)
+		}},
+	}}
+
+	result := s.maintenanceResult(context.TODO(), "123", newCheckResult(), errors.New("503"))
+	if result.Status.Code != int32(rpc.OK) {
+		t.Errorf("expected open maintenance fail policy to allow the request, got %v", result.Status)
+	}
+
+	s.conf.MaintenanceFailPolicy = FailClosed
+	result = s.maintenanceResult(context.TODO(), "123", newCheckResult(), nil)
+	if result.Status.Code != int32(rpc.UNAVAILABLE) {
+		t.Errorf("expected closed maintenance fail policy to deny the request, got %v", result.Status)
+	}
+
+	if !reflect.DeepEqual(reported, []string{"123", "123"}) {
+		t.Errorf("expected each request to be reported, got %v", reported)
+	}
+}
+
+func TestMaintenanceDoesNotOpenCircuit(t *testing.T) {
+	request := authorizer.BackendRequest{Service: "123", Transactions: []authorizer.BackendTransaction{{}}}
+	s := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer:  mockAuthorizer{withBackendErr: errors.New("unavailable"), withAuthResponse: &authorizer.BackendResponse{}},
+			Maintenance: NewMaintenance(true, nil),
+		},
+		circuitBreaker: newCircuitBreaker(CircuitBreaker{FailureThreshold: 1}, nil),
+	}
+
+	s.callBackendOnce("", request)
+	if !s.circuitBreaker.allow() {
+		t.Errorf("expected failures during maintenance not to open the circuit")
+	}
+
+	s.conf.Maintenance.Set(false)
+	s.callBackendOnce("", request)
+	if s.circuitBreaker.allow() {
+		t.Errorf("expected failures outside of maintenance to open the circuit")
+	}
+}
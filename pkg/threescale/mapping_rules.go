@@ -0,0 +1,243 @@
+package threescale
+
+import (
+	"container/list"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	system "github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/istio/mixer/template/authorization"
+)
+
+// DefaultMetricName is the top level metric of a 3scale service unless it has been renamed
+const DefaultMetricName = "hits"
+
+// maxCompiledPatterns bounds the number of mapping rule patterns held compiled, after which the least recently used
+// pattern is evicted
+const maxCompiledPatterns = 10000
+
+// patterns holds the compiled patterns of the mapping rules evaluated, shared across services
+var patterns = newPatternCache(maxCompiledPatterns)
+
+// MappingRulesMode determines how locally configured mapping rules are combined with those fetched from 3scale
+type MappingRulesMode int
+
+const (
+	// MappingRulesMerge evaluates local mapping rules alongside those fetched from 3scale
+	MappingRulesMerge MappingRulesMode = iota
+	// MappingRulesOverride evaluates only the local mapping rules for services which have them configured
+	MappingRulesOverride
+)
+
+// MultiMatchPolicy determines which metrics are reported for a request which matches multiple mapping rules
+type MultiMatchPolicy int
+
+const (
+	// MultiMatchAll reports the metric of every matching rule, up to any rule marked as last
+	MultiMatchAll MultiMatchPolicy = iota
+	// MultiMatchFirst reports only the metric of the first matching rule by position
+	MultiMatchFirst
+	// MultiMatchMostSpecific reports only the metric of the matching rule with the longest pattern,
+	// preferring the first by position when patterns are of equal length
+	MultiMatchMostSpecific
+)
+
+// PathNormalization determines how the request path is normalized before mapping rules are evaluated.
+// Each option changes which requests a mapping rule matches, so none are applied by default
+type PathNormalization struct {
+	// StripTrailingSlash removes a trailing slash from the path, other than the root path, such that "/foo/" is
+	// evaluated as "/foo". Patterns which expect the trailing slash no longer match
+	StripTrailingSlash bool
+	// CaseInsensitive matches mapping rule patterns regardless of case, such that "/Foo" matches the pattern "/foo"
+	CaseInsensitive bool
+}
+
+// normalize returns the path as per the enabled options. Any query string is left unchanged
+func (n PathNormalization) normalize(path string) string {
+	if !n.StripTrailingSlash {
+		return path
+	}
+
+	query := ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+
+	for len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path + query
+}
+
+// MappingRule is a mapping rule configured locally. In addition to the method and path, a rule may be conditional on
+// the value of a request header, allowing requests to the same path to be mapped to different metrics
+type MappingRule struct {
+	system.ProxyRule
+	// Header is optional and names the request header which must match HeaderValue for the rule to apply.
+	// It is read from the subject property HeaderPropertyPrefix + Header
+	Header string `json:"header,omitempty"`
+	// HeaderValue is a regular expression matched against the value of the Header
+	HeaderValue string `json:"header_value,omitempty"`
+}
+
+// matchesHeader returns true if the rule does not depend on a header or the request provides a matching header value
+func (r MappingRule) matchesHeader(instance authorization.InstanceMsg) bool {
+	if r.Header == "" {
+		return true
+	}
+
+	value := subjectProperty(instance, HeaderPropertyPrefix+strings.ToLower(r.Header))
+	if value == "" {
+		return false
+	}
+
+	match, err := regexp.MatchString(r.HeaderValue, value)
+	return err == nil && match
+}
+
+// withLocalMappingRules returns a copy of the proxy config with any mapping rules configured locally for the service applied.
+// Rules conditional on a header which the request does not match are omitted, such that the remaining rules are
+// evaluated by position as usual. The cached config is never modified.
+func (s *Threescale) withLocalMappingRules(serviceID string, conf system.ProxyConfig, instance authorization.InstanceMsg) system.ProxyConfig {
+	local, ok := s.conf.LocalMappingRules[serviceID]
+	if !ok {
+		return conf
+	}
+
+	var rules []system.ProxyRule
+	if s.conf.MappingRulesMode == MappingRulesMerge {
+		rules = append(rules, conf.Content.Proxy.ProxyRules...)
+	}
+	for _, rule := range local {
+		if !rule.matchesHeader(instance) {
+			continue
+		}
+
+		if rule.MetricSystemName == "" {
+			rule.MetricSystemName = s.defaultMetricName()
+		}
+		rules = append(rules, rule.ProxyRule)
+	}
+
+	conf.Content.Proxy.ProxyRules = rules
+	return conf
+}
+
+// defaultMetricName returns the configured default metric or DefaultMetricName if none has been configured
+func (s *Threescale) defaultMetricName() string {
+	if s.conf.DefaultMetricName == "" {
+		return DefaultMetricName
+	}
+	return s.conf.DefaultMetricName
+}
+
+// validateDefaultMetric warns when local mapping rules for the service rely on the default metric but the configuration
+// fetched from 3scale does not reference it. The proxy config does not list the metrics of the service, so only those
+// referenced by its mapping rules are known
+func (s *Threescale) validateDefaultMetric(ctx context.Context, serviceID string, conf system.ProxyConfig) {
+	var usesDefault bool
+	for _, rule := range s.conf.LocalMappingRules[serviceID] {
+		if rule.MetricSystemName == "" {
+			usesDefault = true
+			break
+		}
+	}
+	if !usesDefault {
+		return
+	}
+
+	metric := s.defaultMetricName()
+	for _, rule := range conf.Content.Proxy.ProxyRules {
+		if rule.MetricSystemName == metric {
+			return
+		}
+	}
+	logFor(ctx).Warnf("default metric %s is not referenced by the configuration for service %s - usage may not be reported", metric, serviceID)
+}
+
+// evaluateMappingRules returns the metrics to report for the request, as per the mapping rules of the service,
+// reporting the time taken and logging when the MaxMappingRuleEvaluations was reached
+func (s *Threescale) evaluateMappingRules(ctx context.Context, serviceID string, action *authorization.ActionMsg, conf system.ProxyConfig) api.Metrics {
+	start := time.Now()
+	norm := s.conf.PathNormalization
+	rules := conf.Content.Proxy.ProxyRules
+
+	var idx *ruleIndex
+	if _, ok := s.conf.LocalMappingRules[serviceID]; ok {
+		// local rules are combined with the cached rules for each request, so there is no index to reuse
+		idx = newRuleIndex(rules, norm.CaseInsensitive)
+	} else {
+		idx = s.ruleIndexes.get(serviceID, rules, norm.CaseInsensitive)
+	}
+
+	metrics, capped := idx.metrics(norm.normalize(action.Path), action.Method, s.conf.MaxMappingRuleEvaluations,
+		s.conf.MultiMatchPolicy)
+	if s.conf.Metrics != nil && s.conf.Metrics.MappingRuleEvaluationCB != nil {
+		s.conf.Metrics.MappingRuleEvaluationCB(serviceID, time.Since(start))
+	}
+
+	if capped {
+		logFor(ctx).Warnf("evaluation of mapping rules for service %s stopped after %d rules - "+
+			"the mapping rules for the service should be cleaned up", serviceID, s.conf.MaxMappingRuleEvaluations)
+	}
+	return metrics
+}
+
+// patternCache holds compiled mapping rule patterns so that each is compiled once rather than for every request.
+// Once full, the least recently used pattern is evicted
+type patternCache struct {
+	max int
+
+	mu       sync.Mutex
+	order    *list.List
+	compiled map[string]*list.Element
+}
+
+type compiledPattern struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// newPatternCache returns a cache holding up to max compiled patterns
+func newPatternCache(max int) *patternCache {
+	return &patternCache{
+		max:      max,
+		order:    list.New(),
+		compiled: make(map[string]*list.Element),
+	}
+}
+
+// compile returns the compiled pattern, or nil if it is not a valid regular expression
+func (c *patternCache) compile(pattern string) *regexp.Regexp {
+	c.mu.Lock()
+	if element, ok := c.compiled[pattern]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*compiledPattern).re
+	}
+	c.mu.Unlock()
+
+	// invalid patterns are cached as nil so that they are skipped without being compiled again
+	re, _ := regexp.Compile(pattern)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.compiled[pattern]; ok {
+		// compiled concurrently by another request
+		c.order.MoveToFront(element)
+		return re
+	}
+
+	c.compiled[pattern] = c.order.PushFront(&compiledPattern{pattern: pattern, re: re})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.compiled, oldest.Value.(*compiledPattern).pattern)
+	}
+	return re
+}
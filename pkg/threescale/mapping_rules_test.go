@@ -0,0 +1,356 @@
+package threescale
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/3scale/3scale-porta-go-client/client"
+
+	"istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+)
+
+func TestWithLocalMappingRulesHeaders(t *testing.T) {
+	local := map[string][]MappingRule{
+		"123": {
+			{
+				ProxyRule:   client.ProxyRule{HTTPMethod: http.MethodPost, Pattern: "/graphql", MetricSystemName: "mutations", Delta: 1, Position: 1, Last: true},
+				Header:      "X-GraphQL-Operation",
+				HeaderValue: "^mutation$",
+			},
+			{
+				ProxyRule:   client.ProxyRule{HTTPMethod: http.MethodPost, Pattern: "/graphql", MetricSystemName: "graphql", Delta: 1, Position: 2},
+				Header:      "Content-Type",
+				HeaderValue: "^application/graphql",
+			},
+			{
+				ProxyRule: client.ProxyRule{HTTPMethod: http.MethodPost, Pattern: "/graphql", MetricSystemName: "queries", Delta: 1, Position: 3},
+			},
+		},
+	}
+
+	inputs := []struct {
+		name    string
+		headers map[string]string
+		expect  api.Metrics
+	}{
+		{
+			name:   "Test rules without a header condition apply to any request",
+			expect: api.Metrics{"queries": 1},
+		},
+		{
+			name:    "Test rule matching on content type applies alongside later rules",
+			headers: map[string]string{"content-type": "application/graphql; charset=utf-8"},
+			expect:  api.Metrics{"graphql": 1, "queries": 1},
+		},
+		{
+			name: "Test earlier matching rule marked last takes precedence",
+			headers: map[string]string{
+				"content-type":        "application/graphql",
+				"x-graphql-operation": "mutation",
+			},
+			expect: api.Metrics{"mutations": 1},
+		},
+		{
+			name:    "Test rule is skipped when header value does not match",
+			headers: map[string]string{"x-graphql-operation": "query"},
+			expect:  api.Metrics{"queries": 1},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			c := &Threescale{
+				conf: &AdapterConfig{
+					LocalMappingRules: local,
+					MappingRulesMode:  MappingRulesOverride,
+				},
+			}
+
+			properties := make(map[string]*v1beta1.Value)
+			for header, value := range input.headers {
+				properties[HeaderPropertyPrefix+header] = &v1beta1.Value{Value: &v1beta1.Value_StringValue{StringValue: value}}
+			}
+			instance := authorization.InstanceMsg{Subject: &authorization.SubjectMsg{Properties: properties}}
+
+			conf := c.withLocalMappingRules("123", client.ProxyConfig{}, instance)
+			metrics, _ := generateMetrics("/graphql", http.MethodPost, conf, 0, false, MultiMatchAll)
+			if !reflect.DeepEqual(metrics, input.expect) {
+				t.Errorf("expected metrics %v got %v", input.expect, metrics)
+			}
+		})
+	}
+}
+
+func TestGenerateMetricsMaxEvaluations(t *testing.T) {
+	conf := client.ProxyConfig{
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodPost, Pattern: "/", MetricSystemName: "post", Delta: 1, Position: 1},
+					{HTTPMethod: http.MethodGet, Pattern: "[", MetricSystemName: "invalid", Delta: 1, Position: 2},
+					{HTTPMethod: http.MethodGet, Pattern: "/", MetricSystemName: "first", Delta: 1, Position: 3},
+					{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: "second", Delta: 1, Position: 4},
+				},
+			},
+		},
+	}
+
+	metrics, capped := generateMetrics("/test", http.MethodGet, conf, 0, false, MultiMatchAll)
+	if expect := (api.Metrics{"first": 1, "second": 1}); capped || !reflect.DeepEqual(metrics, expect) {
+		t.Errorf("expected metrics %v without a limit, got %v", expect, metrics)
+	}
+
+	// rules for other methods do not count towards the limit
+	metrics, capped = generateMetrics("/test", http.MethodGet, conf, 2, false, MultiMatchAll)
+	if expect := (api.Metrics{"first": 1}); !capped || !reflect.DeepEqual(metrics, expect) {
+		t.Errorf("expected evaluation to stop after the limit with metrics %v, got %v", expect, metrics)
+	}
+
+	metrics, capped = generateMetrics("/test", http.MethodGet, conf, 3, false, MultiMatchAll)
+	if expect := (api.Metrics{"first": 1, "second": 1}); capped || !reflect.DeepEqual(metrics, expect) {
+		t.Errorf("expected every rule to be evaluated within the limit, got %v", metrics)
+	}
+}
+
+func TestGenerateMetricsMultiMatchPolicy(t *testing.T) {
+	conf := client.ProxyConfig{
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodGet, Pattern: "/orders", MetricSystemName: "orders", Delta: 1, Position: 3},
+					{HTTPMethod: http.MethodGet, Pattern: "/", MetricSystemName: "hits", Delta: 1, Position: 1},
+					{HTTPMethod: http.MethodGet, Pattern: "/orders/[0-9]+", MetricSystemName: "order", Delta: 2, Position: 4},
+					{HTTPMethod: http.MethodGet, Pattern: "/orders/[0-9]*", MetricSystemName: "same_length", Delta: 1, Position: 5},
+					{HTTPMethod: http.MethodGet, Pattern: "/users", MetricSystemName: "users", Delta: 1, Position: 2},
+				},
+			},
+		},
+	}
+
+	inputs := []struct {
+		name   string
+		path   string
+		policy MultiMatchPolicy
+		expect api.Metrics
+	}{
+		{
+			name:   "Test all reports every matching rule",
+			path:   "/orders/123",
+			policy: MultiMatchAll,
+			expect: api.Metrics{"hits": 1, "orders": 1, "order": 2, "same_length": 1},
+		},
+		{
+			name:   "Test first reports the first matching rule by position",
+			path:   "/orders/123",
+			policy: MultiMatchFirst,
+			expect: api.Metrics{"hits": 1},
+		},
+		{
+			name:   "Test most specific reports the rule with the longest pattern, preferring the first by position",
+			path:   "/orders/123",
+			policy: MultiMatchMostSpecific,
+			expect: api.Metrics{"order": 2},
+		},
+		{
+			name:   "Test most specific only considers matching rules",
+			path:   "/users/1",
+			policy: MultiMatchMostSpecific,
+			expect: api.Metrics{"users": 1},
+		},
+		{
+			name:   "Test no matching rule reports no metrics",
+			path:   "/orders/123",
+			policy: MultiMatchFirst,
+			expect: api.Metrics{},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			method := http.MethodGet
+			if len(input.expect) == 0 {
+				method = http.MethodPost
+			}
+
+			metrics, _ := generateMetrics(input.path, method, conf, 0, false, input.policy)
+			if !reflect.DeepEqual(metrics, input.expect) {
+				t.Errorf("expected metrics %v, got %v", input.expect, metrics)
+			}
+		})
+	}
+}
+
+func TestPathNormalization(t *testing.T) {
+	conf := client.ProxyConfig{
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodGet, Pattern: "^/foo$", MetricSystemName: "foo", Delta: 1},
+					{HTTPMethod: http.MethodGet, Pattern: "^/$", MetricSystemName: "root", Delta: 1},
+				},
+			},
+		},
+	}
+
+	inputs := []struct {
+		name   string
+		norm   PathNormalization
+		path   string
+		expect string
+	}{
+		{name: "Test exact path matches by default", path: "/foo", expect: "foo"},
+		{name: "Test trailing slash does not match by default", path: "/foo/"},
+		{name: "Test case variant does not match by default", path: "/FOO"},
+		{
+			name:   "Test trailing slash matches when stripped",
+			norm:   PathNormalization{StripTrailingSlash: true},
+			path:   "/foo/",
+			expect: "foo",
+		},
+		{
+			name: "Test query string is retained when trailing slash stripped",
+			norm: PathNormalization{StripTrailingSlash: true},
+			path: "/foo/?a=b",
+		},
+		{
+			name:   "Test root path is not stripped",
+			norm:   PathNormalization{StripTrailingSlash: true},
+			path:   "/",
+			expect: "root",
+		},
+		{
+			name:   "Test case variant matches when case insensitive",
+			norm:   PathNormalization{CaseInsensitive: true},
+			path:   "/FOO",
+			expect: "foo",
+		},
+		{
+			name:   "Test both options combined",
+			norm:   PathNormalization{StripTrailingSlash: true, CaseInsensitive: true},
+			path:   "/Foo//",
+			expect: "foo",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			s := &Threescale{conf: &AdapterConfig{PathNormalization: input.norm}}
+			action := &authorization.ActionMsg{Method: http.MethodGet, Path: input.path}
+
+			metrics := s.evaluateMappingRules(context.TODO(), "123", action, conf)
+			if input.expect == "" {
+				if len(metrics) != 0 {
+					t.Errorf("expected no metrics, got %v", metrics)
+				}
+				return
+			}
+
+			if len(metrics) != 1 || metrics[input.expect] != 1 {
+				t.Errorf("expected metric %s, got %v", input.expect, metrics)
+			}
+		})
+	}
+}
+
+func TestGenerateMetricsAnchoredSegments(t *testing.T) {
+	conf := client.ProxyConfig{
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodGet, Pattern: "^/foo/", MetricSystemName: "foo", Delta: 1, Position: 1},
+					{HTTPMethod: http.MethodGet, Pattern: "^/bar$", MetricSystemName: "bar", Delta: 1, Position: 2},
+					{HTTPMethod: http.MethodGet, Pattern: "/", MetricSystemName: "any", Delta: 1, Position: 3},
+					{HTTPMethod: http.MethodGet, Pattern: "^/foo", MetricSystemName: "prefix", Delta: 1, Position: 4},
+				},
+			},
+		},
+	}
+
+	inputs := []struct {
+		name            string
+		path            string
+		caseInsensitive bool
+		maxEvaluations  int
+		expect          api.Metrics
+	}{
+		{
+			name:   "Test rules anchored to the segment of the path are evaluated with unanchored rules",
+			path:   "/foo/1",
+			expect: api.Metrics{"foo": 1, "any": 1, "prefix": 1},
+		},
+		{
+			name:   "Test rule anchored to the whole path matches",
+			path:   "/bar",
+			expect: api.Metrics{"bar": 1, "any": 1},
+		},
+		{
+			name:   "Test rules anchored to other segments are not evaluated",
+			path:   "/bar/1",
+			expect: api.Metrics{"any": 1},
+		},
+		{
+			name:            "Test segment is matched regardless of case when case insensitive",
+			path:            "/FOO/1",
+			caseInsensitive: true,
+			expect:          api.Metrics{"foo": 1, "any": 1, "prefix": 1},
+		},
+		{
+			name:           "Test rules anchored to other segments do not count towards the limit",
+			path:           "/baz",
+			maxEvaluations: 2,
+			expect:         api.Metrics{"any": 1},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			metrics, capped := generateMetrics(input.path, http.MethodGet, conf, input.maxEvaluations, input.caseInsensitive, MultiMatchAll)
+			if capped || !reflect.DeepEqual(metrics, input.expect) {
+				t.Errorf("expected metrics %v, got %v capped %t", input.expect, metrics, capped)
+			}
+		})
+	}
+}
+
+func TestRuleIndexesReuse(t *testing.T) {
+	rules := []client.ProxyRule{
+		{HTTPMethod: http.MethodGet, Pattern: "/", MetricSystemName: "hits", Delta: 1, Position: 1},
+	}
+
+	indexes := newRuleIndexes()
+	idx := indexes.get("123", rules, false)
+	if indexes.get("123", rules, false) != idx {
+		t.Errorf("expected the index to be reused for the same rules")
+	}
+
+	if indexes.get("123", rules, true) == idx {
+		t.Errorf("expected the rules to be indexed again once case sensitivity changes")
+	}
+
+	refreshed := append([]client.ProxyRule(nil), rules...)
+	if indexes.get("123", refreshed, true) == idx {
+		t.Errorf("expected the rules to be indexed again once refreshed")
+	}
+}
+
+func TestPatternCacheEviction(t *testing.T) {
+	c := newPatternCache(2)
+	a := c.compile("/a")
+	c.compile("/b")
+	c.compile("/a")
+	c.compile("/c")
+
+	if _, ok := c.compiled["/b"]; ok {
+		t.Errorf("expected the least recently used pattern to be evicted")
+	}
+	if c.compile("/a") != a {
+		t.Errorf("expected the recently used pattern to be retained")
+	}
+	if c.compile("[") != nil {
+		t.Errorf("expected invalid pattern not to compile")
+	}
+}
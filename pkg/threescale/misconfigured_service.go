@@ -0,0 +1,50 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// applicationNotFound is the error code with which 3scale backend responds 404 to requests whose application does not
+// exist, which is a denial of the credentials rather than a misconfiguration of the service
+const applicationNotFound = "application_not_found"
+
+// isMisconfiguredService returns true if 3scale backend responded to an authorization request with 404 for a reason
+// other than the application not being found, which indicates the service id or service token is wrong
+func isMisconfiguredService(resp *authorizer.BackendResponse) bool {
+	if resp == nil {
+		return false
+	}
+
+	raw, ok := resp.RawResponse.(*http.Response)
+	return ok && raw != nil && raw.StatusCode == http.StatusNotFound && resp.ErrorCode != applicationNotFound
+}
+
+// misconfiguredServiceResult treats a request for a service which 3scale backend reported as not found as an internal
+// error, rather than as a denial, as per the InternalErrorPolicy
+func (s *Threescale) misconfiguredServiceResult(ctx context.Context, method string, metrics api.Metrics, serviceID string, result *v1beta1.CheckResult, resp *authorizer.BackendResponse) *v1beta1.CheckResult {
+	if s.conf.Metrics != nil && s.conf.Metrics.MisconfiguredServiceCB != nil {
+		s.conf.Metrics.MisconfiguredServiceCB(serviceID)
+	}
+
+	msg := fmt.Sprintf("service misconfigured - 3scale backend reported service %s as not found", serviceID)
+	if resp.ErrorCode != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, resp.ErrorCode)
+	}
+	logFor(ctx).Errorf("%s, check the service id and service token", msg)
+
+	if s.conf.InternalErrorPolicy == InternalErrorFailPolicy {
+		return s.applyMetricFailPolicy(ctx, method, metrics, result, status.WithInternal, errors.New(msg))
+	}
+
+	result.Status = status.WithInternal(msg)
+	return result
+}
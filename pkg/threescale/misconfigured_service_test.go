@@ -0,0 +1,58 @@
+package threescale
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/gogo/googleapis/google/rpc"
+)
+
+func TestMisconfiguredService(t *testing.T) {
+	withStatus := func(code int, errorCode string) *authorizer.BackendResponse {
+		return &authorizer.BackendResponse{ErrorCode: errorCode, RawResponse: &http.Response{StatusCode: code}}
+	}
+
+	inputs := []struct {
+		name   string
+		resp   *authorizer.BackendResponse
+		expect bool
+	}{
+		{name: "Test invalid service id is misconfigured", resp: withStatus(http.StatusNotFound, "service_id_invalid"), expect: true},
+		{name: "Test not found without a reason is misconfigured", resp: withStatus(http.StatusNotFound, ""), expect: true},
+		{name: "Test unknown application is a denial", resp: withStatus(http.StatusNotFound, applicationNotFound)},
+		{name: "Test forbidden is a denial", resp: withStatus(http.StatusForbidden, "user_key_invalid")},
+		{name: "Test no response"},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			if misconfigured := isMisconfiguredService(input.resp); misconfigured != input.expect {
+				t.Errorf("expected misconfigured to be %v", input.expect)
+			}
+		})
+	}
+
+	var reported string
+	s := &Threescale{conf: &AdapterConfig{
+		FailPolicy: FailOpen,
+		Metrics:    &MetricsReporter{MisconfiguredServiceCB: func(serviceID string) { reported = serviceID }},
+	}}
+
+	resp := withStatus(http.StatusNotFound, "service_id_invalid")
+	result := s.misconfiguredServiceResult(context.TODO(), "GET", nil, "123", newCheckResult(), resp)
+	if result.Status.Code != int32(rpc.INTERNAL) {
+		t.Errorf("expected internal error by default, got %v", result.Status)
+	}
+
+	if reported != "123" {
+		t.Errorf("expected misconfigured service to be reported")
+	}
+
+	s.conf.InternalErrorPolicy = InternalErrorFailPolicy
+	result = s.misconfiguredServiceResult(context.TODO(), "GET", nil, "123", newCheckResult(), resp)
+	if result.Status.Code != int32(rpc.OK) {
+		t.Errorf("expected open fail policy to be applied, got %v", result.Status)
+	}
+}
@@ -0,0 +1,71 @@
+package threescale
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	system "github.com/3scale/3scale-porta-go-client/client"
+)
+
+// invalidCredentialErrorCodes are the 3scale backend error codes which indicate the credentials themselves are invalid.
+// Denials which may change quickly, such as limits_exceeded, must never be added here.
+var invalidCredentialErrorCodes = map[string]bool{
+	"user_key_invalid":        true,
+	"application_not_found":   true,
+	"application_key_invalid": true,
+}
+
+// negativeCache remembers credentials which were denied by 3scale backend as invalid, for a short period
+type negativeCache struct {
+	ttl     time.Duration
+	entries *decisionCache
+}
+
+// newNegativeCache returns a cache with the provided TTL, whose entries are held by the shared decision cache.
+// A non-positive TTL returns nil, which caches nothing
+func newNegativeCache(ttl time.Duration, entries *decisionCache) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{
+		ttl:     ttl,
+		entries: entries,
+	}
+}
+
+// negativeCacheKey identifies the credentials of a request for a particular version of the service configuration,
+// such that entries are invalidated when the configuration changes. Credentials are hashed rather than held in memory.
+func negativeCacheKey(serviceID string, conf system.ProxyConfig, params authorizer.BackendParams) string {
+	return fmt.Sprintf("%s|%d|%s", serviceID, conf.Version, credentialHash(params))
+}
+
+// credentialHash returns the hex encoded sha256 of the credentials, so that they need not be held in plain text
+func credentialHash(params authorizer.BackendParams) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", params.AppID, params.AppKey, params.UserKey)))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the error code with which the credentials were previously denied, if still valid
+func (c *negativeCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	errorCode, ok, expired := c.entries.get(DecisionCacheNegative, key, time.Now())
+	if !ok || expired {
+		return "", false
+	}
+	return errorCode.(string), true
+}
+
+// add remembers the denial if it was due to invalid credentials
+func (c *negativeCache) add(key string, resp *authorizer.BackendResponse) {
+	if c == nil || resp == nil || resp.Authorized || !invalidCredentialErrorCodes[resp.ErrorCode] {
+		return
+	}
+
+	c.entries.add(DecisionCacheNegative, key, resp.ErrorCode, time.Now().Add(c.ttl))
+}
@@ -0,0 +1,40 @@
+package threescale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+func TestNegativeCache(t *testing.T) {
+	params := authorizer.BackendParams{UserKey: "invalid"}
+	key := negativeCacheKey("123", client.ProxyConfig{Version: 1}, params)
+
+	c := newNegativeCache(time.Millisecond*50, newDecisionCache(0, nil))
+	c.add(key, &authorizer.BackendResponse{ErrorCode: "limits_exceeded"})
+	if _, ok := c.get(key); ok {
+		t.Errorf("rate limit denials must not be cached")
+	}
+
+	c.add(key, &authorizer.BackendResponse{ErrorCode: "user_key_invalid"})
+	if code, ok := c.get(key); !ok || code != "user_key_invalid" {
+		t.Errorf("expected invalid credentials to be cached")
+	}
+
+	if _, ok := c.get(negativeCacheKey("123", client.ProxyConfig{Version: 2}, params)); ok {
+		t.Errorf("expected entry to be invalidated by a change in service configuration")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if _, ok := c.get(key); ok {
+		t.Errorf("expected entry to expire")
+	}
+
+	var disabled *negativeCache
+	disabled.add(key, &authorizer.BackendResponse{ErrorCode: "user_key_invalid"})
+	if _, ok := disabled.get(key); ok {
+		t.Errorf("expected nil cache to cache nothing")
+	}
+}
@@ -0,0 +1,44 @@
+package threescale
+
+import (
+	"context"
+	"time"
+)
+
+// overhead returns the time spent by the adapter itself on a request which took total, excluding the time spent
+// waiting on 3scale system and backend
+func (t *checkTimings) overhead(total time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	overhead := total - t.system - t.backend
+	if overhead < 0 {
+		return 0
+	}
+	return overhead
+}
+
+// reportOverhead reports the time spent by the adapter itself on a request, logging the request if it exceeds the
+// OverheadLogThreshold
+func (s *Threescale) reportOverhead(ctx context.Context, t *checkTimings, total time.Duration) {
+	reportMetric := s.conf.Metrics != nil && s.conf.Metrics.AdapterOverheadCB != nil
+	logOverhead := s.conf.OverheadLogThreshold > 0
+	if !reportMetric && !logOverhead {
+		return
+	}
+
+	overhead := t.overhead(total)
+
+	t.mu.Lock()
+	serviceID, system, backend := t.serviceID, t.system, t.backend
+	t.mu.Unlock()
+
+	if reportMetric {
+		s.conf.Metrics.AdapterOverheadCB(serviceID, overhead)
+	}
+
+	if logOverhead && overhead >= s.conf.OverheadLogThreshold {
+		logFor(ctx).Warnf("adapter overhead exceeded threshold: service_id=%s overhead=%s threshold=%s total=%s system_config=%s backend=%s",
+			serviceID, overhead, s.conf.OverheadLogThreshold, total, system, backend)
+	}
+}
@@ -0,0 +1,38 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReportOverhead(t *testing.T) {
+	timings := &checkTimings{
+		serviceID: "123",
+		system:    time.Millisecond * 20,
+		backend:   time.Millisecond * 50,
+	}
+
+	var reported time.Duration
+	s := &Threescale{conf: &AdapterConfig{
+		Metrics: &MetricsReporter{
+			AdapterOverheadCB: func(serviceID string, overhead time.Duration) {
+				if serviceID != "123" {
+					t.Errorf("unexpected service id %s", serviceID)
+				}
+				reported = overhead
+			},
+		},
+	}}
+
+	s.reportOverhead(context.TODO(), timings, time.Millisecond*75)
+	if reported != time.Millisecond*5 {
+		t.Errorf("expected overhead excluding calls to 3scale of 5ms, got %s", reported)
+	}
+
+	// calls to 3scale which outlived the deadline of the request may exceed its total
+	s.reportOverhead(context.TODO(), timings, time.Millisecond*60)
+	if reported != 0 {
+		t.Errorf("expected overhead not to be negative, got %s", reported)
+	}
+}
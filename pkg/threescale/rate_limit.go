@@ -0,0 +1,79 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gogo/googleapis/google/rpc"
+	"golang.org/x/time/rate"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// LocalRateLimit configures a token bucket applied to requests before they reach 3scale
+type LocalRateLimit struct {
+	// RequestsPerSecond is the sustained rate at which requests are allowed. A non-positive value disables the limit
+	RequestsPerSecond float64
+	// Burst is the max number of requests allowed at once. When non-positive, it defaults to RequestsPerSecond
+	Burst int
+	// PerService applies a separate bucket to each service, rather than a single bucket shared by all services
+	PerService bool
+}
+
+// localRateLimiter sheds requests exceeding the LocalRateLimit
+type localRateLimiter struct {
+	conf     LocalRateLimit
+	global   *rate.Limiter
+	services sync.Map
+}
+
+// newLocalRateLimiter returns a limiter as per the provided configuration, or nil if no limit applies
+func newLocalRateLimiter(conf LocalRateLimit) *localRateLimiter {
+	if conf.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	if conf.Burst <= 0 {
+		conf.Burst = int(math.Max(1, math.Ceil(conf.RequestsPerSecond)))
+	}
+
+	l := &localRateLimiter{conf: conf}
+	if !conf.PerService {
+		l.global = l.newBucket()
+	}
+	return l
+}
+
+func (l *localRateLimiter) newBucket() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(l.conf.RequestsPerSecond), l.conf.Burst)
+}
+
+// allow returns true if a request for the service is within the limit
+func (l *localRateLimiter) allow(serviceID string) bool {
+	if l == nil {
+		return true
+	}
+
+	if l.global != nil {
+		return l.global.Allow()
+	}
+
+	bucket, ok := l.services.Load(serviceID)
+	if !ok {
+		bucket, _ = l.services.LoadOrStore(serviceID, l.newBucket())
+	}
+	return bucket.(*rate.Limiter).Allow()
+}
+
+// localRateLimitStatus returns the status for a request rejected by the local rate limit
+func (s *Threescale) localRateLimitStatus(ctx context.Context, serviceID string) rpc.Status {
+	if s.conf.Metrics != nil && s.conf.Metrics.LocalRateLimitedCB != nil {
+		s.conf.Metrics.LocalRateLimitedCB(serviceID)
+	}
+
+	msg := fmt.Sprintf("local rate limit exceeded for service %s", serviceID)
+	logFor(ctx).Debugf("%s", msg)
+	return status.WithResourceExhausted(msg)
+}
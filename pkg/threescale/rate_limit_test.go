@@ -0,0 +1,36 @@
+package threescale
+
+import (
+	"testing"
+)
+
+func TestLocalRateLimiter(t *testing.T) {
+	if l := newLocalRateLimiter(LocalRateLimit{}); l != nil || !l.allow("123") {
+		t.Errorf("expected no limit to apply when disabled")
+	}
+
+	global := newLocalRateLimiter(LocalRateLimit{RequestsPerSecond: 0.001, Burst: 2})
+	for _, serviceID := range []string{"123", "456"} {
+		if !global.allow(serviceID) {
+			t.Errorf("expected request for service %s to be within the burst", serviceID)
+		}
+	}
+
+	if global.allow("789") {
+		t.Errorf("expected the limit to be shared across services")
+	}
+
+	perService := newLocalRateLimiter(LocalRateLimit{RequestsPerSecond: 0.001, Burst: 1, PerService: true})
+	if !perService.allow("123") || !perService.allow("456") {
+		t.Errorf("expected each service to have its own bucket")
+	}
+
+	if perService.allow("123") {
+		t.Errorf("expected request exceeding the limit for the service to be rejected")
+	}
+
+	defaultBurst := newLocalRateLimiter(LocalRateLimit{RequestsPerSecond: 0.5})
+	if defaultBurst.conf.Burst != 1 {
+		t.Errorf("expected burst to default to at least one request, got %d", defaultBurst.conf.Burst)
+	}
+}
@@ -0,0 +1,135 @@
+package threescale
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync/atomic"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+
+	"istio.io/istio/pkg/log"
+)
+
+// maxPersistedReportBytes bounds the size of a single usage report read back from disk
+const maxPersistedReportBytes = 1 << 20
+
+// persistedReport is a usage report retained on disk, as a line of JSON, until it can be sent to 3scale backend
+type persistedReport struct {
+	BackendURL string                    `json:"backend_url"`
+	Request    authorizer.BackendRequest `json:"request"`
+}
+
+// retain holds a report which failed to be sent while the queue is closing, to be persisted once closed
+func (q *reportQueue) retain(job reportJob) {
+	if q.persistPath == "" || atomic.LoadInt32(&q.closing) == 0 {
+		return
+	}
+
+	q.unsentMu.Lock()
+	q.unsent = append(q.unsent, job)
+	q.unsentMu.Unlock()
+}
+
+// persist writes the reports which could not be sent to the persist path, replacing the file atomically so that
+// a partial write never replaces the reports of a previous shutdown
+func (q *reportQueue) persist() {
+	q.unsentMu.Lock()
+	defer q.unsentMu.Unlock()
+
+	if q.persistPath == "" || len(q.unsent) == 0 {
+		return
+	}
+
+	tmp := q.persistPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errorf("failed to persist %d usage reports to %s, usage is lost - %v", len(q.unsent), q.persistPath, err)
+		return
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, job := range q.unsent {
+		if err = enc.Encode(persistedReport{BackendURL: job.backendURL, Request: job.request}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.persistPath)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		log.Errorf("failed to persist %d usage reports to %s, usage is lost - %v", len(q.unsent), q.persistPath, err)
+		return
+	}
+	log.Warnf("persisted %d usage reports which could not be sent to 3scale backend to %s", len(q.unsent), q.persistPath)
+}
+
+// restore reads the reports persisted by a previous shutdown and sends them to 3scale backend. Should one fail, the
+// rest are not attempted, and every unsent report is retained to be persisted again on shutdown. Lines which cannot
+// be parsed, such as a line cut short, are skipped
+func (q *reportQueue) restore() {
+	if q.persistPath == "" {
+		return
+	}
+
+	jobs, corrupt, err := readPersistedReports(q.persistPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to read every usage report persisted to %s, the remainder is skipped - %v", q.persistPath, err)
+	}
+
+	if err := os.Remove(q.persistPath); err != nil {
+		log.Errorf("failed to remove usage reports persisted to %s, reports may be sent twice - %v", q.persistPath, err)
+	}
+
+	if corrupt > 0 {
+		log.Warnf("skipped %d corrupt usage reports persisted to %s", corrupt, q.persistPath)
+	}
+
+	var sent int
+	for i, job := range jobs {
+		if _, err := q.authorizer.Report(job.backendURL, job.request); err != nil {
+			log.Errorf("failed to send usage reports persisted to %s, retaining %d until shutdown - %v", q.persistPath, len(jobs)-i, err)
+			q.unsentMu.Lock()
+			q.unsent = append(q.unsent, jobs[i:]...)
+			q.unsentMu.Unlock()
+			break
+		}
+		sent++
+	}
+	log.Infof("sent %d of %d usage reports persisted to %s", sent, len(jobs), q.persistPath)
+}
+
+// readPersistedReports reads the reports persisted to the file, returning the number of lines which could not be parsed
+func readPersistedReports(path string) ([]reportJob, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var jobs []reportJob
+	var corrupt int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxPersistedReportBytes)
+	for scanner.Scan() {
+		var report persistedReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil || report.Request.Service == "" {
+			corrupt++
+			continue
+		}
+		jobs = append(jobs, reportJob{backendURL: report.BackendURL, request: report.Request})
+	}
+	return jobs, corrupt, scanner.Err()
+}
@@ -0,0 +1,177 @@
+package threescale
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// failingReportingAuthorizer fails to report usage while failing is set
+type failingReportingAuthorizer struct {
+	mockReportingAuthorizer
+	failing bool
+}
+
+func (m *failingReportingAuthorizer) Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	if m.failing {
+		return nil, errors.New("unavailable")
+	}
+	m.reported <- request
+	return &authorizer.BackendResponse{Authorized: true}, nil
+}
+
+// blockingReportingAuthorizer counts the reports attempted, each of which fails once released
+type blockingReportingAuthorizer struct {
+	mockReportingAuthorizer
+	calls   *int32
+	release chan struct{}
+}
+
+func (m blockingReportingAuthorizer) Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	atomic.AddInt32(m.calls, 1)
+	<-m.release
+	return nil, errors.New("unavailable")
+}
+
+func TestReportQueueDrainOnShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs := []struct {
+		name         string
+		drainTimeout time.Duration
+		// release fails the report in flight once the queue is closing, rather than leaving it to hang
+		release         bool
+		expectPersisted int
+	}{
+		{
+			name:            "Test reports are not sent once a report fails on shutdown",
+			drainTimeout:    time.Minute,
+			release:         true,
+			expectPersisted: 3,
+		},
+		{
+			name:         "Test reports still queued once the drain timeout passes are persisted without being sent",
+			drainTimeout: time.Millisecond * 50,
+			// the report in flight is not persisted, since 3scale backend may yet record it
+			expectPersisted: 2,
+		},
+	}
+
+	for i, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var calls int32
+			release := make(chan struct{})
+			defer close(release)
+
+			path := filepath.Join(dir, fmt.Sprintf("reports-%d.jsonl", i))
+			mock := blockingReportingAuthorizer{calls: &calls, release: release}
+			conf := &AdapterConfig{Authorizer: mock, ReportMode: ReportAsync, ReportQueueSize: 10, ReportPersistPath: path}
+
+			q := newReportQueueFromConfig(conf)
+			q.drainTimeout = input.drainTimeout
+			for _, service := range []string{"1", "2", "3"} {
+				q.enqueue("https://backend", authorizer.BackendRequest{Service: service})
+			}
+
+			// wait for the first report to be in flight
+			for atomic.LoadInt32(&calls) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				q.close()
+				close(closed)
+			}()
+
+			if input.release {
+				for atomic.LoadInt32(&q.closing) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				release <- struct{}{}
+			}
+
+			select {
+			case <-closed:
+			case <-time.After(time.Second * 5):
+				t.Fatalf("expected close to return without waiting on 3scale backend")
+			}
+
+			if calls := atomic.LoadInt32(&calls); calls != 1 {
+				t.Errorf("expected a single report to be attempted, got %d", calls)
+			}
+
+			jobs, _, err := readPersistedReports(path)
+			if err != nil || len(jobs) != input.expectPersisted {
+				t.Errorf("expected %d reports to be persisted, got %d - %v", input.expectPersisted, len(jobs), err)
+			}
+		})
+	}
+}
+
+func TestReportQueuePersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reports.jsonl")
+
+	mock := &failingReportingAuthorizer{
+		mockReportingAuthorizer: mockReportingAuthorizer{reported: make(chan authorizer.BackendRequest, 10)},
+		failing:                 true,
+	}
+	conf := &AdapterConfig{Authorizer: mock, ReportMode: ReportAsync, ReportQueueSize: 10, ReportPersistPath: path}
+
+	// reports failing before shutdown are not persisted
+	q := newReportQueueFromConfig(conf)
+	q.retain(reportJob{request: authorizer.BackendRequest{Service: "0"}})
+	q.closing = 1
+	for _, service := range []string{"1", "2"} {
+		q.enqueue("https://backend", authorizer.BackendRequest{
+			Service:      service,
+			Transactions: []authorizer.BackendTransaction{{Params: authorizer.BackendParams{AppID: "app"}}},
+		})
+	}
+	q.close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("expected reports to be persisted - %v", err)
+	}
+	f.WriteString("{\"backend_url\":\"https://back")
+	f.Close()
+
+	// reports are retained once more while 3scale remains unavailable
+	q = newReportQueueFromConfig(conf)
+	if len(q.unsent) != 2 {
+		t.Errorf("expected two reports to be restored and retained, got %d", len(q.unsent))
+	}
+	q.close()
+
+	mock.failing = false
+	q = newReportQueueFromConfig(conf)
+	if len(mock.reported) != 2 || len(q.unsent) != 0 {
+		t.Fatalf("expected persisted reports to be sent on creation, got %d", len(mock.reported))
+	}
+
+	if request := <-mock.reported; request.Service != "1" || request.Transactions[0].Params.AppID != "app" {
+		t.Errorf("unexpected report restored %+v", request)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected persisted reports to be removed once restored")
+	}
+	q.close()
+}
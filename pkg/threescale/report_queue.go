@@ -0,0 +1,297 @@
+package threescale
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+
+	"istio.io/istio/pkg/log"
+)
+
+// ReportingAuthorizer is implemented by an Authorizer which can authorize requests and report usage independently.
+// It is required in order to report usage asynchronously.
+type ReportingAuthorizer interface {
+	Authorizer
+	Authorize(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error)
+	Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error)
+}
+
+// defaultReportDrainTimeout bounds the time for which reports queued on shutdown are sent, after which those remaining
+// are persisted, or dropped, without being sent
+const defaultReportDrainTimeout = time.Second * 5
+
+// reportJob is a usage report waiting to be sent to 3scale backend
+type reportJob struct {
+	backendURL string
+	request    authorizer.BackendRequest
+}
+
+// reportQueue sends usage reports to 3scale backend in the background
+type reportQueue struct {
+	authorizer ReportingAuthorizer
+	metrics    *MetricsReporter
+	overflow   ReportOverflowPolicy
+	jobs       chan reportJob
+	wg         sync.WaitGroup
+
+	// timestamps stamps reports with the time they were queued, adjusted by timeOffset
+	timestamps bool
+	timeOffset time.Duration
+
+	// mu guards against reports being queued once closed, by checks which outlived their deadline
+	mu     sync.RWMutex
+	closed bool
+
+	// persistPath is the file to which reports which could not be sent on shutdown are persisted, if any
+	persistPath string
+	// closing is 1 once close has been called, accessed atomically
+	closing  int32
+	unsentMu sync.Mutex
+	unsent   []reportJob
+
+	// drainTimeout bounds the time for which reports queued on shutdown are sent
+	drainTimeout time.Duration
+	// stopSending is 1 once reports are no longer sent on shutdown, accessed atomically. Reports taken from the queue
+	// from then on are retained to be persisted
+	stopSending int32
+	// drainMu guards the queue being taken by close from the worker once the drain timeout has passed
+	drainMu sync.Mutex
+	drained bool
+}
+
+// newReportQueue starts a worker which reports usage queued, up to size, in the background.
+// The overflow policy is applied to reports queued once full
+func newReportQueue(authorizer ReportingAuthorizer, size int, overflow ReportOverflowPolicy, metrics *MetricsReporter) *reportQueue {
+	q := &reportQueue{
+		authorizer: authorizer,
+		metrics:    metrics,
+		overflow:   overflow,
+		jobs:       make(chan reportJob, size),
+
+		drainTimeout: defaultReportDrainTimeout,
+	}
+
+	q.wg.Add(1)
+	go q.run()
+	return q
+}
+
+func (q *reportQueue) run() {
+	defer q.wg.Done()
+	for {
+		job, ok := q.next()
+		if !ok {
+			return
+		}
+
+		q.reportDepth()
+		if atomic.LoadInt32(&q.stopSending) == 1 {
+			q.retain(job)
+			continue
+		}
+
+		resp, err := q.authorizer.Report(job.backendURL, job.request)
+		if err != nil {
+			log.Errorf("failed to report usage for service %s - %v", job.request.Service, err)
+			q.retain(job)
+
+			// 3scale backend is likely unavailable, so the reports remaining on shutdown are persisted without waiting on it
+			if atomic.LoadInt32(&q.closing) == 1 && q.persistPath != "" {
+				atomic.StoreInt32(&q.stopSending, 1)
+			}
+		}
+		observeReportTimestamp(q.metrics, job.request, resp)
+	}
+}
+
+// next returns the next report queued, or false once the queue is closed and empty, or has been taken by close
+func (q *reportQueue) next() (reportJob, bool) {
+	q.drainMu.Lock()
+	defer q.drainMu.Unlock()
+
+	if q.drained {
+		return reportJob{}, false
+	}
+	job, ok := <-q.jobs
+	return job, ok
+}
+
+// enqueue queues the usage report, applying the overflow policy if the queue is full
+func (q *reportQueue) enqueue(backendURL string, request authorizer.BackendRequest) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		log.Warnf("report queue is closed, dropping usage report for service %s", request.Service)
+		return
+	}
+
+	if q.timestamps {
+		request = stampReport(request, time.Now(), q.timeOffset)
+	}
+
+	job := reportJob{backendURL: backendURL, request: request}
+	select {
+	case q.jobs <- job:
+		q.reportDepth()
+		return
+	default:
+	}
+
+	switch q.overflow {
+	case ReportOverflowDropOldest:
+		q.replaceOldest(job)
+	case ReportOverflowBlock:
+		log.Debugf("report queue is full, waiting to queue usage report for service %s", request.Service)
+		if q.metrics != nil && q.metrics.ReportBlockedCB != nil {
+			q.metrics.ReportBlockedCB()
+		}
+		// close waits for mu, so the worker keeps draining the queue while blocked
+		q.jobs <- job
+		q.reportDepth()
+	default:
+		log.Warnf("report queue is full, dropping usage report for service %s", request.Service)
+		if q.metrics != nil && q.metrics.ReportDroppedCB != nil {
+			q.metrics.ReportDroppedCB()
+		}
+	}
+}
+
+// replaceOldest drops the longest waiting reports until the job can be queued. Callers must hold mu
+func (q *reportQueue) replaceOldest(job reportJob) {
+	for {
+		select {
+		case q.jobs <- job:
+			q.reportDepth()
+			return
+		default:
+		}
+
+		select {
+		case oldest := <-q.jobs:
+			log.Warnf("report queue is full, dropping oldest usage report for service %s", oldest.request.Service)
+			if q.metrics != nil && q.metrics.ReportDroppedOldestCB != nil {
+				q.metrics.ReportDroppedOldestCB()
+			}
+		default:
+			// the worker emptied the queue in the meantime
+		}
+	}
+}
+
+// close stops accepting reports and waits for those queued to be sent, persisting those which could not be sent.
+// Once the drain timeout has passed, the reports still queued are persisted without being sent. A report being sent
+// at that point is not persisted, since 3scale backend may yet record it
+func (q *reportQueue) close() {
+	atomic.StoreInt32(&q.closing, 1)
+
+	q.mu.Lock()
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(q.drainTimeout):
+		atomic.StoreInt32(&q.stopSending, 1)
+
+		// the queue is closed, so the worker only holds drainMu while taking a report already queued
+		q.drainMu.Lock()
+		q.drained = true
+		var remaining int
+		for job := range q.jobs {
+			q.retain(job)
+			remaining++
+		}
+		q.drainMu.Unlock()
+
+		if q.persistPath == "" {
+			log.Errorf("timed out sending usage reports on shutdown, %d usage reports are lost", remaining)
+		} else {
+			log.Warnf("timed out sending usage reports on shutdown, persisting the %d remaining", remaining)
+		}
+	}
+	q.persist()
+}
+
+func (q *reportQueue) reportDepth() {
+	if q.metrics != nil && q.metrics.ReportQueueDepthCB != nil {
+		q.metrics.ReportQueueDepthCB(len(q.jobs))
+	}
+}
+
+// authorizeAndReport authorizes the request against 3scale backend and reports usage for authorized requests,
+// asynchronously when a report queue is configured. Usage for denied requests is reported if configured
+func (s *Threescale) authorizeAndReport(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	var resp *authorizer.BackendResponse
+	var err error
+
+	if s.reports == nil {
+		resp, err = s.conf.Authorizer.AuthRep(backendURL, request)
+	} else {
+		resp, err = s.reports.authorizer.Authorize(backendURL, request)
+		if err == nil && resp != nil && resp.Authorized {
+			s.reports.enqueue(backendURL, request)
+		}
+	}
+
+	if s.conf.ReportDeniedRequests && err == nil && resp != nil && !resp.Authorized {
+		s.reportDenied(backendURL, request, resp)
+	}
+	return resp, err
+}
+
+// reportDenied reports usage for a request denied by 3scale backend, which does not record usage for denied requests
+// itself. Requests denied for invalid credentials are never reported since there is no application to report against
+func (s *Threescale) reportDenied(backendURL string, request authorizer.BackendRequest, resp *authorizer.BackendResponse) {
+	if invalidCredentialErrorCodes[resp.ErrorCode] {
+		return
+	}
+
+	if s.reports != nil {
+		s.reports.enqueue(backendURL, request)
+		return
+	}
+
+	reporter, ok := s.conf.Authorizer.(ReportingAuthorizer)
+	if !ok {
+		return
+	}
+
+	if s.conf.ReportTimestamps {
+		request = stampReport(request, time.Now(), s.conf.ReportTimeOffset)
+	}
+
+	reportResp, err := reporter.Report(backendURL, request)
+	if err != nil {
+		log.Errorf("failed to report usage of denied request for service %s - %v", request.Service, err)
+	}
+	observeReportTimestamp(s.conf.Metrics, request, reportResp)
+}
+
+// newReportQueueFromConfig returns a report queue if asynchronous reporting has been configured and is supported
+func newReportQueueFromConfig(conf *AdapterConfig) *reportQueue {
+	if conf.ReportMode != ReportAsync {
+		return nil
+	}
+
+	reportingAuthorizer, ok := conf.Authorizer.(ReportingAuthorizer)
+	if !ok {
+		log.Warnf("authorizer does not support reporting independently of authorization, usage will be reported synchronously")
+		return nil
+	}
+	q := newReportQueue(reportingAuthorizer, conf.ReportQueueSize, conf.ReportOverflowPolicy, conf.Metrics)
+	q.timestamps = conf.ReportTimestamps
+	q.timeOffset = conf.ReportTimeOffset
+	q.persistPath = conf.ReportPersistPath
+	q.restore()
+	return q
+}
@@ -0,0 +1,222 @@
+package threescale
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+type mockReportingAuthorizer struct {
+	mockAuthorizer
+	reported chan authorizer.BackendRequest
+	block    chan struct{}
+}
+
+func (m mockReportingAuthorizer) Authorize(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	return &authorizer.BackendResponse{Authorized: true}, nil
+}
+
+func (m mockReportingAuthorizer) Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	<-m.block
+	m.reported <- request
+	return &authorizer.BackendResponse{Authorized: true}, nil
+}
+
+func TestReportQueue(t *testing.T) {
+	var dropped int
+	mock := mockReportingAuthorizer{
+		reported: make(chan authorizer.BackendRequest, 10),
+		block:    make(chan struct{}),
+	}
+
+	s := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: mock,
+			Metrics: &MetricsReporter{
+				ReportDroppedCB: func() {
+					dropped++
+				},
+			},
+		},
+	}
+	s.reports = newReportQueue(mock, 1, ReportOverflowDropNewest, s.conf.Metrics)
+
+	// the first report is taken by the blocked worker, the second is queued and the third dropped
+	for _, service := range []string{"1", "2", "3"} {
+		resp, err := s.authorizeAndReport("", authorizer.BackendRequest{Service: service})
+		if err != nil || !resp.Authorized {
+			t.Fatalf("expected request to be authorized")
+		}
+
+		// wait for the worker to pick up the first report
+		for service == "1" && len(s.reports.jobs) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if dropped != 1 {
+		t.Errorf("expected one report to be dropped, got %d", dropped)
+	}
+
+	close(mock.block)
+	s.reports.close()
+
+	if len(mock.reported) != 2 {
+		t.Errorf("expected queued reports to be sent before closing, got %d", len(mock.reported))
+	}
+
+	// reports queued once closed are dropped rather than panic
+	s.reports.enqueue("", authorizer.BackendRequest{Service: "4"})
+}
+
+// denyingReportingAuthorizer denies every request with the error code
+type denyingReportingAuthorizer struct {
+	mockReportingAuthorizer
+	errorCode string
+}
+
+func (m denyingReportingAuthorizer) AuthRep(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	return &authorizer.BackendResponse{ErrorCode: m.errorCode}, nil
+}
+
+func TestReportDeniedRequests(t *testing.T) {
+	inputs := []struct {
+		name         string
+		errorCode    string
+		reportDenied bool
+		expect       int
+	}{
+		{
+			name:      "Test denied request is not reported by default",
+			errorCode: "limits_exceeded",
+		},
+		{
+			name:         "Test denied request is reported when configured",
+			errorCode:    "limits_exceeded",
+			reportDenied: true,
+			expect:       1,
+		},
+		{
+			name:         "Test request denied for invalid credentials is never reported",
+			errorCode:    "user_key_invalid",
+			reportDenied: true,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			mock := denyingReportingAuthorizer{
+				mockReportingAuthorizer: mockReportingAuthorizer{
+					reported: make(chan authorizer.BackendRequest, 1),
+					block:    make(chan struct{}),
+				},
+				errorCode: input.errorCode,
+			}
+			close(mock.block)
+
+			s := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:           mock,
+					ReportDeniedRequests: input.reportDenied,
+				},
+			}
+
+			resp, err := s.authorizeAndReport("", authorizer.BackendRequest{Service: "123"})
+			if err != nil || resp.Authorized {
+				t.Fatalf("expected request to be denied")
+			}
+
+			if len(mock.reported) != input.expect {
+				t.Errorf("expected %d reports, got %d", input.expect, len(mock.reported))
+			}
+		})
+	}
+}
+
+func TestReportOverflowPolicy(t *testing.T) {
+	inputs := []struct {
+		name          string
+		policy        ReportOverflowPolicy
+		expectDropped int
+		expectOldest  int
+		expectBlocked int
+		expectSent    []string
+	}{
+		{
+			name:          "Test newest report is dropped by default",
+			policy:        ReportOverflowDropNewest,
+			expectDropped: 1,
+			expectSent:    []string{"1", "2"},
+		},
+		{
+			name:         "Test oldest queued report is dropped",
+			policy:       ReportOverflowDropOldest,
+			expectOldest: 1,
+			expectSent:   []string{"1", "3"},
+		},
+		{
+			name:          "Test report waits for space in the queue",
+			policy:        ReportOverflowBlock,
+			expectBlocked: 1,
+			expectSent:    []string{"1", "2", "3"},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var dropped, oldest, blocked int
+			metrics := &MetricsReporter{
+				ReportDroppedCB:       func() { dropped++ },
+				ReportDroppedOldestCB: func() { oldest++ },
+				ReportBlockedCB:       func() { blocked++ },
+			}
+
+			mock := mockReportingAuthorizer{
+				reported: make(chan authorizer.BackendRequest, 10),
+				block:    make(chan struct{}),
+			}
+			q := newReportQueue(mock, 1, input.policy, metrics)
+
+			q.enqueue("", authorizer.BackendRequest{Service: "1"})
+			// wait for the worker to pick up the first report
+			for len(q.jobs) != 0 {
+				time.Sleep(time.Millisecond)
+			}
+			q.enqueue("", authorizer.BackendRequest{Service: "2"})
+
+			done := make(chan struct{})
+			go func() {
+				q.enqueue("", authorizer.BackendRequest{Service: "3"})
+				close(done)
+			}()
+
+			if input.policy == ReportOverflowBlock {
+				select {
+				case <-done:
+					t.Fatalf("expected report to wait for space in the queue")
+				case <-time.After(time.Millisecond * 50):
+				}
+				close(mock.block)
+				<-done
+			} else {
+				<-done
+				close(mock.block)
+			}
+			q.close()
+
+			if dropped != input.expectDropped || oldest != input.expectOldest || blocked != input.expectBlocked {
+				t.Errorf("unexpected overflow metrics - dropped %d, dropped oldest %d, blocked %d", dropped, oldest, blocked)
+			}
+
+			var sent []string
+			for len(mock.reported) > 0 {
+				sent = append(sent, (<-mock.reported).Service)
+			}
+			if strings.Join(sent, ",") != strings.Join(input.expectSent, ",") {
+				t.Errorf("expected reports %v to be sent, got %v", input.expectSent, sent)
+			}
+		})
+	}
+}
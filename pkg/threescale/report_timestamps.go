@@ -0,0 +1,82 @@
+package threescale
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+
+	"istio.io/istio/pkg/log"
+)
+
+// reportTimestampNotWithinRange is the error code with which 3scale backend rejects reports whose timestamp is too
+// far in the past, typically since the clock of the adapter is behind that of 3scale
+const reportTimestampNotWithinRange = "report_timestamp_not_within_range"
+
+// stampReport returns a copy of the request whose transactions are stamped with the time, adjusted by the offset,
+// so that usage is recorded by 3scale at the time of the request rather than when the report is sent
+func stampReport(request authorizer.BackendRequest, now time.Time, offset time.Duration) authorizer.BackendRequest {
+	timestamp := now.Add(offset).Unix()
+
+	transactions := make([]authorizer.BackendTransaction, len(request.Transactions))
+	for i, transaction := range request.Transactions {
+		transaction.Timestamp = timestamp
+		transactions[i] = transaction
+	}
+	request.Transactions = transactions
+	return request
+}
+
+// backendClockSkew returns how far the clock of the adapter is ahead of that of 3scale backend, as per the Date
+// header of its response, and false if the response carries no date. The Date header has a resolution of a second
+func backendClockSkew(resp *authorizer.BackendResponse, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	raw, ok := resp.RawResponse.(*http.Response)
+	if !ok || raw == nil {
+		return 0, false
+	}
+
+	date, err := http.ParseTime(raw.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(date).Truncate(time.Second), true
+}
+
+// observeReportTimestamp reports a usage report rejected by 3scale backend due to its timestamp, along with the skew
+// between the clocks of the adapter and 3scale backend, if it could be detected
+func observeReportTimestamp(metrics *MetricsReporter, request authorizer.BackendRequest, resp *authorizer.BackendResponse) {
+	if resp == nil || resp.ErrorCode != reportTimestampNotWithinRange {
+		return
+	}
+
+	if metrics != nil && metrics.ReportTimestampRejectedCB != nil {
+		metrics.ReportTimestampRejectedCB()
+	}
+
+	skew, ok := backendClockSkew(resp, time.Now())
+	if !ok {
+		log.Warnf("usage report for service %s rejected by 3scale backend due to its timestamp, check the clock of the adapter", request.Service)
+		return
+	}
+
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	log.Warnf("usage report for service %s rejected by 3scale backend due to its timestamp - clock is %s %s 3scale backend, "+
+		"check NTP or set a report time offset", request.Service, absDuration(skew), direction)
+	if metrics != nil && metrics.BackendClockSkewCB != nil {
+		metrics.BackendClockSkewCB(skew)
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
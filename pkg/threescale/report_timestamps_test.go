@@ -0,0 +1,95 @@
+package threescale
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+func TestStampReport(t *testing.T) {
+	request := authorizer.BackendRequest{
+		Service:      "123",
+		Transactions: []authorizer.BackendTransaction{{Params: authorizer.BackendParams{AppID: "app"}}},
+	}
+
+	now := time.Unix(1500000000, 0)
+	stamped := stampReport(request, now, -time.Minute)
+	if stamped.Transactions[0].Timestamp != 1500000000-60 {
+		t.Errorf("expected timestamp adjusted by the offset, got %d", stamped.Transactions[0].Timestamp)
+	}
+
+	if stamped.Transactions[0].Params.AppID != "app" {
+		t.Errorf("expected transaction to be otherwise unchanged")
+	}
+
+	if request.Transactions[0].Timestamp != 0 {
+		t.Errorf("expected the original request not to be modified")
+	}
+}
+
+func TestObserveReportTimestamp(t *testing.T) {
+	now := time.Now()
+	withDate := func(errorCode string, date time.Time) *authorizer.BackendResponse {
+		header := http.Header{}
+		if !date.IsZero() {
+			header.Set("Date", date.UTC().Format(http.TimeFormat))
+		}
+		return &authorizer.BackendResponse{
+			ErrorCode:   errorCode,
+			RawResponse: &http.Response{StatusCode: http.StatusConflict, Header: header},
+		}
+	}
+
+	inputs := []struct {
+		name           string
+		resp           *authorizer.BackendResponse
+		expectRejected bool
+		expectSkew     bool
+	}{
+		{
+			name:           "Test rejected report reports skew from date of response",
+			resp:           withDate(reportTimestampNotWithinRange, now.Add(time.Hour)),
+			expectRejected: true,
+			expectSkew:     true,
+		},
+		{
+			name:           "Test rejected report without date reports no skew",
+			resp:           withDate(reportTimestampNotWithinRange, time.Time{}),
+			expectRejected: true,
+		},
+		{
+			name: "Test report rejected for other reasons is ignored",
+			resp: withDate("usage_value_invalid", now.Add(time.Hour)),
+		},
+		{
+			name: "Test missing response is ignored",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var rejected bool
+			var skew *time.Duration
+			metrics := &MetricsReporter{
+				ReportTimestampRejectedCB: func() { rejected = true },
+				BackendClockSkewCB:        func(s time.Duration) { skew = &s },
+			}
+
+			observeReportTimestamp(metrics, authorizer.BackendRequest{Service: "123"}, input.resp)
+			if rejected != input.expectRejected {
+				t.Errorf("expected rejected to be %t", input.expectRejected)
+			}
+
+			if (skew != nil) != input.expectSkew {
+				t.Fatalf("expected skew reported to be %t", input.expectSkew)
+			}
+
+			// the clock of the adapter is an hour behind that of 3scale backend, within the resolution of the Date header
+			if skew != nil && (*skew > -time.Hour+2*time.Second || *skew < -time.Hour-2*time.Second) {
+				t.Errorf("unexpected skew %s", *skew)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package threescale
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"istio.io/istio/pkg/log"
+)
+
+// RequestIDHeader is the gRPC metadata key from which the id of a request is read
+const RequestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of the context which carries the request id
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id carried by the context, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDInterceptor stores the request id from the incoming metadata in the context, generating one if not provided
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 {
+			id = values[0]
+		}
+	}
+
+	if id == "" {
+		id = newRequestID()
+	}
+	return handler(ContextWithRequestID(ctx, id), req)
+}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("failed to generate request id - %v", err)
+		return ""
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// chainUnaryInterceptors combines the interceptors into one, which invokes them in the order provided
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return chained(ctx, req)
+	}
+}
+
+// requestLog prefixes log lines with the id of the request they relate to
+type requestLog string
+
+// logFor returns a requestLog for the request id carried by the context
+func logFor(ctx context.Context) requestLog {
+	return requestLog(RequestIDFromContext(ctx))
+}
+
+func (l requestLog) Debugf(format string, args ...interface{}) {
+	log.Debugf(l.format(format), args...)
+}
+
+func (l requestLog) Infof(format string, args ...interface{}) {
+	log.Infof(l.format(format), args...)
+}
+
+func (l requestLog) Warnf(format string, args ...interface{}) {
+	log.Warnf(l.format(format), args...)
+}
+
+func (l requestLog) Errorf(format string, args ...interface{}) {
+	log.Errorf(l.format(format), args...)
+}
+
+func (l requestLog) format(format string) string {
+	if l == "" {
+		return format
+	}
+	// escape the id since it may be provided by the client
+	return fmt.Sprintf("request_id=%s %s", strings.Replace(string(l), "%", "%%", -1), format)
+}
@@ -0,0 +1,47 @@
+package threescale
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return RequestIDFromContext(ctx), nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.TODO(), metadata.Pairs(RequestIDHeader, "provided"))
+	id, _ := requestIDInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	if id != "provided" {
+		t.Errorf("expected request id from metadata, got %v", id)
+	}
+
+	id, _ = requestIDInterceptor(context.TODO(), nil, &grpc.UnaryServerInfo{}, handler)
+	if len(id.(string)) != 36 {
+		t.Errorf("expected a generated request id, got %v", id)
+	}
+}
+
+func TestChainUnaryInterceptors(t *testing.T) {
+	var order []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			order = append(order, name)
+			return handler(ctx, req)
+		}
+	}
+
+	chained := chainUnaryInterceptors(record("first"), record("second"))
+	chained(context.TODO(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		order = append(order, "handler")
+		return nil, nil
+	})
+
+	if expect := []string{"first", "second", "handler"}; !reflect.DeepEqual(order, expect) {
+		t.Errorf("expected interceptors to be invoked in order %v, got %v", expect, order)
+	}
+}
@@ -0,0 +1,115 @@
+package threescale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// maxRetryBudgetTokens bounds the retries which may be made at once after a period without failures
+const maxRetryBudgetTokens = 10
+
+// BackendRetries configures retries of calls to 3scale backend which fail, such as on connection errors or 5xx responses
+type BackendRetries struct {
+	// Max is the number of times a failed call may be retried for a single request. A non-positive value disables retries.
+	// Retries require usage to be reported asynchronously, since calls which also report usage are never retried
+	Max int
+	// BudgetRatio bounds the retries made to a fraction of the calls made, such that 0.1 allows a retry for every
+	// ten calls. Once the budget is exhausted, failed calls are not retried. A non-positive value places no bound
+	BudgetRatio float64
+}
+
+// retryBudget is a token bucket which is credited BudgetRatio tokens by each call to 3scale backend and debited a
+// token by each retry, so that retries cannot amplify the load on 3scale backend while it is struggling
+type retryBudget struct {
+	ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// newRetryBudget returns a budget for the provided ratio, or nil if retries are unbounded
+func newRetryBudget(ratio float64) *retryBudget {
+	if ratio <= 0 {
+		return nil
+	}
+	return &retryBudget{ratio: ratio}
+}
+
+// deposit credits the budget for a call to 3scale backend
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > maxRetryBudgetTokens {
+		b.tokens = maxRetryBudgetTokens
+	}
+	b.mu.Unlock()
+}
+
+// withdraw returns true, debiting the budget, if a retry is allowed
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// callBackend authorizes the request against 3scale backend, retrying failures as configured while the retry budget,
+// the request deadline and the circuit to 3scale backend allow. Only calls which authorize without reporting usage are
+// retried, since a failed call may have been recorded by 3scale backend before failing
+func (s *Threescale) callBackend(ctx context.Context, backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	s.retryBudget.deposit()
+	resp, err := s.callBackendOnce(backendURL, request)
+
+	maxRetries := s.conf.BackendRetries.Max
+	if s.reports == nil {
+		// usage is reported by the call itself, so retrying it could report the usage twice
+		maxRetries = 0
+	}
+
+	for attempt := 0; attempt < maxRetries && isBackendFailure(resp, err); attempt++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !s.retryBudget.withdraw() {
+			logFor(ctx).Debugf("retry budget exhausted, not retrying failed call to 3scale backend for service %s", request.Service)
+			if s.conf.Metrics != nil && s.conf.Metrics.RetryBudgetExhaustedCB != nil {
+				s.conf.Metrics.RetryBudgetExhaustedCB()
+			}
+			break
+		}
+
+		if !s.circuitBreaker.allow() {
+			break
+		}
+
+		logFor(ctx).Debugf("retrying failed call to 3scale backend for service %s", request.Service)
+		resp, err = s.callBackendOnce(backendURL, request)
+	}
+	return resp, err
+}
+
+// callBackendOnce authorizes the request against 3scale backend, recording the outcome
+func (s *Threescale) callBackendOnce(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	start := time.Now()
+	resp, err := s.authorizeAndReport(backendURL, request)
+	s.reportBackendDuration(resp, time.Since(start))
+	// failures during maintenance are expected and so are not counted towards opening the circuit
+	s.circuitBreaker.record(isBackendFailure(resp, err) && !s.conf.Maintenance.IsActive())
+	return resp, err
+}
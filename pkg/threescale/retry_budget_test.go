@@ -0,0 +1,97 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// failingAuthorizer fails every call to 3scale backend, counting the calls made
+type failingAuthorizer struct {
+	mockAuthorizer
+	calls *int
+}
+
+func (m failingAuthorizer) AuthRep(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	*m.calls++
+	return nil, errors.New("connection refused")
+}
+
+func (m failingAuthorizer) Authorize(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	return m.AuthRep(backendURL, request)
+}
+
+func (m failingAuthorizer) Report(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5)
+	if b.withdraw() {
+		t.Errorf("expected empty budget not to allow a retry")
+	}
+
+	b.deposit()
+	b.deposit()
+	if !b.withdraw() || b.withdraw() {
+		t.Errorf("expected two calls to allow a single retry")
+	}
+
+	for i := 0; i < 100; i++ {
+		b.deposit()
+	}
+	if b.tokens != maxRetryBudgetTokens {
+		t.Errorf("expected budget to be bounded, got %v tokens", b.tokens)
+	}
+
+	if !newRetryBudget(0).withdraw() {
+		t.Errorf("expected unbounded budget to allow every retry")
+	}
+}
+
+func TestCallBackendRetries(t *testing.T) {
+	var calls, exhausted int
+	mock := failingAuthorizer{calls: &calls}
+	s := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer:     mock,
+			BackendRetries: BackendRetries{Max: 2, BudgetRatio: 1},
+			Metrics: &MetricsReporter{
+				RetryBudgetExhaustedCB: func() { exhausted++ },
+			},
+		},
+	}
+	s.retryBudget = newRetryBudget(s.conf.BackendRetries.BudgetRatio)
+
+	// calls which report usage themselves are never retried
+	if _, err := s.callBackend(context.TODO(), "", authorizer.BackendRequest{Service: "123"}); err == nil {
+		t.Fatalf("expected call to fail")
+	}
+
+	if calls != 1 {
+		t.Errorf("expected no retries when usage is reported synchronously, got %d calls", calls)
+	}
+
+	s.reports = &reportQueue{authorizer: mock}
+	s.retryBudget = newRetryBudget(s.conf.BackendRetries.BudgetRatio)
+	calls = 0
+
+	// the call deposits a single token, allowing one of the two retries
+	if _, err := s.callBackend(context.TODO(), "", authorizer.BackendRequest{Service: "123"}); err == nil {
+		t.Fatalf("expected call to fail")
+	}
+
+	if calls != 2 || exhausted != 1 {
+		t.Errorf("expected one retry before the budget was exhausted, got %d calls and %d exhaustions", calls, exhausted)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	calls = 0
+	s.callBackend(ctx, "", authorizer.BackendRequest{Service: "123"})
+	if calls != 1 {
+		t.Errorf("expected no retries once the request deadline is exceeded, got %d calls", calls)
+	}
+}
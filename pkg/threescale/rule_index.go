@@ -0,0 +1,211 @@
+package threescale
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	system "github.com/3scale/3scale-porta-go-client/client"
+)
+
+// regexpMetaChars are the characters which end the literal prefix of a pattern
+const regexpMetaChars = `\.+*?()|[]{}^$`
+
+// ruleIndex holds the mapping rules of a service compiled and grouped by method, such that a request only evaluates
+// the rules of its method. Patterns are unanchored regular expressions, so a rule may match anywhere in the path,
+// unless its pattern is anchored to a literal first path segment, such as "^/foo/" or "^/foo$". Such rules are further
+// grouped by that segment and only evaluated for requests to it. Every group is ordered by position
+type ruleIndex struct {
+	// source is the rules indexed, by which an index is known to be current for the configuration of a service
+	source          []system.ProxyRule
+	caseInsensitive bool
+	methods         map[string]*methodRules
+}
+
+// methodRules are the rules of a single method
+type methodRules struct {
+	// bySegment holds the rules anchored to a literal first path segment, keyed by the segment
+	bySegment map[string][]indexedRule
+	// anywhere holds every other rule, which may match any path
+	anywhere []indexedRule
+}
+
+type indexedRule struct {
+	*system.ProxyRule
+	// order is the order of the rule among every rule of the service, by position and then by declaration
+	order   int
+	pattern *regexp.Regexp
+}
+
+// newRuleIndex returns an index of the rules, compiled for case insensitive matching if required
+func newRuleIndex(rules []system.ProxyRule, caseInsensitive bool) *ruleIndex {
+	// the rules are ordered by reference since the config is shared with the cache and concurrent requests
+	sorted := make([]*system.ProxyRule, len(rules))
+	for i := range rules {
+		sorted[i] = &rules[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Position < sorted[j].Position
+	})
+
+	idx := &ruleIndex{
+		source:          rules,
+		caseInsensitive: caseInsensitive,
+		methods:         make(map[string]*methodRules),
+	}
+	for order, rule := range sorted {
+		method := strings.ToUpper(rule.HTTPMethod)
+		group, ok := idx.methods[method]
+		if !ok {
+			group = &methodRules{bySegment: make(map[string][]indexedRule)}
+			idx.methods[method] = group
+		}
+
+		expr := rule.Pattern
+		if caseInsensitive {
+			expr = "(?i)" + expr
+		}
+		indexed := indexedRule{ProxyRule: rule, order: order, pattern: patterns.compile(expr)}
+
+		if segment, ok := anchoredSegment(rule.Pattern); ok {
+			segment = idx.fold(segment)
+			group.bySegment[segment] = append(group.bySegment[segment], indexed)
+			continue
+		}
+		group.anywhere = append(group.anywhere, indexed)
+	}
+	return idx
+}
+
+// current returns true if the index is of the rules, as matched by the provided case sensitivity
+func (idx *ruleIndex) current(rules []system.ProxyRule, caseInsensitive bool) bool {
+	if idx.caseInsensitive != caseInsensitive || len(idx.source) != len(rules) {
+		return false
+	}
+	return len(rules) == 0 || &idx.source[0] == &rules[0]
+}
+
+func (idx *ruleIndex) fold(segment string) string {
+	if idx.caseInsensitive {
+		return strings.ToLower(segment)
+	}
+	return segment
+}
+
+// metrics evaluates the rules which may match the request in order of position, returning the metrics to report.
+// When maxEvaluations is positive, evaluation stops after that many patterns have been evaluated, in which case true
+// is returned
+func (idx *ruleIndex) metrics(path string, method string, maxEvaluations int, policy MultiMatchPolicy) (api.Metrics, bool) {
+	metrics := make(api.Metrics)
+
+	group, ok := idx.methods[strings.ToUpper(method)]
+	if !ok {
+		return metrics, false
+	}
+	segmentRules := group.bySegment[idx.fold(pathSegment(path))]
+
+	var evaluations int
+	var capped bool
+	// mostSpecific is the matching rule with the longest pattern, when only the most specific rule is reported
+	var mostSpecific *system.ProxyRule
+	// the rules of the segment and those matching anywhere are merged by order
+	for i, j := 0, 0; i < len(segmentRules) || j < len(group.anywhere); {
+		var rule indexedRule
+		if j >= len(group.anywhere) || i < len(segmentRules) && segmentRules[i].order < group.anywhere[j].order {
+			rule = segmentRules[i]
+			i++
+		} else {
+			rule = group.anywhere[j]
+			j++
+		}
+
+		if maxEvaluations > 0 && evaluations >= maxEvaluations {
+			capped = true
+			break
+		}
+		evaluations++
+
+		if rule.pattern == nil || !rule.pattern.MatchString(path) {
+			continue
+		}
+
+		switch policy {
+		case MultiMatchFirst:
+			metrics.Add(rule.MetricSystemName, int(rule.Delta))
+			return metrics, false
+		case MultiMatchMostSpecific:
+			// rules of equal length are resolved by position
+			if mostSpecific == nil || len(rule.Pattern) > len(mostSpecific.Pattern) {
+				mostSpecific = rule.ProxyRule
+			}
+		default:
+			metrics.Add(rule.MetricSystemName, int(rule.Delta))
+		}
+
+		// stop matching if this rule has been marked as Last
+		if rule.Last {
+			break
+		}
+	}
+
+	if mostSpecific != nil {
+		metrics.Add(mostSpecific.MetricSystemName, int(mostSpecific.Delta))
+	}
+	return metrics, capped
+}
+
+// anchoredSegment returns the literal first path segment a pattern is anchored to, if any. The segment must be
+// followed by a slash or the end of the path, so that the pattern cannot match a path whose first segment differs
+func anchoredSegment(pattern string) (string, bool) {
+	if !strings.HasPrefix(pattern, "^/") || strings.Contains(pattern, "|") {
+		return "", false
+	}
+
+	rest := pattern[len("^/"):]
+	end := strings.IndexAny(rest, "/"+regexpMetaChars)
+	if end <= 0 || rest[end] != '/' && rest[end] != '$' {
+		return "", false
+	}
+	return rest[:end], true
+}
+
+// pathSegment returns the first segment of the request path, ignoring any query string
+func pathSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if end := strings.IndexAny(path, "/?"); end >= 0 {
+		return path[:end]
+	}
+	return path
+}
+
+// ruleIndexes holds the index of the mapping rules of each service, rebuilt once the rules of a service change
+type ruleIndexes struct {
+	mu      sync.RWMutex
+	indexes map[string]*ruleIndex
+}
+
+func newRuleIndexes() *ruleIndexes {
+	return &ruleIndexes{indexes: make(map[string]*ruleIndex)}
+}
+
+// get returns the index of the rules of the service, indexing them if they have not been indexed already
+func (r *ruleIndexes) get(serviceID string, rules []system.ProxyRule, caseInsensitive bool) *ruleIndex {
+	if r == nil {
+		return newRuleIndex(rules, caseInsensitive)
+	}
+
+	r.mu.RLock()
+	idx, ok := r.indexes[serviceID]
+	r.mu.RUnlock()
+	if ok && idx.current(rules, caseInsensitive) {
+		return idx
+	}
+
+	idx = newRuleIndex(rules, caseInsensitive)
+	r.mu.Lock()
+	r.indexes[serviceID] = idx
+	r.mu.Unlock()
+	return idx
+}
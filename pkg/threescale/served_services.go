@@ -0,0 +1,39 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// newServedServices returns the set of service ids to be served, or nil if every service is served
+func newServedServices(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	served := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		served[id] = true
+	}
+	return served
+}
+
+// isServed returns true if requests for the service are handled by this adapter
+func (s *Threescale) isServed(serviceID string) bool {
+	return s.servedServices == nil || s.servedServices[serviceID]
+}
+
+// unservedServiceStatus returns the status for a request to a service which is not handled by this adapter
+func (s *Threescale) unservedServiceStatus(ctx context.Context, serviceID string) rpc.Status {
+	if s.conf.Metrics != nil && s.conf.Metrics.UnservedServiceCB != nil {
+		s.conf.Metrics.UnservedServiceCB(serviceID)
+	}
+
+	msg := fmt.Sprintf("service %s is not served by this adapter", serviceID)
+	logFor(ctx).Warnf("%s", msg)
+	return status.WithPermissionDenied(msg)
+}
@@ -0,0 +1,84 @@
+package threescale
+
+import (
+	"context"
+	"sync"
+)
+
+// serviceLimiters bound the number of concurrent authorization requests to each service, so that a spike in the
+// traffic to one service does not starve the others
+type serviceLimiters struct {
+	max       int
+	overrides map[string]int
+	metrics   *MetricsReporter
+
+	mu       sync.Mutex
+	limiters map[string]*inflightLimiter
+}
+
+// newServiceLimiters returns limiters allowing max concurrent requests to each service, unless overridden by service id.
+// A non-positive limit applies no limit to the service. Returns nil if no limit applies to any service
+func newServiceLimiters(max int, overrides map[string]int, metrics *MetricsReporter) *serviceLimiters {
+	if max <= 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	return &serviceLimiters{
+		max:       max,
+		overrides: overrides,
+		metrics:   metrics,
+		limiters:  make(map[string]*inflightLimiter),
+	}
+}
+
+// limiter returns the limiter for the service, which is nil if no limit applies to it
+func (l *serviceLimiters) limiter(serviceID string) *inflightLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limiter, ok := l.limiters[serviceID]; ok {
+		return limiter
+	}
+
+	max := l.max
+	if override, ok := l.overrides[serviceID]; ok {
+		max = override
+	}
+
+	limiter := newInflightLimiter(max)
+	l.limiters[serviceID] = limiter
+	return limiter
+}
+
+// acquire reserves a slot for a request to the service, returning false if its limit has been reached
+func (l *serviceLimiters) acquire(ctx context.Context, serviceID string) bool {
+	if l == nil {
+		return true
+	}
+
+	limiter := l.limiter(serviceID)
+	if !limiter.acquire(ctx, false) {
+		return false
+	}
+
+	l.report(serviceID, limiter, 1)
+	return true
+}
+
+// release frees a slot previously reserved by acquire
+func (l *serviceLimiters) release(serviceID string) {
+	if l == nil {
+		return
+	}
+
+	limiter := l.limiter(serviceID)
+	limiter.release()
+	l.report(serviceID, limiter, -1)
+}
+
+// report reports the change to the requests in flight to a service which has a limit
+func (l *serviceLimiters) report(serviceID string, limiter *inflightLimiter, delta int) {
+	if limiter != nil && l.metrics != nil && l.metrics.ServiceInflightCB != nil {
+		l.metrics.ServiceInflightCB(serviceID, delta)
+	}
+}
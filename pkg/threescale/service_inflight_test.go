@@ -0,0 +1,55 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+)
+
+func TestServiceLimiters(t *testing.T) {
+	if newServiceLimiters(0, nil, nil) != nil {
+		t.Errorf("expected no limiters when no limit applies")
+	}
+
+	inflight := make(map[string]int)
+	l := newServiceLimiters(1, map[string]int{"unlimited": 0, "two": 2}, &MetricsReporter{
+		ServiceInflightCB: func(serviceID string, delta int) {
+			inflight[serviceID] += delta
+		},
+	})
+
+	if !l.acquire(context.TODO(), "123") {
+		t.Errorf("expected first request to be admitted")
+	}
+
+	if l.acquire(context.TODO(), "123") {
+		t.Errorf("expected request beyond the limit of the service to be rejected")
+	}
+
+	if !l.acquire(context.TODO(), "456") {
+		t.Errorf("expected request to another service to be unaffected")
+	}
+
+	for i := 0; i < 2; i++ {
+		if !l.acquire(context.TODO(), "two") {
+			t.Errorf("expected requests within the overridden limit to be admitted")
+		}
+	}
+	if l.acquire(context.TODO(), "two") {
+		t.Errorf("expected request beyond the overridden limit to be rejected")
+	}
+
+	for i := 0; i < 5; i++ {
+		if !l.acquire(context.TODO(), "unlimited") {
+			t.Errorf("expected requests to a service without a limit to be admitted")
+		}
+	}
+
+	if inflight["123"] != 1 || inflight["two"] != 2 || inflight["unlimited"] != 0 {
+		t.Errorf("unexpected requests in flight reported %v", inflight)
+	}
+
+	l.release("123")
+	if inflight["123"] != 0 || !l.acquire(context.TODO(), "123") {
+		t.Errorf("expected request to be admitted once a slot was released")
+	}
+}
@@ -0,0 +1,132 @@
+package threescale
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+// checkTimings records the time spent in each phase of an authorization request.
+// It is safe for concurrent use since a check may still be in progress when its deadline is exceeded.
+type checkTimings struct {
+	mu        sync.Mutex
+	serviceID string
+	appID     string
+	clientIP  string
+	// appHash identifies the application the request was made for, as per AppIdentifierHash
+	appHash string
+	// credentialHash identifies the credentials provided without exposing them
+	credentialHash string
+	// metrics are the names of the 3scale metrics the request was counted against
+	metrics []string
+	system  time.Duration
+	backend time.Duration
+	// retryAfter is the time until the limit exceeded by a denied request resets
+	retryAfter time.Duration
+	// usage is the usage of the application against its limits, as returned by 3scale backend
+	usage api.UsageReports
+	// authorized is set once 3scale backend authorized the request, as opposed to a fail policy or a decision
+	// remembered by the adapter allowing it
+	authorized bool
+}
+
+func (t *checkTimings) setServiceID(serviceID string) {
+	t.mu.Lock()
+	t.serviceID = serviceID
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setAppID(appID string) {
+	t.mu.Lock()
+	t.appID = appID
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setAppHash(hash string) {
+	t.mu.Lock()
+	t.appHash = hash
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setCredentialHash(hash string) {
+	t.mu.Lock()
+	t.credentialHash = hash
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setMetrics(metrics api.Metrics) {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t.mu.Lock()
+	t.metrics = names
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setRetryAfter(retryAfter time.Duration) {
+	t.mu.Lock()
+	t.retryAfter = retryAfter
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setUsage(usage api.UsageReports) {
+	t.mu.Lock()
+	t.usage = usage
+	t.mu.Unlock()
+}
+
+func (t *checkTimings) setAuthorized() {
+	t.mu.Lock()
+	t.authorized = true
+	t.mu.Unlock()
+}
+
+// authorizedByBackend returns true if 3scale backend authorized the request
+func (t *checkTimings) authorizedByBackend() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.authorized
+}
+
+func (t *checkTimings) setClientIP(clientIP string) {
+	t.mu.Lock()
+	t.clientIP = clientIP
+	t.mu.Unlock()
+}
+
+// observeSystem records the time taken to fetch the service configuration since start
+func (t *checkTimings) observeSystem(start time.Time) {
+	t.mu.Lock()
+	t.system = time.Since(start)
+	t.mu.Unlock()
+}
+
+// observeBackend records the time taken to authorize the request against 3scale backend since start
+func (t *checkTimings) observeBackend(start time.Time) {
+	t.mu.Lock()
+	t.backend = time.Since(start)
+	t.mu.Unlock()
+}
+
+// reportSlowCheck logs the phase timings of a request which took longer than the configured threshold
+func (s *Threescale) reportSlowCheck(ctx context.Context, t *checkTimings, total time.Duration) {
+	if s.conf.SlowCheckThreshold <= 0 || total < s.conf.SlowCheckThreshold {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	logFor(ctx).Warnf("slow check: service_id=%s app_id=%s client_ip=%s metrics=%v total=%s threshold=%s system_config=%s backend=%s",
+		t.serviceID, t.appID, t.clientIP, t.metrics, total, s.conf.SlowCheckThreshold, t.system, t.backend)
+
+	if s.conf.Metrics != nil && s.conf.Metrics.SlowCheckCB != nil {
+		s.conf.Metrics.SlowCheckCB(t.serviceID)
+	}
+}
@@ -0,0 +1,33 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+)
+
+// checkSoftLimit warns of a request authorized by 3scale whose application has used at least the SoftLimitThreshold of
+// any of its limits, so that the application may be notified before it is denied. The request is allowed regardless,
+// since only 3scale enforces the limit itself
+func (s *Threescale) checkSoftLimit(ctx context.Context, serviceID string, result *v1beta1.CheckResult, reports api.UsageReports) {
+	if s.conf.SoftLimitThreshold <= 0 || result.Status.Code != int32(rpc.OK) {
+		return
+	}
+
+	utilization, ok := appQuotaUtilization(reports)
+	if !ok || utilization < s.conf.SoftLimitThreshold {
+		return
+	}
+
+	if s.conf.Metrics != nil && s.conf.Metrics.SoftLimitExceededCB != nil {
+		s.conf.Metrics.SoftLimitExceededCB(serviceID)
+	}
+
+	if s.conf.SoftLimitLog {
+		logFor(ctx).Warnf("request to service %s allowed, application has used %.0f%% of a limit, beyond the soft limit of %.0f%%",
+			serviceID, utilization*100, s.conf.SoftLimitThreshold*100)
+	}
+}
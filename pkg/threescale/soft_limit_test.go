@@ -0,0 +1,55 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale/3scale-go-client/threescale/api"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+func TestCheckSoftLimit(t *testing.T) {
+	reports := func(current int) api.UsageReports {
+		return api.UsageReports{
+			"hits": {{PeriodWindow: api.PeriodWindow{Period: api.Minute, End: 1060}, MaxValue: 10, CurrentValue: current}},
+		}
+	}
+
+	var exceeded []string
+	s := &Threescale{conf: &AdapterConfig{
+		Metrics: &MetricsReporter{SoftLimitExceededCB: func(serviceID string) {
+			exceeded = append(exceeded, serviceID)
+		}},
+	}}
+
+	result := newCheckResult()
+	result.Status = status.OK
+	s.checkSoftLimit(context.TODO(), "123", result, reports(9))
+	if len(exceeded) != 0 {
+		t.Errorf("expected no soft limit unless enabled")
+	}
+
+	s.conf.SoftLimitThreshold = 0.8
+	s.checkSoftLimit(context.TODO(), "123", result, reports(7))
+	if len(exceeded) != 0 {
+		t.Errorf("expected usage below the threshold not to exceed the soft limit")
+	}
+
+	s.checkSoftLimit(context.TODO(), "123", result, reports(8))
+	if len(exceeded) != 1 || result.Status.Code != int32(rpc.OK) || result.Status.Message != "" {
+		t.Errorf("expected request at the threshold to be allowed and counted, got %v", result.Status)
+	}
+
+	s.checkSoftLimit(context.TODO(), "123", result, reports(9))
+	if len(exceeded) != 2 || result.Status.Code != int32(rpc.OK) {
+		t.Errorf("expected request beyond the threshold to be allowed and counted, got %v", result.Status)
+	}
+
+	result.Status = status.WithResourceExhausted("usage limits are exceeded")
+	s.checkSoftLimit(context.TODO(), "123", result, reports(10))
+	if len(exceeded) != 2 || result.Status.Message != "usage limits are exceeded" {
+		t.Errorf("expected denial at the hard limit to be left unchanged, got %v", result.Status)
+	}
+}
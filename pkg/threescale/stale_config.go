@@ -0,0 +1,38 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// staleConfigStatus returns the status for a request to a service whose configuration has not been successfully
+// fetched from 3scale within MaxStaleServe, and true, or false if the configuration may be served
+func (s *Threescale) staleConfigStatus(ctx context.Context, serviceID string) (rpc.Status, bool) {
+	if s.conf.MaxStaleServe <= 0 || s.conf.ConfigRefreshedAt == nil {
+		return rpc.Status{}, false
+	}
+
+	refreshed := s.conf.ConfigRefreshedAt(serviceID)
+	if refreshed.IsZero() {
+		return rpc.Status{}, false
+	}
+
+	age := time.Since(refreshed)
+	if age <= s.conf.MaxStaleServe {
+		return rpc.Status{}, false
+	}
+
+	if s.conf.Metrics != nil && s.conf.Metrics.StaleConfigDeniedCB != nil {
+		s.conf.Metrics.StaleConfigDeniedCB(serviceID)
+	}
+
+	msg := fmt.Sprintf("config too stale - configuration for service %s was last fetched from 3scale %s ago",
+		serviceID, age.Round(time.Second))
+	logFor(ctx).Warnf("%s", msg)
+	return status.WithUnavailable(msg), true
+}
@@ -0,0 +1,54 @@
+package threescale
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/googleapis/google/rpc"
+)
+
+func TestStaleConfigStatus(t *testing.T) {
+	refreshed := map[string]time.Time{
+		"fresh": time.Now(),
+		"stale": time.Now().Add(-time.Hour),
+	}
+
+	var denied []string
+	s := &Threescale{
+		conf: &AdapterConfig{
+			MaxStaleServe: time.Minute,
+			ConfigRefreshedAt: func(serviceID string) time.Time {
+				return refreshed[serviceID]
+			},
+			Metrics: &MetricsReporter{
+				StaleConfigDeniedCB: func(serviceID string) { denied = append(denied, serviceID) },
+			},
+		},
+	}
+
+	for _, serviceID := range []string{"fresh", "unknown"} {
+		if _, stale := s.staleConfigStatus(context.TODO(), serviceID); stale {
+			t.Errorf("expected configuration of service %s to be served", serviceID)
+		}
+	}
+
+	st, stale := s.staleConfigStatus(context.TODO(), "stale")
+	if !stale {
+		t.Fatalf("expected configuration of stale service to be denied")
+	}
+
+	if st.Code != int32(rpc.UNAVAILABLE) || !strings.HasPrefix(st.Message, "config too stale") {
+		t.Errorf("unexpected status %v", st)
+	}
+
+	if len(denied) != 1 || denied[0] != "stale" {
+		t.Errorf("expected a single denial to be reported, got %v", denied)
+	}
+
+	s.conf.MaxStaleServe = 0
+	if _, stale := s.staleConfigStatus(context.TODO(), "stale"); stale {
+		t.Errorf("expected stale configuration to be served when disabled")
+	}
+}
@@ -0,0 +1,55 @@
+package threescale
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+)
+
+// Standby determines whether the adapter serves authorization requests. While in standby, the caches are kept warm
+// but every request is responded to with UNAVAILABLE, until promoted. A nil Standby is always active.
+type Standby struct {
+	// standby is 1 while in standby, accessed atomically
+	standby int32
+	metrics *MetricsReporter
+}
+
+// NewStandby returns a Standby in the provided state
+func NewStandby(standby bool, metrics *MetricsReporter) *Standby {
+	s := &Standby{metrics: metrics}
+	if standby {
+		s.standby = 1
+	}
+	s.report(standby)
+	return s
+}
+
+// IsStandby returns true if the adapter is not serving requests
+func (s *Standby) IsStandby() bool {
+	return s != nil && atomic.LoadInt32(&s.standby) == 1
+}
+
+// Promote starts serving requests immediately, returning false if the adapter was already serving
+func (s *Standby) Promote() bool {
+	if s == nil || !atomic.CompareAndSwapInt32(&s.standby, 1, 0) {
+		return false
+	}
+
+	s.report(false)
+	return true
+}
+
+func (s *Standby) report(standby bool) {
+	if s.metrics != nil && s.metrics.StandbyCB != nil {
+		s.metrics.StandbyCB(standby)
+	}
+}
+
+// warmSystemCache fetches the configuration for the service, without authorizing the request, so that it is cached
+// and kept up to date by the cache refresh for when the adapter is promoted
+func (s *Threescale) warmSystemCache(ctx context.Context, cfg *config.Params) {
+	if _, err := s.getSystemConfiguration(cfg); err != nil {
+		logFor(ctx).Debugf("failed to fetch config for service %s while in standby - %v", cfg.ServiceId, err)
+	}
+}
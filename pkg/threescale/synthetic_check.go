@@ -0,0 +1,114 @@
+package threescale
+
+import (
+	"context"
+	"time"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/gogo/googleapis/google/rpc"
+	"github.com/gogo/protobuf/types"
+
+	policy "istio.io/api/policy/v1beta1"
+	"istio.io/istio/mixer/template/authorization"
+	"istio.io/istio/pkg/log"
+)
+
+// syntheticCheckRequestID identifies synthetic checks in the logs
+const syntheticCheckRequestID = "synthetic-check"
+
+// SyntheticCheck is an authorization request made periodically against a designated service and credentials, to verify
+// the adapter end to end while real traffic is idle. The credentials are provided as the subject user, for a user key,
+// or the app_id and app_key subject properties. Should no access token be provided, that of the AccessTokenProvider is used
+type SyntheticCheck struct {
+	SystemURL   string
+	AccessToken string
+	ServiceID   string
+	UserKey     string
+	AppID       string
+	AppKey      string
+	// Method and Path must match a mapping rule of the service
+	Method string
+	Path   string
+}
+
+// RunSyntheticChecks authorizes the synthetic check through the same path as requests from Mixer every interval,
+// until stop is closed, reporting whether each was authorized. A synthetic check is allowed at most the interval
+// to complete. Usage is reported to 3scale for the credentials of the check as for any other request, but synthetic
+// checks are neither counted in the request metrics nor audited
+func (s *Threescale) RunSyntheticChecks(check SyntheticCheck, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.syntheticCheck(check, interval)
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// syntheticCheck makes a single synthetic check, returning true if it was authorized by 3scale backend.
+// Requests allowed otherwise, such as by the fail policy or a last known decision, are failed checks
+func (s *Threescale) syntheticCheck(check SyntheticCheck, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ContextWithRequestID(context.Background(), syntheticCheckRequestID), timeout)
+	defer cancel()
+
+	start := time.Now()
+	timings := &checkTimings{}
+	result, err := s.checkInPool(ctx, syntheticCheckRequest(check), timings)
+	elapsed := time.Since(start)
+
+	success := err == nil && timings.authorizedByBackend()
+	if !success {
+		reason := "no result"
+		if err != nil {
+			reason = err.Error()
+		} else if result != nil && result.Status.Code == int32(rpc.OK) {
+			reason = "not authorized by 3scale backend"
+		} else if result != nil {
+			reason = result.Status.Message
+		}
+		log.Warnf("synthetic check of service %s failed after %s - %s", check.ServiceID, elapsed, reason)
+	}
+
+	if s.conf.Metrics != nil && s.conf.Metrics.SyntheticCheckCB != nil {
+		s.conf.Metrics.SyntheticCheckCB(check.ServiceID, success, elapsed)
+	}
+	return success
+}
+
+// syntheticCheckRequest returns the request Mixer would send for the synthetic check
+func syntheticCheckRequest(check SyntheticCheck) *authorization.HandleAuthorizationRequest {
+	params := config.Params{
+		ServiceId:   check.ServiceID,
+		SystemUrl:   check.SystemURL,
+		AccessToken: check.AccessToken,
+	}
+	// marshalling the generated params never fails
+	b, _ := params.Marshal()
+
+	properties := make(map[string]*policy.Value)
+	if check.AppID != "" {
+		properties[AppIDAttributeKey] = &policy.Value{Value: &policy.Value_StringValue{StringValue: check.AppID}}
+	}
+	if check.AppKey != "" {
+		properties[AppKeyAttributeKey] = &policy.Value{Value: &policy.Value_StringValue{StringValue: check.AppKey}}
+	}
+
+	return &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: check.Method,
+				Path:   check.Path,
+			},
+			Subject: &authorization.SubjectMsg{
+				User:       check.UserKey,
+				Properties: properties,
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+}
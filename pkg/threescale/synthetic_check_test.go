@@ -0,0 +1,119 @@
+package threescale
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+func TestSyntheticCheckRequest(t *testing.T) {
+	request := syntheticCheckRequest(SyntheticCheck{
+		SystemURL:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+		ServiceID:   "123",
+		AppID:       "id",
+		AppKey:      "key",
+		Method:      "GET",
+		Path:        "/test",
+	})
+
+	params := &config.Params{}
+	if err := params.Unmarshal(request.AdapterConfig.Value); err != nil {
+		t.Fatalf("unexpected error unmarshalling adapter config - %v", err)
+	}
+	if params.ServiceId != "123" || params.SystemUrl != "https://www.fake-system.3scale.net" || params.AccessToken != "any" {
+		t.Errorf("unexpected adapter config %v", params)
+	}
+
+	if request.Instance.Action.Method != "GET" || request.Instance.Action.Path != "/test" {
+		t.Errorf("unexpected action %v", request.Instance.Action)
+	}
+
+	properties := request.Instance.Subject.Properties
+	if properties[AppIDAttributeKey].GetStringValue() != "id" || properties[AppKeyAttributeKey].GetStringValue() != "key" {
+		t.Errorf("expected application credentials as subject properties, got %v", properties)
+	}
+}
+
+func TestSyntheticCheck(t *testing.T) {
+	inputs := []struct {
+		name       string
+		userKey    string
+		backendErr error
+		expect     bool
+	}{
+		{
+			name:    "Test authorized synthetic check",
+			userKey: "VALID",
+			expect:  true,
+		},
+		{
+			name:    "Test denied synthetic check",
+			userKey: "INVALID",
+			expect:  false,
+		},
+		{
+			name:       "Test synthetic check allowed by the fail policy",
+			userKey:    "VALID",
+			backendErr: errors.New("unavailable"),
+			expect:     false,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported []bool
+			s := &Threescale{conf: &AdapterConfig{
+				FailPolicy: FailOpen,
+				Authorizer: mockAuthorizer{
+					withConfig: client.ProxyConfig{
+						Content: client.Content{
+							Proxy: client.ContentProxy{
+								ProxyRules: []client.ProxyRule{
+									{
+										HTTPMethod: http.MethodGet,
+										Pattern:    "/test",
+									},
+								},
+							},
+						},
+					},
+					withAuthResponse: &authorizer.BackendResponse{},
+					withBackendErr:   input.backendErr,
+				},
+				Metrics: &MetricsReporter{
+					SyntheticCheckCB: func(serviceID string, success bool, duration time.Duration) {
+						if serviceID != "123" {
+							t.Errorf("unexpected service id %s", serviceID)
+						}
+						reported = append(reported, success)
+					},
+					RequestCB: func(RequestReport) {
+						t.Errorf("expected synthetic check not to be reported as a request")
+					},
+				},
+			}}
+
+			check := SyntheticCheck{
+				SystemURL:   "https://www.fake-system.3scale.net",
+				AccessToken: "any",
+				ServiceID:   "123",
+				UserKey:     input.userKey,
+				Method:      "get",
+				Path:        "/test",
+			}
+
+			if success := s.syntheticCheck(check, time.Second); success != input.expect {
+				t.Errorf("expected synthetic check success to be %v", input.expect)
+			}
+			if len(reported) != 1 || reported[0] != input.expect {
+				t.Errorf("expected synthetic check outcome to be reported once, got %v", reported)
+			}
+		})
+	}
+}
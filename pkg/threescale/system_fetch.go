@@ -0,0 +1,69 @@
+package threescale
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	system "github.com/3scale/3scale-porta-go-client/client"
+)
+
+// systemFetch is a call to fetch configuration from 3scale system, whose result is shared by concurrent requests
+type systemFetch struct {
+	done chan struct{}
+	conf system.ProxyConfig
+	err  error
+}
+
+// systemFetchGroup coalesces concurrent fetches of the configuration for the same service into one.
+// The zero value is ready to use
+type systemFetchGroup struct {
+	mu      sync.Mutex
+	fetches map[string]*systemFetch
+}
+
+// do calls fetch, unless a fetch for the key is already in flight, in which case its result is returned once complete.
+// The returned bool is true if the result was shared
+func (g *systemFetchGroup) do(key string, fetch func() (system.ProxyConfig, error)) (system.ProxyConfig, bool, error) {
+	g.mu.Lock()
+	if g.fetches == nil {
+		g.fetches = make(map[string]*systemFetch)
+	}
+
+	if f, ok := g.fetches[key]; ok {
+		g.mu.Unlock()
+		<-f.done
+		return f.conf, true, f.err
+	}
+
+	f := &systemFetch{done: make(chan struct{})}
+	g.fetches[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.fetches, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+
+	f.conf, f.err = fetch()
+	return f.conf, false, f.err
+}
+
+// getSystemConfiguration fetches the configuration for the service via the cache, coalescing concurrent fetches for
+// the same service so that a cold or failing service is fetched from 3scale system once rather than by every request
+func (s *Threescale) getSystemConfiguration(cfg *config.Params) (system.ProxyConfig, error) {
+	request := s.systemRequestFromHandlerConfig(cfg)
+	// the access token is included in the key so that requests are never served configuration fetched with another token
+	key := fmt.Sprintf("%s|%s", unknownServiceKey(cfg), request.AccessToken)
+
+	conf, shared, err := s.systemFetches.do(key, func() (system.ProxyConfig, error) {
+		return s.conf.Authorizer.GetSystemConfiguration(cfg.SystemUrl, request)
+	})
+
+	if shared && s.conf.Metrics != nil && s.conf.Metrics.SystemFetchCoalescedCB != nil {
+		s.conf.Metrics.SystemFetchCoalescedCB(cfg.ServiceId)
+	}
+	return conf, err
+}
@@ -0,0 +1,80 @@
+package threescale
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+// countingAuthorizer counts fetches of configuration, which complete once released
+type countingAuthorizer struct {
+	mockAuthorizer
+	fetches *int64
+	release chan struct{}
+}
+
+func (m countingAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	atomic.AddInt64(m.fetches, 1)
+	<-m.release
+	return client.ProxyConfig{Version: 2}, nil
+}
+
+func TestGetSystemConfigurationCoalesces(t *testing.T) {
+	const requests = 50
+
+	var fetches, coalesced int64
+	release := make(chan struct{})
+	c := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: countingAuthorizer{fetches: &fetches, release: release},
+			Metrics: &MetricsReporter{
+				SystemFetchCoalescedCB: func(serviceID string) {
+					atomic.AddInt64(&coalesced, 1)
+				},
+			},
+		},
+	}
+
+	cfg := &config.Params{ServiceId: "123", SystemUrl: "https://www.fake-system.3scale.net", AccessToken: "any"}
+
+	var wg sync.WaitGroup
+	var shared int64
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conf, err := c.getSystemConfiguration(cfg)
+			if err == nil && conf.Version == 2 {
+				atomic.AddInt64(&shared, 1)
+			}
+		}()
+	}
+
+	// allow every request to join the fetch in flight before it completes
+	time.Sleep(time.Millisecond * 100)
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("expected concurrent requests for a cold service to be coalesced into one fetch, got %d", fetches)
+	}
+
+	if shared != requests {
+		t.Errorf("expected every request to receive the fetched config, got %d", shared)
+	}
+
+	if coalesced != requests-1 {
+		t.Errorf("expected %d coalesced requests to be reported, got %d", requests-1, coalesced)
+	}
+
+	// a completed fetch is not reused, so subsequent requests go to the cache
+	c.getSystemConfiguration(cfg)
+	if fetches != 2 {
+		t.Errorf("expected a new fetch once the previous one completed, got %d fetches", fetches)
+	}
+}
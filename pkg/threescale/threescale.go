@@ -10,10 +10,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
-	"regexp"
-	"sort"
 	"strings"
 	"time"
 
@@ -25,7 +24,9 @@ import (
 	"github.com/gogo/googleapis/google/rpc"
 
 	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
 	"istio.io/api/mixer/adapter/model/v1beta1"
 	"istio.io/istio/mixer/pkg/status"
@@ -50,27 +51,80 @@ const (
 
 // HandleAuthorization takes care of the authorization request from mixer
 func (s *Threescale) HandleAuthorization(ctx context.Context, r *authorization.HandleAuthorizationRequest) (*v1beta1.CheckResult, error) {
+	start := time.Now()
+	timings := &checkTimings{}
+	result, err := s.checkInPool(ctx, r, timings)
+
+	elapsed := time.Since(start)
+	s.reportRequest(timings, result, elapsed)
+	s.reportSlowCheck(ctx, timings, elapsed)
+	s.reportOverhead(ctx, timings, elapsed)
+	s.audit(ctx, timings, result)
+	s.traceDecision(ctx, timings, result, elapsed)
+	s.renderDenyResponse(ctx, timings, result)
+	return result, err
+}
 
-	log.Debugf("Got instance %+v", r.Instance)
-	result := &v1beta1.CheckResult{
-		// Caching at Mixer/Envoy layer needs to be disabled currently since we would miss reporting
-		// cached requests. We can determine caching values going forward by splitting the check
-		// and report functionality and using cache values obtained from 3scale extension api
+// checkWithDeadline runs the authorization pipeline, applying the fail policy should it not complete within the deadline
+func (s *Threescale) checkWithDeadline(ctx context.Context, r *authorization.HandleAuthorizationRequest, timings *checkTimings) (*v1beta1.CheckResult, error) {
+	timeout := s.checkTimeout(ctx)
+	if timeout <= 0 {
+		return s.check(ctx, r, timings)
+	}
 
-		// Setting a negative value will invalidate the cache - it seems from integration test
-		// and manual testing that zero values for a successful check set a large default value
-		ValidDuration: 0 * time.Second,
-		ValidUseCount: -1,
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type checkResponse struct {
+		result *v1beta1.CheckResult
+		err    error
+	}
+
+	done := make(chan checkResponse, 1)
+	go func() {
+		result, err := s.check(ctx, r, timings)
+		done <- checkResponse{result: result, err: err}
+	}()
+
+	select {
+	case resp := <-done:
+		return resp.result, resp.err
+	case <-ctx.Done():
+		err := fmt.Errorf("authorization did not complete within %s - %v", timeout, ctx.Err())
+		return s.applyFailPolicy(ctx, requestMethod(r), newCheckResult(), status.WithDeadlineExceeded, err), nil
 	}
+}
+
+// check runs the authorization pipeline for a single request, recording the time spent in each phase
+func (s *Threescale) check(ctx context.Context, r *authorization.HandleAuthorizationRequest, timings *checkTimings) (*v1beta1.CheckResult, error) {
+	rlog := logFor(ctx)
+	rlog.Debugf("Got instance %+v", s.redactInstance(r.Instance))
+	result := newCheckResult()
 
 	cfg, err := s.parseConfigParams(r)
 	if err != nil {
 		// this theoretically should not happen
-		log.Errorf("error parsing params - %v", err)
+		rlog.Errorf("error parsing params - %v", err)
 		result.Status = status.WithInternal(err.Error())
 		return result, err
 	}
 
+	if cfg.ServiceId == "" {
+		result.Status = s.missingServiceIDStatus(ctx)
+		return result, nil
+	}
+
+	timings.setServiceID(cfg.ServiceId)
+	s.logDebugAttributes(ctx, cfg.ServiceId, r.Instance)
+
+	if attrErrs := attributeErrors(r.Instance, cfg); len(attrErrs) > 0 {
+		s.reportAttributeErrors(ctx, attrErrs)
+	}
+
+	if cfg.AccessToken == "" && s.conf.AccessTokenProvider != nil {
+		cfg.AccessToken = s.conf.AccessTokenProvider()
+	}
+
 	err = s.validateRequestAndConfigParams(r, cfg)
 	if err != nil {
 		// intentionally return nil as error here as failed rpc.Status is sufficient
@@ -78,27 +132,235 @@ func (s *Threescale) HandleAuthorization(ctx context.Context, r *authorization.H
 		return result, nil
 	}
 
-	proxyConf, err := s.conf.Authorizer.GetSystemConfiguration(cfg.SystemUrl, s.systemRequestFromHandlerConfig(cfg))
+	if s.conf.Standby.IsStandby() {
+		s.warmSystemCache(ctx, cfg)
+		result.Status = status.WithUnavailable(errStandby.Error())
+		return result, nil
+	}
+
+	if !s.isServed(cfg.ServiceId) {
+		result.Status = s.unservedServiceStatus(ctx, cfg.ServiceId)
+		return result, nil
+	}
+
+	if !s.rateLimiter.allow(cfg.ServiceId) {
+		result.Status = s.localRateLimitStatus(ctx, cfg.ServiceId)
+		return result, nil
+	}
+
+	if !s.serviceLimiters.acquire(ctx, cfg.ServiceId) {
+		err := fmt.Errorf("limit of in flight requests to service %s reached", cfg.ServiceId)
+		return s.applyFailPolicy(ctx, r.Instance.Action.Method, result, status.WithResourceExhausted, err), nil
+	}
+	defer s.serviceLimiters.release(cfg.ServiceId)
+
+	clientIP := s.resolveClientIP(*r.Instance)
+	timings.setClientIP(clientIP)
+	rlog.Debugf("resolved client ip %q for request to service %s", clientIP, cfg.ServiceId)
+
+	if s.conf.UnknownServicePolicy != UnknownServiceFetch && s.isMarkedUnknown(cfg) {
+		result.Status = s.unknownServiceStatus(ctx, cfg.ServiceId)
+		return result, nil
+	}
+
+	systemStart := time.Now()
+	proxyConf, err := s.getSystemConfiguration(cfg)
+	timings.observeSystem(systemStart)
+	// configuration retained for a deleted service is not observed, so that the deletion is only reported once
+	var useRetained bool
+	if err != nil && isUnknownService(err) {
+		var retained system.ProxyConfig
+		if retained, useRetained = s.deletedServiceConfig(ctx, cfg); useRetained {
+			proxyConf, err = retained, nil
+		}
+	}
+
+	if err != nil && isUnknownService(err) && s.conf.UnknownServicePolicy != UnknownServiceFetch {
+		s.markUnknownService(cfg)
+		result.Status = s.unknownServiceStatus(ctx, cfg.ServiceId)
+		return result, nil
+	}
+
 	if err != nil {
-		result.Status, err = rpcStatusErrorHandler("error fetching config from 3scale", systemErrorToRpcStatus(err), err)
+		result.Status, err = rpcStatusErrorHandler(rlog, "error fetching config from 3scale", systemErrorToRpcStatus(err), err)
 		return result, err
 	}
 
-	backendReq := s.requestFromConfig(proxyConf, *r.Instance, *cfg)
+	if !useRetained {
+		s.observeConfigVersion(ctx, cfg, proxyConf)
+	}
+
+	if st, stale := s.staleConfigStatus(ctx, cfg.ServiceId); stale {
+		result.Status = st
+		return result, nil
+	}
+	proxyConf = s.withLocalMappingRules(cfg.ServiceId, proxyConf, *r.Instance)
+	backendReq := s.requestFromConfig(ctx, proxyConf, *r.Instance, *cfg)
+	timings.setAppID(backendReq.Transactions[0].Params.AppID)
+	timings.setMetrics(backendReq.Transactions[0].Metrics)
+	s.logDebugRequest(ctx, cfg.ServiceId, backendReq.Transactions[0].Params, backendReq.Transactions[0].Metrics)
+	timings.setCredentialHash(credentialHash(backendReq.Transactions[0].Params))
+	timings.setAppHash(AppIdentifierHash(backendReq.Transactions[0].Params))
+	if st, rejected := s.compositeCredentialsStatus(ctx, cfg.ServiceId, backendReq.Transactions[0].Params); rejected {
+		result.Status = st
+		return result, nil
+	}
+
+	if st, rejected := s.conflictingCredentialsStatus(ctx, cfg.ServiceId, *r.Instance, proxyConf); rejected {
+		result.Status = st
+		return result, nil
+	}
+
 	rpcFN, err := s.validateBackendRequest(backendReq)
+	if err == errNoCredentials {
+		result.Status = s.missingCredentialsStatus(ctx, cfg.ServiceId)
+		return result, nil
+	}
+
 	if err != nil {
 		result.Status = rpcFN(err.Error())
 		// intentionally return nil as error here as failed rpc.Status is sufficient
 		return result, nil
 	}
 
+	if st, rejected := s.authModeStatus(ctx, cfg.ServiceId, *r.Instance, proxyConf); rejected {
+		result.Status = st
+		return result, nil
+	}
+
 	if cfg.BackendUrl == "" {
 		//if not set in the handler, take it from 3scale config
 		cfg.BackendUrl = proxyConf.Content.Proxy.Backend.Endpoint
 	}
 
-	authResult, err := s.conf.Authorizer.AuthRep(cfg.BackendUrl, backendReq)
-	return s.convertAuthResponse(authResult, result, err)
+	negativeKey := negativeCacheKey(cfg.ServiceId, proxyConf, backendReq.Transactions[0].Params)
+	if errorCode, ok := s.negativeCache.get(negativeKey); ok {
+		if s.conf.Metrics != nil && s.conf.Metrics.NegativeCacheHitCB != nil {
+			s.conf.Metrics.NegativeCacheHitCB(cfg.ServiceId)
+		}
+		result.Status = errorCodeToRpcStatus(errorCode)(errorCode)
+		return result, nil
+	}
+
+	backendStart := time.Now()
+	authResult, err := s.authorize(ctx, cfg.BackendUrl, backendReq)
+	timings.observeBackend(backendStart)
+	if err == errBackendSaturated || err == errBackendCacheFull {
+		return s.applyMetricFailPolicy(ctx, r.Instance.Action.Method, backendReq.Transactions[0].Metrics, result, status.WithResourceExhausted, err), nil
+	}
+
+	lastKnownKey := lastKnownDecisionKey(cfg.ServiceId, backendReq.Transactions[0].Params, backendReq.Transactions[0].Metrics)
+	if err == errCircuitOpen || isBackendFailure(authResult, err) {
+		if st, ok := s.lastKnownStatus(ctx, cfg.ServiceId, lastKnownKey); ok {
+			result.Status = st
+			return result, nil
+		}
+	}
+
+	if s.conf.Maintenance.IsActive() && (err == errCircuitOpen || isBackendFailure(authResult, err)) {
+		return s.maintenanceResult(ctx, cfg.ServiceId, result, err), nil
+	}
+
+	if err == errCircuitOpen {
+		return s.applyMetricFailPolicy(ctx, r.Instance.Action.Method, backendReq.Transactions[0].Metrics, result, status.WithUnavailable, err), nil
+	}
+
+	if isMisconfiguredService(authResult) {
+		return s.misconfiguredServiceResult(ctx, r.Instance.Action.Method, backendReq.Transactions[0].Metrics, cfg.ServiceId, result, authResult), nil
+	}
+
+	if code, unexpected := unexpectedBackendResponse(authResult, err); unexpected {
+		return s.unexpectedBackendResponseResult(ctx, r.Instance.Action.Method, backendReq.Transactions[0].Metrics, result, code, err), nil
+	}
+
+	if err == nil {
+		s.negativeCache.add(negativeKey, authResult)
+		s.lastKnown.add(lastKnownKey, authResult)
+		s.observeUsageData(ctx, cfg.ServiceId, authResult)
+		timings.setUsage(authResult.UsageReports)
+		if authResult.Authorized {
+			timings.setAuthorized()
+		}
+		s.appUsage.record(cfg.ServiceId, backendReq.Transactions[0].Params.AppID, authResult)
+		s.reportAppQuota(cfg.ServiceId, backendReq.Transactions[0].Params, authResult)
+		if !authResult.Authorized && authResult.ErrorCode == "limits_exceeded" {
+			timings.setRetryAfter(retryAfter(authResult.UsageReports, time.Now()))
+		}
+	}
+
+	result, err = s.convertAuthResponse(rlog, authResult, result, err)
+	if result.Status.Code == int32(rpc.OK) {
+		s.setValidity(result)
+		if authResult != nil {
+			s.checkSoftLimit(ctx, cfg.ServiceId, result, authResult.UsageReports)
+		}
+	}
+	return result, err
+}
+
+// reportRequest reports the outcome of an authorization request if metrics are enabled
+func (s *Threescale) reportRequest(t *checkTimings, result *v1beta1.CheckResult, timeTaken time.Duration) {
+	if s.conf.Metrics == nil || s.conf.Metrics.RequestCB == nil || result == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.conf.Metrics.RequestCB(RequestReport{
+		ServiceID: t.serviceID,
+		ClientIP:  t.clientIP,
+		App:       t.appHash,
+		Metrics:   t.metrics,
+		Code:      rpc.Code(result.Status.Code),
+		TimeTaken: timeTaken,
+	})
+}
+
+// newCheckResult returns a result with the default caching values set
+func newCheckResult() *v1beta1.CheckResult {
+	return &v1beta1.CheckResult{
+		// Caching at Mixer/Envoy layer needs to be disabled currently since we would miss reporting
+		// cached requests. We can determine caching values going forward by splitting the check
+		// and report functionality and using cache values obtained from 3scale extension api
+
+		// Setting a negative value will invalidate the cache - it seems from integration test
+		// and manual testing that zero values for a successful check set a large default value
+		ValidDuration: 0 * time.Second,
+		ValidUseCount: -1,
+	}
+}
+
+// setValidity allows Mixer to cache a result authorized by 3scale, if configured.
+// Usage is not reported to 3scale for requests which are served from the Mixer cache.
+func (s *Threescale) setValidity(result *v1beta1.CheckResult) {
+	if s.conf.CheckValidDuration <= 0 {
+		return
+	}
+
+	result.ValidDuration = s.conf.CheckValidDuration
+	result.ValidUseCount = s.conf.CheckValidUseCount
+	if result.ValidUseCount <= 0 {
+		result.ValidUseCount = math.MaxInt32
+	}
+}
+
+// applyFailPolicy sets the status of a result whose fate could not be determined by 3scale, as per the policy for the request method.
+// The provided function determines the status returned when failing closed.
+func (s *Threescale) applyFailPolicy(ctx context.Context, method string, result *v1beta1.CheckResult, fn func(string) rpc.Status, err error) *v1beta1.CheckResult {
+	return s.applyMetricFailPolicy(ctx, method, nil, result, fn, err)
+}
+
+// applyMetricFailPolicy applies the FailPolicy to a request whose metrics are known, as per FailPolicyByMetric
+func (s *Threescale) applyMetricFailPolicy(ctx context.Context, method string, metrics api.Metrics, result *v1beta1.CheckResult, fn func(string) rpc.Status, err error) *v1beta1.CheckResult {
+	if s.metricFailPolicy(method, metrics) == FailOpen {
+		logFor(ctx).Warnf("fail policy is open, allowing request - %v", err)
+		result.Status = status.OK
+		return result
+	}
+
+	result.Status, _ = rpcStatusErrorHandler(logFor(ctx), "", fn, err)
+	return result
 }
 
 // parseConfigParams - parses the configuration passed to the adapter from mixer
@@ -115,13 +377,24 @@ func (s *Threescale) parseConfigParams(r *authorization.HandleAuthorizationReque
 	}
 
 	// Support receiving service_id as both hardcoded value in handler and at request time
-	if cfg.ServiceId == "" {
+	if cfg.ServiceId == "" && r.Instance != nil && r.Instance.Action != nil {
 		cfg.ServiceId = r.Instance.Action.Service
 	}
 
 	return cfg, nil
 }
 
+// missingServiceIDStatus returns the status for a request which does not identify the 3scale service, either by the
+// service_id of the handler or the action.service attribute of the instance
+func (s *Threescale) missingServiceIDStatus(ctx context.Context) rpc.Status {
+	if s.conf.Metrics != nil && s.conf.Metrics.MissingServiceIDCB != nil {
+		s.conf.Metrics.MissingServiceIDCB()
+	}
+
+	logFor(ctx).Errorf("rejecting request - %v", errServiceID)
+	return status.WithInvalidArgument(errServiceID.Error())
+}
+
 func (s *Threescale) validateRequestAndConfigParams(r *authorization.HandleAuthorizationRequest, config *config.Params) error {
 	var errMsgs []string
 	if config.AccessToken == "" {
@@ -132,11 +405,9 @@ func (s *Threescale) validateRequestAndConfigParams(r *authorization.HandleAutho
 		errMsgs = append(errMsgs, errSystemURL.Error())
 	}
 
-	if config.ServiceId == "" {
-		errMsgs = append(errMsgs, errServiceID.Error())
-	}
-
-	if r.Instance.Action.Path == "" {
+	if r.Instance == nil || r.Instance.Action == nil {
+		errMsgs = append(errMsgs, errRequestAction.Error())
+	} else if r.Instance.Action.Path == "" {
 		errMsgs = append(errMsgs, errRequestPath.Error())
 	}
 
@@ -158,29 +429,14 @@ func (s *Threescale) systemRequestFromHandlerConfig(cfg *config.Params) authoriz
 	}
 }
 
-func (s *Threescale) requestFromConfig(systemConf system.ProxyConfig, istioConf authorization.InstanceMsg, cfg config.Params) authorizer.BackendRequest {
-	var (
-		// Application ID/OpenID Connect authentication pattern - App Key is optional when using this authn
-		appID, appKey string
-		// Application Key auth pattern
-		userKey string
-	)
+func (s *Threescale) requestFromConfig(ctx context.Context, systemConf system.ProxyConfig, istioConf authorization.InstanceMsg, cfg config.Params) authorizer.BackendRequest {
+	metrics := s.evaluateMappingRules(ctx, cfg.ServiceId, istioConf.Action, systemConf)
 
-	if istioConf.Subject != nil {
-		var appIdentifierKey string
-
-		if systemConf.Content.BackendVersion == openIDTypeIdentifier {
-			// OIDC integration configured so force app identifier to come from jwt claims
-			appIdentifierKey = OIDCAttributeKey
-		} else {
-			appIdentifierKey = AppIDAttributeKey
-		}
-
-		appID = istioConf.Subject.Properties[appIdentifierKey].GetStringValue()
-		appKey = istioConf.Subject.Properties[AppKeyAttributeKey].GetStringValue()
-		userKey = istioConf.Subject.User
+	mode, enforced := s.authMode(cfg.ServiceId, systemConf)
+	params := s.extractCredentials(cfg.ServiceId, istioConf, withAuthMode(systemConf, mode))
+	if enforced {
+		params = credentialsForAuthMode(params, mode)
 	}
-	metrics := generateMetrics(istioConf.Action.Path, istioConf.Action.Method, systemConf)
 
 	request := authorizer.BackendRequest{
 		Auth: authorizer.BackendAuth{
@@ -191,11 +447,7 @@ func (s *Threescale) requestFromConfig(systemConf system.ProxyConfig, istioConf
 		Transactions: []authorizer.BackendTransaction{
 			{
 				Metrics: metrics,
-				Params: authorizer.BackendParams{
-					AppID:   appID,
-					AppKey:  appKey,
-					UserKey: userKey,
-				},
+				Params:  params,
 			},
 		},
 	}
@@ -203,10 +455,18 @@ func (s *Threescale) requestFromConfig(systemConf system.ProxyConfig, istioConf
 	return request
 }
 
+// credentialExtractor returns the configured CredentialExtractor or the default if none has been configured
+func (s *Threescale) credentialExtractor() CredentialExtractor {
+	if s.conf.CredentialExtractor == nil {
+		return CredentialExtractorFunc(extractFromAttributes)
+	}
+	return s.conf.CredentialExtractor
+}
+
 // validateBackendRequest will help us reduce network calls by verifying that required auth credentials have been set
 func (s *Threescale) validateBackendRequest(request authorizer.BackendRequest) (func(string) rpc.Status, error) {
 	for _, transaction := range request.Transactions {
-		if transaction.Params.AppID == "" && transaction.Params.UserKey == "" {
+		if !hasCredentials(transaction.Params) {
 			return status.WithUnauthenticated, errNoCredentials
 		}
 
@@ -217,11 +477,11 @@ func (s *Threescale) validateBackendRequest(request authorizer.BackendRequest) (
 	return nil, nil
 }
 
-func (s *Threescale) convertAuthResponse(resp *authorizer.BackendResponse, result *v1beta1.CheckResult, err error) (*v1beta1.CheckResult, error) {
+func (s *Threescale) convertAuthResponse(rlog requestLog, resp *authorizer.BackendResponse, result *v1beta1.CheckResult, err error) (*v1beta1.CheckResult, error) {
 	if err != nil {
 		// Try to obtain a correct mapping for the cause of failure. This will occur in events of 500+ status codes from
 		// upstream where we have not managed to get an actual response from Apisonator.
-		result.Status, _ = rpcStatusErrorHandler("request authorization failed", backendResponseToRpcStatus(resp), err)
+		result.Status, _ = rpcStatusErrorHandler(rlog, "request authorization failed", backendResponseToRpcStatus(resp), err)
 		return result, nil
 
 	}
@@ -234,31 +494,17 @@ func (s *Threescale) convertAuthResponse(resp *authorizer.BackendResponse, resul
 	return result, nil
 }
 
-func generateMetrics(path string, method string, conf system.ProxyConfig) api.Metrics {
-	metrics := make(api.Metrics)
-
-	// sort proxy rules based on Position field to establish priority
-	sort.Slice(conf.Content.Proxy.ProxyRules, func(i, j int) bool {
-		return conf.Content.Proxy.ProxyRules[i].Position < conf.Content.Proxy.ProxyRules[j].Position
-	})
-
-	for _, pr := range conf.Content.Proxy.ProxyRules {
-		if match, err := regexp.MatchString(pr.Pattern, path); err == nil {
-			if match && strings.ToUpper(pr.HTTPMethod) == strings.ToUpper(method) {
-				metrics.Add(pr.MetricSystemName, int(pr.Delta))
-				// stop matching if this rule has been marked as Last
-				if pr.Last {
-					break
-				}
-			}
-		}
-	}
-	return metrics
+// generateMetrics evaluates the mapping rules in order of position, returning the metrics to report for the request.
+// The regular expression of a rule is only evaluated when the rule may match the method and path, as per ruleIndex.
+// When maxEvaluations is positive, evaluation stops after that many expressions have been evaluated, in which case
+// true is returned
+func generateMetrics(path string, method string, conf system.ProxyConfig, maxEvaluations int, caseInsensitive bool, policy MultiMatchPolicy) (api.Metrics, bool) {
+	return newRuleIndex(conf.Content.Proxy.ProxyRules, caseInsensitive).metrics(path, method, maxEvaluations, policy)
 }
 
 // rpcStatusErrorHandler provides a uniform way to log and format error messages and status which should be
 // returned to the user in cases where the authorization request is rejected.
-func rpcStatusErrorHandler(userFacingErrMsg string, fn func(string) rpc.Status, err error) (rpc.Status, error) {
+func rpcStatusErrorHandler(rlog requestLog, userFacingErrMsg string, fn func(string) rpc.Status, err error) (rpc.Status, error) {
 	if userFacingErrMsg != "" {
 		var errMsg string
 		if err != nil {
@@ -267,7 +513,7 @@ func rpcStatusErrorHandler(userFacingErrMsg string, fn func(string) rpc.Status,
 		err = fmt.Errorf("%s %s", userFacingErrMsg, errMsg)
 	}
 
-	log.Error(err.Error())
+	rlog.Errorf("%s", err.Error())
 	return fn(err.Error()), err
 }
 
@@ -329,10 +575,18 @@ var httpStatusToRpcStatus = map[int]func(string) rpc.Status{
 var (
 	errAccessToken   = errors.New("access token must be set in configuration")
 	errSystemURL     = errors.New("3scale system URL must be provided in configuration")
-	errServiceID     = errors.New("service ID must be provided in configuration")
+	errServiceID     = errors.New("no service ID provided - set service_id in the handler or the action.service attribute of the instance")
 	errRequestPath   = errors.New("request path must be provided")
+	errRequestAction = errors.New("request action must be provided")
 	errNoMappingRule = errors.New("no matching mapping rule for request")
 	errNoCredentials = errors.New("no auth credentials provided or provided in invalid location")
+
+	errBackendSaturated = errors.New("limit of in flight requests to 3scale backend reached")
+	errBackendCacheFull = errors.New("limit of entries in the backend cache reached")
+	errStandby          = errors.New("adapter is in standby and not serving requests")
+	errCircuitOpen      = errors.New("circuit to 3scale backend is open")
+	errLoadShed         = errors.New("adapter is overloaded, request shed")
+	errHandlerPoolFull  = errors.New("limit of queued requests to the handler pool reached")
 )
 
 // NewThreescale returns a Server interface
@@ -342,17 +596,58 @@ func NewThreescale(addr string, conf *AdapterConfig) (Server, error) {
 		return nil, err
 	}
 
+	// the caches of decisions share a single bound on their entries
+	decisions := newDecisionCache(conf.MaxDecisionCacheEntries, conf.Metrics)
+
 	s := &Threescale{
-		listener: listener,
-		conf:     conf,
+		listener:        listener,
+		conf:            conf,
+		backendLimiter:  newInflightLimiter(conf.BackendMaxInflight),
+		reports:         newReportQueueFromConfig(conf),
+		negativeCache:   newNegativeCache(conf.NegativeCacheTTL, decisions),
+		servedServices:  newServedServices(conf.ServedServiceIDs),
+		debugServices:   newDebugServices(conf.DebugServiceIDs),
+		audits:          newAuditQueue(conf.AuditSink, conf.AuditBufferSize, conf.Metrics),
+		decisionTraces:  newDecisionTraceQueue(conf.DecisionTraceSink, conf.DecisionTraceSampleRate, conf.DecisionTraceBufferSize, conf.Metrics),
+		rateLimiter:     newLocalRateLimiter(conf.LocalRateLimit),
+		backendCache:    newBackendCacheBudget(conf.BackendCacheMaxEntries, conf.BackendCacheMaxBytes, conf.BackendCacheFlushInterval, conf.Metrics),
+		circuitBreaker:  newCircuitBreaker(conf.CircuitBreaker, conf.Metrics),
+		lastKnown:       newLastKnownDecisions(conf.LastKnownDecisionTTL, decisions),
+		retryBudget:     newRetryBudget(conf.BackendRetries.BudgetRatio),
+		loadShedder:     newLoadShedder(conf.LoadShed, conf.Metrics),
+		appUsage:        newAppUsage(conf.TrackAppUsage),
+		ruleIndexes:     newRuleIndexes(),
+		serviceLimiters: newServiceLimiters(conf.ServiceMaxInflight, conf.ServiceMaxInflightOverrides, conf.Metrics),
+		handlerPool:     newHandlerPool(conf.HandlerPool, conf.Metrics),
+	}
+
+	if _, ok := conf.Authorizer.(ReportingAuthorizer); conf.ReportDeniedRequests && !ok {
+		log.Warnf("authorizer does not support reporting independently of authorization, denied requests will not be reported")
 	}
 
 	log.Infof("Threescale Istio Adapter is listening on \"%v\"\n", s.Addr())
 
-	s.server = grpc.NewServer(grpc.KeepaliveParams(keepalive.ServerParameters{
-		MaxConnectionAge: conf.KeepAliveMaxAge,
-	}))
+	// the request id is always established first so that it is available to any configured interceptors
+	interceptors := []grpc.UnaryServerInterceptor{requestIDInterceptor}
+	if conf.GRPCAPIKey != "" {
+		interceptors = append(interceptors, apiKeyInterceptor(conf.GRPCAPIKey))
+	}
+	interceptors = append(interceptors, conf.UnaryInterceptors...)
+
+	s.server = grpc.NewServer(
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge:      conf.KeepAliveMaxAge,
+			MaxConnectionAgeGrace: conf.KeepAliveMaxAgeGrace,
+		}),
+		grpc.UnaryInterceptor(chainUnaryInterceptors(interceptors...)),
+	)
 	authorization.RegisterHandleAuthorizationServiceServer(s.server, s)
+	if conf.GRPCReflection {
+		reflection.Register(s.server)
+	}
+	if conf.GRPCChannelz {
+		channelz.RegisterChannelzServiceToServer(s.server)
+	}
 	return s, nil
 }
 
@@ -376,5 +671,14 @@ func (s *Threescale) Close() error {
 		_ = s.listener.Close()
 	}
 
+	if s.reports != nil {
+		s.reports.close()
+	}
+
+	s.handlerPool.close()
+	s.audits.close()
+	s.decisionTraces.close()
+	s.backendCache.close()
+
 	return nil
 }
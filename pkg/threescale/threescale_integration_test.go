@@ -251,7 +251,7 @@ spec:
 					},
 				},
 			},
-			expect: generatedExpectedError(t, rpc.FAILED_PRECONDITION, errServiceID.Error()+"."),
+			expect: generatedExpectedError(t, rpc.INVALID_ARGUMENT, errServiceID.Error()),
 		},
 		{
 			name: "Test error when no credentials provided",
@@ -3,12 +3,15 @@ package threescale
 import (
 	"context"
 	"errors"
+	"math"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
 	"github.com/3scale/3scale-istio-adapter/config"
 	"github.com/3scale/3scale-porta-go-client/client"
 	"github.com/gogo/googleapis/google/rpc"
@@ -250,6 +253,799 @@ func TestHandleAuthorization(t *testing.T) {
 	}
 }
 
+func TestHandleAuthorizationDeadline(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	newRequest := func() *authorization.HandleAuthorizationRequest {
+		return &authorization.HandleAuthorizationRequest{
+			Instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{
+					Method: "get",
+					Path:   "/test",
+				},
+				Subject: &authorization.SubjectMsg{
+					User: "secret",
+				},
+			},
+			AdapterConfig: &types.Any{Value: b},
+		}
+	}
+
+	slowAuthorizer := mockAuthorizer{
+		withConfig: client.ProxyConfig{
+			Content: client.Content{
+				Proxy: client.ContentProxy{
+					ProxyRules: []client.ProxyRule{
+						{
+							HTTPMethod:       http.MethodGet,
+							Pattern:          "/test",
+							MetricSystemName: "hits",
+							Delta:            1,
+						},
+					},
+				},
+			},
+		},
+		withAuthResponse: &authorizer.BackendResponse{
+			Authorized: true,
+		},
+		withDelay: time.Millisecond * 100,
+	}
+
+	inputs := []struct {
+		name         string
+		timeout      time.Duration
+		policy       FailPolicy
+		byMethod     map[string]FailPolicy
+		expectStatus int32
+	}{
+		{
+			name:         "Test request completing within deadline is authorized",
+			timeout:      time.Second,
+			expectStatus: int32(rpc.OK),
+		},
+		{
+			name:         "Test request exceeding deadline fails closed",
+			timeout:      time.Millisecond,
+			policy:       FailClosed,
+			expectStatus: int32(rpc.DEADLINE_EXCEEDED),
+		},
+		{
+			name:         "Test request exceeding deadline fails open",
+			timeout:      time.Millisecond,
+			policy:       FailOpen,
+			expectStatus: int32(rpc.OK),
+		},
+		{
+			name:         "Test fail policy for the request method overrides global policy",
+			timeout:      time.Millisecond,
+			policy:       FailClosed,
+			byMethod:     map[string]FailPolicy{http.MethodGet: FailOpen},
+			expectStatus: int32(rpc.OK),
+		},
+		{
+			name:         "Test fail policy for other methods does not apply",
+			timeout:      time.Millisecond,
+			policy:       FailClosed,
+			byMethod:     map[string]FailPolicy{http.MethodPost: FailOpen},
+			expectStatus: int32(rpc.DEADLINE_EXCEEDED),
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:         slowAuthorizer,
+					CheckTimeout:       input.timeout,
+					FailPolicy:         input.policy,
+					FailPolicyByMethod: input.byMethod,
+				},
+			}
+			result, _ := c.HandleAuthorization(context.TODO(), newRequest())
+			if result.Status.Code != input.expectStatus {
+				t.Errorf("Expected %v got %#v", input.expectStatus, result.Status.Code)
+			}
+		})
+	}
+}
+
+func TestHandleAuthorizationUnknownService(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	newRequest := func() *authorization.HandleAuthorizationRequest {
+		return &authorization.HandleAuthorizationRequest{
+			Instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{
+					Method: "get",
+					Path:   "/test",
+				},
+				Subject: &authorization.SubjectMsg{
+					User: "secret",
+				},
+			},
+			AdapterConfig: &types.Any{Value: b},
+		}
+	}
+
+	notFound := mockAuthorizer{
+		withSystemErr: notFoundErr{},
+	}
+
+	inputs := []struct {
+		name         string
+		policy       UnknownServicePolicy
+		expectStatus int32
+		expectCB     int
+	}{
+		{
+			name:         "Test unknown service with fetch policy reports error from 3scale",
+			policy:       UnknownServiceFetch,
+			expectStatus: int32(rpc.UNKNOWN),
+		},
+		{
+			name:         "Test unknown service with deny policy is rejected",
+			policy:       UnknownServiceDeny,
+			expectStatus: int32(rpc.NOT_FOUND),
+			expectCB:     2,
+		},
+		{
+			name:         "Test unknown service with allow policy is allowed",
+			policy:       UnknownServiceAllow,
+			expectStatus: int32(rpc.OK),
+			expectCB:     2,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var unknownCount int
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:           notFound,
+					UnknownServicePolicy: input.policy,
+					Metrics: &MetricsReporter{
+						UnknownServiceCB: func(serviceID string) {
+							unknownCount++
+						},
+					},
+				},
+			}
+
+			// the second request is expected to be handled without a lookup where the service has been marked unknown
+			for i := 0; i < 2; i++ {
+				result, _ := c.HandleAuthorization(context.TODO(), newRequest())
+				if result.Status.Code != input.expectStatus {
+					t.Errorf("Expected %v got %#v", input.expectStatus, result.Status.Code)
+				}
+			}
+
+			if unknownCount != input.expectCB {
+				t.Errorf("expected unknown service callback to be called %d times, got %d", input.expectCB, unknownCount)
+			}
+		})
+	}
+}
+
+func TestHandleAuthorizationSlowCheck(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	slowAuthorizer := mockAuthorizer{
+		withConfig: client.ProxyConfig{
+			Content: client.Content{
+				Proxy: client.ContentProxy{
+					ProxyRules: []client.ProxyRule{
+						{
+							HTTPMethod:       http.MethodGet,
+							Pattern:          "/test",
+							MetricSystemName: "hits",
+							Delta:            1,
+						},
+					},
+				},
+			},
+		},
+		withAuthResponse: &authorizer.BackendResponse{
+			Authorized: true,
+		},
+		withDelay: time.Millisecond * 20,
+	}
+
+	inputs := []struct {
+		name      string
+		threshold time.Duration
+		expectCB  bool
+	}{
+		{
+			name:      "Test slow check is reported",
+			threshold: time.Millisecond,
+			expectCB:  true,
+		},
+		{
+			name:      "Test check within threshold is not reported",
+			threshold: time.Second,
+		},
+		{
+			name: "Test slow checks are not reported when disabled",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reportedService string
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:         slowAuthorizer,
+					SlowCheckThreshold: input.threshold,
+					Metrics: &MetricsReporter{
+						SlowCheckCB: func(serviceID string) {
+							reportedService = serviceID
+						},
+					},
+				},
+			}
+			c.HandleAuthorization(context.TODO(), request)
+
+			if input.expectCB && reportedService != params.ServiceId {
+				t.Errorf("expected slow check to be reported for service %s, got %q", params.ServiceId, reportedService)
+			}
+
+			if !input.expectCB && reportedService != "" {
+				t.Errorf("unexpected slow check reported for service %s", reportedService)
+			}
+		})
+	}
+}
+
+func TestHandleAuthorizationMissingCredentials(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	inputs := []struct {
+		name         string
+		policy       MissingCredentialPolicy
+		expectStatus int32
+	}{
+		{
+			name:         "Test missing credentials are denied",
+			policy:       MissingCredentialDeny,
+			expectStatus: int32(rpc.UNAUTHENTICATED),
+		},
+		{
+			name:         "Test missing credentials are allowed anonymously",
+			policy:       MissingCredentialAllowAnonymous,
+			expectStatus: int32(rpc.OK),
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported bool
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer:              mockAuthorizer{},
+					MissingCredentialPolicy: input.policy,
+					Metrics: &MetricsReporter{
+						MissingCredentialsCB: func(serviceID string) {
+							reported = true
+						},
+					},
+				},
+			}
+
+			result, _ := c.HandleAuthorization(context.TODO(), request)
+			if result.Status.Code != input.expectStatus {
+				t.Errorf("Expected %v got %#v", input.expectStatus, result.Status.Code)
+			}
+
+			if !reported {
+				t.Errorf("expected missing credentials to be reported")
+			}
+		})
+	}
+}
+
+func TestHandleAuthorizationMissingServiceID(t *testing.T) {
+	params := config.Params{
+		AccessToken: "secret",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	var reported bool
+	c := &Threescale{conf: &AdapterConfig{
+		Authorizer: mockAuthorizer{},
+		Metrics:    &MetricsReporter{MissingServiceIDCB: func() { reported = true }},
+	}}
+
+	result, _ := c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.INVALID_ARGUMENT) || result.Status.Message != errServiceID.Error() {
+		t.Errorf("expected missing service id to be rejected as invalid, got %v", result.Status)
+	}
+
+	if !reported {
+		t.Errorf("expected missing service id to be reported")
+	}
+
+	request.Instance.Action.Service = "123"
+	result, _ = c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code == int32(rpc.INVALID_ARGUMENT) {
+		t.Errorf("expected service id to be read from the instance, got %v", result.Status)
+	}
+}
+
+func TestHandleAuthorizationAccessTokenProvider(t *testing.T) {
+	params := config.Params{
+		ServiceId: "123",
+		SystemUrl: "https://www.fake-system.3scale.net",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	c := &Threescale{conf: &AdapterConfig{Authorizer: mockAuthorizer{}}}
+	result, _ := c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.FAILED_PRECONDITION) {
+		t.Errorf("expected missing access token to be rejected, got %v", result.Status.Code)
+	}
+
+	tokens := make(chan string, 1)
+	c = &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: tokenRecordingAuthorizer{
+				mockAuthorizer: mockAuthorizer{withSystemErr: errors.New("stop here")},
+				tokens:         tokens,
+			},
+			AccessTokenProvider: func() string { return "from-file" },
+		},
+	}
+	c.HandleAuthorization(context.TODO(), request)
+
+	select {
+	case token := <-tokens:
+		if token != "from-file" {
+			t.Errorf("expected access token from provider, got %q", token)
+		}
+	default:
+		t.Errorf("expected system configuration to be fetched")
+	}
+}
+
+func TestHandleAuthorizationValidity(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	newRequest := func(userKey string) *authorization.HandleAuthorizationRequest {
+		return &authorization.HandleAuthorizationRequest{
+			Instance: &authorization.InstanceMsg{
+				Action: &authorization.ActionMsg{
+					Method: "get",
+					Path:   "/test",
+				},
+				Subject: &authorization.SubjectMsg{
+					User: userKey,
+				},
+			},
+			AdapterConfig: &types.Any{Value: b},
+		}
+	}
+
+	inputs := []struct {
+		name           string
+		request        *authorization.HandleAuthorizationRequest
+		useCount       int32
+		expectDuration time.Duration
+		expectUseCount int32
+	}{
+		{
+			name:           "Test authorized result is cached",
+			request:        newRequest("VALID"),
+			useCount:       10,
+			expectDuration: time.Second,
+			expectUseCount: 10,
+		},
+		{
+			name:           "Test authorized result is cached without a use limit",
+			request:        newRequest("VALID"),
+			expectDuration: time.Second,
+			expectUseCount: math.MaxInt32,
+		},
+		{
+			name:           "Test denied result is never cached",
+			request:        newRequest("INVALID"),
+			useCount:       10,
+			expectUseCount: -1,
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Authorizer: mockAuthorizer{
+						withConfig: client.ProxyConfig{
+							Content: client.Content{
+								Proxy: client.ContentProxy{
+									ProxyRules: []client.ProxyRule{
+										{
+											HTTPMethod: http.MethodGet,
+											Pattern:    "/test",
+										},
+									},
+								},
+							},
+						},
+						withAuthResponse: &authorizer.BackendResponse{ErrorCode: "user_key_invalid"},
+					},
+					CheckValidDuration: time.Second,
+					CheckValidUseCount: input.useCount,
+				},
+			}
+
+			result, _ := c.HandleAuthorization(context.TODO(), input.request)
+			if result.ValidDuration != input.expectDuration || result.ValidUseCount != input.expectUseCount {
+				t.Errorf("expected validity of %v and %d uses, got %v and %d uses",
+					input.expectDuration, input.expectUseCount, result.ValidDuration, result.ValidUseCount)
+			}
+		})
+	}
+}
+
+func TestHandleAuthorizationServedServices(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	var reported string
+	c := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: mockAuthorizer{withSystemErr: errors.New("should not be called")},
+			Metrics: &MetricsReporter{
+				UnservedServiceCB: func(serviceID string) {
+					reported = serviceID
+				},
+			},
+		},
+		servedServices: newServedServices([]string{"456"}),
+	}
+
+	result, _ := c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.PERMISSION_DENIED) {
+		t.Errorf("expected request for unserved service to be denied, got %v", result.Status.Code)
+	}
+
+	if !strings.Contains(result.Status.Message, "not served") {
+		t.Errorf("expected reason to be provided, got %q", result.Status.Message)
+	}
+
+	if reported != "123" {
+		t.Errorf("expected unserved service to be reported, got %q", reported)
+	}
+
+	c.servedServices = newServedServices([]string{"123", "456"})
+	result, _ = c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code == int32(rpc.PERMISSION_DENIED) {
+		t.Errorf("expected request for served service not to be denied")
+	}
+}
+
+func TestHandleAuthorizationLocalRateLimit(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "secret",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	var limited int
+	c := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: mockAuthorizer{withSystemErr: errors.New("system unavailable")},
+			Metrics: &MetricsReporter{
+				LocalRateLimitedCB: func(serviceID string) {
+					limited++
+				},
+			},
+		},
+		rateLimiter: newLocalRateLimiter(LocalRateLimit{RequestsPerSecond: 0.001, Burst: 1}),
+	}
+
+	result, _ := c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code == int32(rpc.RESOURCE_EXHAUSTED) {
+		t.Errorf("expected first request to be within the limit")
+	}
+
+	result, _ = c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.RESOURCE_EXHAUSTED) {
+		t.Errorf("expected request exceeding the limit to be rejected, got %v", result.Status.Code)
+	}
+
+	if limited != 1 {
+		t.Errorf("expected one request to be reported as rate limited, got %d", limited)
+	}
+}
+
+func TestHandleAuthorizationStandby(t *testing.T) {
+	params := config.Params{
+		ServiceId:   "123",
+		SystemUrl:   "https://www.fake-system.3scale.net",
+		AccessToken: "any",
+	}
+	b, _ := params.Marshal()
+
+	request := &authorization.HandleAuthorizationRequest{
+		Instance: &authorization.InstanceMsg{
+			Action: &authorization.ActionMsg{
+				Method: "get",
+				Path:   "/test",
+			},
+			Subject: &authorization.SubjectMsg{
+				User: "VALID",
+			},
+		},
+		AdapterConfig: &types.Any{Value: b},
+	}
+
+	var states []bool
+	metrics := &MetricsReporter{
+		StandbyCB: func(standby bool) {
+			states = append(states, standby)
+		},
+	}
+
+	var authReps int
+	fetched := make(chan string, 2)
+	c := &Threescale{
+		conf: &AdapterConfig{
+			Authorizer: tokenRecordingAuthorizer{
+				mockAuthorizer: mockAuthorizer{
+					withConfig: client.ProxyConfig{
+						Content: client.Content{
+							Proxy: client.ContentProxy{
+								ProxyRules: []client.ProxyRule{
+									{
+										HTTPMethod: http.MethodGet,
+										Pattern:    "/test",
+									},
+								},
+							},
+						},
+					},
+					withAuthRepCallback: func(backendURL string, request authorizer.BackendRequest, t *testing.T) {
+						authReps++
+					},
+					withAuthResponse: &authorizer.BackendResponse{},
+				},
+				tokens: fetched,
+			},
+			Standby: NewStandby(true, metrics),
+		},
+	}
+
+	result, _ := c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.UNAVAILABLE) {
+		t.Errorf("expected request to be unavailable while in standby, got %v", result.Status.Code)
+	}
+
+	if len(fetched) != 1 {
+		t.Errorf("expected configuration to be fetched while in standby")
+	}
+
+	if authReps != 0 {
+		t.Errorf("expected no call to 3scale backend while in standby")
+	}
+
+	if !c.conf.Standby.Promote() {
+		t.Errorf("expected promotion from standby to succeed")
+	}
+
+	if c.conf.Standby.Promote() {
+		t.Errorf("expected promotion of an active adapter to be a no-op")
+	}
+
+	result, _ = c.HandleAuthorization(context.TODO(), request)
+	if result.Status.Code != int32(rpc.OK) || authReps != 1 {
+		t.Errorf("expected request to be authorized once promoted, got %v", result.Status.Code)
+	}
+
+	if !reflect.DeepEqual(states, []bool{true, false}) {
+		t.Errorf("expected standby state to be reported on creation and promotion, got %v", states)
+	}
+}
+
+type tokenRecordingAuthorizer struct {
+	mockAuthorizer
+	tokens chan string
+}
+
+func (m tokenRecordingAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	m.tokens <- request.AccessToken
+	return m.mockAuthorizer.GetSystemConfiguration(systemURL, request)
+}
+
+func TestWithLocalMappingRules(t *testing.T) {
+	fetched := client.ProxyConfig{
+		Content: client.Content{
+			Proxy: client.ContentProxy{
+				ProxyRules: []client.ProxyRule{
+					{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: "hits", Delta: 1},
+				},
+			},
+		},
+	}
+
+	local := map[string][]MappingRule{
+		"123": {
+			{ProxyRule: client.ProxyRule{HTTPMethod: http.MethodGet, Pattern: "/test", MetricSystemName: "local", Delta: 2}},
+		},
+		"789": {
+			{ProxyRule: client.ProxyRule{HTTPMethod: http.MethodGet, Pattern: "/test", Delta: 1}},
+		},
+	}
+
+	inputs := []struct {
+		name          string
+		serviceID     string
+		mode          MappingRulesMode
+		defaultMetric string
+		expect        api.Metrics
+	}{
+		{
+			name:      "Test service without local rules uses fetched rules",
+			serviceID: "456",
+			expect:    api.Metrics{"hits": 1},
+		},
+		{
+			name:      "Test local rules are merged with fetched rules",
+			serviceID: "123",
+			mode:      MappingRulesMerge,
+			expect:    api.Metrics{"hits": 1, "local": 2},
+		},
+		{
+			name:      "Test local rules override fetched rules",
+			serviceID: "123",
+			mode:      MappingRulesOverride,
+			expect:    api.Metrics{"local": 2},
+		},
+		{
+			name:      "Test local rules without a metric increment the default metric",
+			serviceID: "789",
+			mode:      MappingRulesOverride,
+			expect:    api.Metrics{"hits": 1},
+		},
+		{
+			name:          "Test local rules without a metric increment the configured default metric",
+			serviceID:     "789",
+			mode:          MappingRulesOverride,
+			defaultMetric: "requests",
+			expect:        api.Metrics{"requests": 1},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			c := &Threescale{
+				conf: &AdapterConfig{
+					LocalMappingRules: local,
+					MappingRulesMode:  input.mode,
+					DefaultMetricName: input.defaultMetric,
+				},
+			}
+
+			conf := c.withLocalMappingRules(input.serviceID, fetched, authorization.InstanceMsg{})
+			metrics, _ := generateMetrics("/test", http.MethodGet, conf, 0, false, MultiMatchAll)
+			if !reflect.DeepEqual(metrics, input.expect) {
+				t.Errorf("expected metrics %v got %v", input.expect, metrics)
+			}
+		})
+	}
+
+	if len(fetched.Content.Proxy.ProxyRules) != 1 {
+		t.Errorf("fetched config should not be modified")
+	}
+
+	if local["789"][0].MetricSystemName != "" {
+		t.Errorf("local rules should not be modified")
+	}
+}
+
 func Test_NewThreescale(t *testing.T) {
 	addr := "0"
 	threescaleConf := &AdapterConfig{
@@ -273,6 +1069,7 @@ type mockAuthorizer struct {
 	withConfig          client.ProxyConfig
 	withAuthRepCallback func(backendURL string, request authorizer.BackendRequest, t *testing.T)
 	withAuthResponse    *authorizer.BackendResponse
+	withDelay           time.Duration
 	t                   *testing.T
 }
 
@@ -281,6 +1078,8 @@ func (m mockAuthorizer) GetSystemConfiguration(systemURL string, request authori
 }
 
 func (m mockAuthorizer) AuthRep(backendURL string, request authorizer.BackendRequest) (*authorizer.BackendResponse, error) {
+	time.Sleep(m.withDelay)
+
 	if m.withAuthRepCallback != nil {
 		m.withAuthRepCallback(backendURL, request, m.t)
 	}
@@ -302,3 +1101,13 @@ func (m mockAuthorizer) AuthRep(backendURL string, request authorizer.BackendReq
 }
 
 func (m mockAuthorizer) Shutdown() {}
+
+type notFoundErr struct{}
+
+func (e notFoundErr) Error() string {
+	return "not found"
+}
+
+func (e notFoundErr) Code() int {
+	return http.StatusNotFound
+}
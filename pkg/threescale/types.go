@@ -2,11 +2,14 @@ package threescale
 
 import (
 	"net"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/3scale/3scale-porta-go-client/client"
 
 	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/gogo/googleapis/google/rpc"
 	"google.golang.org/grpc"
 )
 
@@ -22,6 +25,52 @@ type Threescale struct {
 	listener net.Listener
 	server   *grpc.Server
 	conf     *AdapterConfig
+	// unknownServices records when services were found to be unknown to 3scale
+	unknownServices sync.Map
+	// configVersions records the version of the configuration last fetched for each service
+	configVersions map[string]int
+	// lastKnownConfigs records the configuration last fetched for each service when the DeletedServicePolicy retains it
+	lastKnownConfigs map[string]client.ProxyConfig
+	configVersionsMu sync.Mutex
+	// backendLimiter bounds concurrent calls to 3scale backend and is nil when no limit applies
+	backendLimiter *inflightLimiter
+	// reports sends usage reports in the background and is nil when reporting synchronously
+	reports *reportQueue
+	// negativeCache remembers invalid credentials and is nil when disabled
+	negativeCache *negativeCache
+	// servedServices is the set of service ids handled by the adapter and is nil when every service is served
+	servedServices map[string]bool
+	// debugServices is the set of service ids whose requests are logged in detail and is nil when there are none
+	debugServices map[string]bool
+	// audits publishes authorization decisions in the background and is nil when auditing is disabled
+	audits *auditQueue
+	// decisionTraces publishes a sample of authorization decisions in the background and is nil when tracing is disabled
+	decisionTraces *decisionTraceQueue
+	// rateLimiter sheds requests before they reach 3scale and is nil when no local rate limit applies
+	rateLimiter *localRateLimiter
+	// backendCache bounds the entries held by the backend cache and is nil when no limit applies
+	backendCache *backendCacheBudget
+	// circuitBreaker stops calls to 3scale backend while it is failing and is nil when disabled
+	circuitBreaker *circuitBreaker
+	// lastKnown remembers decisions made by 3scale backend for use while it is unavailable and is nil when disabled
+	lastKnown *lastKnownDecisions
+	// retryBudget bounds retries of failed calls to 3scale backend and is nil when retries are unbounded
+	retryBudget *retryBudget
+	// loadShedder sheds requests while the adapter is overloaded and is nil when disabled
+	loadShedder *loadShedder
+	// appUsage retains the usage last returned by 3scale backend for each application and is nil when disabled
+	appUsage *appUsage
+	// ruleIndexes holds the mapping rules of each service indexed for evaluation, and is nil when they are indexed
+	// for each request
+	ruleIndexes *ruleIndexes
+	// serviceLimiters bound concurrent requests to each service and is nil when no limit applies
+	serviceLimiters *serviceLimiters
+	// handlerPool bounds the goroutines handling requests and is nil when disabled
+	handlerPool *handlerPool
+	// systemFetches coalesces concurrent fetches of configuration from 3scale system
+	systemFetches systemFetchGroup
+	// authorizes coalesces concurrent identical calls to authorize against 3scale backend when AuthorizeSingleflight is enabled
+	authorizes authorizeGroup
 }
 
 type Authorizer interface {
@@ -30,9 +79,415 @@ type Authorizer interface {
 	Shutdown()
 }
 
+// FailPolicy determines the outcome of a request when its fate cannot be determined by 3scale
+type FailPolicy int
+
+const (
+	// FailClosed denies requests which could not be authorized
+	FailClosed FailPolicy = iota
+	// FailOpen allows requests which could not be authorized
+	FailOpen
+)
+
+// UnknownServicePolicy determines the outcome of a request for a service which does not exist in 3scale
+type UnknownServicePolicy int
+
+const (
+	// UnknownServiceFetch attempts to fetch the service configuration from 3scale for every request
+	UnknownServiceFetch UnknownServicePolicy = iota
+	// UnknownServiceDeny rejects requests for unknown services
+	UnknownServiceDeny
+	// UnknownServiceAllow allows requests for unknown services
+	UnknownServiceAllow
+)
+
+// DeletedServicePolicy determines the outcome of a request for a service which has been deleted from 3scale since
+// its configuration was last fetched
+type DeletedServicePolicy int
+
+const (
+	// DeletedServiceEvict discards the configuration of the deleted service, applying the UnknownServicePolicy
+	DeletedServiceEvict DeletedServicePolicy = iota
+	// DeletedServiceRetain continues to authorize requests with the configuration last fetched for the deleted service
+	DeletedServiceRetain
+)
+
+// InternalErrorPolicy determines the outcome of a request which could not be authorized due to an error in the
+// configuration of the adapter or of the service, rather than the request itself
+type InternalErrorPolicy int
+
+const (
+	// InternalErrorDeny rejects the request with an internal error
+	InternalErrorDeny InternalErrorPolicy = iota
+	// InternalErrorFailPolicy applies the FailPolicy, as if 3scale were unavailable
+	InternalErrorFailPolicy
+)
+
+// MissingCredentialPolicy determines the outcome of a request which does not provide any credentials
+type MissingCredentialPolicy int
+
+const (
+	// MissingCredentialDeny rejects requests which do not provide credentials
+	MissingCredentialDeny MissingCredentialPolicy = iota
+	// MissingCredentialAllowAnonymous allows requests which do not provide credentials, without reporting to 3scale
+	MissingCredentialAllowAnonymous
+)
+
+// BackendOverflowPolicy determines the outcome of a request when the limit of in flight calls to 3scale backend is reached
+type BackendOverflowPolicy int
+
+const (
+	// BackendOverflowQueue waits for an in flight call to complete, until the request deadline is exceeded
+	BackendOverflowQueue BackendOverflowPolicy = iota
+	// BackendOverflowFail applies the FailPolicy immediately
+	BackendOverflowFail
+)
+
+// ReportMode determines whether usage is reported to 3scale before or after the authorization decision is returned
+type ReportMode int
+
+const (
+	// ReportSync authorizes and reports usage in a single call before returning
+	ReportSync ReportMode = iota
+	// ReportAsync returns once authorized, reporting usage in the background
+	ReportAsync
+)
+
+// ReportOverflowPolicy determines how usage reports are handled when the report queue is full
+type ReportOverflowPolicy int
+
+const (
+	// ReportOverflowDropNewest drops the report being queued
+	ReportOverflowDropNewest ReportOverflowPolicy = iota
+	// ReportOverflowDropOldest drops the report which has waited longest, in order to queue the newest
+	ReportOverflowDropOldest
+	// ReportOverflowBlock waits for space in the queue, delaying the authorization response
+	ReportOverflowBlock
+)
+
 // AdapterConfig wraps optional configuration for the 3scale adapter
 type AdapterConfig struct {
 	Authorizer Authorizer
 	//gRPC connection keepalive duration
 	KeepAliveMaxAge time.Duration
+	// KeepAliveMaxAgeGrace is the time allowed for in flight requests to complete once a connection reaches KeepAliveMaxAge,
+	// after which it is closed forcibly. A zero value waits indefinitely
+	KeepAliveMaxAgeGrace time.Duration
+	// CheckTimeout is the maximum duration an authorization request may take before the FailPolicy is applied.
+	// A zero value applies no deadline
+	CheckTimeout time.Duration
+	// MaxCheckTimeout bounds the timeout which may be provided for a single request via the TimeoutHeader, overriding
+	// the CheckTimeout. A zero value ignores the TimeoutHeader
+	MaxCheckTimeout time.Duration
+	// SlowCheckThreshold is the duration after which an authorization request is logged with a breakdown of its timings.
+	// A zero value disables reporting of slow requests
+	SlowCheckThreshold time.Duration
+	// OverheadLogThreshold is the time spent by the adapter itself, excluding calls to 3scale, after which an
+	// authorization request is logged. A zero value disables logging of requests by their overhead
+	OverheadLogThreshold time.Duration
+	// FailPolicy is applied to requests whose fate could not be determined by 3scale
+	FailPolicy FailPolicy
+	// FailPolicyByMethod overrides the FailPolicy for requests with the HTTP method, keyed by upper case method
+	FailPolicyByMethod map[string]FailPolicy
+	// FailPolicyByMetric overrides the FailPolicy for the metrics a request is counted against, keyed by metric system name.
+	// Once its metrics are known, a request fails closed if the policy of any of its metrics is closed, and open otherwise
+	FailPolicyByMetric map[string]FailPolicy
+	// SoftLimitThreshold is the ratio of usage to limit, between 0 and 1, beyond which requests authorized by 3scale are
+	// counted as exceeding a soft limit, while still allowed. A zero value disables soft limits
+	SoftLimitThreshold float64
+	// SoftLimitLog logs a warning for each request exceeding the SoftLimitThreshold
+	SoftLimitLog bool
+	// UnknownServicePolicy is applied to requests for services which do not exist in 3scale
+	UnknownServicePolicy UnknownServicePolicy
+	// UnknownServiceTTL is the duration for which a service found to be unknown is remembered before being fetched again,
+	// when the UnknownServicePolicy is not UnknownServiceFetch. A zero value remembers the service indefinitely
+	UnknownServiceTTL time.Duration
+	// DeletedServicePolicy is applied to requests for services which have been deleted from 3scale
+	DeletedServicePolicy DeletedServicePolicy
+	// InternalErrorPolicy is applied to requests for services which 3scale backend reports as not found, which
+	// indicates the service id or service token is misconfigured
+	InternalErrorPolicy InternalErrorPolicy
+	// CredentialExtractor is optional and determines how credentials are read from requests.
+	// When nil, credentials are read from the subject as per the DefaultCredentialSource. A CredentialChain tries several
+	// sources in order, and the MissingCredentialPolicy applies when none of them yield credentials
+	CredentialExtractor CredentialExtractor
+	// MissingCredentialPolicy is applied to requests which do not provide any credentials
+	MissingCredentialPolicy MissingCredentialPolicy
+	// RejectConflictingCredentials denies requests for which more than one source of a CredentialChain yields
+	// credentials, and those credentials disagree
+	RejectConflictingCredentials bool
+	// BackendMaxInflight bounds the number of concurrent authorization calls to 3scale backend. A zero value applies no limit
+	BackendMaxInflight int
+	// BackendOverflowPolicy is applied to requests when the BackendMaxInflight limit is reached
+	BackendOverflowPolicy BackendOverflowPolicy
+	// ServiceMaxInflight bounds the number of concurrent authorization requests to each service. Requests beyond the
+	// limit of their service have the FailPolicy applied. A zero value applies no limit
+	ServiceMaxInflight int
+	// ServiceMaxInflightOverrides overrides ServiceMaxInflight by service id. A zero value applies no limit to the service
+	ServiceMaxInflightOverrides map[string]int
+	// BackendCacheMaxEntries bounds the number of distinct applications held by the backend cache between flushes,
+	// as per the BackendOverflowPolicy. A zero value applies no limit
+	BackendCacheMaxEntries int
+	// BackendCacheMaxBytes bounds the estimated size, in bytes, of the applications held by the backend cache between
+	// flushes, as per the BackendOverflowPolicy. A zero value applies no limit
+	BackendCacheMaxBytes int
+	// BackendCacheFlushInterval is the interval at which the backend cache is flushed, required by BackendCacheMaxEntries
+	// and BackendCacheMaxBytes. Their budget is reset at this interval on a timer of its own, approximating the flush
+	BackendCacheFlushInterval time.Duration
+	// MaxStaleServe is the age beyond which the configuration of a service, as reported by ConfigRefreshedAt, is too
+	// stale to be served and requests to the service are denied. A zero value serves configuration regardless of age
+	MaxStaleServe time.Duration
+	// ConfigRefreshedAt is optional and returns when the configuration of the service was last successfully fetched
+	// from 3scale, or the zero time if unknown. Required by MaxStaleServe
+	ConfigRefreshedAt func(serviceID string) time.Time
+	// LastKnownDecisionTTL is the duration for which the decision made by 3scale backend for a credential and set of
+	// metrics may be reused, in place of the FailPolicy, while 3scale backend is unavailable. A zero value disables it
+	LastKnownDecisionTTL time.Duration
+	// MaxDecisionCacheEntries bounds the entries held by the negative cache and last known decisions combined. Once
+	// reached, the least recently used entry of either is evicted. A zero value applies a default of 20000
+	MaxDecisionCacheEntries int
+	// CircuitBreaker stops calls to 3scale backend after consecutive failures, applying the FailPolicy until a probe succeeds
+	CircuitBreaker CircuitBreaker
+	// BackendRetries retries failed calls to 3scale backend, within a budget which bounds the load added by retries
+	BackendRetries BackendRetries
+	// LoadShed sheds a fraction of requests, applying the FailPolicy, while the adapter is overloaded
+	LoadShed LoadShed
+	// HandlerPool bounds the number of goroutines handling requests, queueing or rejecting requests beyond it
+	HandlerPool HandlerPool
+	// ReportMode is ReportSync by default. ReportAsync requires the Authorizer to implement ReportingAuthorizer
+	ReportMode ReportMode
+	// ReportDeniedRequests reports usage for requests denied by 3scale backend, other than for invalid credentials,
+	// in order to track demand. Requires the Authorizer to implement ReportingAuthorizer
+	ReportDeniedRequests bool
+	// AuthorizeSingleflight coalesces concurrent identical calls to authorize against 3scale backend, such that
+	// requests with the same credentials and usage share the result of a call in flight. With ReportSync, the usage of
+	// requests which shared a result is not reported
+	AuthorizeSingleflight bool
+	// ReportQueueSize bounds the number of usage reports waiting to be sent when reporting asynchronously
+	ReportQueueSize int
+	// ReportOverflowPolicy is applied to usage reports when ReportQueueSize is reached
+	ReportOverflowPolicy ReportOverflowPolicy
+	// ReportTimestamps stamps usage reports sent independently of authorization, asynchronously or for denied
+	// requests, with the time of the request, so that 3scale records usage in the period in which it occurred
+	ReportTimestamps bool
+	// ReportTimeOffset is added to the timestamps of usage reports, to compensate for the clock of the adapter
+	// being skewed from that of 3scale
+	ReportTimeOffset time.Duration
+	// ReportPersistPath is optional and, with ReportAsync, is the file to which usage reports which could not be sent
+	// to 3scale backend on shutdown are persisted. Reports persisted are sent on creation, before requests are served
+	ReportPersistPath string
+	// AuthModes overrides, by service id, the authentication mode declared by the configuration of the service in 3scale.
+	// Once set, the mode of every service is enforced, such that only the credentials of its mode are sent to
+	// 3scale and OpenID Connect tokens must have been issued by the issuer configured for the service
+	AuthModes map[string]AuthMode
+	// LocalMappingRules are optional mapping rules, keyed by service id, which are applied as per the MappingRulesMode
+	LocalMappingRules map[string][]MappingRule
+	// MappingRulesMode determines how LocalMappingRules are combined with the mapping rules fetched from 3scale
+	MappingRulesMode MappingRulesMode
+	// MaxMappingRuleEvaluations bounds the number of mapping rule patterns evaluated for a single request, after which
+	// the remaining rules are ignored. A zero value applies no limit
+	MaxMappingRuleEvaluations int
+	// MultiMatchPolicy determines which metrics are reported for requests which match multiple mapping rules
+	MultiMatchPolicy MultiMatchPolicy
+	// CredentialLogMode determines how credentials appear in every log of the adapter, hashed by default
+	CredentialLogMode CredentialLogMode
+	// PathNormalization is applied to the request path before mapping rules are evaluated
+	PathNormalization PathNormalization
+	// DefaultMetricName is incremented by LocalMappingRules which do not name a metric. Defaults to DefaultMetricName
+	DefaultMetricName string
+	// TrustXFF enables resolving the client address from the X-Forwarded-For header
+	TrustXFF bool
+	// TrustedProxies are skipped when resolving the client address from the X-Forwarded-For header.
+	// When empty, and TrustXFF is enabled, all proxies are trusted
+	TrustedProxies []*net.IPNet
+	// NegativeCacheTTL is the duration for which requests with credentials denied as invalid are rejected without
+	// calling 3scale backend. A zero value disables negative caching
+	NegativeCacheTTL time.Duration
+	// UnaryInterceptors are optional and invoked, in the order provided, for every gRPC request.
+	// The request id is available to each via RequestIDFromContext
+	UnaryInterceptors []grpc.UnaryServerInterceptor
+	// GRPCAPIKey is optional and, if set, must be provided by every gRPC request in the APIKeyHeader metadata,
+	// otherwise the request is rejected as Unauthenticated before any UnaryInterceptors are invoked
+	GRPCAPIKey string
+	// GRPCReflection registers the gRPC reflection service, exposing the schema of the adapter's services to tools such as grpcurl
+	GRPCReflection bool
+	// GRPCChannelz registers the gRPC channelz service, exposing the state of the connections, channels and sockets of
+	// the gRPC server to tools such as grpcdebug, for diagnosing connection issues between Mixer and the adapter
+	GRPCChannelz bool
+	// AccessTokenProvider is optional and provides the 3scale system access token for handlers which do not configure one
+	AccessTokenProvider func() string
+	// ServedServiceIDs restricts the services handled by the adapter. Requests for other services are denied.
+	// When empty, every service is served
+	ServedServiceIDs []string
+	// DebugServiceIDs are the services whose requests have their attributes, credentials and metrics logged at info level,
+	// regardless of the log level, with credentials redacted
+	DebugServiceIDs []string
+	// TrackAppUsage retains the usage last returned by 3scale backend for each application, for lookup by AppUsage
+	TrackAppUsage bool
+	// LocalRateLimit is applied to requests before any call to 3scale. Requests exceeding it are denied
+	LocalRateLimit LocalRateLimit
+	// AuditSink is optional and receives a record of every authorization decision, without blocking the request
+	AuditSink AuditSink
+	// AuditBufferSize bounds the number of audit records waiting to be published. Further records are dropped
+	AuditBufferSize int
+	// DecisionTraceSink is optional and receives a trace of a sample of authorization decisions, without blocking the request
+	DecisionTraceSink DecisionTraceSink
+	// DecisionTraceSampleRate is the fraction of authorization decisions traced, between 0 and 1. A zero value disables tracing
+	DecisionTraceSampleRate float64
+	// DecisionTraceBufferSize bounds the number of decision traces waiting to be published. Further traces are dropped
+	DecisionTraceBufferSize int
+	// Standby is optional and, while in standby, causes every request to be responded to with UNAVAILABLE
+	Standby *Standby
+	// Maintenance is optional and, while active, applies the MaintenanceFailPolicy to requests whose fate could not be
+	// determined by 3scale backend, without opening the circuit
+	Maintenance *Maintenance
+	// MaintenanceFailPolicy is applied in place of the FailPolicy while Maintenance is active
+	MaintenanceFailPolicy FailPolicy
+	// CheckValidDuration is the duration for which Mixer may cache requests authorized by 3scale. Denials are never
+	// cached. A zero value disables caching
+	CheckValidDuration time.Duration
+	// CheckValidUseCount is the number of times Mixer may use a cached authorization within the CheckValidDuration.
+	// A zero value places no limit on the number of uses
+	CheckValidUseCount int32
+	// DenyResponseTemplate is optional and renders the message of denied requests from a DenyResponse.
+	// See NewDenyResponseTemplate
+	DenyResponseTemplate *template.Template
+	// Metrics is optional and provides callbacks for reporting metrics about the requests handled by the adapter
+	Metrics *MetricsReporter
+}
+
+// MetricsReporter wraps the callbacks which are invoked in order to report metrics
+type MetricsReporter struct {
+	// RequestCB is called on completion of every authorization request
+	RequestCB func(RequestReport)
+	// UnknownServiceCB is called with the service id of requests for services which do not exist in 3scale
+	UnknownServiceCB func(serviceID string)
+	// SlowCheckCB is called with the service id of requests which exceeded the SlowCheckThreshold
+	SlowCheckCB func(serviceID string)
+	// MissingCredentialsCB is called with the service id of requests which did not provide any credentials
+	MissingCredentialsCB func(serviceID string)
+	// ConflictingCredentialsCB is called with the service id of requests rejected for presenting conflicting credentials
+	ConflictingCredentialsCB func(serviceID string)
+	// MissingServiceIDCB is called for requests which do not identify the 3scale service
+	MissingServiceIDCB func()
+	// BackendInflightCB is called with the number of calls to 3scale backend in flight, whenever it changes
+	BackendInflightCB func(inflight int64)
+	// BackendRejectedCB is called when a request could not call 3scale backend since the in flight limit was reached
+	BackendRejectedCB func()
+	// ReportQueueDepthCB is called with the number of usage reports waiting to be sent, whenever it changes
+	ReportQueueDepthCB func(depth int)
+	// ReportDroppedCB is called when a usage report is dropped since the report queue is full
+	ReportDroppedCB func()
+	// ReportDroppedOldestCB is called when a queued usage report is dropped to make room for a newer one
+	ReportDroppedOldestCB func()
+	// ReportBlockedCB is called when queueing a usage report waits for space in the report queue
+	ReportBlockedCB func()
+	// NegativeCacheHitCB is called with the service id of requests rejected by the negative cache
+	NegativeCacheHitCB func(serviceID string)
+	// AttributeErrorCB is called for each attribute which could not be extracted from a request, with the reason
+	AttributeErrorCB func(attribute, reason string)
+	// UnexpectedBackendStatusCB is called with the status of responses from 3scale backend which could not be interpreted
+	UnexpectedBackendStatusCB func(code string)
+	// UnservedServiceCB is called with the service id of requests denied since the service is not in ServedServiceIDs
+	UnservedServiceCB func(serviceID string)
+	// AuditDroppedCB is called when an audit record is dropped since the audit buffer is full
+	AuditDroppedCB func()
+	// LocalRateLimitedCB is called with the service id of requests denied by the LocalRateLimit
+	LocalRateLimitedCB func(serviceID string)
+	// ConfigVersionChangeCB is called with the service id when a new version of its configuration is observed
+	ConfigVersionChangeCB func(serviceID string)
+	// BackendCacheEntriesCB is called with the estimated number of entries held by the backend cache, whenever it changes
+	BackendCacheEntriesCB func(entries int)
+	// BackendCacheBytesCB is called with the estimated size, in bytes, of the entries held by the backend cache,
+	// whenever it changes, when BackendCacheMaxBytes is set
+	BackendCacheBytesCB func(bytes int)
+	// ServiceInflightCB is called with the service id and a delta of 1 or -1 whenever a request to a service with a
+	// limit as per ServiceMaxInflight starts or completes
+	ServiceInflightCB func(serviceID string, delta int)
+	// StandbyCB is called with the standby state of the adapter on creation and whenever it changes
+	StandbyCB func(standby bool)
+	// MaintenanceCB is called with the maintenance state of the adapter on creation and whenever it changes
+	MaintenanceCB func(active bool)
+	// MaintenanceFailPolicyCB is called with the service id of requests which had the MaintenanceFailPolicy applied
+	MaintenanceFailPolicyCB func(serviceID string)
+	// CircuitStateCB is called with the state of the circuit to 3scale backend whenever it changes
+	CircuitStateCB func(state string)
+	// CircuitProbeIntervalCB is called with the interval between probes of 3scale backend whenever it changes
+	CircuitProbeIntervalCB func(interval time.Duration)
+	// SystemFetchCoalescedCB is called with the service id of requests which shared a fetch of configuration in flight
+	SystemFetchCoalescedCB func(serviceID string)
+	// AuthorizeCoalescedCB is called with the service id of requests which shared a call to authorize against
+	// 3scale backend already in flight, as per AuthorizeSingleflight
+	AuthorizeCoalescedCB func(serviceID string)
+	// MissingUsageDataCB is called with the service id of requests authorized by 3scale backend without usage data
+	MissingUsageDataCB func(serviceID string)
+	// MappingRuleEvaluationCB is called with the service id and the time taken to evaluate the mapping rules of every request
+	MappingRuleEvaluationCB func(serviceID string, elapsed time.Duration)
+	// CredentialSourceCB is called with the service id and the source which provided the credentials of requests,
+	// when the CredentialExtractor is a CredentialChain
+	CredentialSourceCB func(serviceID, source string)
+	// DeletedServiceCB is called with the service id when a service is found to have been deleted from 3scale
+	DeletedServiceCB func(serviceID string)
+	// LastKnownDecisionCB is called with the service id and one of the LastKnownDecision outcomes whenever a last known
+	// decision is looked up since 3scale backend is unavailable
+	LastKnownDecisionCB func(serviceID, outcome string)
+	// BackendDurationCB is called with the time taken by each call to 3scale backend and the class of its HTTP status,
+	// such as 2xx, or BackendStatusError if no response was received
+	BackendDurationCB func(statusClass string, elapsed time.Duration)
+	// RetryBudgetExhaustedCB is called when a failed call to 3scale backend is not retried since the retry budget is exhausted
+	RetryBudgetExhaustedCB func()
+	// DecisionTraceDroppedCB is called when a decision trace is dropped since the decision trace buffer is full
+	DecisionTraceDroppedCB func()
+	// StaleConfigDeniedCB is called with the service id of requests denied since the configuration of the service
+	// is older than MaxStaleServe
+	StaleConfigDeniedCB func(serviceID string)
+	// MisconfiguredServiceCB is called with the service id of requests for which 3scale backend reported the service
+	// as not found
+	MisconfiguredServiceCB func(serviceID string)
+	// LoadShedCB is called when a request is shed since the adapter is overloaded
+	LoadShedCB func()
+	// LoadShedProbabilityCB is called with the probability with which requests are shed whenever it changes
+	LoadShedProbabilityCB func(probability float64)
+	// HandlerActiveCB is called with the number of goroutines of the HandlerPool handling a request whenever it changes
+	HandlerActiveCB func(active int64)
+	// HandlerQueueDepthCB is called with the number of requests waiting for a goroutine of the HandlerPool whenever it changes
+	HandlerQueueDepthCB func(depth int64)
+	// HandlerRejectedCB is called when a request is rejected since the queue of the HandlerPool is full
+	HandlerRejectedCB func()
+	// AppQuotaUtilizationCB is called with the service id, a hash identifying the application and the highest ratio of
+	// usage to limit of the application, whenever 3scale backend returns usage for an application whose plan sets limits
+	AppQuotaUtilizationCB func(serviceID, appHash string, utilization float64)
+	// SoftLimitExceededCB is called with the service id of requests allowed by 3scale beyond the SoftLimitThreshold
+	SoftLimitExceededCB func(serviceID string)
+	// SyntheticCheckCB is called with the service id, the outcome and the duration of each synthetic check
+	SyntheticCheckCB func(serviceID string, success bool, duration time.Duration)
+	// ReportTimestampRejectedCB is called when 3scale backend rejects a usage report due to its timestamp
+	ReportTimestampRejectedCB func()
+	// BackendClockSkewCB is called with how far the clock of the adapter is ahead of that of 3scale backend, as
+	// detected when a usage report is rejected due to its timestamp
+	BackendClockSkewCB func(skew time.Duration)
+	// AdapterOverheadCB is called with the service id and the time spent by the adapter itself on every request,
+	// excluding the time spent waiting on 3scale system and backend
+	AdapterOverheadCB func(serviceID string, overhead time.Duration)
+	// DecisionCacheRequestCB is called with the cache, one of the DecisionCache labels, and one of the DecisionCacheHit
+	// or DecisionCacheMiss results of every lookup of the negative cache or last known decisions
+	DecisionCacheRequestCB func(cache, result string)
+	// DecisionCacheEvictedCB is called with the cache of each entry evicted since MaxDecisionCacheEntries was reached
+	DecisionCacheEvictedCB func(cache string)
+	// DecisionCacheEntriesCB is called with the number of entries held by the caches of decisions whenever it changes
+	DecisionCacheEntriesCB func(entries int)
+}
+
+// RequestReport describes the outcome of an authorization request handled by the adapter
+type RequestReport struct {
+	ServiceID string
+	// ClientIP is the resolved address of the client which originated the request, if known
+	ClientIP string
+	// App identifies the application the request was made for, as per AppIdentifierHash, if known
+	App string
+	// Metrics are the names of the 3scale metrics the request was counted against, if its mapping rules were evaluated
+	Metrics []string
+	// Code is the rpc status code returned to Mixer
+	Code      rpc.Code
+	TimeTaken time.Duration
 }
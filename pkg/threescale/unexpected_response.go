@@ -0,0 +1,68 @@
+package threescale
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+
+	"istio.io/api/mixer/adapter/model/v1beta1"
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// unparsableResponse is reported in place of a status when the response from 3scale backend could not be parsed
+const unparsableResponse = "unparsable"
+
+// expectedBackendStatus are the statuses returned by 3scale backend for authorization requests,
+// in addition to those mapped by httpStatusToRpcStatus
+var expectedBackendStatus = map[int]bool{
+	http.StatusOK:                  true,
+	http.StatusConflict:            true,
+	http.StatusUnprocessableEntity: true,
+}
+
+// unexpectedBackendResponse returns the status of a response from 3scale backend which the adapter does not know how
+// to interpret, such as an error page served by a gateway in front of 3scale, and true if the response was unexpected
+func unexpectedBackendResponse(resp *authorizer.BackendResponse, err error) (string, bool) {
+	if _, ok := err.(*xml.SyntaxError); ok {
+		return unparsableResponse, true
+	}
+
+	if resp == nil {
+		return "", false
+	}
+
+	raw, ok := resp.RawResponse.(*http.Response)
+	if !ok || raw == nil {
+		return "", false
+	}
+
+	if _, mapped := httpStatusToRpcStatus[raw.StatusCode]; !mapped && !expectedBackendStatus[raw.StatusCode] {
+		return strconv.Itoa(raw.StatusCode), true
+	}
+
+	if err == nil && !resp.Authorized && resp.ErrorCode == "" {
+		// 3scale backend always provides a reason for denying a request so this was not a response from 3scale backend
+		return strconv.Itoa(raw.StatusCode), true
+	}
+	return "", false
+}
+
+// unexpectedBackendResponseResult treats an unexpected response from 3scale backend as an internal error, rather than
+// as a denial, and applies the FailPolicy
+func (s *Threescale) unexpectedBackendResponseResult(ctx context.Context, method string, metrics api.Metrics, result *v1beta1.CheckResult, code string, err error) *v1beta1.CheckResult {
+	if s.conf.Metrics != nil && s.conf.Metrics.UnexpectedBackendStatusCB != nil {
+		s.conf.Metrics.UnexpectedBackendStatusCB(code)
+	}
+
+	msg := fmt.Sprintf("unexpected response from 3scale backend with status %s", code)
+	if err != nil {
+		msg = fmt.Sprintf("%s - %v", msg, err)
+	}
+	return s.applyMetricFailPolicy(ctx, method, metrics, result, status.WithInternal, errors.New(msg))
+}
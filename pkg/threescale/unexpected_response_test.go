@@ -0,0 +1,120 @@
+package threescale
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/gogo/googleapis/google/rpc"
+)
+
+func TestUnexpectedBackendResponse(t *testing.T) {
+	withStatus := func(code int, authorized bool, errorCode string) *authorizer.BackendResponse {
+		return &authorizer.BackendResponse{
+			Authorized:  authorized,
+			ErrorCode:   errorCode,
+			RawResponse: &http.Response{StatusCode: code},
+		}
+	}
+
+	inputs := []struct {
+		name         string
+		resp         *authorizer.BackendResponse
+		err          error
+		expectCode   string
+		expectResult bool
+	}{
+		{
+			name: "Test authorized response is expected",
+			resp: withStatus(http.StatusOK, true, ""),
+		},
+		{
+			name: "Test denial with a reason is expected",
+			resp: withStatus(http.StatusConflict, false, "limits_exceeded"),
+		},
+		{
+			name: "Test mapped error status is expected",
+			resp: withStatus(http.StatusServiceUnavailable, false, ""),
+			err:  errors.New("unavailable"),
+		},
+		{
+			name:         "Test gateway error is unexpected",
+			resp:         withStatus(http.StatusBadGateway, false, ""),
+			err:          errors.New("bad gateway"),
+			expectCode:   "502",
+			expectResult: true,
+		},
+		{
+			name:         "Test denial without a reason is unexpected",
+			resp:         withStatus(http.StatusForbidden, false, ""),
+			expectCode:   "403",
+			expectResult: true,
+		},
+		{
+			name:         "Test unparsable response is unexpected",
+			err:          &xml.SyntaxError{Msg: "invalid", Line: 1},
+			expectCode:   unparsableResponse,
+			expectResult: true,
+		},
+		{
+			name: "Test response without raw response is expected",
+			resp: &authorizer.BackendResponse{},
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			code, unexpected := unexpectedBackendResponse(input.resp, input.err)
+			if unexpected != input.expectResult || code != input.expectCode {
+				t.Errorf("expected (%q, %v) got (%q, %v)", input.expectCode, input.expectResult, code, unexpected)
+			}
+		})
+	}
+}
+
+func TestUnexpectedBackendResponseResult(t *testing.T) {
+	inputs := []struct {
+		name         string
+		policy       FailPolicy
+		expectStatus int32
+	}{
+		{
+			name:         "Test unexpected response fails closed",
+			policy:       FailClosed,
+			expectStatus: int32(rpc.INTERNAL),
+		},
+		{
+			name:         "Test unexpected response fails open",
+			policy:       FailOpen,
+			expectStatus: int32(rpc.OK),
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported string
+			s := &Threescale{
+				conf: &AdapterConfig{
+					FailPolicy: input.policy,
+					Metrics: &MetricsReporter{
+						UnexpectedBackendStatusCB: func(code string) {
+							reported = code
+						},
+					},
+				},
+			}
+
+			result := s.unexpectedBackendResponseResult(context.TODO(), "GET", nil, newCheckResult(), "502", nil)
+			if result.Status.Code != input.expectStatus {
+				t.Errorf("expected %v got %v", input.expectStatus, result.Status.Code)
+			}
+
+			if reported != "502" {
+				t.Errorf("expected status to be reported, got %q", reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package threescale
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"istio.io/istio/mixer/pkg/status"
+)
+
+// isUnknownService returns true if the error returned when fetching configuration from 3scale system
+// indicates that the service does not exist
+func isUnknownService(err error) bool {
+	// match on behaviour rather than system.ApiErr so that errors wrapping the response code are also handled
+	apiErr, ok := err.(interface{ Code() int })
+	return ok && apiErr.Code() == http.StatusNotFound
+}
+
+// unknownServiceKey identifies a service across 3scale tenants
+func unknownServiceKey(cfg *config.Params) string {
+	return fmt.Sprintf("%s|%s", cfg.SystemUrl, cfg.ServiceId)
+}
+
+// markUnknownService records that the service has been found to be unknown to 3scale
+func (s *Threescale) markUnknownService(cfg *config.Params) {
+	s.unknownServices.Store(unknownServiceKey(cfg), time.Now())
+}
+
+// isMarkedUnknown returns true if the service has been found to be unknown to 3scale within the configured TTL
+func (s *Threescale) isMarkedUnknown(cfg *config.Params) bool {
+	key := unknownServiceKey(cfg)
+	markedAt, ok := s.unknownServices.Load(key)
+	if !ok {
+		return false
+	}
+
+	if s.conf.UnknownServiceTTL > 0 && time.Since(markedAt.(time.Time)) > s.conf.UnknownServiceTTL {
+		s.unknownServices.Delete(key)
+		return false
+	}
+	return true
+}
+
+// unknownServiceStatus returns the status for a request to a service which is unknown to 3scale, as per the configured policy
+func (s *Threescale) unknownServiceStatus(ctx context.Context, serviceID string) rpc.Status {
+	if s.conf.Metrics != nil && s.conf.Metrics.UnknownServiceCB != nil {
+		s.conf.Metrics.UnknownServiceCB(serviceID)
+	}
+
+	if s.conf.UnknownServicePolicy == UnknownServiceAllow {
+		logFor(ctx).Warnf("service %s is unknown to 3scale, unknown service policy is allow - allowing request", serviceID)
+		return status.OK
+	}
+
+	msg := fmt.Sprintf("service %s is unknown to 3scale", serviceID)
+	logFor(ctx).Errorf("%s", msg)
+	return status.WithNotFound(msg)
+}
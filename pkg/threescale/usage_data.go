@@ -0,0 +1,21 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+)
+
+// observeUsageData reports responses from 3scale backend which authorized a request without providing usage data.
+// Usage data is only returned for applications whose plan sets limits, and the authorization decision never depends
+// on it, so its absence is not treated as an error
+func (s *Threescale) observeUsageData(ctx context.Context, serviceID string, resp *authorizer.BackendResponse) {
+	if resp == nil || !resp.Authorized || len(resp.UsageReports) > 0 {
+		return
+	}
+
+	logFor(ctx).Debugf("3scale backend authorized request for service %s without providing usage data", serviceID)
+	if s.conf.Metrics != nil && s.conf.Metrics.MissingUsageDataCB != nil {
+		s.conf.Metrics.MissingUsageDataCB(serviceID)
+	}
+}
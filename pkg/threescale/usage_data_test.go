@@ -0,0 +1,57 @@
+package threescale
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-go-client/threescale/api"
+)
+
+func TestObserveUsageData(t *testing.T) {
+	inputs := []struct {
+		name   string
+		resp   *authorizer.BackendResponse
+		expect int
+	}{
+		{
+			name:   "Test authorized response without usage data is reported",
+			resp:   &authorizer.BackendResponse{Authorized: true},
+			expect: 1,
+		},
+		{
+			name: "Test authorized response with usage data is not reported",
+			resp: &authorizer.BackendResponse{
+				Authorized:   true,
+				UsageReports: api.UsageReports{"hits": {{MaxValue: 10, CurrentValue: 1}}},
+			},
+		},
+		{
+			name: "Test denied response is not reported",
+			resp: &authorizer.BackendResponse{ErrorCode: "user_key_invalid"},
+		},
+		{
+			name: "Test missing response is not reported",
+		},
+	}
+
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			var reported int
+			c := &Threescale{
+				conf: &AdapterConfig{
+					Metrics: &MetricsReporter{
+						MissingUsageDataCB: func(serviceID string) {
+							reported++
+						},
+					},
+				},
+			}
+
+			c.observeUsageData(context.TODO(), "123", input.resp)
+			if reported != input.expect {
+				t.Errorf("expected %d reports of missing usage data, got %d", input.expect, reported)
+			}
+		})
+	}
+}
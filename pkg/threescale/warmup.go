@@ -0,0 +1,77 @@
+package threescale
+
+import (
+	"context"
+
+	"github.com/3scale/3scale-istio-adapter/config"
+	"istio.io/istio/pkg/log"
+)
+
+// WarmupTarget identifies a service whose configuration is fetched into the system cache before serving requests
+type WarmupTarget struct {
+	SystemURL   string
+	ServiceID   string
+	AccessToken string
+}
+
+// Warmup fetches the configuration of each target into the system cache, with at most concurrency fetches in flight.
+// Warmup returns once every target has been fetched or ctx is done, with the service ids of the targets which failed
+// or were not fetched in time. A non-positive concurrency fetches targets one at a time
+func (s *Threescale) Warmup(ctx context.Context, targets []WarmupTarget, concurrency int) []string {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	type warmupResult struct {
+		index int
+		err   error
+	}
+
+	// buffered so that fetches still in flight once ctx is done never block
+	results := make(chan warmupResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+
+	var started int
+start:
+	for i, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break start
+		}
+
+		started++
+		go func(i int, target WarmupTarget) {
+			defer func() { <-sem }()
+			_, err := s.getSystemConfiguration(&config.Params{
+				SystemUrl:   target.SystemURL,
+				ServiceId:   target.ServiceID,
+				AccessToken: target.AccessToken,
+			})
+			results <- warmupResult{index: i, err: err}
+		}(i, target)
+	}
+
+	warmed := make([]bool, len(targets))
+collect:
+	for received := 0; received < started; received++ {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				log.Warnf("failed to warm config for service %s - %v", targets[result.index].ServiceID, result.err)
+				continue
+			}
+			warmed[result.index] = true
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	var failed []string
+	for i, target := range targets {
+		if !warmed[i] {
+			failed = append(failed, target.ServiceID)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,71 @@
+package threescale
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3scale/3scale-authorizer/pkg/authorizer"
+	"github.com/3scale/3scale-porta-go-client/client"
+)
+
+// warmupAuthorizer fails to fetch the service "broken", blocks fetching "slow" until released, and records the
+// maximum number of fetches in flight
+type warmupAuthorizer struct {
+	mockAuthorizer
+	release     chan struct{}
+	inflight    int64
+	maxInflight int64
+}
+
+func (m *warmupAuthorizer) GetSystemConfiguration(systemURL string, request authorizer.SystemRequest) (client.ProxyConfig, error) {
+	n := atomic.AddInt64(&m.inflight, 1)
+	defer atomic.AddInt64(&m.inflight, -1)
+	for {
+		max := atomic.LoadInt64(&m.maxInflight)
+		if n <= max || atomic.CompareAndSwapInt64(&m.maxInflight, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	switch request.ServiceID {
+	case "broken":
+		return client.ProxyConfig{}, errors.New("unavailable")
+	case "slow":
+		<-m.release
+	}
+	return client.ProxyConfig{}, nil
+}
+
+func TestWarmup(t *testing.T) {
+	mock := &warmupAuthorizer{release: make(chan struct{})}
+	defer close(mock.release)
+
+	c := &Threescale{conf: &AdapterConfig{Authorizer: mock}}
+
+	var targets []WarmupTarget
+	for _, id := range []string{"1", "2", "broken", "3", "4"} {
+		targets = append(targets, WarmupTarget{SystemURL: "https://www.fake-system.3scale.net", ServiceID: id})
+	}
+
+	failed := c.Warmup(context.Background(), targets, 2)
+	if len(failed) != 1 || failed[0] != "broken" {
+		t.Errorf("expected only the broken service to fail to warm, got %v", failed)
+	}
+
+	if max := atomic.LoadInt64(&mock.maxInflight); max != 2 {
+		t.Errorf("expected at most 2 fetches in flight, got %d", max)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	targets = append([]WarmupTarget{{ServiceID: "slow"}}, targets...)
+	failed = c.Warmup(ctx, targets, 1)
+	if len(failed) != len(targets) {
+		t.Errorf("expected every service to be reported as not warmed once timed out, got %v", failed)
+	}
+}